@@ -25,7 +25,8 @@ func TestHookCommandIntegration(t *testing.T) {
 			shell: "bash",
 			wantContains: []string{
 				"_crumb_hook()",
-				"if [ -f .crumb.yaml ]",
+				"_crumb_has_config()",
+				"[ -f \"$dir/.crumb.yaml\" ]",
 				"export --shell bash",
 				"PROMPT_COMMAND",
 			},
@@ -36,7 +37,8 @@ func TestHookCommandIntegration(t *testing.T) {
 			shell: "zsh",
 			wantContains: []string{
 				"_crumb_hook()",
-				"if [ -f .crumb.yaml ]",
+				"_crumb_has_config()",
+				"[ -f \"$dir/.crumb.yaml\" ]",
 				"export --shell bash",
 				"precmd_functions",
 				"chpwd_functions",
@@ -48,7 +50,8 @@ func TestHookCommandIntegration(t *testing.T) {
 			shell: "fish",
 			wantContains: []string{
 				"function _crumb_hook",
-				"if test -f .crumb.yaml",
+				"function _crumb_has_config",
+				"if test -f \"$dir/.crumb.yaml\"",
 				"export --shell fish",
 				"--on-variable PWD",
 				"--on-event fish_prompt",
@@ -56,6 +59,17 @@ func TestHookCommandIntegration(t *testing.T) {
 			},
 			wantError: false,
 		},
+		{
+			name:  "tcsh hook output",
+			shell: "tcsh",
+			wantContains: []string{
+				"alias _crumb_hook",
+				"export --fingerprint 2>/dev/null",
+				"export --shell csh",
+				"alias precmd \"_crumb_hook; `alias precmd`\";",
+			},
+			wantError: false,
+		},
 		{
 			name:          "unsupported shell",
 			shell:         "powershell",
@@ -230,3 +244,98 @@ func TestFishHookNoTabCharacters(t *testing.T) {
 		t.Errorf("Fish hook should call _crumb_hook immediately after definition")
 	}
 }
+
+func TestHookCommandShellInference(t *testing.T) {
+	tests := []struct {
+		name          string
+		envShell      string
+		args          []string
+		wantContains  string
+		errorContains string
+	}{
+		{
+			name:         "fish inferred from $SHELL",
+			envShell:     "/usr/bin/fish",
+			args:         []string{"hook"},
+			wantContains: "export --shell fish",
+		},
+		{
+			name:         "zsh inferred from $SHELL",
+			envShell:     "/bin/zsh",
+			args:         []string{"hook"},
+			wantContains: "precmd_functions",
+		},
+		{
+			name:         "explicit argument takes precedence",
+			envShell:     "/usr/bin/fish",
+			args:         []string{"hook", "bash"},
+			wantContains: "PROMPT_COMMAND",
+		},
+		{
+			name:         "shell flag takes precedence over $SHELL",
+			envShell:     "/usr/bin/fish",
+			args:         []string{"hook", "--shell", "zsh"},
+			wantContains: "precmd_functions",
+		},
+		{
+			name:          "unknown $SHELL lists supported shells",
+			envShell:      "/bin/ksh",
+			args:          []string{"hook"},
+			errorContains: "unsupported shell: ksh (supported: bash, zsh, fish, csh, tcsh, elvish)",
+		},
+		{
+			name:          "no $SHELL set",
+			envShell:      "",
+			args:          []string{"hook"},
+			errorContains: "could not determine shell",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Isolate from any crumb.toml shell preference
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("SHELL", tt.envShell)
+
+			var buf bytes.Buffer
+			oldStdout := os.Stdout
+			r, w, _ := os.Pipe()
+			os.Stdout = w
+
+			cmd := &cli.Command{
+				Name:   "hook",
+				Action: commands.HookCommand,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "shell",
+						Usage: "Shell format (bash, zsh or fish)",
+					},
+				},
+			}
+
+			err := cmd.Run(context.Background(), tt.args)
+
+			w.Close()
+			os.Stdout = oldStdout
+			buf.ReadFrom(r)
+			output := buf.String()
+
+			if tt.errorContains != "" {
+				if err == nil {
+					t.Fatalf("expected error containing %q, got none", tt.errorContains)
+				}
+				if !strings.Contains(err.Error(), tt.errorContains) {
+					t.Errorf("expected error to contain %q, got: %v", tt.errorContains, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(output, tt.wantContains) {
+				t.Errorf("output missing %q\nGot output:\n%s", tt.wantContains, output)
+			}
+		})
+	}
+}
@@ -281,9 +281,9 @@ func TestGetCommandIntegration(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name:    "invalid key path - contains equals",
+			name:    "valid key path - contains equals",
 			keyPath: "/prod/billing=svc/vars/mg",
-			wantErr: true,
+			wantErr: false,
 		},
 	}
 
@@ -496,12 +496,12 @@ URL_WITH_EQUALS=https://api.example.com?token=abc123&refresh=def456`
 			"/dev/test",
 			"/prod/api",
 			"/staging/db",
+			"/dev=test",
 		}
 
 		invalidPaths := []string{
 			"dev/test",  // no leading slash
 			"/dev test", // contains space
-			"/dev=test", // contains equals
 			"",          // empty
 		}
 
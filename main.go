@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/urfave/cli/v3"
 
 	"crumb/pkg/commands"
 	"crumb/pkg/config"
+	"crumb/pkg/crypto"
 )
 
 // Version information (injected by GoReleaser)
@@ -22,7 +24,16 @@ func main() {
 	cli.VersionPrinter = func(cmd *cli.Command) {
 		fmt.Printf("version=%s commit=%s date=%s\n", cmd.Root().Version, commit, date)
 	}
-	cmd := &cli.Command{
+
+	if err := newApp().Run(context.Background(), os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newApp builds the crumb command tree
+func newApp() *cli.Command {
+	return &cli.Command{
 		Name:    "crumb",
 		Usage:   "Securely store, manage, and export API keys and secrets",
 		Version: version,
@@ -31,9 +42,35 @@ func main() {
 				Name:    "profile",
 				Usage:   "Profile to use for configuration",
 				Value:   "default",
-				Sources: cli.EnvVars("CRUMB_PROFILE"),
+				Sources: cli.NewValueSourceChain(cli.EnvVar("CRUMB_PROFILE"), config.NewTomlValueSource("profile")),
+			},
+			&cli.DurationFlag{
+				Name:    "timeout",
+				Usage:   "Abort interactive prompts (e.g. key passphrases) after this long (e.g. 30s; 0 waits forever)",
+				Sources: cli.EnvVars("CRUMB_PROMPT_TIMEOUT"),
+			},
+			&cli.IntFlag{
+				Name:    "retry",
+				Usage:   "Retry reading the private key and storage this many times on transient I/O errors (e.g. on NFS or SSHFS)",
+				Sources: cli.EnvVars("CRUMB_RETRY"),
+			},
+			&cli.DurationFlag{
+				Name:    "retry-delay",
+				Usage:   "Wait this long between --retry attempts",
+				Value:   500 * time.Millisecond,
+				Sources: cli.EnvVars("CRUMB_RETRY_DELAY"),
+			},
+			&cli.DurationFlag{
+				Name:    "lock-timeout",
+				Usage:   "Give up if another crumb process holds the storage file's lock for longer than this (e.g. 5s; 0 waits forever)",
+				Sources: cli.NewValueSourceChain(cli.EnvVar("CRUMB_LOCK_TIMEOUT"), config.NewTomlValueSource("lock-timeout")),
 			},
 		},
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			config.SetPromptTimeout(cmd.Duration("timeout"))
+			crypto.PassphrasePrompt = config.PromptForPassphrase
+			return ctx, nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:   "setup",
@@ -57,6 +94,18 @@ func main() {
 						Name:  "s3-endpoint-url",
 						Usage: "Custom S3 endpoint URL (for MinIO, LocalStack, etc.)",
 					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Replace an existing storage file with an empty one",
+					},
+					&cli.StringFlag{
+						Name:  "file-mode",
+						Usage: "Octal permissions for the storage file (default 0600; must not be world-writable)",
+					},
+					&cli.StringFlag{
+						Name:  "dir-mode",
+						Usage: "Octal permissions for directories created for the storage (default 0700)",
+					},
 				},
 			},
 			{
@@ -71,6 +120,61 @@ func main() {
 						Aliases: []string{"l"},
 						Usage:   "Show metadata columns (updated, expires)",
 					},
+					&cli.StringFlag{
+						Name:  "modified-since",
+						Usage: "Only show secrets updated within a duration (e.g. 24h, 7d) or since an RFC3339 timestamp",
+					},
+					&cli.BoolFlag{
+						Name:  "include-undated",
+						Usage: "With --modified-since, also show secrets that have no update timestamp",
+					},
+					&cli.BoolFlag{
+						Name:  "empty-only",
+						Usage: "Only show secrets whose value is empty or whitespace",
+					},
+					&cli.StringFlag{
+						Name:  "grep",
+						Usage: "Only show keys whose path contains this text",
+					},
+					&cli.BoolFlag{
+						Name:  "regex",
+						Usage: "Treat --grep as a regular expression",
+					},
+					&cli.StringFlag{
+						Name:  "sort",
+						Usage: "Sort by full path or by the last path segment (path or leaf)",
+						Value: "path",
+					},
+					&cli.BoolFlag{
+						Name:    "reverse",
+						Aliases: []string{"r"},
+						Usage:   "Sort in descending order",
+					},
+					&cli.BoolFlag{
+						Name:  "paths-only",
+						Usage: "Only show key paths (the default; cannot be combined with --with-values or --long)",
+					},
+					&cli.BoolFlag{
+						Name:  "with-values",
+						Usage: "Also show values, masked unless --show is given",
+					},
+					&cli.BoolFlag{
+						Name:  "show",
+						Usage: "With --with-values, show values in plain text",
+					},
+					&cli.StringFlag{
+						Name:  "redact-pattern",
+						Usage: "With --show, keep masking values that match this regular expression",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Allow --show when stdout is not a terminal",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Output format (text or json)",
+						Value: "text",
+					},
 				},
 			},
 			{
@@ -83,26 +187,96 @@ func main() {
 						Name:  "expires",
 						Usage: "Expiry date (e.g., 2026-12-31, 31.12.2026, 31/12/2026)",
 					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Read a JSON object and store each field as <key-path>/<field>",
+					},
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Usage:   "Read the --json input from a file instead of stdin",
+					},
+					&cli.BoolFlag{
+						Name:  "if-not-exists",
+						Usage: "Only create the key; leave it unchanged (and succeed) if it already exists",
+					},
+					&cli.BoolFlag{
+						Name:  "only-if-exists",
+						Usage: "Only update the key without prompting; do nothing (and succeed) if it doesn't exist",
+					},
+					&cli.BoolFlag{
+						Name:  "editor",
+						Usage: "Write the value in $EDITOR (kept exactly as saved, including newlines)",
+					},
+					&cli.StringFlag{
+						Name:  "append",
+						Usage: "Add this entry to the end of the key's delimited list, creating the key if needed",
+					},
+					&cli.StringFlag{
+						Name:  "separator",
+						Usage: "Separator between list entries for --append",
+						Value: ",",
+					},
+					&cli.BoolFlag{
+						Name:  "unique",
+						Usage: "With --append, leave the value unchanged if the entry is already in the list",
+					},
+					&cli.StringFlag{
+						Name:  "from-env",
+						Usage: "Store the value of this environment variable, so it never appears on the command line",
+					},
+					&cli.BoolFlag{
+						Name:  "allow-empty",
+						Usage: "With --from-env, store the variable even if it is empty",
+					},
+					&cli.BoolFlag{
+						Name:  "generate",
+						Usage: "Create the key with a random value, printed once, unless it already exists",
+					},
+					&cli.IntFlag{
+						Name:  "length",
+						Usage: "Length of the --generate value",
+						Value: 32,
+					},
+					&cli.StringFlag{
+						Name:  "charset",
+						Usage: "Characters for the --generate value (alnum, hex, base64url or symbols)",
+						Value: "alnum",
+					},
 				},
 			},
 			{
 				Name:      "get",
 				Usage:     "Retrieve a secret by its key path",
 				Action:    commands.GetCommand,
-				ArgsUsage: "<key-path>",
+				ArgsUsage: "<key-path> [key-path...]",
 				Flags: []cli.Flag{
 					&cli.BoolFlag{
 						Name:    "mask",
 						Usage:   "Mask the secret value with ****",
 						Sources: cli.NewValueSourceChain(config.NewTomlValueSource("mask")),
 					},
+					&cli.StringFlag{
+						Name:    "mask-char",
+						Usage:   "Character used to mask values (default *)",
+						Sources: cli.NewValueSourceChain(config.NewTomlValueSource("mask-char")),
+					},
+					&cli.StringFlag{
+						Name:    "mask-length",
+						Usage:   "Number of mask characters, or 'preserve' to match the value length (default 4)",
+						Sources: cli.NewValueSourceChain(config.NewTomlValueSource("mask-length")),
+					},
 					&cli.BoolFlag{
 						Name:  "export",
 						Usage: "Output in shell-compatible format for sourcing",
 					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Output format: shell (same as --export), dotenv (KEY=value) or json ({\"KEY\":\"value\"})",
+					},
 					&cli.StringFlag{
 						Name:    "shell",
-						Usage:   "Shell format for export (bash or fish)",
+						Usage:   "Shell format for export (bash, zsh, fish, csh, tcsh or elvish)",
 						Value:   "bash",
 						Sources: cli.NewValueSourceChain(config.NewTomlValueSource("shell")),
 					},
@@ -111,6 +285,46 @@ func main() {
 						Aliases: []string{"i"},
 						Usage:   "Pick a secret path interactively",
 					},
+					&cli.BoolFlag{
+						Name:  "all-under",
+						Usage: "Print every secret under the path as path=**** (also enabled by a trailing slash)",
+					},
+					&cli.BoolFlag{
+						Name:  "show",
+						Usage: "With --all-under, --history or several keys, reveal the values instead of masking them",
+					},
+					&cli.StringFlag{
+						Name:  "redact-pattern",
+						Usage: "With --show, keep masking values that match this regular expression",
+					},
+					&cli.BoolFlag{
+						Name:  "exists",
+						Usage: "Print nothing; exit 0 if every key exists and 1 otherwise",
+					},
+					&cli.BoolFlag{
+						Name:  "no-labels",
+						Usage: "With several keys, print only the values, one per line in argument order",
+					},
+					&cli.BoolFlag{
+						Name:  "base64",
+						Usage: "Print the value base64-encoded (standard encoding, with padding); combines with --export, --format and --fd",
+					},
+					&cli.StringFlag{
+						Name:  "default",
+						Usage: "Print this value instead of failing when the key doesn't exist",
+					},
+					&cli.BoolFlag{
+						Name:  "history",
+						Usage: "List the key's previous values, masked unless --show is given, with when each was set",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Allow --show when stdout is not a terminal",
+					},
+					&cli.IntFlag{
+						Name:  "fd",
+						Usage: "Write the raw value to this inherited file descriptor (3 or higher) instead of stdout, keeping it out of argv and the environment",
+					},
 				},
 			},
 			{
@@ -118,6 +332,27 @@ func main() {
 				Usage:  "Create a YAML configuration file in current directory",
 				Action: commands.InitCommand,
 			},
+			{
+				Name:   "describe-config",
+				Usage:  "Explain what each environment in .crumb.yaml exports (no decryption needed)",
+				Action: commands.DescribeConfigCommand,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Usage:   "Configuration file to describe (default: .crumb.yaml)",
+						Value:   ".crumb.yaml",
+					},
+					&cli.BoolFlag{
+						Name:  "no-parent-search",
+						Usage: "Only look for the configuration file in the current directory",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Output the description as JSON",
+					},
+				},
+			},
 			{
 				Name:      "info",
 				Usage:     "Show metadata for a secret (without revealing the value)",
@@ -142,6 +377,17 @@ func main() {
 				Usage:     "Delete a secret key-value pair",
 				Action:    commands.DeleteCommand,
 				ArgsUsage: "<key-path>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "stdin",
+						Usage: "Read newline-separated key paths to delete from stdin",
+					},
+					&cli.BoolFlag{
+						Name:    "yes",
+						Aliases: []string{"y"},
+						Usage:   "Delete without asking for confirmation",
+					},
+				},
 			},
 			{
 				Name:      "move",
@@ -152,7 +398,7 @@ func main() {
 			},
 			{
 				Name:      "import",
-				Usage:     "Import secrets from a .env file",
+				Usage:     "Import secrets from a .env file or a Vault KV JSON dump",
 				Action:    commands.ImportCommand,
 				ArgsUsage: "--file <path> --path <destination-path>",
 				Flags: []cli.Flag{
@@ -168,15 +414,71 @@ func main() {
 						Usage:    "Destination path where secrets will be stored (e.g., /dev/foo)",
 						Required: true,
 					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Show which keys would be created or updated without writing anything",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-strip",
+						Usage: "Remove this prefix from env var names before building key paths (e.g. MYAPP_)",
+					},
+					&cli.StringFlag{
+						Name:  "only",
+						Usage: "Only import variables matching these comma-separated names or globs (e.g. DB_HOST,AWS_*)",
+					},
+					&cli.StringFlag{
+						Name:  "exclude",
+						Usage: "Skip variables matching these comma-separated names or globs (e.g. PATH,HOME)",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Format of --file: env (a .env file) or vault (a Vault KV v1/v2 JSON dump)",
+						Value: "env",
+					},
+					&cli.BoolFlag{
+						Name:  "import-comments",
+						Usage: "Keep the comment lines above each variable as the secret's description",
+					},
 				},
 			},
 			{
 				Name:  "export",
 				Usage: "Export secrets as shell-compatible environment variables",
 				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Output format: shell (assignments for --shell), dotenv (KEY=value lines, e.g. for docker compose), laravel (KEY=value lines quoted for PHP dotenv), compose (a YAML environment: mapping for a service definition), vault (vault kv put commands) or null (NUL-terminated KEY=value records for env -0 / xargs -0)",
+						Value: "shell",
+					},
+					&cli.BoolFlag{
+						Name:  "dedupe-identical",
+						Usage: "Leave out variables the current environment already has with the same value",
+					},
+					&cli.BoolFlag{
+						Name:  "annotate-duplicates",
+						Usage: "With a comma-separated --env, list on stderr the variables defined in more than one environment and which one won",
+					},
+					&cli.BoolFlag{
+						Name:  "escape-dollar",
+						Usage: "With --format dotenv, write $ as $$ so docker compose doesn't interpolate values",
+					},
+					&cli.IntFlag{
+						Name:  "indent",
+						Usage: "With --format compose, the number of spaces before each entry",
+						Value: 2,
+					},
+					&cli.StringFlag{
+						Name:  "mount",
+						Usage: "With --format vault, the KV secrets engine mount to write to",
+						Value: "secret",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Allow --format vault to write values when stdout is not a terminal or to --output, and print even when --only-changed finds no change",
+					},
 					&cli.StringFlag{
 						Name:    "shell",
-						Usage:   "Shell format (bash or fish)",
+						Usage:   "Shell format (bash, zsh, fish, csh, tcsh or elvish)",
 						Value:   "bash",
 						Sources: cli.NewValueSourceChain(config.NewTomlValueSource("shell")),
 					},
@@ -186,32 +488,335 @@ func main() {
 						Usage:   "Configuration file to use (default: .crumb.yaml)",
 						Value:   ".crumb.yaml",
 					},
+					&cli.BoolFlag{
+						Name:  "no-parent-search",
+						Usage: "Only look for the configuration file in the current directory",
+					},
 					&cli.StringFlag{
 						Name:  "path",
 						Usage: "Export all secrets from a specific path (bypasses .crumb.yaml)",
 					},
+					&cli.IntFlag{
+						Name:  "name-segments",
+						Usage: "Number of trailing path segments used to build variable names with --path",
+						Value: 1,
+					},
 					&cli.StringFlag{
 						Name:  "env",
-						Usage: "Environment to export from .crumb.yaml (default: default)",
+						Usage: "Environment to export from .crumb.yaml; a comma list (e.g. shared,api) merges them, later ones win",
 						Value: "default",
 					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Write the export to a file (mode 0600) instead of stdout",
+					},
+					&cli.BoolFlag{
+						Name:  "watch",
+						Usage: "Keep running and rewrite --output whenever the storage file changes",
+					},
+					&cli.BoolFlag{
+						Name:  "fingerprint",
+						Usage: "Print a hash of the files the export reads (configs, env files, storage) instead of the export, so shell hooks can tell when to reload",
+					},
+					&cli.BoolFlag{
+						Name:  "only-changed",
+						Usage: "Print nothing if the export is identical to the last one printed in this directory by the same shell",
+					},
+					&cli.BoolFlag{
+						Name:  "merge",
+						Usage: "Only rewrite crumb's marked block in an existing --output file, keeping every other line",
+					},
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "Resolve the export and report how many variables it produces and any problems, without printing values",
+					},
+					&cli.StringFlag{
+						Name:  "template",
+						Usage: "Render a Go text/template file with the variables (e.g. {{ .DB_PASSWORD }}) instead of shell assignments",
+					},
+					&cli.StringFlag{
+						Name:  "sort-by",
+						Usage: "Order variables by env var name or by the secret path they came from (name or path)",
+						Value: "name",
+					},
+					&cli.BoolFlag{
+						Name:  "mask",
+						Usage: "Replace each value with '*'s of the same length, to see what would be exported (not for sourcing)",
+					},
+					&cli.StringFlag{
+						Name:  "redact-pattern",
+						Usage: "Mask only the values that match this regular expression, e.g. for screen sharing (not for sourcing)",
+					},
+					&cli.BoolFlag{
+						Name:  "base64",
+						Usage: "Export every value base64-encoded, e.g. for the data of a Kubernetes Secret",
+					},
+					&cli.StringFlag{
+						Name:    "mask-char",
+						Usage:   "Character used to mask values (default *)",
+						Sources: cli.NewValueSourceChain(config.NewTomlValueSource("mask-char")),
+					},
+					&cli.StringFlag{
+						Name:    "mask-length",
+						Usage:   "Number of mask characters, or 'preserve' to match the value length (default preserve)",
+						Sources: cli.NewValueSourceChain(config.NewTomlValueSource("mask-length")),
+					},
+					&cli.StringSliceFlag{
+						Name:  "prefix-map",
+						Usage: "Prefix names derived from secrets under a path, e.g. /billing=BILLING_ (repeatable, the longest matching path wins)",
+					},
+					&cli.StringFlag{
+						Name:  "strip-prefix",
+						Usage: "Remove this prefix from names derived from secret paths, e.g. MYAPP_ turns MYAPP_DB_HOST into DB_HOST (applied before --prefix-map and remaps)",
+					},
+					&cli.BoolFlag{
+						Name:  "quote-all",
+						Usage: "Double-quote every value for bash, zsh and fish, even when quoting isn't needed",
+					},
+					&cli.BoolFlag{
+						Name:  "allow-multiline",
+						Usage: "Export values with line breaks even for csh and tcsh, whose eval can't carry them intact",
+					},
+					&cli.BoolFlag{
+						Name:  "comment-source",
+						Usage: "Print a '# from <secret-path>' comment before each variable",
+					},
+					&cli.BoolFlag{
+						Name:  "no-comments",
+						Usage: "Leave out all comment lines",
+					},
+					&cli.StringFlag{
+						Name:  "name-filter",
+						Usage: "Only export variables whose final (remapped) name matches this regular expression",
+					},
+					&cli.StringFlag{
+						Name:  "exclude-filter",
+						Usage: "Leave out variables whose final (remapped) name matches this regular expression",
+					},
+					&cli.StringFlag{
+						Name:  "merge-file",
+						Usage: "Seed the export with variables from an existing .env file; crumb's values win",
+					},
+					&cli.BoolFlag{
+						Name:    "env-from-branch",
+						Usage:   "Pick the environment from the branch_map in .crumb.yaml for the current git branch, falling back to --env",
+						Sources: cli.EnvVars("CRUMB_ENV_FROM_BRANCH"),
+					},
+					&cli.BoolFlag{
+						Name:  "strict-remap",
+						Usage: "Fail when a remap in .crumb.yaml refers to a variable that wasn't exported or replaces one with a different value",
+					},
+					&cli.BoolFlag{
+						Name:  "strict-env",
+						Usage: "Fail when an env entry in .crumb.yaml refers to an unset environment variable such as ${HOME}",
+					},
+					&cli.IntFlag{
+						Name:  "max-value-length",
+						Usage: "Fail if any value is longer than this many bytes (default: only warn above 128 KiB)",
+					},
 				},
 				Action: commands.ExportCommand,
 			},
+			{
+				Name:   "diff",
+				Usage:  "Compare a .env file with the variables crumb would export",
+				Action: commands.DiffCommand,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Usage:    ".env file to compare",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "config",
+						Usage: "Configuration file to resolve the export from (default: .crumb.yaml)",
+						Value: ".crumb.yaml",
+					},
+					&cli.BoolFlag{
+						Name:  "no-parent-search",
+						Usage: "Only look for the configuration file in the current directory",
+					},
+					&cli.StringFlag{
+						Name:  "path",
+						Usage: "Compare against all secrets from a specific path (bypasses .crumb.yaml)",
+					},
+					&cli.IntFlag{
+						Name:  "name-segments",
+						Usage: "Number of trailing path segments used to build variable names with --path",
+						Value: 1,
+					},
+					&cli.StringFlag{
+						Name:  "env",
+						Usage: "Environment from .crumb.yaml to compare against; a comma list merges them, later ones win",
+						Value: "default",
+					},
+					&cli.StringSliceFlag{
+						Name:  "prefix-map",
+						Usage: "Prefix names derived from secrets under a path, e.g. /billing=BILLING_ (repeatable)",
+					},
+					&cli.StringFlag{
+						Name:  "strip-prefix",
+						Usage: "Remove this prefix from names derived from secret paths",
+					},
+					&cli.BoolFlag{
+						Name:  "show",
+						Usage: "Print the values of the variables that differ",
+					},
+				},
+			},
+			{
+				Name:      "shell",
+				Usage:     "Start $SHELL with the exported secrets in its environment",
+				ArgsUsage: "[-- shell-args...]",
+				Action:    commands.ShellCommand,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Usage:   "Configuration file to use (default: .crumb.yaml)",
+						Value:   ".crumb.yaml",
+					},
+					&cli.BoolFlag{
+						Name:  "no-parent-search",
+						Usage: "Only look for the configuration file in the current directory",
+					},
+					&cli.StringFlag{
+						Name:  "path",
+						Usage: "Load all secrets from a specific path (bypasses .crumb.yaml)",
+					},
+					&cli.IntFlag{
+						Name:  "name-segments",
+						Usage: "Number of trailing path segments used to build variable names with --path",
+						Value: 1,
+					},
+					&cli.StringFlag{
+						Name:  "env",
+						Usage: "Environment from .crumb.yaml to load; a comma list merges them, later ones win",
+						Value: "default",
+					},
+					&cli.StringSliceFlag{
+						Name:  "prefix-map",
+						Usage: "Prefix names derived from secrets under a path, e.g. /billing=BILLING_ (repeatable)",
+					},
+					&cli.StringFlag{
+						Name:  "strip-prefix",
+						Usage: "Remove this prefix from names derived from secret paths",
+					},
+				},
+			},
 			{
 				Name:      "hook",
 				Usage:     "Output shell hook script for automatic secret loading",
-				ArgsUsage: "<shell>",
+				ArgsUsage: "[shell]",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:    "shell",
-						Usage:   "Shell format (bash, zsh or fish)",
-						Value:   "bash",
+						Usage:   "Shell format (bash, zsh, fish, csh, tcsh or elvish; default: inferred from $SHELL)",
 						Sources: cli.NewValueSourceChain(config.NewTomlValueSource("shell")),
 					},
 				},
 				Action: commands.HookCommand,
 			},
+			{
+				Name:   "doctor",
+				Usage:  "Check the profile's config, keys and storage file for problems",
+				Action: commands.DoctorCommand,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "fix",
+						Usage: "Fix the problems that are safe to fix, such as missing directories or a storage file readable by others",
+					},
+				},
+			},
+			{
+				Name:   "version",
+				Usage:  "Print the version, optionally checking for a newer release",
+				Action: commands.VersionCommand,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "Compare against the latest GitHub release (cached for a day) and report whether an update is available",
+					},
+					&cli.BoolFlag{
+						Name:    "no-network",
+						Usage:   "Never contact the network, so --check is skipped",
+						Sources: cli.EnvVars("CRUMB_NO_NETWORK"),
+					},
+				},
+			},
+			{
+				Name:  "recipients",
+				Usage: "Inspect who can decrypt the storage file",
+				Commands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List recipients from the storage file header (no decryption needed)",
+						Action: commands.RecipientsListCommand,
+					},
+				},
+			},
+			{
+				Name:   "keys",
+				Usage:  "Show the fingerprints of the public keys the profile encrypts to",
+				Action: commands.KeysCommand,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "Output as JSON",
+					},
+				},
+			},
+			{
+				Name:  "sync",
+				Usage: "Share the encrypted storage file through git",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "remote",
+						Usage: "Git remote to sync with (default: profile sync.remote, then origin)",
+					},
+					&cli.StringFlag{
+						Name:  "branch",
+						Usage: "Git branch to sync with (default: profile sync.branch, then the current branch)",
+					},
+				},
+				Commands: []*cli.Command{
+					{
+						Name:   "push",
+						Usage:  "Commit the storage file if it changed and push it",
+						Action: commands.SyncPushCommand,
+					},
+					{
+						Name:   "pull",
+						Usage:  "Fast-forward the storage file to the remote version",
+						Action: commands.SyncPullCommand,
+					},
+				},
+			},
+			{
+				Name:  "rotate",
+				Usage: "Track rotation intervals for secrets",
+				Commands: []*cli.Command{
+					{
+						Name:      "set",
+						Usage:     "Set how often a secret should be rotated (e.g. 90d)",
+						ArgsUsage: "<key-path> <interval>",
+						Action:    commands.RotateSetCommand,
+					},
+					{
+						Name:      "clear",
+						Usage:     "Remove the rotation interval from a secret",
+						ArgsUsage: "<key-path>",
+						Action:    commands.RotateClearCommand,
+					},
+					{
+						Name:   "due",
+						Usage:  "List secrets that are due for rotation",
+						Action: commands.RotateDueCommand,
+					},
+				},
+			},
 			{
 				Name:  "storage",
 				Usage: "Manage storage file configuration",
@@ -221,12 +826,46 @@ func main() {
 						Usage:     "Set storage file path for current profile",
 						ArgsUsage: "<path>",
 						Action:    commands.StorageSetCommand,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "init",
+								Usage: "Create an empty encrypted storage file at the path if none exists",
+							},
+						},
+					},
+					{
+						Name:      "move",
+						Usage:     "Move the storage file to a new path and update the current profile",
+						ArgsUsage: "<new-path>",
+						Action:    commands.StorageMoveCommand,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "yes",
+								Aliases: []string{"y"},
+								Usage:   "Remove the old storage file without asking",
+							},
+							&cli.BoolFlag{
+								Name:  "keep-old",
+								Usage: "Keep the old storage file without asking",
+							},
+						},
 					},
 					{
 						Name:   "get",
 						Usage:  "Show current storage file path for current profile",
 						Action: commands.StorageGetCommand,
 					},
+					{
+						Name:   "info",
+						Usage:  "Show the storage file's size, modification time, permissions and secret count",
+						Action: commands.StorageInfoCommand,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "json",
+								Usage: "Output as JSON",
+							},
+						},
+					},
 					{
 						Name:   "clear",
 						Usage:  "Clear storage file path for current profile (use default)",
@@ -244,11 +883,13 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:      "__complete-keys",
+				Usage:     "Print key path completions for shell completion scripts",
+				Hidden:    true,
+				Action:    commands.CompleteKeysCommand,
+				ArgsUsage: "[prefix]",
+			},
 		},
 	}
-
-	if err := cmd.Run(context.Background(), os.Args); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
 }
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"golang.org/x/crypto/ssh"
+
+	"crumb/pkg/backend"
 	"crumb/pkg/config"
 	"crumb/pkg/storage"
 )
@@ -90,9 +99,8 @@ func TestValidateKeyPath(t *testing.T) {
 		},
 		{
 			name:    "path with equals",
-			keyPath: "/prod/billing=svc/vars/mg",
-			wantErr: true,
-			errMsg:  "key path cannot contain '='",
+			keyPath: "/prod/billing/ids/dXNlcg==",
+			wantErr: false,
 		},
 		{
 			name:    "path with newline",
@@ -206,6 +214,21 @@ func TestGetFilteredKeys(t *testing.T) {
 	}
 }
 
+// Test that filtered keys are never nil, so they marshal to [] rather than null
+func TestGetFilteredKeysNonNil(t *testing.T) {
+	for _, pathFilter := range []string{"", "/prod"} {
+		result := storage.GetFilteredKeys(storage.SecretStore{}, pathFilter)
+		if result == nil || len(result) != 0 {
+			t.Errorf("GetFilteredKeys(empty, %q) = %#v, want non-nil empty slice", pathFilter, result)
+		}
+	}
+
+	result := storage.GetFilteredKeys(storage.SecretStore{"/dev/key": {Value: "x"}}, "/prod")
+	if result == nil || len(result) != 0 {
+		t.Errorf("GetFilteredKeys() with no matches = %#v, want non-nil empty slice", result)
+	}
+}
+
 // Test YAML configuration parsing
 func TestLoadCrumbConfig(t *testing.T) {
 	tempDir := createTempDir(t)
@@ -262,6 +285,30 @@ env: {}`,
 			wantErr:     true,
 			errContains: "missing version",
 		},
+		{
+			name:       "short version",
+			configFile: "short-version.yaml",
+			content: `version: 1
+environments:
+  default:
+    path: "/prod/billing-svc"`,
+			wantErr: false,
+			validate: func(t *testing.T, cfg *config.CrumbConfig) {
+				if cfg.Version != "1" {
+					t.Errorf("Expected version '1', got '%s'", cfg.Version)
+				}
+			},
+		},
+		{
+			name:       "unsupported version",
+			configFile: "future-version.yaml",
+			content: `version: "2.0"
+environments:
+  default:
+    path: "/prod/billing-svc"`,
+			wantErr:     true,
+			errContains: `unsupported .crumb.yaml version "2.0"`,
+		},
 		{
 			name:        "invalid yaml",
 			configFile:  "invalid.yaml",
@@ -309,6 +356,69 @@ env: {}`,
 	}
 }
 
+// Test searching parent directories for .crumb.yaml
+func TestFindCrumbConfig(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	projectDir := filepath.Join(tempDir, "project")
+	nestedDir := filepath.Join(projectDir, "services", "api")
+	if err := os.MkdirAll(nestedDir, 0700); err != nil {
+		t.Fatalf("Failed to create nested dir: %v", err)
+	}
+
+	configPath := filepath.Join(projectDir, ".crumb.yaml")
+	if err := os.WriteFile(configPath, []byte(`version: "1.0"`), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	t.Run("config two levels up", func(t *testing.T) {
+		found, err := config.FindCrumbConfig(nestedDir, ".crumb.yaml")
+		if err != nil {
+			t.Fatalf("FindCrumbConfig() unexpected error = %v", err)
+		}
+		if found != configPath {
+			t.Errorf("FindCrumbConfig() = %q, want %q", found, configPath)
+		}
+	})
+
+	t.Run("config in start directory", func(t *testing.T) {
+		found, err := config.FindCrumbConfig(projectDir, ".crumb.yaml")
+		if err != nil {
+			t.Fatalf("FindCrumbConfig() unexpected error = %v", err)
+		}
+		if found != configPath {
+			t.Errorf("FindCrumbConfig() = %q, want %q", found, configPath)
+		}
+	})
+
+	t.Run("nearest config wins", func(t *testing.T) {
+		nearerPath := filepath.Join(nestedDir, ".crumb.yaml")
+		if err := os.WriteFile(nearerPath, []byte(`version: "1.0"`), 0600); err != nil {
+			t.Fatalf("Failed to write nested config: %v", err)
+		}
+		defer os.Remove(nearerPath)
+
+		found, err := config.FindCrumbConfig(nestedDir, ".crumb.yaml")
+		if err != nil {
+			t.Fatalf("FindCrumbConfig() unexpected error = %v", err)
+		}
+		if found != nearerPath {
+			t.Errorf("FindCrumbConfig() = %q, want %q", found, nearerPath)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := config.FindCrumbConfig(nestedDir, "missing-config.yaml")
+		if err == nil {
+			t.Fatal("FindCrumbConfig() expected error but got none")
+		}
+		if !strings.Contains(err.Error(), "no missing-config.yaml found") {
+			t.Errorf("FindCrumbConfig() error = %v, want 'no missing-config.yaml found'", err)
+		}
+	})
+}
+
 // Test shell output formatting
 func TestShellOutputFormatting(t *testing.T) {
 	tests := []struct {
@@ -807,3 +917,116 @@ environments:
 		}
 	})
 }
+
+// addProfileWithSecret creates a profile with a real key pair whose store
+// holds a single secret.
+func addProfileWithSecret(t *testing.T, cfg *config.Config, home, name, key, value string) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to convert public key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "crumb-test")
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+	pubPath := filepath.Join(home, "id_"+name+".pub")
+	privPath := filepath.Join(home, "id_"+name)
+	if err := os.WriteFile(pubPath, ssh.MarshalAuthorizedKey(sshPub), 0600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write private key: %v", err)
+	}
+
+	storagePath := filepath.Join(home, "secrets-"+name)
+	cfg.Profiles[name] = config.ProfileConfig{
+		PublicKeyPath:  pubPath,
+		PrivateKeyPath: privPath,
+		Storage:        config.StorageConfig{Local: &config.LocalStorageConfig{Path: storagePath}},
+	}
+
+	secrets := make(storage.SecretStore)
+	storage.SetSecret(secrets, key, value, time.Now())
+	if err := storage.SaveSecrets(secrets, pubPath, &backend.FileBackend{Path: storagePath}); err != nil {
+		t.Fatalf("Failed to save secrets: %v", err)
+	}
+}
+
+// runApp runs the crumb CLI with args and returns what it wrote to stdout.
+func runApp(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	os.Stdout = w
+	runErr := newApp().Run(context.Background(), append([]string{"crumb"}, args...))
+	w.Close()
+	os.Stdout = stdout
+
+	output, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	return string(output), runErr
+}
+
+// Test that export reads from the profile given on the export command itself,
+// ahead of CRUMB_PROFILE and the profile setting in crumb.toml
+func TestExportProfileOverride(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	// Restored after the test by t.Setenv
+	t.Setenv("CRUMB_PROFILE", "")
+	os.Unsetenv("CRUMB_PROFILE")
+
+	cfg := &config.Config{Profiles: map[string]config.ProfileConfig{}}
+	addProfileWithSecret(t, cfg, home, "default", "/app/key", "default-value")
+	addProfileWithSecret(t, cfg, home, "prod", "/app/key", "prod-value")
+	if err := config.SaveConfig(cfg); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	export := func(t *testing.T, args ...string) string {
+		t.Helper()
+		output, err := runApp(t, append(args, "--path", "/app/key", "--no-comments")...)
+		if err != nil {
+			t.Fatalf("crumb %v unexpected error = %v", args, err)
+		}
+		return output
+	}
+
+	if got := export(t, "export"); got != "export KEY=default-value\n" {
+		t.Errorf("default profile export = %q", got)
+	}
+	if got := export(t, "export", "--profile", "prod"); got != "export KEY=prod-value\n" {
+		t.Errorf("export --profile prod = %q", got)
+	}
+
+	tomlPath := filepath.Join(home, ".config", "crumb", "crumb.toml")
+	if err := os.WriteFile(tomlPath, []byte(`profile = "prod"`), 0600); err != nil {
+		t.Fatalf("Failed to write crumb.toml: %v", err)
+	}
+	if got := export(t, "export"); got != "export KEY=prod-value\n" {
+		t.Errorf("export with crumb.toml profile = %q", got)
+	}
+	if got := export(t, "export", "--profile", "default"); got != "export KEY=default-value\n" {
+		t.Errorf("export --profile default should override crumb.toml, got %q", got)
+	}
+
+	t.Setenv("CRUMB_PROFILE", "default")
+	if got := export(t, "export"); got != "export KEY=default-value\n" {
+		t.Errorf("CRUMB_PROFILE should override crumb.toml, got %q", got)
+	}
+	if got := export(t, "export", "--profile", "prod"); got != "export KEY=prod-value\n" {
+		t.Errorf("export --profile prod should override CRUMB_PROFILE, got %q", got)
+	}
+}
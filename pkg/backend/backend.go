@@ -5,4 +5,13 @@ type Backend interface {
 	Read() ([]byte, error)
 	Write(data []byte) error
 	Exists() (bool, error)
+	Location() string
+}
+
+// Updater is implemented by backends that can read their data and write it
+// back under a single lock, so concurrent read-modify-writes don't lose each
+// other's changes. Update writes what update returns; nil leaves the data as
+// it is.
+type Updater interface {
+	Update(update func(data []byte) ([]byte, error)) error
 }
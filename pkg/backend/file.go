@@ -2,6 +2,7 @@ package backend
 
 import (
 	"os"
+	"time"
 
 	"crumb/pkg/crypto"
 )
@@ -9,14 +10,27 @@ import (
 // FileBackend stores encrypted data on the local filesystem.
 type FileBackend struct {
 	Path string
+	// Mode is the permission a newly created file gets; 0 means 0600
+	Mode os.FileMode
+	// LockTimeout bounds how long Read and Write wait for another process's
+	// lock on the file; 0 waits forever
+	LockTimeout time.Duration
 }
 
 func (f *FileBackend) Read() ([]byte, error) {
-	return crypto.ReadFileWithLock(f.Path)
+	return crypto.ReadFileWithLock(f.Path, f.LockTimeout)
 }
 
 func (f *FileBackend) Write(data []byte) error {
-	return crypto.WriteFileWithLock(f.Path, data, 0600)
+	return crypto.WriteFileWithLock(f.Path, data, f.mode(), f.LockTimeout)
+}
+
+// mode returns the permission for a newly created file
+func (f *FileBackend) mode() os.FileMode {
+	if f.Mode == 0 {
+		return 0600
+	}
+	return f.Mode
 }
 
 func (f *FileBackend) Exists() (bool, error) {
@@ -29,3 +43,13 @@ func (f *FileBackend) Exists() (bool, error) {
 	}
 	return true, nil
 }
+
+// Update reads and rewrites the file under one exclusive lock on the file
+// itself, the same lock Read and Write take.
+func (f *FileBackend) Update(update func(data []byte) ([]byte, error)) error {
+	return crypto.UpdateFileWithLock(f.Path, f.mode(), f.LockTimeout, update)
+}
+
+func (f *FileBackend) Location() string {
+	return f.Path
+}
@@ -27,5 +27,10 @@ func ResolveBackend(profile *config.ProfileConfig) (Backend, error) {
 	}
 	path = config.ExpandTilde(path)
 
-	return &FileBackend{Path: path}, nil
+	mode, err := profile.StorageFileMode()
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileBackend{Path: path, Mode: mode}, nil
 }
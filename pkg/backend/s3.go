@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -97,3 +98,7 @@ func (b *S3Backend) Exists() (bool, error) {
 	}
 	return true, nil
 }
+
+func (b *S3Backend) Location() string {
+	return fmt.Sprintf("s3://%s/%s", b.Bucket, b.Key)
+}
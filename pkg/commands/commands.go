@@ -3,14 +3,24 @@ package commands
 import (
 	"bufio"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
+	"unicode/utf8"
 
 	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
 	"gopkg.in/yaml.v3"
 
 	"crumb/pkg/backend"
@@ -23,9 +33,18 @@ import (
 func SetupCommand(_ context.Context, cmd *cli.Command) error {
 	profile := getProfile(cmd)
 
+	fileMode, err := config.ParseFileMode("--file-mode", cmd.String("file-mode"), config.DefaultFileMode)
+	if err != nil {
+		return err
+	}
+	dirMode, err := config.ParseFileMode("--dir-mode", cmd.String("dir-mode"), config.DefaultDirMode)
+	if err != nil {
+		return err
+	}
+
 	// Create ~/.config/crumb directory if it doesn't exist
 	configDir := filepath.Clean(filepath.Join(os.Getenv("HOME"), ".config", "crumb"))
-	if err := os.MkdirAll(configDir, 0700); err != nil {
+	if err := mkdirWithMode(configDir, dirMode); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
@@ -69,6 +88,8 @@ func SetupCommand(_ context.Context, cmd *cli.Command) error {
 	var profileConfig config.ProfileConfig
 	profileConfig.PublicKeyPath = publicKeyPath
 	profileConfig.PrivateKeyPath = privateKeyPath
+	profileConfig.FileMode = cmd.String("file-mode")
+	profileConfig.DirMode = cmd.String("dir-mode")
 
 	var b backend.Backend
 
@@ -121,12 +142,12 @@ func SetupCommand(_ context.Context, cmd *cli.Command) error {
 
 		// Create storage directory if it doesn't exist
 		storageDir := filepath.Clean(filepath.Dir(storagePath))
-		if err := os.MkdirAll(storageDir, 0700); err != nil {
+		if err := mkdirWithMode(storageDir, dirMode); err != nil {
 			return fmt.Errorf("failed to create storage directory: %w", err)
 		}
 
 		profileConfig.Storage.Local = &config.LocalStorageConfig{Path: storagePath}
-		b = &backend.FileBackend{Path: storagePath}
+		b = &backend.FileBackend{Path: storagePath, Mode: fileMode}
 	}
 
 	// Load existing config or create new one
@@ -149,9 +170,13 @@ func SetupCommand(_ context.Context, cmd *cli.Command) error {
 		return err
 	}
 
-	// Create empty encrypted storage
-	if err := storage.CreateEmptyStorage(publicKeyPath, b); err != nil {
-		return fmt.Errorf("failed to create secrets storage: %w", err)
+	// Create empty encrypted storage, keeping an existing store unless --force is given
+	created, err := ensureStorage(publicKeyPath, b, cmd.Bool("force"))
+	if err != nil {
+		return err
+	}
+	if !created {
+		fmt.Printf("Keeping existing secrets in %s (use --force to replace them with an empty store)\n", b.Location())
 	}
 
 	fmt.Printf("Setup completed successfully for profile '%s'!\n", profile)
@@ -165,9 +190,71 @@ func SetupCommand(_ context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// mkdirWithMode creates dir and any missing parents. If dir itself is new it
+// gets exactly mode, regardless of the umask; an existing dir is left alone.
+func mkdirWithMode(dir string, mode os.FileMode) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	return os.Chmod(dir, mode)
+}
+
+// ensureStorage creates an empty encrypted store, unless the backend already
+// holds a non-empty one and force is false. It reports whether a store was created.
+func ensureStorage(publicKeyPath string, b backend.Backend, force bool) (bool, error) {
+	if !force {
+		exists, err := b.Exists()
+		if err != nil {
+			return false, fmt.Errorf("failed to check for existing storage: %w", err)
+		}
+		if exists {
+			data, err := b.Read()
+			if err != nil {
+				return false, fmt.Errorf("failed to read existing storage: %w", err)
+			}
+			if len(data) > 0 {
+				warnIfNotRecipient(data, publicKeyPath, b.Location())
+				return false, nil
+			}
+		}
+	}
+
+	if err := storage.CreateEmptyStorage(publicKeyPath, b); err != nil {
+		return false, fmt.Errorf("failed to create secrets storage: %w", err)
+	}
+	return true, nil
+}
+
+// warnIfNotRecipient warns when a kept store isn't encrypted to the newly
+// configured public key, since the profile then can't decrypt it.
+func warnIfNotRecipient(encryptedData []byte, publicKeyPath, location string) {
+	stanzas, err := crypto.ParseRecipientStanzas(encryptedData)
+	if err != nil {
+		return
+	}
+	tag, err := crypto.SSHRecipientTag(publicKeyPath)
+	if err != nil {
+		return
+	}
+	for _, stanza := range stanzas {
+		if stanza.Tag() == tag {
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Warning: existing storage %s is not encrypted to %s, so this profile won't be able to read it; re-run setup with the old key or pass --force\n", location, publicKeyPath)
+}
+
 // resolveBackend is a helper that loads config and resolves the backend for a command.
 func resolveBackend(cmd *cli.Command) (*config.ProfileConfig, backend.Backend, error) {
-	profile := getProfile(cmd)
+	return resolveProfileBackend(cmd, getProfile(cmd))
+}
+
+// resolveProfileBackend loads config and resolves the backend for a named
+// profile. A local storage file waits at most --lock-timeout for its lock.
+func resolveProfileBackend(cmd *cli.Command, profile string) (*config.ProfileConfig, backend.Backend, error) {
 	cfg, err := config.LoadConfig(profile)
 	if err != nil {
 		return nil, nil, err
@@ -178,35 +265,162 @@ func resolveBackend(cmd *cli.Command) (*config.ProfileConfig, backend.Backend, e
 		return nil, nil, err
 	}
 
+	lockTimeout := cmd.Duration("lock-timeout")
+	if lockTimeout < 0 {
+		return nil, nil, fmt.Errorf("--lock-timeout must not be negative")
+	}
+	if fileBackend, ok := b.(*backend.FileBackend); ok {
+		fileBackend.LockTimeout = lockTimeout
+	}
+
 	return cfg, b, nil
 }
 
+// storeClock is the clock of every store the commands resolve, and the time
+// they stamp on secrets. It's a variable so tests can freeze time.
+var storeClock storage.Clock = storage.DefaultClock
+
+// resolveStore is a helper that loads config and resolves the secret store for a command.
+func resolveStore(ctx context.Context, cmd *cli.Command) (storage.Store, error) {
+	return resolveProfileStore(ctx, cmd, getProfile(cmd))
+}
+
+// resolveProfileStore loads config and resolves the secret store for a named
+// profile, honoring the command's --retry and --retry-delay. Cancelling ctx
+// stops any retries.
+func resolveProfileStore(ctx context.Context, cmd *cli.Command, profile string) (storage.Store, error) {
+	cfg, b, err := resolveProfileBackend(cmd, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	retries := int(cmd.Int("retry"))
+	if retries < 0 {
+		return nil, fmt.Errorf("--retry must not be negative")
+	}
+	historyDepth, err := cfg.SecretHistoryDepth(storage.DefaultHistoryDepth)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewFileStore(cfg.PublicKeyPath, cfg.PrivateKeyPath, b, storage.WithRetry(retries, cmd.Duration("retry-delay")), storage.WithContext(ctx), storage.WithHistoryDepth(historyDepth), storage.WithClock(storeClock)), nil
+}
+
 // ListCommand handles the list command
-func ListCommand(_ context.Context, cmd *cli.Command) error {
+func ListCommand(ctx context.Context, cmd *cli.Command) error {
 	pathFilter := ""
 	if cmd.Args().Len() > 0 {
 		pathFilter = cmd.Args().Get(0)
 	}
 
-	cfg, b, err := resolveBackend(cmd)
+	sortBy := cmd.String("sort")
+	switch sortBy {
+	case "":
+		sortBy = "path"
+	case "path", "leaf":
+	default:
+		return fmt.Errorf("unsupported --sort value: %s (supported: path, leaf)", sortBy)
+	}
+
+	modifiedSince := cmd.String("modified-since")
+	if modifiedSince == "" && cmd.Bool("include-undated") {
+		return fmt.Errorf("--include-undated requires --modified-since")
+	}
+
+	format := cmd.String("format")
+	switch format {
+	case "":
+		format = "text"
+	case "text", "json":
+	default:
+		return fmt.Errorf("unsupported --format value: %s (supported: text, json)", format)
+	}
+
+	withValues := cmd.Bool("with-values")
+	if cmd.Bool("paths-only") {
+		if withValues {
+			return fmt.Errorf("--paths-only and --with-values cannot be used together")
+		}
+		if cmd.Bool("long") {
+			return fmt.Errorf("--paths-only and --long cannot be used together")
+		}
+	}
+	if cmd.Bool("show") {
+		if !withValues {
+			return fmt.Errorf("--show requires --with-values")
+		}
+		if !cmd.Bool("force") && !term.IsTerminal(int(os.Stdout.Fd())) {
+			return fmt.Errorf("refusing to reveal secret values because stdout is not a terminal, pass --force to override")
+		}
+	}
+
+	mask, err := maskStyleFromFlags(cmd, "4")
+	if err != nil {
+		return err
+	}
+	redact, err := redactPatternFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if redact != nil && !cmd.Bool("show") {
+		return fmt.Errorf("--redact-pattern requires --show")
+	}
+
+	grep, err := grepPatternFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	store, err := resolveStore(ctx, cmd)
 	if err != nil {
 		return err
 	}
 
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
+	var since time.Time
+	if modifiedSince != "" {
+		since, err = storage.ParseSince(modifiedSince, store.Clock().Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	secrets, err := store.Load()
 	if err != nil {
 		return err
 	}
 
 	if len(secrets) == 0 {
+		if format == "json" {
+			return printListJSON(nil, secrets, false, nil)
+		}
 		fmt.Println("No secrets found")
 		return nil
 	}
 
 	keys := storage.GetFilteredKeys(secrets, pathFilter)
+	if modifiedSince != "" {
+		keys = storage.FilterModifiedSince(secrets, keys, since, cmd.Bool("include-undated"))
+	}
+	if cmd.Bool("empty-only") {
+		keys = storage.FilterEmpty(secrets, keys)
+	}
+	if grep != nil {
+		keys = storage.FilterMatching(keys, grep)
+	}
+	// A trailing slash lists one level, like a directory
+	if strings.HasSuffix(pathFilter, "/") {
+		keys = storage.DirectChildren(keys, pathFilter)
+	}
 
 	if len(keys) == 0 {
-		if pathFilter != "" {
+		if format == "json" {
+			return printListJSON(nil, secrets, false, nil)
+		} else if cmd.Bool("empty-only") {
+			fmt.Println("No secrets with empty values found")
+		} else if grep != nil {
+			fmt.Printf("No secrets found matching: %s\n", cmd.String("grep"))
+		} else if modifiedSince != "" {
+			fmt.Printf("No secrets modified since %s\n", since.UTC().Format(time.RFC3339))
+		} else if pathFilter != "" {
 			fmt.Printf("No secrets found matching path: %s\n", pathFilter)
 		} else {
 			fmt.Println("No secrets found")
@@ -214,10 +428,33 @@ func ListCommand(_ context.Context, cmd *cli.Command) error {
 		return nil
 	}
 
+	storage.SortKeys(keys, sortBy, cmd.Bool("reverse"))
+
+	// Values are only looked at, and masked unless --show, with --with-values
+	displayValue := func(key string) string {
+		return displaySecret(secrets[key].Value, cmd.Bool("show"), redact, mask)
+	}
+
+	if format == "json" {
+		return printListJSON(keys, secrets, withValues, displayValue)
+	}
+
 	if cmd.Bool("long") {
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintf(w, "KEY\tUPDATED\tEXPIRES\n")
+		if withValues {
+			fmt.Fprintf(w, "KEY\tUPDATED\tEXPIRES\tVALUE\n")
+		} else {
+			fmt.Fprintf(w, "KEY\tUPDATED\tEXPIRES\n")
+		}
 		for _, key := range keys {
+			if strings.HasSuffix(key, "/") {
+				if withValues {
+					fmt.Fprintf(w, "%s\t-\t-\t-\n", key)
+				} else {
+					fmt.Fprintf(w, "%s\t-\t-\n", key)
+				}
+				continue
+			}
 			entry := secrets[key]
 			updated := entry.Updated
 			if updated == "" {
@@ -227,9 +464,25 @@ func ListCommand(_ context.Context, cmd *cli.Command) error {
 			if expires == "" {
 				expires = "(none)"
 			}
-			fmt.Fprintf(w, "%s\t%s\t%s\n", key, updated, expires)
+			if withValues {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key, updated, expires, displayValue(key))
+			} else {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", key, updated, expires)
+			}
 		}
 		w.Flush()
+	} else if withValues {
+		width := 0
+		for _, key := range keys {
+			width = max(width, len(key))
+		}
+		for _, key := range keys {
+			if strings.HasSuffix(key, "/") {
+				fmt.Println(key)
+				continue
+			}
+			fmt.Printf("%-*s = %s\n", width, key, displayValue(key))
+		}
 	} else {
 		for _, key := range keys {
 			fmt.Println(key)
@@ -239,8 +492,59 @@ func ListCommand(_ context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// jsonSchemaVersion is the "version" field of the JSON printed by list, get,
+// keys, storage info and describe-config. It only changes when existing
+// fields are removed or change meaning; new fields can be added without a
+// bump.
+const jsonSchemaVersion = 1
+
+// listJSON is the envelope of list --format json
+type listJSON struct {
+	Version int         `json:"version"`
+	Keys    []listEntry `json:"keys"`
+}
+
+// getJSON is the envelope of get --format json
+type getJSON struct {
+	Version int               `json:"version"`
+	Vars    map[string]string `json:"vars"`
+}
+
+// listEntry is one secret in list --format json. Value is only set with
+// --with-values, and groups from a trailing-slash listing have no metadata.
+type listEntry struct {
+	Key     string  `json:"key"`
+	Updated string  `json:"updated,omitempty"`
+	Expires string  `json:"expires,omitempty"`
+	Value   *string `json:"value,omitempty"`
+}
+
+// printListJSON writes the listed keys as a versioned JSON envelope
+func printListJSON(keys []string, secrets storage.SecretStore, withValues bool, displayValue func(string) string) error {
+	entries := make([]listEntry, 0, len(keys))
+	for _, key := range keys {
+		entry := listEntry{Key: key}
+		if !strings.HasSuffix(key, "/") {
+			entry.Updated = secrets[key].Updated
+			entry.Expires = secrets[key].Expires
+			if withValues {
+				value := displayValue(key)
+				entry.Value = &value
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	encoded, err := json.MarshalIndent(listJSON{Version: jsonSchemaVersion, Keys: entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	fmt.Println(string(encoded))
+	return nil
+}
+
 // SetCommand handles the set command
-func SetCommand(_ context.Context, cmd *cli.Command) error {
+func SetCommand(ctx context.Context, cmd *cli.Command) error {
 	if cmd.Args().Len() < 1 || cmd.Args().Len() > 2 {
 		return fmt.Errorf("usage: crumb set <key-path> [value]")
 	}
@@ -248,15 +552,96 @@ func SetCommand(_ context.Context, cmd *cli.Command) error {
 	keyPath := cmd.Args().Get(0)
 
 	if err := config.ValidateKeyPath(keyPath); err != nil {
+		// "crumb set secretvalue /path" is a common slip; the value is left out
+		// of the hint since it's likely a secret
+		if cmd.Args().Len() == 2 && config.ValidateKeyPath(cmd.Args().Get(1)) == nil {
+			return fmt.Errorf("the key path must come first, the arguments look swapped: use 'crumb set %s <value>'", cmd.Args().Get(1))
+		}
 		return err
 	}
 
-	cfg, b, err := resolveBackend(cmd)
+	ifNotExists := cmd.Bool("if-not-exists")
+	onlyIfExists := cmd.Bool("only-if-exists")
+	if ifNotExists && onlyIfExists {
+		return fmt.Errorf("--if-not-exists and --only-if-exists cannot be used together")
+	}
+
+	useEditor := cmd.Bool("editor")
+	if useEditor && cmd.Args().Len() == 2 {
+		return fmt.Errorf("--editor cannot be combined with a value argument")
+	}
+
+	// The value is read up front so a missing variable fails before the store
+	// is decrypted or anything is prompted for
+	fromEnv := cmd.String("from-env")
+	var envValue string
+	if fromEnv != "" {
+		if cmd.Args().Len() == 2 || useEditor || cmd.Bool("json") || cmd.IsSet("append") {
+			return fmt.Errorf("--from-env cannot be combined with a value argument, --editor, --json or --append")
+		}
+		var ok bool
+		envValue, ok = os.LookupEnv(fromEnv)
+		if !ok {
+			return fmt.Errorf("environment variable %s is not set", fromEnv)
+		}
+		if strings.TrimSpace(envValue) == "" && !cmd.Bool("allow-empty") {
+			return fmt.Errorf("environment variable %s is empty, pass --allow-empty to store it anyway", fromEnv)
+		}
+	} else if cmd.Bool("allow-empty") {
+		return fmt.Errorf("--allow-empty requires --from-env")
+	}
+
+	appending := cmd.IsSet("append")
+	if appending {
+		if cmd.Args().Len() == 2 || useEditor || cmd.Bool("json") {
+			return fmt.Errorf("--append takes the value to add and cannot be combined with a value argument, --editor or --json")
+		}
+		if strings.TrimSpace(cmd.String("append")) == "" {
+			return fmt.Errorf("--append value cannot be empty")
+		}
+		if cmd.String("separator") == "" {
+			return fmt.Errorf("--separator cannot be empty")
+		}
+	}
+
+	if cmd.IsSet("file") && !cmd.Bool("json") {
+		return fmt.Errorf("--file requires --json")
+	}
+
+	if cmd.Bool("generate") {
+		if cmd.Args().Len() == 2 || useEditor || fromEnv != "" || appending || cmd.Bool("json") || onlyIfExists {
+			return fmt.Errorf("--generate cannot be combined with a value argument, --editor, --from-env, --append, --json or --only-if-exists")
+		}
+		return setGenerated(ctx, cmd, keyPath)
+	}
+	if cmd.IsSet("length") || cmd.IsSet("charset") {
+		return fmt.Errorf("--length and --charset require --generate")
+	}
+
+	if cmd.Bool("json") {
+		if useEditor {
+			return fmt.Errorf("--editor cannot be used with --json")
+		}
+		if ifNotExists || onlyIfExists {
+			return fmt.Errorf("--if-not-exists and --only-if-exists cannot be used with --json")
+		}
+		if cmd.IsSet("expires") {
+			return fmt.Errorf("--expires cannot be used with --json")
+		}
+		if cmd.Args().Len() != 1 {
+			return fmt.Errorf("usage: crumb set --json <parent-path> [--file <path>]")
+		}
+		return setFromJSON(ctx, cmd, keyPath)
+	}
+
+	store, err := resolveStore(ctx, cmd)
 	if err != nil {
 		return err
 	}
 
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
+	// This copy only decides what to ask; the change itself is applied by
+	// Store.Update to the secrets as they are once the lock is held
+	secrets, err := store.Load()
 	if err != nil {
 		return err
 	}
@@ -272,20 +657,40 @@ func SetCommand(_ context.Context, cmd *cli.Command) error {
 
 	_, exists := storage.SecretExists(secrets, keyPath)
 
-	if expires != "" && cmd.Args().Len() == 1 && exists {
-		storage.SetSecretExpiry(secrets, keyPath, expires)
-		if err := storage.SaveSecrets(secrets, cfg.PublicKeyPath, b); err != nil {
+	if ifNotExists && exists {
+		fmt.Printf("Key '%s' already exists, leaving it unchanged.\n", keyPath)
+		return nil
+	}
+	if onlyIfExists && !exists {
+		fmt.Printf("Key '%s' does not exist, nothing to update.\n", keyPath)
+		return nil
+	}
+
+	if appending {
+		return appendToSecret(store, keyPath, cmd.String("append"), cmd.String("separator"), cmd.Bool("unique"), expires, onlyIfExists)
+	}
+
+	if expires != "" && cmd.Args().Len() == 1 && exists && !useEditor && fromEnv == "" {
+		err := store.Update(func(secrets storage.SecretStore) error {
+			if _, exists := storage.SecretExists(secrets, keyPath); !exists {
+				return fmt.Errorf("key '%s' does not exist, provide a value to create it", keyPath)
+			}
+			storage.SetSecretExpiry(secrets, keyPath, expires)
+			return nil
+		})
+		if err != nil {
 			return err
 		}
 		fmt.Printf("Successfully updated expiry for key: %s\n", keyPath)
 		return nil
 	}
 
-	if expires != "" && cmd.Args().Len() == 1 && !exists {
+	if expires != "" && cmd.Args().Len() == 1 && !exists && !useEditor && fromEnv == "" {
 		return fmt.Errorf("key '%s' does not exist, provide a value to create it", keyPath)
 	}
 
-	if exists {
+	// --only-if-exists already states the intent to overwrite, so don't prompt
+	if exists && !onlyIfExists {
 		fmt.Printf("Key '%s' already exists.\n", keyPath)
 		if !crypto.ConfirmOverwrite("key") {
 			fmt.Println("Operation cancelled.")
@@ -295,8 +700,22 @@ func SetCommand(_ context.Context, cmd *cli.Command) error {
 	}
 
 	var value string
-	if cmd.Args().Len() == 2 {
+	if fromEnv != "" {
+		value = envValue
+	} else if cmd.Args().Len() == 2 {
 		value = cmd.Args().Get(1)
+	} else if useEditor {
+		// The saved file is stored as-is, including its newlines, so PEM
+		// blocks and other multi-line values survive unchanged
+		editor, err := editorFromEnv()
+		if err != nil {
+			return err
+		}
+		edited, err := editInTempFile(editor, "crumb-value-*", "")
+		if err != nil {
+			return err
+		}
+		value = string(edited)
 	} else {
 		value, err = config.PromptForSecret("Enter secret value: ")
 		if err != nil {
@@ -304,120 +723,755 @@ func SetCommand(_ context.Context, cmd *cli.Command) error {
 		}
 	}
 
-	if strings.TrimSpace(value) == "" {
+	if strings.TrimSpace(value) == "" && !cmd.Bool("allow-empty") {
 		return fmt.Errorf("secret value cannot be empty")
 	}
 
-	if expires != "" {
-		storage.SetSecretWithExpires(secrets, keyPath, value, expires)
-	} else {
-		storage.SetSecret(secrets, keyPath, value)
-	}
-
-	if err := storage.SaveSecrets(secrets, cfg.PublicKeyPath, b); err != nil {
+	// The key may have come or gone while the value was being entered, so
+	// the flags are checked again against the secrets being updated
+	err = store.Update(func(secrets storage.SecretStore) error {
+		_, exists = storage.SecretExists(secrets, keyPath)
+		if (ifNotExists && exists) || (onlyIfExists && !exists) {
+			return nil
+		}
+		if expires != "" {
+			storage.SetSecretWithExpires(secrets, keyPath, value, expires, store.Clock().Now())
+		} else {
+			storage.SetSecret(secrets, keyPath, value, store.Clock().Now())
+		}
+		return nil
+	})
+	if err != nil {
 		return err
 	}
+	if ifNotExists && exists {
+		fmt.Printf("Key '%s' already exists, leaving it unchanged.\n", keyPath)
+		return nil
+	}
+	if onlyIfExists && !exists {
+		fmt.Printf("Key '%s' does not exist, nothing to update.\n", keyPath)
+		return nil
+	}
 
 	fmt.Printf("Successfully set key: %s\n", keyPath)
 	return nil
 }
 
-// GetCommand handles the get command
-func GetCommand(_ context.Context, cmd *cli.Command) error {
-	var keyPath string
-	if cmd.Bool("interactive") {
-		picked, err := pickSecretPath(cmd)
-		if err != nil {
-			return err
-		}
-		keyPath = picked
-	} else {
-		if cmd.Args().Len() != 1 {
-			return fmt.Errorf("usage: crumb get <key-path>")
+// alnumCharset is the default alphabet for set --generate
+const alnumCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// generateCharsets are the alphabets --charset can pick for set --generate
+var generateCharsets = map[string]string{
+	"alnum":     alnumCharset,
+	"hex":       "0123456789abcdef",
+	"base64url": alnumCharset + "-_",
+	"symbols":   alnumCharset + "!#%+-.:=@^_~",
+}
+
+// maxGenerateLength caps --length for set --generate
+const maxGenerateLength = 4096
+
+// setGenerated stores a random value at keyPath unless the key already
+// exists, printing the new value once on stdout. The existence check and the
+// save happen in one Store.Update, so two concurrent runs can't both
+// create the key.
+func setGenerated(ctx context.Context, cmd *cli.Command, keyPath string) error {
+	charset := cmd.String("charset")
+	alphabet, ok := generateCharsets[charset]
+	if !ok {
+		var names []string
+		for name := range generateCharsets {
+			names = append(names, name)
 		}
-		keyPath = cmd.Args().Get(0)
+		sort.Strings(names)
+		return fmt.Errorf("unsupported --charset value: %s (supported: %s)", charset, strings.Join(names, ", "))
+	}
+	length := int(cmd.Int("length"))
+	if length < 1 || length > maxGenerateLength {
+		return fmt.Errorf("--length must be between 1 and %d, got %d", maxGenerateLength, length)
 	}
-	maskValue := cmd.Bool("mask")
-	exportFormat := cmd.Bool("export")
-	shell := cmd.String("shell")
 
-	if err := config.ValidateKeyPath(keyPath); err != nil {
-		return err
+	expires := cmd.String("expires")
+	if expires != "" {
+		parsed, err := storage.ParseExpiryDate(expires)
+		if err != nil {
+			return err
+		}
+		expires = parsed
 	}
 
-	cfg, b, err := resolveBackend(cmd)
+	store, err := resolveStore(ctx, cmd)
 	if err != nil {
 		return err
 	}
 
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
+	var value string
+	err = store.Update(func(secrets storage.SecretStore) error {
+		value = ""
+		if _, exists := storage.SecretExists(secrets, keyPath); exists {
+			return nil
+		}
+		generated, err := crypto.RandomString(length, alphabet)
+		if err != nil {
+			return err
+		}
+		if expires != "" {
+			storage.SetSecretWithExpires(secrets, keyPath, generated, expires, store.Clock().Now())
+		} else {
+			storage.SetSecret(secrets, keyPath, generated, store.Clock().Now())
+		}
+		value = generated
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	entry, exists := storage.SecretExists(secrets, keyPath)
-	if !exists {
-		fmt.Println("Key not found.")
+	// Messages go to stderr so stdout carries nothing but a new value
+	if value == "" {
+		fmt.Fprintf(os.Stderr, "Key '%s' already exists, leaving it unchanged.\n", keyPath)
 		return nil
 	}
+	fmt.Fprintf(os.Stderr, "Generated a new value for key: %s\n", keyPath)
+	fmt.Println(value)
+	return nil
+}
+
+// appendToSecret adds item to the separator-delimited list stored at keyPath,
+// creating the key if it doesn't exist unless onlyIfExists is set. With
+// unique, an item that's already in the list leaves it unchanged. The secret
+// keeps its expiry unless a new one is given.
+func appendToSecret(store storage.Store, keyPath, item, separator string, unique bool, expires string, onlyIfExists bool) error {
+	var exists, contained bool
+	err := store.Update(func(secrets storage.SecretStore) error {
+		var entry storage.SecretEntry
+		entry, exists = storage.SecretExists(secrets, keyPath)
+		contained = false
+		if onlyIfExists && !exists {
+			return nil
+		}
+
+		value := item
+		if exists && entry.Value != "" {
+			if unique && slices.Contains(strings.Split(entry.Value, separator), item) {
+				contained = true
+				return nil
+			}
+			value = entry.Value + separator + item
+		}
 
-	if exportFormat {
-		varName := storage.ExtractVarName(keyPath)
-		switch shell {
-		case "bash":
-			quotedValue := storage.ShellQuoteValue(entry.Value)
-			fmt.Printf("export %s=%s\n", varName, quotedValue)
-		case "fish":
-			quotedValue := storage.ShellQuoteValue(entry.Value)
-			fmt.Printf("set -x -g %s %s\n", varName, quotedValue)
-		default:
-			return fmt.Errorf("unsupported shell format: %s (supported: bash, fish)", shell)
+		newExpires := expires
+		if newExpires == "" {
+			newExpires = entry.Expires
+		}
+		if newExpires != "" {
+			storage.SetSecretWithExpires(secrets, keyPath, value, newExpires, store.Clock().Now())
+		} else {
+			storage.SetSecret(secrets, keyPath, value, store.Clock().Now())
 		}
 		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	if maskValue {
-		fmt.Println("****")
+	switch {
+	case onlyIfExists && !exists:
+		fmt.Printf("Key '%s' does not exist, nothing to update.\n", keyPath)
+		return nil
+	case contained:
+		fmt.Printf("Key '%s' already contains that entry, leaving it unchanged.\n", keyPath)
+		return nil
+	}
+	if exists {
+		fmt.Printf("Successfully appended to key: %s\n", keyPath)
 	} else {
-		fmt.Printf("%s\n", entry.Value)
+		fmt.Printf("Successfully set key: %s\n", keyPath)
 	}
-
 	return nil
 }
 
-// InfoCommand shows metadata for a secret without revealing the value.
-func InfoCommand(_ context.Context, cmd *cli.Command) error {
-	var keyPath string
-	if cmd.Bool("interactive") {
-		picked, err := pickSecretPath(cmd)
-		if err != nil {
-			return err
-		}
-		keyPath = picked
+// setFromJSON stores each field of a JSON object as a secret under parentPath
+func setFromJSON(ctx context.Context, cmd *cli.Command, parentPath string) error {
+	filePath := cmd.String("file")
+
+	var data []byte
+	var err error
+	if filePath != "" {
+		data, err = os.ReadFile(filepath.Clean(filePath))
 	} else {
-		if cmd.Args().Len() != 1 {
-			return fmt.Errorf("usage: crumb info <key-path>")
-		}
-		keyPath = cmd.Args().Get(0)
+		data, err = io.ReadAll(os.Stdin)
 	}
-
-	if err := config.ValidateKeyPath(keyPath); err != nil {
-		return err
+	if err != nil {
+		return fmt.Errorf("failed to read JSON input: %w", err)
 	}
 
-	cfg, b, err := resolveBackend(cmd)
+	values, err := storage.FlattenJSON(parentPath, data)
 	if err != nil {
 		return err
 	}
 
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
-	if err != nil {
-		return err
+	if len(values) == 0 {
+		return fmt.Errorf("JSON object is empty, nothing to set")
 	}
 
-	entry, exists := storage.SecretExists(secrets, keyPath)
-	if !exists {
-		fmt.Println("Key not found.")
+	var keys []string
+	for key := range values {
+		if err := config.ValidateKeyPath(key); err != nil {
+			return fmt.Errorf("invalid key path %q: %w", key, err)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	store, err := resolveStore(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	var conflicts []string
+	for _, key := range keys {
+		if _, exists := storage.SecretExists(secrets, key); exists {
+			conflicts = append(conflicts, key)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		fmt.Printf("Existing keys that will be updated: %d\n", len(conflicts))
+		for _, key := range conflicts {
+			fmt.Printf("  - %s\n", key)
+		}
+		if filePath == "" {
+			return fmt.Errorf("cannot confirm overwrite while reading JSON from stdin; use --file instead")
+		}
+
+		fmt.Print("Continue? This will overwrite existing keys. (y/n): ")
+		reader := bufio.NewReader(os.Stdin)
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		response = strings.TrimSpace(strings.ToLower(response))
+		if response != "y" && response != "yes" {
+			fmt.Println("Operation cancelled.")
+			return nil
+		}
+	}
+
+	err = store.Update(func(secrets storage.SecretStore) error {
+		now := store.Clock().Now()
+		for _, key := range keys {
+			storage.SetSecret(secrets, key, values[key], now)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		fmt.Printf("Successfully set key: %s\n", key)
+	}
+	return nil
+}
+
+// GetCommand handles the get command
+func GetCommand(ctx context.Context, cmd *cli.Command) error {
+	toFD := cmd.IsSet("fd")
+	if toFD {
+		if cmd.Args().Len() > 1 || cmd.Bool("exists") {
+			return fmt.Errorf("--fd writes a single value and cannot be combined with several keys or --exists")
+		}
+		if fd := cmd.Int("fd"); fd < 3 {
+			return fmt.Errorf("--fd must be 3 or higher, got %d (0, 1 and 2 are stdin, stdout and stderr)", fd)
+		}
+	}
+
+	if cmd.IsSet("default") && (cmd.Args().Len() > 1 || cmd.Bool("exists") || cmd.Bool("all-under")) {
+		return fmt.Errorf("--default applies to a single key and cannot be combined with several keys, --exists or --all-under")
+	}
+	history := cmd.Bool("history")
+	if history && (cmd.Args().Len() > 1 || cmd.Bool("exists") || cmd.IsSet("default") || toFD) {
+		return fmt.Errorf("--history applies to a single key and cannot be combined with several keys, --exists, --default or --fd")
+	}
+
+	var keyPath string
+	if cmd.Bool("interactive") {
+		picked, err := pickSecretPath(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		keyPath = picked
+	} else {
+		if cmd.Args().Len() == 0 {
+			return fmt.Errorf("usage: crumb get <key-path> [key-path...]")
+		}
+		if cmd.Bool("exists") {
+			return checkSecretsExist(ctx, cmd, cmd.Args().Slice())
+		}
+		if cmd.Args().Len() > 1 {
+			return getMultipleSecrets(ctx, cmd, cmd.Args().Slice())
+		}
+		keyPath = cmd.Args().Get(0)
+	}
+	maskValue := cmd.Bool("mask")
+	shell := cmd.String("shell")
+
+	if err := config.ValidateKeyPath(keyPath); err != nil {
+		return err
+	}
+
+	format, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	if format == "shell" {
+		if err := validateExportShell(shell); err != nil {
+			return err
+		}
+	}
+
+	allUnder := cmd.Bool("all-under") || strings.HasSuffix(keyPath, "/")
+	if allUnder && format != "" {
+		return fmt.Errorf("--all-under cannot be combined with --export or --format, use 'crumb export --path' instead")
+	}
+	if allUnder && cmd.Bool("base64") {
+		return fmt.Errorf("--base64 cannot be combined with --all-under, use 'crumb export --path --base64' instead")
+	}
+	if toFD && (allUnder || format != "") {
+		return fmt.Errorf("--fd writes the raw value and cannot be combined with --all-under, --export or --format")
+	}
+	if history && (allUnder || format != "" || cmd.Bool("base64")) {
+		return fmt.Errorf("--history cannot be combined with --all-under, --export, --format or --base64")
+	}
+	if (allUnder || history) && cmd.Bool("show") && !cmd.Bool("force") && !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("refusing to reveal secret values because stdout is not a terminal, pass --force to override")
+	}
+
+	mask, err := maskStyleFromFlags(cmd, "4")
+	if err != nil {
+		return err
+	}
+	redact, err := redactPatternFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if redact != nil && !((allUnder || history) && cmd.Bool("show")) {
+		return fmt.Errorf("--redact-pattern requires --show")
+	}
+
+	store, err := resolveStore(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	if allUnder {
+		return printSecretsUnder(secrets, keyPath, cmd.Bool("show"), redact, mask)
+	}
+
+	entry, exists := storage.SecretExists(secrets, keyPath)
+	if history {
+		if !exists {
+			return fmt.Errorf("key not found: %s", keyPath)
+		}
+		printSecretHistory(entry, cmd.Bool("show"), redact, mask)
+		return nil
+	}
+	if !exists {
+		if !cmd.IsSet("default") {
+			return fmt.Errorf("key not found: %s", keyPath)
+		}
+		// The default stands in for the value and goes through the same output
+		entry.Value = cmd.String("default")
+	}
+
+	// Shell output is meant to be sourced and --fd feeds another program, so
+	// neither is ever masked
+	value := encodeIfBase64(cmd, entry.Value)
+	if maskValue && format != "shell" && !toFD {
+		value = maskSecret(value, mask)
+	}
+
+	if toFD {
+		return writeToFD(int(cmd.Int("fd")), value)
+	}
+
+	if format != "" {
+		return writeSecretFormat(os.Stdout, format, shell, storage.ExtractVarName(keyPath), value)
+	}
+
+	fmt.Printf("%s\n", value)
+	return nil
+}
+
+// encodeIfBase64 returns value in standard, padded base64 when --base64 is
+// set, and unchanged otherwise
+func encodeIfBase64(cmd *cli.Command, value string) string {
+	if !cmd.Bool("base64") {
+		return value
+	}
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+// writeToFD writes value as-is, without a trailing newline, to the inherited
+// file descriptor fd, then closes it so the reader sees end of file. Unlike
+// the environment or argv, a pipe's contents can't be read through ps or
+// /proc/<pid>/environ.
+func writeToFD(fd int, value string) error {
+	file := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if _, err := file.WriteString(value); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write to file descriptor %d: %w", fd, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close file descriptor %d: %w", fd, err)
+	}
+	return nil
+}
+
+// checkSecretsExist prints nothing and succeeds if every key exists, and
+// exits with status 1 otherwise, for use in shell conditions
+func checkSecretsExist(ctx context.Context, cmd *cli.Command, keyPaths []string) error {
+	for _, keyPath := range keyPaths {
+		if err := config.ValidateKeyPath(keyPath); err != nil {
+			return err
+		}
+	}
+	format, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	if format != "" || cmd.Bool("all-under") {
+		return fmt.Errorf("--exists cannot be combined with --export, --format or --all-under")
+	}
+
+	store, err := resolveStore(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	for _, keyPath := range keyPaths {
+		if _, exists := storage.SecretExists(secrets, keyPath); !exists {
+			return cli.Exit("", 1)
+		}
+	}
+	return nil
+}
+
+// getMultipleSecrets prints several secrets in argument order, as aligned
+// "key = value" lines (masked unless --show) or, with --no-labels, as bare
+// values one per line.
+func getMultipleSecrets(ctx context.Context, cmd *cli.Command, keyPaths []string) error {
+	for _, keyPath := range keyPaths {
+		if err := config.ValidateKeyPath(keyPath); err != nil {
+			return err
+		}
+		if cmd.Bool("all-under") || strings.HasSuffix(keyPath, "/") {
+			return fmt.Errorf("--all-under (or a trailing slash) takes a single path")
+		}
+	}
+
+	format, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	if format != "" {
+		return fmt.Errorf("--export and --format take a single key, use 'crumb export' for several")
+	}
+
+	noLabels := cmd.Bool("no-labels")
+	if !noLabels && cmd.Bool("show") && !cmd.Bool("force") && !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("refusing to reveal secret values because stdout is not a terminal, pass --force to override")
+	}
+
+	mask, err := maskStyleFromFlags(cmd, "4")
+	if err != nil {
+		return err
+	}
+	redact, err := redactPatternFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if redact != nil && (noLabels || !cmd.Bool("show")) {
+		return fmt.Errorf("--redact-pattern requires --show")
+	}
+
+	store, err := resolveStore(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, keyPath := range keyPaths {
+		if _, exists := storage.SecretExists(secrets, keyPath); !exists {
+			missing = append(missing, keyPath)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("keys not found: %s", strings.Join(missing, ", "))
+	}
+
+	if noLabels {
+		for _, keyPath := range keyPaths {
+			value := encodeIfBase64(cmd, secrets[keyPath].Value)
+			if cmd.Bool("mask") {
+				value = maskSecret(value, mask)
+			}
+			fmt.Println(value)
+		}
+		return nil
+	}
+
+	width := 0
+	for _, keyPath := range keyPaths {
+		width = max(width, len(keyPath))
+	}
+	for _, keyPath := range keyPaths {
+		fmt.Printf("%-*s = %s\n", width, keyPath, displaySecret(encodeIfBase64(cmd, secrets[keyPath].Value), cmd.Bool("show"), redact, mask))
+	}
+	return nil
+}
+
+// maskPreserve is the --mask-length value that matches the value's length
+const maskPreserve = "preserve"
+
+// maskStyle describes how masked values are displayed
+type maskStyle struct {
+	Char string
+	// Length is the number of mask characters; 0 uses one per character of
+	// the value
+	Length int
+}
+
+// maskStyleFromFlags reads --mask-char and --mask-length (mask_char and
+// mask_length in crumb.toml). defaultLength applies when no length is set and
+// is a number or "preserve".
+func maskStyleFromFlags(cmd *cli.Command, defaultLength string) (maskStyle, error) {
+	style := maskStyle{Char: cmd.String("mask-char")}
+	if style.Char == "" {
+		style.Char = "*"
+	}
+	if utf8.RuneCountInString(style.Char) != 1 {
+		return style, fmt.Errorf("invalid mask character %q: must be a single character", style.Char)
+	}
+
+	length := cmd.String("mask-length")
+	if length == "" {
+		length = defaultLength
+	}
+	if length != maskPreserve {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 1 {
+			return style, fmt.Errorf("invalid mask length %q: must be a positive number or %q", length, maskPreserve)
+		}
+		style.Length = n
+	}
+	return style, nil
+}
+
+// emptyMaskLabel is shown instead of a mask for an empty value, so masked
+// output tells empty values apart from set ones
+const emptyMaskLabel = "(empty)"
+
+// maskSecret hides a value for display according to style
+func maskSecret(value string, style maskStyle) string {
+	if value == "" {
+		return emptyMaskLabel
+	}
+	length := style.Length
+	if length == 0 {
+		length = utf8.RuneCountInString(value)
+	}
+	return strings.Repeat(style.Char, length)
+}
+
+// grepPatternFromFlags compiles list's --grep, a plain substring unless
+// --regex is set. It returns nil when --grep isn't given.
+func grepPatternFromFlags(cmd *cli.Command) (*regexp.Regexp, error) {
+	pattern := cmd.String("grep")
+	if pattern == "" {
+		if cmd.Bool("regex") {
+			return nil, fmt.Errorf("--regex requires --grep")
+		}
+		return nil, nil
+	}
+	if !cmd.Bool("regex") {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --grep pattern: %w", err)
+	}
+	return compiled, nil
+}
+
+// redactPatternFromFlags compiles --redact-pattern, returning nil when it
+// isn't set
+func redactPatternFromFlags(cmd *cli.Command) (*regexp.Regexp, error) {
+	pattern := cmd.String("redact-pattern")
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --redact-pattern: %w", err)
+	}
+	return re, nil
+}
+
+// redacted reports whether a revealed value matches the --redact-pattern and
+// should be masked anyway
+func redacted(pattern *regexp.Regexp, value string) bool {
+	return pattern != nil && pattern.MatchString(value)
+}
+
+// displaySecret returns value as listed by the commands that mask values
+// unless --show is given: masked without show, and with show still masked
+// if it matches the --redact-pattern
+func displaySecret(value string, show bool, redact *regexp.Regexp, style maskStyle) string {
+	if !show || redacted(redact, value) {
+		return maskSecret(value, style)
+	}
+	return value
+}
+
+// supportedGetFormats lists the --format values understood by get
+var supportedGetFormats = []string{"shell", "dotenv", "json"}
+
+// getOutputFormat returns the --format for get, treating --export as
+// "shell", or "" for the plain value
+func getOutputFormat(cmd *cli.Command) (string, error) {
+	format := cmd.String("format")
+	if format != "" && !slices.Contains(supportedGetFormats, format) {
+		return "", fmt.Errorf("unsupported format: %s (supported: %s)", format, strings.Join(supportedGetFormats, ", "))
+	}
+	if cmd.Bool("export") {
+		if format != "" && format != "shell" {
+			return "", fmt.Errorf("--export cannot be combined with --format %s", format)
+		}
+		format = "shell"
+	}
+	return format, nil
+}
+
+// writeSecretFormat writes a single secret as varName in the given format
+func writeSecretFormat(w io.Writer, format, shell, varName, value string) error {
+	switch format {
+	case "shell":
+		result := newExportResult()
+		result.set(varName, value, "")
+		writeExport(w, exportOptions{Shell: shell, NoComments: true}, result)
+	case "dotenv":
+		fmt.Fprintf(w, "%s=%s\n", varName, storage.DotenvQuoteValue(value))
+	case "json":
+		encoded, err := json.Marshal(getJSON{Version: jsonSchemaVersion, Vars: map[string]string{varName: value}})
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		fmt.Fprintf(w, "%s\n", encoded)
+	}
+	return nil
+}
+
+// printSecretsUnder prints every secret below prefix as path=value sorted by
+// path, masking the values unless show is set or they match redact.
+func printSecretsUnder(secrets storage.SecretStore, prefix string, show bool, redact *regexp.Regexp, mask maskStyle) error {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	var paths []string
+	pathSecrets := storage.GetSecretsForPath(secrets, prefix)
+	for secretPath := range pathSecrets {
+		// Only match whole segments so /app doesn't include /application
+		if secretPath == prefix || strings.HasPrefix(secretPath, prefix+"/") {
+			paths = append(paths, secretPath)
+		}
+	}
+	sort.Strings(paths)
+
+	if len(paths) == 0 {
+		fmt.Printf("No secrets found under: %s/\n", prefix)
+		return nil
+	}
+
+	for _, secretPath := range paths {
+		fmt.Printf("%s=%s\n", secretPath, displaySecret(pathSecrets[secretPath], show, redact, mask))
+	}
+	return nil
+}
+
+// printSecretHistory prints the current value of a secret and then its
+// previous ones, newest first, each with the time it was set
+func printSecretHistory(entry storage.SecretEntry, show bool, redact *regexp.Regexp, mask maskStyle) {
+	versions := append([]storage.HistoryEntry{{Value: entry.Value, Updated: entry.Updated}}, entry.History...)
+	for i, version := range versions {
+		updated := version.Updated
+		if updated == "" {
+			updated = "(unknown)"
+		}
+		line := fmt.Sprintf("%-20s  %s", updated, displaySecret(version.Value, show, redact, mask))
+		if i == 0 {
+			line += "  (current)"
+		}
+		fmt.Println(line)
+	}
+	if len(entry.History) == 0 {
+		fmt.Println("No previous values")
+	}
+}
+
+// InfoCommand shows metadata for a secret without revealing the value.
+func InfoCommand(ctx context.Context, cmd *cli.Command) error {
+	var keyPath string
+	if cmd.Bool("interactive") {
+		picked, err := pickSecretPath(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		keyPath = picked
+	} else {
+		if cmd.Args().Len() != 1 {
+			return fmt.Errorf("usage: crumb info <key-path>")
+		}
+		keyPath = cmd.Args().Get(0)
+	}
+
+	if err := config.ValidateKeyPath(keyPath); err != nil {
+		return err
+	}
+
+	store, err := resolveStore(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	entry, exists := storage.SecretExists(secrets, keyPath)
+	if !exists {
+		fmt.Println("Key not found.")
 		return nil
 	}
 
@@ -433,6 +1487,15 @@ func InfoCommand(_ context.Context, cmd *cli.Command) error {
 	fmt.Printf("Key:     %s\n", keyPath)
 	fmt.Printf("Updated: %s\n", updated)
 	fmt.Printf("Expires: %s\n", expires)
+	if entry.Rotate != "" {
+		fmt.Printf("Rotate:  every %s\n", entry.Rotate)
+	}
+	if entry.Description != "" {
+		fmt.Println("Description:")
+		for _, line := range strings.Split(entry.Description, "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+	}
 
 	return nil
 }
@@ -459,7 +1522,14 @@ func InitCommand(_ context.Context, _ *cli.Command) error {
 }
 
 // DeleteCommand handles the delete command
-func DeleteCommand(_ context.Context, cmd *cli.Command) error {
+func DeleteCommand(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Bool("stdin") {
+		if cmd.Args().Len() != 0 {
+			return fmt.Errorf("usage: crumb delete --stdin [--yes] < keys.txt")
+		}
+		return deleteKeysFromStdin(ctx, cmd)
+	}
+
 	if cmd.Args().Len() != 1 {
 		return fmt.Errorf("usage: crumb delete <key-path>")
 	}
@@ -470,12 +1540,12 @@ func DeleteCommand(_ context.Context, cmd *cli.Command) error {
 		return err
 	}
 
-	cfg, b, err := resolveBackend(cmd)
+	store, err := resolveStore(ctx, cmd)
 	if err != nil {
 		return err
 	}
 
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
+	secrets, err := store.Load()
 	if err != nil {
 		return err
 	}
@@ -485,34 +1555,161 @@ func DeleteCommand(_ context.Context, cmd *cli.Command) error {
 		return nil
 	}
 
-	fmt.Printf("Type the key path to confirm deletion: ")
-	reader := bufio.NewReader(os.Stdin)
-	confirmation, err := reader.ReadString('\n')
-	if err != nil {
-		return fmt.Errorf("failed to read confirmation: %w", err)
+	if !cmd.Bool("yes") {
+		fmt.Printf("Type the key path to confirm deletion: ")
+		reader := bufio.NewReader(os.Stdin)
+		confirmation, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read confirmation: %w", err)
+		}
+
+		confirmation = strings.TrimSpace(confirmation)
+		if confirmation != keyPath {
+			fmt.Println("Confirmation failed. Deletion cancelled.")
+			return nil
+		}
 	}
 
-	confirmation = strings.TrimSpace(confirmation)
-	if confirmation != keyPath {
-		fmt.Println("Confirmation failed. Deletion cancelled.")
+	var deleted bool
+	err = store.Update(func(secrets storage.SecretStore) error {
+		deleted = storage.DeleteSecret(secrets, keyPath)
 		return nil
+	})
+	if err != nil {
+		return err
 	}
-
-	if !storage.DeleteSecret(secrets, keyPath) {
+	if !deleted {
 		fmt.Println("Key not found.")
 		return nil
 	}
 
-	if err := storage.SaveSecrets(secrets, cfg.PublicKeyPath, b); err != nil {
+	fmt.Printf("Successfully deleted key: %s\n", keyPath)
+	return nil
+}
+
+// deleteKeysFromStdin deletes every key path listed on stdin (one per line)
+// after a single confirmation, decrypting and saving the store only once.
+func deleteKeysFromStdin(ctx context.Context, cmd *cli.Command) error {
+	keyPaths, err := readKeyPaths(os.Stdin)
+	if err != nil {
+		return err
+	}
+	if len(keyPaths) == 0 {
+		return fmt.Errorf("no key paths provided on stdin")
+	}
+
+	for _, keyPath := range keyPaths {
+		if err := config.ValidateKeyPath(keyPath); err != nil {
+			return fmt.Errorf("invalid key path %q: %w", keyPath, err)
+		}
+	}
+
+	store, err := resolveStore(ctx, cmd)
+	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Successfully deleted key: %s\n", keyPath)
+	secrets, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	var found, missing []string
+	for _, keyPath := range keyPaths {
+		if _, exists := storage.SecretExists(secrets, keyPath); exists {
+			found = append(found, keyPath)
+		} else {
+			missing = append(missing, keyPath)
+		}
+	}
+
+	if len(missing) > 0 {
+		fmt.Printf("Keys not found: %d\n", len(missing))
+		for _, keyPath := range missing {
+			fmt.Printf("  ? %s\n", keyPath)
+		}
+	}
+
+	if len(found) == 0 {
+		fmt.Println("Nothing to delete.")
+		return nil
+	}
+
+	fmt.Printf("Keys to delete: %d\n", len(found))
+	for _, keyPath := range found {
+		fmt.Printf("  - %s\n", keyPath)
+	}
+
+	if !cmd.Bool("yes") {
+		confirmed, err := confirmFromTerminal(fmt.Sprintf("Delete these %d keys? (y/n): ", len(found)))
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Println("Deletion cancelled.")
+			return nil
+		}
+	}
+
+	deleted := 0
+	err = store.Update(func(secrets storage.SecretStore) error {
+		deleted = 0
+		for _, keyPath := range found {
+			if storage.DeleteSecret(secrets, keyPath) {
+				deleted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully deleted %d keys\n", deleted)
 	return nil
 }
 
+// readKeyPaths reads newline-separated key paths, skipping blank lines and duplicates
+func readKeyPaths(r io.Reader) ([]string, error) {
+	var keyPaths []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		keyPath := strings.TrimSpace(scanner.Text())
+		if keyPath == "" || seen[keyPath] {
+			continue
+		}
+		seen[keyPath] = true
+		keyPaths = append(keyPaths, keyPath)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read key paths from stdin: %w", err)
+	}
+
+	return keyPaths, nil
+}
+
+// confirmFromTerminal asks a y/n question on the controlling terminal, for
+// commands whose stdin is already used for input.
+func confirmFromTerminal(prompt string) (bool, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false, fmt.Errorf("cannot confirm while reading keys from stdin without a terminal; pass --yes")
+	}
+	defer tty.Close()
+
+	fmt.Print(prompt)
+	response, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failed to read input: %w", err)
+	}
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes", nil
+}
+
 // MoveCommand handles the move command
-func MoveCommand(_ context.Context, cmd *cli.Command) error {
+func MoveCommand(ctx context.Context, cmd *cli.Command) error {
 	if cmd.Args().Len() != 2 {
 		return fmt.Errorf("usage: crumb move <old-key-path> <new-key-path>")
 	}
@@ -527,21 +1724,34 @@ func MoveCommand(_ context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("invalid new key path: %w", err)
 	}
 
-	cfg, b, err := resolveBackend(cmd)
+	store, err := resolveStore(ctx, cmd)
 	if err != nil {
 		return err
 	}
 
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
+	secrets, err := store.Load()
 	if err != nil {
 		return err
 	}
 
-	if err := storage.MoveSecret(secrets, oldKeyPath, newKeyPath); err != nil {
-		return err
+	if _, exists := storage.SecretExists(secrets, oldKeyPath); !exists {
+		return fmt.Errorf("old key not found: %s", oldKeyPath)
+	}
+	overwrite := false
+	if _, exists := storage.SecretExists(secrets, newKeyPath); exists {
+		if !crypto.ConfirmOverwrite("key") {
+			return fmt.Errorf("operation cancelled")
+		}
+		overwrite = true
 	}
 
-	if err := storage.SaveSecrets(secrets, cfg.PublicKeyPath, b); err != nil {
+	err = store.Update(func(secrets storage.SecretStore) error {
+		if overwrite {
+			storage.DeleteSecret(secrets, newKeyPath)
+		}
+		return storage.MoveSecret(secrets, oldKeyPath, newKeyPath, store.Clock().Now())
+	})
+	if err != nil {
 		return err
 	}
 
@@ -549,19 +1759,24 @@ func MoveCommand(_ context.Context, cmd *cli.Command) error {
 	return nil
 }
 
-// computeEnvDiff compares current environment with new variables and returns a formatted diff string
-func computeEnvDiff(newVars map[string]string) string {
-	var added []string
-	var modified []string
-
-	currentEnv := make(map[string]string)
+// currentEnvironment returns the process environment as a map
+func currentEnvironment() map[string]string {
+	env := make(map[string]string)
 	for _, envVar := range os.Environ() {
 		parts := strings.SplitN(envVar, "=", 2)
 		if len(parts) == 2 {
-			currentEnv[parts[0]] = parts[1]
+			env[parts[0]] = parts[1]
 		}
 	}
+	return env
+}
 
+// computeEnvDiff compares current environment with new variables and returns a formatted diff string
+func computeEnvDiff(newVars map[string]string) string {
+	var added []string
+	var modified []string
+
+	currentEnv := currentEnvironment()
 	for key, newValue := range newVars {
 		if currentValue, exists := currentEnv[key]; exists {
 			if currentValue != newValue {
@@ -586,156 +1801,8 @@ func computeEnvDiff(newVars map[string]string) string {
 	return strings.Join(parts, " ")
 }
 
-// ExportCommand handles the export command
-func ExportCommand(_ context.Context, cmd *cli.Command) error {
-	shell := cmd.String("shell")
-	if shell == "" {
-		shell = "bash"
-	}
-
-	pathFlag := cmd.String("path")
-
-	cfg, b, err := resolveBackend(cmd)
-	if err != nil {
-		return err
-	}
-
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
-	if err != nil {
-		return err
-	}
-
-	envVars := make(map[string]string)
-
-	if pathFlag != "" {
-		isPathPrefix := strings.HasSuffix(pathFlag, "/")
-
-		if isPathPrefix {
-			pathPrefix := strings.TrimSuffix(pathFlag, "/")
-
-			comment := fmt.Sprintf("# Exported from %s", pathPrefix)
-			switch shell {
-			case "bash":
-				fmt.Println(comment)
-			case "fish":
-				fmt.Println(comment)
-			}
-
-			pathSecrets := storage.GetSecretsForPath(secrets, pathPrefix)
-			for secretPath, secretValue := range pathSecrets {
-				keyName := storage.ConvertPathToEnvVar(secretPath, pathPrefix)
-				if keyName != "" {
-					envVars[keyName] = secretValue
-				}
-			}
-		} else {
-			if entry, exists := storage.SecretExists(secrets, pathFlag); exists {
-				comment := fmt.Sprintf("# Exported from %s", pathFlag)
-				switch shell {
-				case "bash":
-					fmt.Println(comment)
-				case "fish":
-					fmt.Println(comment)
-				}
-
-				keyName := storage.ExtractVarName(pathFlag)
-				if keyName != "" {
-					envVars[keyName] = entry.Value
-				}
-			}
-		}
-	} else {
-		configFile := cmd.String("file")
-		environmentName := cmd.String("env")
-
-		crumbConfig, err := config.LoadCrumbConfig(configFile)
-		if err != nil {
-			return err
-		}
-
-		envConfig, exists := crumbConfig.Environments[environmentName]
-		if !exists {
-			return fmt.Errorf("environment '%s' not found in %s", environmentName, configFile)
-		}
-
-		if envConfig.Path != "" {
-			comment := fmt.Sprintf("# Exported from %s (environment: %s)", envConfig.Path, environmentName)
-			switch shell {
-			case "bash":
-				fmt.Println(comment)
-			case "fish":
-				fmt.Println(comment)
-			}
-
-			pathPrefix := strings.TrimSuffix(envConfig.Path, "/")
-			pathSecrets := storage.GetSecretsForPath(secrets, pathPrefix)
-			for secretPath, secretValue := range pathSecrets {
-				keyName := strings.TrimPrefix(secretPath, pathPrefix)
-				keyName = strings.TrimPrefix(keyName, "/")
-				keyName = strings.ToUpper(strings.ReplaceAll(keyName, "/", "_"))
-				keyName = strings.ReplaceAll(keyName, "-", "_")
-
-				if keyName != "" {
-					envVars[keyName] = secretValue
-				}
-			}
-		}
-
-		for envVarName, envVarValue := range envConfig.Env {
-			sanitizedEnvVarName := strings.ToUpper(strings.ReplaceAll(envVarName, "-", "_"))
-
-			if strings.HasPrefix(envVarValue, "/") {
-				if entry, exists := storage.SecretExists(secrets, envVarValue); exists {
-					envVars[sanitizedEnvVarName] = entry.Value
-				}
-			} else {
-				envVars[sanitizedEnvVarName] = envVarValue
-			}
-		}
-
-		for originalKey, newKey := range envConfig.Remap {
-			sanitizedOriginalKey := strings.ToUpper(strings.ReplaceAll(originalKey, "-", "_"))
-			sanitizedNewKey := strings.ToUpper(strings.ReplaceAll(newKey, "-", "_"))
-
-			if value, exists := envVars[sanitizedOriginalKey]; exists {
-				envVars[sanitizedNewKey] = value
-				delete(envVars, sanitizedOriginalKey)
-			}
-		}
-	}
-
-	if len(envVars) == 0 {
-		return fmt.Errorf("no secrets found to export")
-	}
-
-	diffStatus := computeEnvDiff(envVars)
-	if diffStatus != "" {
-		fmt.Fprintf(os.Stderr, "crumb: export %s\n", diffStatus)
-	}
-
-	var keys []string
-	for key := range envVars {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
-
-	for _, key := range keys {
-		value := envVars[key]
-		switch shell {
-		case "bash":
-			quotedValue := storage.ShellQuoteValue(value)
-			fmt.Printf("export %s=%s\n", key, quotedValue)
-		case "fish":
-			quotedValue := storage.ShellQuoteValue(value)
-			fmt.Printf("set -x -g %s %s\n", key, quotedValue)
-		}
-	}
-
-	return nil
-}
-
 // ImportCommand handles importing secrets from a .env file
-func ImportCommand(_ context.Context, cmd *cli.Command) error {
+func ImportCommand(ctx context.Context, cmd *cli.Command) error {
 	filePath := cmd.String("file")
 	basePath := cmd.String("path")
 
@@ -750,33 +1817,73 @@ func ImportCommand(_ context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("invalid path: %w", err)
 	}
 
-	envVars, err := storage.ParseEnvFile(filePath)
+	// Vault dumps hold secret paths rather than environment variables, so
+	// they're checked as key paths and named accordingly in messages
+	var envVars, comments map[string]string
+	var err error
+	what := "environment variables"
+	switch format := cmd.String("format"); format {
+	case "", "env":
+		envVars, err = storage.ParseEnvFile(filePath)
+		if err == nil && cmd.Bool("import-comments") {
+			comments, err = storage.ParseEnvFileComments(filePath)
+		}
+	case "vault":
+		if cmd.Bool("import-comments") {
+			return fmt.Errorf("--import-comments only applies to --format env")
+		}
+		what = "secrets"
+		envVars, err = storage.ParseVaultJSON(filePath)
+		if err == nil {
+			err = validateVaultKeys(basePath, envVars)
+		}
+	default:
+		return fmt.Errorf("unsupported --format value: %s (supported: env, vault)", format)
+	}
 	if err != nil {
 		return err
 	}
 
 	if len(envVars) == 0 {
-		fmt.Println("No environment variables found in the .env file")
+		fmt.Printf("No %s found in %s\n", what, filePath)
+		return nil
+	}
+
+	foundCount := len(envVars)
+	envVars, err = selectEnvVars(envVars, cmd.String("only"), cmd.String("exclude"))
+	if err != nil {
+		return err
+	}
+	if len(envVars) == 0 {
+		fmt.Printf("None of the %d %s in %s match --only/--exclude\n", foundCount, what, filePath)
 		return nil
 	}
 
-	cfg, b, err := resolveBackend(cmd)
+	store, err := resolveStore(ctx, cmd)
 	if err != nil {
 		return err
 	}
 
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
+	secrets, err := store.Load()
 	if err != nil {
 		return err
 	}
 
 	basePath = strings.TrimSuffix(basePath, "/")
 
+	keyNames, unprefixed, err := importKeyNames(envVars, cmd.String("prefix-strip"))
+	if err != nil {
+		return err
+	}
+	for _, envKey := range unprefixed {
+		fmt.Fprintf(os.Stderr, "Warning: %s does not start with %s, importing it unchanged\n", envKey, cmd.String("prefix-strip"))
+	}
+
 	var conflicts []string
 	var newKeys []string
 
 	for envKey := range envVars {
-		fullKeyPath := basePath + "/" + envKey
+		fullKeyPath := basePath + "/" + keyNames[envKey]
 
 		if _, exists := storage.SecretExists(secrets, fullKeyPath); exists {
 			conflicts = append(conflicts, fullKeyPath)
@@ -785,9 +1892,18 @@ func ImportCommand(_ context.Context, cmd *cli.Command) error {
 		}
 	}
 
-	fmt.Printf("Found %d environment variables in %s\n", len(envVars), filePath)
+	sort.Strings(newKeys)
+	sort.Strings(conflicts)
+
+	fmt.Printf("Found %d %s in %s\n", foundCount, what, filePath)
+	if skipped := foundCount - len(envVars); skipped > 0 {
+		fmt.Printf("Skipped by --only/--exclude: %d\n", skipped)
+	}
 	if len(newKeys) > 0 {
 		fmt.Printf("New keys to import: %d\n", len(newKeys))
+		for _, key := range newKeys {
+			fmt.Printf("  + %s\n", key)
+		}
 	}
 	if len(conflicts) > 0 {
 		fmt.Printf("Existing keys that will be updated: %d\n", len(conflicts))
@@ -796,6 +1912,11 @@ func ImportCommand(_ context.Context, cmd *cli.Command) error {
 		}
 	}
 
+	if cmd.Bool("dry-run") {
+		fmt.Println("Dry run: no changes were written.")
+		return nil
+	}
+
 	if len(conflicts) > 0 {
 		fmt.Print("Continue with import? This will overwrite existing keys. (y/n): ")
 		reader := bufio.NewReader(os.Stdin)
@@ -811,13 +1932,22 @@ func ImportCommand(_ context.Context, cmd *cli.Command) error {
 	}
 
 	importedCount := 0
-	for envKey, envValue := range envVars {
-		fullKeyPath := basePath + "/" + envKey
-		storage.SetSecret(secrets, fullKeyPath, envValue)
-		importedCount++
-	}
-
-	if err := storage.SaveSecrets(secrets, cfg.PublicKeyPath, b); err != nil {
+	err = store.Update(func(secrets storage.SecretStore) error {
+		importedCount = 0
+		now := store.Clock().Now()
+		for envKey, envValue := range envVars {
+			fullKeyPath := basePath + "/" + keyNames[envKey]
+			storage.SetSecret(secrets, fullKeyPath, envValue, now)
+			if comment, ok := comments[envKey]; ok {
+				entry := secrets[fullKeyPath]
+				entry.Description = comment
+				secrets[fullKeyPath] = entry
+			}
+			importedCount++
+		}
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 
@@ -825,6 +1955,114 @@ func ImportCommand(_ context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// selectEnvVars keeps the variables whose names match one of the comma
+// separated only patterns (all of them if only is empty) and none of the
+// exclude patterns. Patterns are names or globs such as AWS_*.
+func selectEnvVars(envVars map[string]string, only, exclude string) (map[string]string, error) {
+	onlyPatterns, err := parseNamePatterns("--only", only)
+	if err != nil {
+		return nil, err
+	}
+	excludePatterns, err := parseNamePatterns("--exclude", exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]string, len(envVars))
+	for name, value := range envVars {
+		if len(onlyPatterns) > 0 && !matchesAnyPattern(name, onlyPatterns) {
+			continue
+		}
+		if matchesAnyPattern(name, excludePatterns) {
+			continue
+		}
+		selected[name] = value
+	}
+	return selected, nil
+}
+
+// parseNamePatterns splits a comma list of names or globs, rejecting
+// malformed globs
+func parseNamePatterns(flagName, list string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", flagName, pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// matchesAnyPattern reports whether name matches one of the glob patterns
+func matchesAnyPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validateVaultKeys checks that every Vault secret makes a valid key path
+// under basePath, in sorted order so the error is stable
+func validateVaultKeys(basePath string, secrets map[string]string) error {
+	keys := make([]string, 0, len(secrets))
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := config.ValidateKeyPath(strings.TrimSuffix(basePath, "/") + "/" + key); err != nil {
+			return fmt.Errorf("cannot import Vault secret %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// importKeyNames maps each env var name to the key name it is imported as,
+// removing prefix where present. Names that don't start with the prefix (or
+// would become empty) keep their name and are returned sorted so the caller
+// can warn about them.
+func importKeyNames(envVars map[string]string, prefix string) (map[string]string, []string, error) {
+	keyNames := make(map[string]string, len(envVars))
+	importedFrom := make(map[string]string, len(envVars))
+	var unprefixed []string
+
+	for envKey := range envVars {
+		keyName := envKey
+		if prefix != "" {
+			if stripped, ok := strings.CutPrefix(envKey, prefix); ok && stripped != "" {
+				keyName = stripped
+			} else {
+				unprefixed = append(unprefixed, envKey)
+			}
+		}
+		keyNames[envKey] = keyName
+	}
+
+	// Check collisions in sorted order so the error is stable
+	var envKeys []string
+	for envKey := range keyNames {
+		envKeys = append(envKeys, envKey)
+	}
+	sort.Strings(envKeys)
+	for _, envKey := range envKeys {
+		keyName := keyNames[envKey]
+		if other, exists := importedFrom[keyName]; exists {
+			return nil, nil, fmt.Errorf("%s and %s would both be imported as %s", other, envKey, keyName)
+		}
+		importedFrom[keyName] = envKey
+	}
+
+	sort.Strings(unprefixed)
+	return keyNames, unprefixed, nil
+}
+
 // Helper functions
 
 func getProfile(cmd *cli.Command) string {
@@ -1,9 +1,27 @@
 package commands
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"golang.org/x/crypto/ssh"
+
+	"crumb/pkg/backend"
+	"crumb/pkg/config"
+	"crumb/pkg/crypto"
+	"crumb/pkg/storage"
 )
 
 func TestComputeEnvDiff(t *testing.T) {
@@ -123,3 +141,1728 @@ func TestComputeEnvDiff(t *testing.T) {
 		})
 	}
 }
+
+func TestSetCommandJSON(t *testing.T) {
+	flags := setTestFlags()
+
+	t.Run("flattens object from stdin", func(t *testing.T) {
+		profile := setupTestProfile(t, nil)
+
+		input := `{"user": "admin", "db": {"host": "localhost", "port": 5432}}`
+		output, err := runTestCommand(t, SetCommand, flags, []string{"--json", "/prod/creds"}, input)
+		if err != nil {
+			t.Fatalf("SetCommand() unexpected error = %v", err)
+		}
+
+		secrets := profile.loadTestSecrets(t)
+		expected := map[string]string{
+			"/prod/creds/user":    "admin",
+			"/prod/creds/db/host": "localhost",
+			"/prod/creds/db/port": "5432",
+		}
+		for key, value := range expected {
+			if secrets[key].Value != value {
+				t.Errorf("secret %s = %q, want %q", key, secrets[key].Value, value)
+			}
+		}
+		if !strings.Contains(output, "Successfully set key: /prod/creds/db/host") {
+			t.Errorf("expected success message, got: %s", output)
+		}
+	})
+
+	t.Run("confirms overwrites collectively from file", func(t *testing.T) {
+		profile := setupTestProfile(t, map[string]string{"/prod/creds/user": "old"})
+
+		jsonPath := filepath.Join(profile.Home, "creds.json")
+		if err := os.WriteFile(jsonPath, []byte(`{"user": "new", "token": "abc"}`), 0600); err != nil {
+			t.Fatalf("Failed to write JSON file: %v", err)
+		}
+
+		output, err := runTestCommand(t, SetCommand, flags, []string{"--json", "--file", jsonPath, "/prod/creds"}, "y\n")
+		if err != nil {
+			t.Fatalf("SetCommand() unexpected error = %v", err)
+		}
+		if !strings.Contains(output, "Existing keys that will be updated: 1") {
+			t.Errorf("expected conflict summary, got: %s", output)
+		}
+
+		secrets := profile.loadTestSecrets(t)
+		if secrets["/prod/creds/user"].Value != "new" || secrets["/prod/creds/token"].Value != "abc" {
+			t.Errorf("unexpected secrets after overwrite: %v", secrets)
+		}
+	})
+
+	t.Run("rejects non-object JSON", func(t *testing.T) {
+		setupTestProfile(t, nil)
+
+		_, err := runTestCommand(t, SetCommand, flags, []string{"--json", "/prod/creds"}, `["a", "b"]`)
+		if err == nil || !strings.Contains(err.Error(), "must be an object") {
+			t.Errorf("expected object error, got: %v", err)
+		}
+	})
+
+	t.Run("rejects flags it would ignore", func(t *testing.T) {
+		profile := setupTestProfile(t, nil)
+
+		tests := []struct {
+			args    []string
+			wantErr string
+		}{
+			{[]string{"--json", "--expires", "2026-12-31", "/prod/creds"}, "--expires cannot be used with --json"},
+			{[]string{"--file", "creds.json", "/prod/creds/user", "admin"}, "--file requires --json"},
+		}
+		for _, tt := range tests {
+			_, err := runTestCommand(t, SetCommand, flags, tt.args, `{"user": "admin"}`)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SetCommand(%q) error = %v, want %q", tt.args, err, tt.wantErr)
+			}
+		}
+		if secrets := profile.loadTestSecrets(t); len(secrets) != 0 {
+			t.Errorf("rejected sets stored %v", secrets)
+		}
+	})
+}
+
+func TestSetCommandExistenceFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   map[string]string
+		args       []string
+		wantValue  string
+		wantOutput string
+	}{
+		{
+			name:       "if-not-exists creates missing key",
+			args:       []string{"--if-not-exists", "/app/key", "new"},
+			wantValue:  "new",
+			wantOutput: "Successfully set key: /app/key",
+		},
+		{
+			name:       "if-not-exists leaves existing key",
+			existing:   map[string]string{"/app/key": "old"},
+			args:       []string{"--if-not-exists", "/app/key", "new"},
+			wantValue:  "old",
+			wantOutput: "already exists, leaving it unchanged",
+		},
+		{
+			name:       "only-if-exists updates without prompting",
+			existing:   map[string]string{"/app/key": "old"},
+			args:       []string{"--only-if-exists", "/app/key", "new"},
+			wantValue:  "new",
+			wantOutput: "Successfully set key: /app/key",
+		},
+		{
+			name:       "only-if-exists skips missing key",
+			args:       []string{"--only-if-exists", "/app/key", "new"},
+			wantValue:  "",
+			wantOutput: "does not exist, nothing to update",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := setupTestProfile(t, tt.existing)
+
+			// No stdin: any overwrite prompt would read EOF and cancel
+			output, err := runTestCommand(t, SetCommand, setTestFlags(), tt.args, "")
+			if err != nil {
+				t.Fatalf("SetCommand() unexpected error = %v", err)
+			}
+			if !strings.Contains(output, tt.wantOutput) {
+				t.Errorf("expected output to contain %q, got: %s", tt.wantOutput, output)
+			}
+			if got := profile.loadTestSecrets(t)["/app/key"].Value; got != tt.wantValue {
+				t.Errorf("value = %q, want %q", got, tt.wantValue)
+			}
+		})
+	}
+
+	t.Run("flags are mutually exclusive", func(t *testing.T) {
+		setupTestProfile(t, nil)
+
+		_, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"--if-not-exists", "--only-if-exists", "/app/key", "v"}, "")
+		if err == nil || !strings.Contains(err.Error(), "cannot be used together") {
+			t.Errorf("expected mutual exclusion error, got: %v", err)
+		}
+	})
+}
+
+func TestSetCommandFromEnv(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/token": "old"})
+	t.Setenv("CRUMB_TEST_TOKEN", "from-the-env")
+	t.Setenv("CRUMB_TEST_EMPTY", "")
+
+	output, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"--from-env", "CRUMB_TEST_TOKEN", "/app/new-token"}, "")
+	if err != nil {
+		t.Fatalf("SetCommand() unexpected error = %v", err)
+	}
+	if strings.Contains(output, "from-the-env") {
+		t.Errorf("output = %q, the value must not be printed", output)
+	}
+	if got := profile.loadTestSecrets(t)["/app/new-token"].Value; got != "from-the-env" {
+		t.Errorf("stored value = %q, want %q", got, "from-the-env")
+	}
+
+	// Overwriting still asks first
+	if _, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"--from-env", "CRUMB_TEST_TOKEN", "/app/token"}, "n\n"); err != nil {
+		t.Fatalf("SetCommand() unexpected error = %v", err)
+	}
+	if got := profile.loadTestSecrets(t)["/app/token"].Value; got != "old" {
+		t.Errorf("declined overwrite changed the value to %q", got)
+	}
+
+	_, err = runTestCommand(t, SetCommand, setTestFlags(), []string{"--from-env", "CRUMB_TEST_MISSING", "/app/missing"}, "")
+	if err == nil || err.Error() != "environment variable CRUMB_TEST_MISSING is not set" {
+		t.Errorf("expected an unset variable error, got: %v", err)
+	}
+	_, err = runTestCommand(t, SetCommand, setTestFlags(), []string{"--from-env", "CRUMB_TEST_EMPTY", "/app/empty"}, "")
+	if err == nil || !strings.Contains(err.Error(), "pass --allow-empty") {
+		t.Errorf("expected an empty variable error, got: %v", err)
+	}
+	if _, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"--from-env", "CRUMB_TEST_EMPTY", "--allow-empty", "/app/empty"}, ""); err != nil {
+		t.Fatalf("SetCommand() with --allow-empty unexpected error = %v", err)
+	}
+	if entry, ok := profile.loadTestSecrets(t)["/app/empty"]; !ok || entry.Value != "" {
+		t.Errorf("expected /app/empty to be stored empty, got %+v (exists: %v)", entry, ok)
+	}
+
+	if _, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"--from-env", "CRUMB_TEST_TOKEN", "not-a-path"}, ""); err == nil {
+		t.Error("expected an invalid key path to be rejected")
+	}
+	if _, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"--from-env", "CRUMB_TEST_TOKEN", "/app/x", "value"}, ""); err == nil {
+		t.Error("expected --from-env with a value argument to be rejected")
+	}
+}
+
+func TestSetCommandGenerate(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/existing": "keep-me"})
+
+	output, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"--generate", "/app/session-key"}, "")
+	if err != nil {
+		t.Fatalf("SetCommand() unexpected error = %v", err)
+	}
+	stored := profile.loadTestSecrets(t)["/app/session-key"].Value
+	if output != stored+"\n" {
+		t.Errorf("output = %q, want the stored value %q printed once", output, stored)
+	}
+	if !regexp.MustCompile(`^[A-Za-z0-9]{32}$`).MatchString(stored) {
+		t.Errorf("generated value = %q, want 32 alphanumeric characters", stored)
+	}
+
+	// Running it again is a no-op, so provisioning scripts can repeat it
+	output, err = runTestCommand(t, SetCommand, setTestFlags(), []string{"--generate", "/app/session-key"}, "")
+	if err != nil {
+		t.Fatalf("SetCommand() unexpected error = %v", err)
+	}
+	if output != "" {
+		t.Errorf("output = %q, want nothing for an existing key", output)
+	}
+	if got := profile.loadTestSecrets(t)["/app/session-key"].Value; got != stored {
+		t.Errorf("existing value changed from %q to %q", stored, got)
+	}
+	if _, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"--generate", "/app/existing"}, ""); err != nil {
+		t.Fatalf("SetCommand() unexpected error = %v", err)
+	}
+	if got := profile.loadTestSecrets(t)["/app/existing"].Value; got != "keep-me" {
+		t.Errorf("existing value changed to %q", got)
+	}
+
+	output, err = runTestCommand(t, SetCommand, setTestFlags(), []string{"--generate", "--length", "16", "--charset", "hex", "/app/hex"}, "")
+	if err != nil {
+		t.Fatalf("SetCommand() unexpected error = %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{16}\n$`).MatchString(output) {
+		t.Errorf("output = %q, want 16 hex characters", output)
+	}
+
+	errorCases := [][]string{
+		{"--generate", "/app/x", "value"},
+		{"--generate", "--only-if-exists", "/app/x"},
+		{"--generate", "--charset", "emoji", "/app/x"},
+		{"--generate", "--length", "0", "/app/x"},
+		{"--length", "16", "/app/x", "value"},
+	}
+	for _, args := range errorCases {
+		if _, err := runTestCommand(t, SetCommand, setTestFlags(), args, ""); err == nil {
+			t.Errorf("SetCommand(%q) expected an error", args)
+		}
+	}
+	if _, ok := profile.loadTestSecrets(t)["/app/x"]; ok {
+		t.Error("a rejected --generate stored /app/x")
+	}
+}
+
+func TestSetCommandConcurrentWithGenerate(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/existing": "keep-me"})
+
+	// Plain sets of different keys race several --generate runs of the same
+	// key, each in a process of its own; every set must survive and only one
+	// run may create the key
+	var runs [][]string
+	for i := 0; i < 10; i++ {
+		runs = append(runs, []string{fmt.Sprintf("/app/key-%d", i), fmt.Sprintf("value-%d", i)})
+		runs = append(runs, []string{"--generate", "/app/generated"})
+	}
+	output := strings.Join(runTestProcesses(t, "set", runs), "")
+
+	secrets := profile.loadTestSecrets(t)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("/app/key-%d", i)
+		if got := secrets[key].Value; got != fmt.Sprintf("value-%d", i) {
+			t.Errorf("%s = %q, want the value set concurrently", key, got)
+		}
+	}
+	if secrets["/app/existing"].Value != "keep-me" {
+		t.Errorf("/app/existing = %q, want it untouched", secrets["/app/existing"].Value)
+	}
+	generated := regexp.MustCompile(`(?m)^[A-Za-z0-9]{32}$`).FindAllString(output, -1)
+	if len(generated) != 1 || secrets["/app/generated"].Value != generated[0] {
+		t.Errorf("generated values printed = %q, want exactly the stored %q", generated, secrets["/app/generated"].Value)
+	}
+}
+
+func TestSetCommandSwappedArgs(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{})
+
+	_, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"hunter2", "/app/password"}, "")
+	if err == nil {
+		t.Fatal("SetCommand() expected error for swapped arguments")
+	}
+	if !strings.Contains(err.Error(), "look swapped") || !strings.Contains(err.Error(), "crumb set /app/password <value>") {
+		t.Errorf("error should suggest the corrected order, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("error should not echo the value, got: %v", err)
+	}
+	if secrets := profile.loadTestSecrets(t); len(secrets) != 0 {
+		t.Errorf("nothing should be stored, got: %v", secrets)
+	}
+
+	_, err = runTestCommand(t, SetCommand, setTestFlags(), []string{"app/password", "value"}, "")
+	if err == nil || err.Error() != "key path must start with '/'" {
+		t.Errorf("a bad key path with a plain value should keep the usual error, got: %v", err)
+	}
+}
+
+func TestGetCommandAllUnder(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/db/password": "hunter2",
+		"/app/api-key":     "secret123",
+		"/application/key": "other",
+	})
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "masked by default",
+			args:     []string{"--all-under", "/app"},
+			expected: "/app/api-key=****\n/app/db/password=****\n",
+		},
+		{
+			name:     "trailing slash implies all-under",
+			args:     []string{"/app/"},
+			expected: "/app/api-key=****\n/app/db/password=****\n",
+		},
+		{
+			name:     "show with force reveals values",
+			args:     []string{"--show", "--force", "/app/"},
+			expected: "/app/api-key=secret123\n/app/db/password=hunter2\n",
+		},
+		{
+			name:     "empty prefix",
+			args:     []string{"/missing/"},
+			expected: "No secrets found under: /missing/\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runTestCommand(t, GetCommand, getTestFlags(), tt.args, "")
+			if err != nil {
+				t.Fatalf("GetCommand() unexpected error = %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("output = %q, want %q", output, tt.expected)
+			}
+		})
+	}
+
+	t.Run("show refuses when stdout is not a terminal", func(t *testing.T) {
+		output, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--show", "/app/"}, "")
+		if err == nil || !strings.Contains(err.Error(), "stdout is not a terminal") {
+			t.Errorf("expected TTY safety error, got: %v", err)
+		}
+		if strings.Contains(output, "hunter2") {
+			t.Errorf("values must not be printed, got: %s", output)
+		}
+	})
+}
+
+func TestGetCommandFormat(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/db-password": "pa ss\"word",
+		"/app/api-key":     "secret123",
+	})
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "dotenv",
+			args:     []string{"--format", "dotenv", "/app/api-key"},
+			expected: "API_KEY=secret123\n",
+		},
+		{
+			name:     "dotenv quotes values that need it",
+			args:     []string{"--format", "dotenv", "/app/db-password"},
+			expected: "DB_PASSWORD=\"pa ss\\\"word\"\n",
+		},
+		{
+			name:     "json",
+			args:     []string{"--format", "json", "/app/db-password"},
+			expected: "{\"version\":1,\"vars\":{\"DB_PASSWORD\":\"pa ss\\\"word\"}}\n",
+		},
+		{
+			name:     "shell",
+			args:     []string{"--format", "shell", "--shell", "fish", "/app/api-key"},
+			expected: "set -x -g API_KEY secret123\n",
+		},
+		{
+			name:     "mask applies to dotenv",
+			args:     []string{"--format", "dotenv", "--mask", "/app/api-key"},
+			expected: "API_KEY=\"****\"\n",
+		},
+		{
+			name:     "mask applies to json",
+			args:     []string{"--format", "json", "--mask", "/app/api-key"},
+			expected: "{\"version\":1,\"vars\":{\"API_KEY\":\"****\"}}\n",
+		},
+		{
+			name:     "export is not masked",
+			args:     []string{"--export", "--mask", "/app/api-key"},
+			expected: "export API_KEY=secret123\n",
+		},
+		{
+			name:    "unknown format",
+			args:    []string{"--format", "xml", "/app/api-key"},
+			wantErr: "unsupported format: xml (supported: shell, dotenv, json)",
+		},
+		{
+			name:    "export conflicts with another format",
+			args:    []string{"--export", "--format", "json", "/app/api-key"},
+			wantErr: "--export cannot be combined with --format json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runTestCommand(t, GetCommand, getTestFlags(), tt.args, "")
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("GetCommand() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCommand() unexpected error = %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("output = %q, want %q", output, tt.expected)
+			}
+		})
+	}
+}
+
+func TestImportCommandDryRun(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/dev/API_KEY": "old"})
+
+	envPath := filepath.Join(profile.Home, "app.env")
+	if err := os.WriteFile(envPath, []byte("DB_HOST=localhost\nAPI_KEY=new\nCACHE_URL=redis://\n"), 0600); err != nil {
+		t.Fatalf("Failed to write .env file: %v", err)
+	}
+
+	output, err := runTestCommand(t, ImportCommand, importTestFlags(), []string{"--file", envPath, "--path", "/dev", "--dry-run"}, "")
+	if err != nil {
+		t.Fatalf("ImportCommand() unexpected error = %v", err)
+	}
+
+	expected := "Found 3 environment variables in " + envPath + "\n" +
+		"New keys to import: 2\n" +
+		"  + /dev/CACHE_URL\n" +
+		"  + /dev/DB_HOST\n" +
+		"Existing keys that will be updated: 1\n" +
+		"  - /dev/API_KEY\n" +
+		"Dry run: no changes were written.\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	secrets := profile.loadTestSecrets(t)
+	if len(secrets) != 1 || secrets["/dev/API_KEY"].Value != "old" {
+		t.Errorf("dry run must not change the store, got: %v", secrets)
+	}
+}
+
+func TestImportCommandComments(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{})
+
+	envPath := filepath.Join(profile.Home, "app.env")
+	content := "# Stripe secret key\nSTRIPE_KEY=sk\n\n# Primary database\n# (read-write)\nDATABASE_URL=postgres://db\nPORT=5432\n"
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write .env file: %v", err)
+	}
+
+	if _, err := runTestCommand(t, ImportCommand, importTestFlags(), []string{"--file", envPath, "--path", "/app", "--import-comments"}, ""); err != nil {
+		t.Fatalf("ImportCommand() unexpected error = %v", err)
+	}
+
+	secrets := profile.loadTestSecrets(t)
+	want := map[string]string{
+		"/app/STRIPE_KEY":   "Stripe secret key",
+		"/app/DATABASE_URL": "Primary database\n(read-write)",
+		"/app/PORT":         "",
+	}
+	for key, description := range want {
+		if secrets[key].Description != description {
+			t.Errorf("%s description = %q, want %q", key, secrets[key].Description, description)
+		}
+	}
+
+	infoFlags := []cli.Flag{&cli.BoolFlag{Name: "interactive"}}
+	output, err := runTestCommand(t, InfoCommand, infoFlags, []string{"/app/DATABASE_URL"}, "")
+	if err != nil {
+		t.Fatalf("InfoCommand() unexpected error = %v", err)
+	}
+	if !strings.HasSuffix(output, "Description:\n  Primary database\n  (read-write)\n") {
+		t.Errorf("info output = %q, want the imported description", output)
+	}
+
+	// Re-importing without the flag keeps the descriptions already stored
+	if _, err := runTestCommand(t, ImportCommand, importTestFlags(), []string{"--file", envPath, "--path", "/app"}, "y\n"); err != nil {
+		t.Fatalf("ImportCommand() unexpected error = %v", err)
+	}
+	if secrets := profile.loadTestSecrets(t); secrets["/app/STRIPE_KEY"].Description != "Stripe secret key" {
+		t.Errorf("re-import dropped the description, got %q", secrets["/app/STRIPE_KEY"].Description)
+	}
+
+	vaultPath := filepath.Join(profile.Home, "vault.json")
+	if err := os.WriteFile(vaultPath, []byte(`{}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = runTestCommand(t, ImportCommand, importTestFlags(), []string{"--file", vaultPath, "--path", "/app", "--format", "vault", "--import-comments"}, "")
+	if err == nil || err.Error() != "--import-comments only applies to --format env" {
+		t.Errorf("expected --import-comments to be rejected for vault, got: %v", err)
+	}
+}
+
+func TestImportCommandVault(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/prod/myapp/db/password": "old"})
+
+	vaultPath := filepath.Join(profile.Home, "vault.json")
+	content := `{
+  "myapp/db": {"data": {"data": {"password": "new", "port": 5432}, "metadata": {"version": 2}}},
+  "myapp/api": {"data": {"key": "abc"}}
+}`
+	if err := os.WriteFile(vaultPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write Vault JSON: %v", err)
+	}
+
+	// The existing password is a conflict, so the import asks before overwriting
+	output, err := runTestCommand(t, ImportCommand, importTestFlags(), []string{"--file", vaultPath, "--path", "/prod", "--format", "vault"}, "y\n")
+	if err != nil {
+		t.Fatalf("ImportCommand() unexpected error = %v", err)
+	}
+	for _, want := range []string{
+		"Found 3 secrets in " + vaultPath,
+		"  + /prod/myapp/api/key\n  + /prod/myapp/db/port\n",
+		"Existing keys that will be updated: 1\n  - /prod/myapp/db/password\n",
+		"Successfully imported 3 secrets",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output = %q, want it to contain %q", output, want)
+		}
+	}
+
+	secrets := profile.loadTestSecrets(t)
+	want := map[string]string{
+		"/prod/myapp/db/password": "new",
+		"/prod/myapp/db/port":     "5432",
+		"/prod/myapp/api/key":     "abc",
+	}
+	for key, value := range want {
+		if secrets[key].Value != value {
+			t.Errorf("%s = %q, want %q", key, secrets[key].Value, value)
+		}
+	}
+
+	_, err = runTestCommand(t, ImportCommand, importTestFlags(), []string{"--file", vaultPath, "--path", "/prod", "--format", "yaml"}, "")
+	if err == nil || !strings.Contains(err.Error(), "unsupported --format value: yaml (supported: env, vault)") {
+		t.Errorf("ImportCommand() error = %v, want unsupported format", err)
+	}
+}
+
+func TestDeleteCommandStdin(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/a":    "1",
+		"/app/b":    "2",
+		"/app/keep": "3",
+	})
+
+	stdin := "/app/a\n\n/app/missing\n/app/b\n/app/a\n"
+	output, err := runTestCommand(t, DeleteCommand, deleteTestFlags(), []string{"--stdin", "--yes"}, stdin)
+	if err != nil {
+		t.Fatalf("DeleteCommand() unexpected error = %v", err)
+	}
+
+	expected := "Keys not found: 1\n" +
+		"  ? /app/missing\n" +
+		"Keys to delete: 2\n" +
+		"  - /app/a\n" +
+		"  - /app/b\n" +
+		"Successfully deleted 2 keys\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	secrets := profile.loadTestSecrets(t)
+	if len(secrets) != 1 || secrets["/app/keep"].Value != "3" {
+		t.Errorf("expected only /app/keep to remain, got: %v", secrets)
+	}
+
+	if _, err := runTestCommand(t, DeleteCommand, deleteTestFlags(), []string{"--stdin", "--yes"}, "/app/keep\nnot-a-path\n"); err == nil {
+		t.Error("expected an error for an invalid key path")
+	}
+	if secrets := profile.loadTestSecrets(t); len(secrets) != 1 {
+		t.Errorf("invalid input must not delete anything, got: %v", secrets)
+	}
+
+	if _, err := runTestCommand(t, DeleteCommand, deleteTestFlags(), []string{"--stdin", "/app/keep"}, ""); err == nil {
+		t.Error("expected a usage error when combining --stdin with a key path")
+	}
+}
+
+func TestImportCommandOnlyExclude(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{})
+
+	envPath := filepath.Join(profile.Home, "dump.env")
+	content := "AWS_ACCESS_KEY_ID=id\nAWS_SECRET_ACCESS_KEY=secret\nDB_HOST=localhost\nPATH=/usr/bin\nHOME=/root\n"
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write .env file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "only glob", args: []string{"--only", "AWS_*"}, want: []string{"/dev/AWS_ACCESS_KEY_ID", "/dev/AWS_SECRET_ACCESS_KEY"}},
+		{name: "only list", args: []string{"--only", "DB_HOST, HOME"}, want: []string{"/dev/DB_HOST", "/dev/HOME"}},
+		{name: "exclude list", args: []string{"--exclude", "PATH,HOME"}, want: []string{"/dev/AWS_ACCESS_KEY_ID", "/dev/AWS_SECRET_ACCESS_KEY", "/dev/DB_HOST"}},
+		{name: "only and exclude", args: []string{"--only", "AWS_*,DB_*", "--exclude", "*SECRET*"}, want: []string{"/dev/AWS_ACCESS_KEY_ID", "/dev/DB_HOST"}},
+	}
+
+	for _, tt := range tests {
+		args := append([]string{"--file", envPath, "--path", "/dev", "--dry-run"}, tt.args...)
+		output, err := runTestCommand(t, ImportCommand, importTestFlags(), args, "")
+		if err != nil {
+			t.Fatalf("%s: unexpected error = %v", tt.name, err)
+		}
+
+		var got []string
+		for _, line := range strings.Split(output, "\n") {
+			if key, ok := strings.CutPrefix(line, "  + "); ok {
+				got = append(got, key)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: imported %v, want %v", tt.name, got, tt.want)
+		}
+		if skipped := 5 - len(tt.want); !strings.Contains(output, fmt.Sprintf("Skipped by --only/--exclude: %d\n", skipped)) {
+			t.Errorf("%s: expected %d skipped, got:\n%s", tt.name, skipped, output)
+		}
+	}
+
+	if _, err := runTestCommand(t, ImportCommand, importTestFlags(), []string{"--file", envPath, "--path", "/dev", "--only", "AWS_["}, ""); err == nil {
+		t.Error("ImportCommand() expected error for a malformed glob")
+	}
+}
+
+func TestImportKeyNames(t *testing.T) {
+	envVars := map[string]string{
+		"MYAPP_DB_HOST": "localhost",
+		"MYAPP_DB_PORT": "5432",
+		"OTHER_VAR":     "x",
+		"MYAPP_":        "empty after strip",
+	}
+
+	keyNames, unprefixed, err := importKeyNames(envVars, "MYAPP_")
+	if err != nil {
+		t.Fatalf("importKeyNames() unexpected error = %v", err)
+	}
+	expected := map[string]string{
+		"MYAPP_DB_HOST": "DB_HOST",
+		"MYAPP_DB_PORT": "DB_PORT",
+		"OTHER_VAR":     "OTHER_VAR",
+		"MYAPP_":        "MYAPP_",
+	}
+	for envKey, want := range expected {
+		if keyNames[envKey] != want {
+			t.Errorf("keyNames[%s] = %q, want %q", envKey, keyNames[envKey], want)
+		}
+	}
+	if want := []string{"MYAPP_", "OTHER_VAR"}; strings.Join(unprefixed, ",") != strings.Join(want, ",") {
+		t.Errorf("unprefixed = %v, want %v", unprefixed, want)
+	}
+
+	_, _, err = importKeyNames(map[string]string{"MYAPP_DB_HOST": "a", "DB_HOST": "b"}, "MYAPP_")
+	if err == nil || err.Error() != "DB_HOST and MYAPP_DB_HOST would both be imported as DB_HOST" {
+		t.Errorf("expected collision error, got: %v", err)
+	}
+}
+
+func TestImportCommandPrefixStrip(t *testing.T) {
+	profile := setupTestProfile(t, nil)
+
+	envPath := filepath.Join(profile.Home, "app.env")
+	if err := os.WriteFile(envPath, []byte("MYAPP_DB_HOST=localhost\nDEBUG=true\n"), 0600); err != nil {
+		t.Fatalf("Failed to write .env file: %v", err)
+	}
+
+	_, err := runTestCommand(t, ImportCommand, importTestFlags(), []string{"--file", envPath, "--path", "/dev", "--prefix-strip", "MYAPP_"}, "")
+	if err != nil {
+		t.Fatalf("ImportCommand() unexpected error = %v", err)
+	}
+
+	secrets := profile.loadTestSecrets(t)
+	if secrets["/dev/DB_HOST"].Value != "localhost" {
+		t.Errorf("expected /dev/DB_HOST=localhost, got: %v", secrets)
+	}
+	if secrets["/dev/DEBUG"].Value != "true" {
+		t.Errorf("expected non-matching DEBUG to be imported unchanged, got: %v", secrets)
+	}
+}
+
+func TestRecipientsListCommand(t *testing.T) {
+	setupTestProfile(t, map[string]string{"/app/key": "value"})
+
+	output, err := runTestCommand(t, RecipientsListCommand, nil, nil, "")
+	if err != nil {
+		t.Fatalf("RecipientsListCommand() unexpected error = %v", err)
+	}
+
+	if !strings.Contains(output, "ssh-ed25519") || !strings.Contains(output, "profile public key") {
+		t.Errorf("expected the profile's ssh-ed25519 recipient, got:\n%s", output)
+	}
+	if strings.Contains(output, "value") {
+		t.Errorf("recipients output must not contain secret values:\n%s", output)
+	}
+}
+
+func TestKeysCommand(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{})
+
+	data, err := os.ReadFile(profile.Config.PublicKeyPath)
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		t.Fatalf("Failed to parse public key: %v", err)
+	}
+	fingerprint := ssh.FingerprintSHA256(pubKey)
+
+	output, err := runTestCommand(t, KeysCommand, []cli.Flag{&cli.BoolFlag{Name: "json"}}, nil, "")
+	if err != nil {
+		t.Fatalf("KeysCommand() unexpected error = %v", err)
+	}
+	want := fingerprint + " ssh-ed25519 " + profile.Config.PublicKeyPath + "\n"
+	if output != want {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+
+	output, err = runTestCommand(t, KeysCommand, []cli.Flag{&cli.BoolFlag{Name: "json"}}, []string{"--json"}, "")
+	if err != nil {
+		t.Fatalf("KeysCommand() unexpected error = %v", err)
+	}
+	var envelope keysJSON
+	if err := json.Unmarshal([]byte(output), &envelope); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", output, err)
+	}
+	if envelope.Version != jsonSchemaVersion {
+		t.Errorf("version = %d, want %d", envelope.Version, jsonSchemaVersion)
+	}
+	keys := envelope.Keys
+	if len(keys) != 1 || keys[0].Fingerprint != fingerprint || keys[0].Type != "ssh-ed25519" || keys[0].Path != profile.Config.PublicKeyPath {
+		t.Errorf("keys = %+v, want the profile's ssh-ed25519 key %s", keys, fingerprint)
+	}
+
+	// The storage file isn't needed, only the key
+	if err := os.Remove(filepath.Join(profile.Home, ".config", "crumb", "secrets")); err != nil {
+		t.Fatalf("Failed to remove storage: %v", err)
+	}
+	if _, err := runTestCommand(t, KeysCommand, []cli.Flag{&cli.BoolFlag{Name: "json"}}, nil, ""); err != nil {
+		t.Errorf("KeysCommand() without storage unexpected error = %v", err)
+	}
+}
+
+func TestLoadSecretsMismatchedKey(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "value"})
+
+	// Point the profile at a private key the store was not encrypted to
+	_, otherPrivPath := writeTestKeyPair(t, profile.Home, "other_key")
+	profile.Config.PrivateKeyPath = otherPrivPath
+	cfg := &config.Config{Profiles: map[string]config.ProfileConfig{"default": *profile.Config}}
+	if err := config.SaveConfig(cfg); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	_, err := runTestCommand(t, ListCommand, []cli.Flag{&cli.BoolFlag{Name: "long"}}, nil, "")
+	if err == nil {
+		t.Fatal("expected error for mismatched private key")
+	}
+
+	for _, want := range []string{otherPrivPath, profile.Backend.Location(), "encrypted to a different key", "private_key_path"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q, got: %v", want, err)
+		}
+	}
+	if !errors.Is(err, crypto.ErrKeyMismatch) {
+		t.Errorf("error should wrap crypto.ErrKeyMismatch, got: %v", err)
+	}
+}
+
+func TestRedactPattern(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/region": "us-east-1",
+		"/app/token":  "sk_live_abc",
+	})
+
+	tests := []struct {
+		name    string
+		action  cli.ActionFunc
+		flags   []cli.Flag
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "list with values",
+			action: ListCommand,
+			flags:  listTestFlags(),
+			args:   []string{"--with-values", "--show", "--force", "--redact-pattern", "^sk_", "/app"},
+			want:   "/app/region = us-east-1\n/app/token  = ****\n",
+		},
+		{
+			name:   "list json",
+			action: ListCommand,
+			flags:  listTestFlags(),
+			args:   []string{"--format", "json", "--with-values", "--show", "--force", "--redact-pattern", "^sk_", "/app/token"},
+			want:   "\"value\": \"****\"",
+		},
+		{
+			name:   "get all under",
+			action: GetCommand,
+			flags:  getTestFlags(),
+			args:   []string{"--show", "--force", "--redact-pattern", "live", "/app/"},
+			want:   "/app/region=us-east-1\n/app/token=****\n",
+		},
+		{
+			name:   "get several keys",
+			action: GetCommand,
+			flags:  getTestFlags(),
+			args:   []string{"--show", "--force", "--redact-pattern", "east", "/app/region", "/app/token"},
+			want:   "/app/region = ****\n/app/token  = sk_live_abc\n",
+		},
+		{
+			name:    "list without show",
+			action:  ListCommand,
+			flags:   listTestFlags(),
+			args:    []string{"--with-values", "--redact-pattern", "^sk_", "/app"},
+			wantErr: "--redact-pattern requires --show",
+		},
+		{
+			name:    "get without show",
+			action:  GetCommand,
+			flags:   getTestFlags(),
+			args:    []string{"--redact-pattern", "^sk_", "/app/"},
+			wantErr: "--redact-pattern requires --show",
+		},
+		{
+			name:    "get without labels",
+			action:  GetCommand,
+			flags:   getTestFlags(),
+			args:    []string{"--no-labels", "--show", "--redact-pattern", "^sk_", "/app/region", "/app/token"},
+			wantErr: "--redact-pattern requires --show",
+		},
+		{
+			name:    "invalid pattern",
+			action:  ListCommand,
+			flags:   listTestFlags(),
+			args:    []string{"--with-values", "--show", "--force", "--redact-pattern", "[", "/app"},
+			wantErr: "invalid --redact-pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runTestCommand(t, tt.action, tt.flags, tt.args, "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error = %v", err)
+			}
+			if !strings.Contains(output, tt.want) {
+				t.Errorf("output = %q, want it to contain %q", output, tt.want)
+			}
+		})
+	}
+}
+
+func TestListCommandModifiedSince(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/fresh": "a", "/other/fresh": "b"})
+
+	secrets := profile.loadTestSecrets(t)
+	secrets["/app/stale"] = storage.SecretEntry{Value: "c", Updated: "2020-01-01T00:00:00Z"}
+	secrets["/app/legacy"] = storage.SecretEntry{Value: "d"}
+	if err := storage.SaveSecrets(secrets, profile.Config.PublicKeyPath, profile.Backend); err != nil {
+		t.Fatalf("Failed to save secrets: %v", err)
+	}
+
+	flags := listTestFlags()
+
+	output, err := runTestCommand(t, ListCommand, flags, []string{"--modified-since", "7d", "/app"}, "")
+	if err != nil {
+		t.Fatalf("ListCommand() unexpected error = %v", err)
+	}
+	if output != "/app/fresh\n" {
+		t.Errorf("expected only /app/fresh, got:\n%s", output)
+	}
+
+	output, err = runTestCommand(t, ListCommand, flags, []string{"--modified-since", "7d", "--include-undated", "/app"}, "")
+	if err != nil {
+		t.Fatalf("ListCommand() unexpected error = %v", err)
+	}
+	if output != "/app/fresh\n/app/legacy\n" {
+		t.Errorf("expected /app/fresh and /app/legacy, got:\n%s", output)
+	}
+
+	if _, err := runTestCommand(t, ListCommand, flags, []string{"--include-undated"}, ""); err == nil {
+		t.Error("expected --include-undated without --modified-since to fail")
+	}
+}
+
+func TestListCommandEmptyOnly(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/token":  "",
+		"/app/url":    "https://example.com",
+		"/app/blank":  "   ",
+		"/other/name": "",
+	})
+
+	output, err := runTestCommand(t, ListCommand, listTestFlags(), []string{"--empty-only", "/app"}, "")
+	if err != nil {
+		t.Fatalf("ListCommand() unexpected error = %v", err)
+	}
+	if output != "/app/blank\n/app/token\n" {
+		t.Errorf("expected /app/blank and /app/token, got:\n%s", output)
+	}
+
+	output, err = runTestCommand(t, ListCommand, listTestFlags(), []string{"--empty-only", "/nothing"}, "")
+	if err != nil {
+		t.Fatalf("ListCommand() unexpected error = %v", err)
+	}
+	if output != "No secrets with empty values found\n" {
+		t.Errorf("unexpected output for no matches: %q", output)
+	}
+}
+
+func TestListCommandGrep(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/stripe/key":      "sk",
+		"/app/stripe/webhook":  "wh",
+		"/app/db/password":     "pw",
+		"/billing/stripe/key":  "sk2",
+		"/app/payments/stripe": "x",
+	})
+
+	output, err := runTestCommand(t, ListCommand, listTestFlags(), []string{"--grep", "stripe", "/app"}, "")
+	if err != nil {
+		t.Fatalf("ListCommand() unexpected error = %v", err)
+	}
+	if output != "/app/payments/stripe\n/app/stripe/key\n/app/stripe/webhook\n" {
+		t.Errorf("unexpected --grep output:\n%s", output)
+	}
+
+	output, err = runTestCommand(t, ListCommand, listTestFlags(), []string{"--grep", "stripe/.*key$", "--regex"}, "")
+	if err != nil {
+		t.Fatalf("ListCommand() unexpected error = %v", err)
+	}
+	if output != "/app/stripe/key\n/billing/stripe/key\n" {
+		t.Errorf("unexpected --regex output:\n%s", output)
+	}
+
+	// Without --regex the pattern is plain text
+	output, err = runTestCommand(t, ListCommand, listTestFlags(), []string{"--grep", "stripe/.*key$", "/app"}, "")
+	if err != nil {
+		t.Fatalf("ListCommand() unexpected error = %v", err)
+	}
+	if output != "No secrets found matching: stripe/.*key$\n" {
+		t.Errorf("unexpected output for no matches: %q", output)
+	}
+
+	if _, err := runTestCommand(t, ListCommand, listTestFlags(), []string{"--regex"}, ""); err == nil || err.Error() != "--regex requires --grep" {
+		t.Errorf("expected --regex to require --grep, got: %v", err)
+	}
+	if _, err := runTestCommand(t, ListCommand, listTestFlags(), []string{"--grep", "(", "--regex"}, ""); err == nil || !strings.HasPrefix(err.Error(), "invalid --grep pattern") {
+		t.Errorf("expected an invalid pattern error, got: %v", err)
+	}
+}
+
+func TestEnsureStorageKeepsExistingSecrets(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "value"})
+
+	created, err := ensureStorage(profile.Config.PublicKeyPath, profile.Backend, false)
+	if err != nil {
+		t.Fatalf("ensureStorage() unexpected error = %v", err)
+	}
+	if created {
+		t.Error("ensureStorage() recreated an existing store")
+	}
+	if secrets := profile.loadTestSecrets(t); secrets["/app/key"].Value != "value" {
+		t.Errorf("re-setup lost existing secrets, got: %v", secrets)
+	}
+
+	created, err = ensureStorage(profile.Config.PublicKeyPath, profile.Backend, true)
+	if err != nil {
+		t.Fatalf("ensureStorage() with force unexpected error = %v", err)
+	}
+	if !created {
+		t.Error("ensureStorage() with force did not recreate the store")
+	}
+	if secrets := profile.loadTestSecrets(t); len(secrets) != 0 {
+		t.Errorf("expected an empty store after --force, got: %v", secrets)
+	}
+
+	fresh := &backend.FileBackend{Path: filepath.Join(profile.Home, "fresh-secrets")}
+	created, err = ensureStorage(profile.Config.PublicKeyPath, fresh, false)
+	if err != nil {
+		t.Fatalf("ensureStorage() for a new store unexpected error = %v", err)
+	}
+	if !created {
+		t.Error("ensureStorage() did not create a missing store")
+	}
+}
+
+func TestResolveStoreFileStore(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "value"})
+
+	cmd := &cli.Command{Flags: []cli.Flag{&cli.StringFlag{Name: "profile", Value: "default"}}}
+	store, err := resolveStore(t.Context(), cmd)
+	if err != nil {
+		t.Fatalf("resolveStore() unexpected error = %v", err)
+	}
+	if store.Location() != profile.Backend.Location() {
+		t.Errorf("Location() = %q, want %q", store.Location(), profile.Backend.Location())
+	}
+
+	secrets, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error = %v", err)
+	}
+	if secrets["/app/key"].Value != "value" {
+		t.Fatalf("expected /app/key=value, got %v", secrets)
+	}
+
+	storage.SetSecret(secrets, "/app/other", "second", store.Clock().Now())
+	if err := store.Save(secrets); err != nil {
+		t.Fatalf("Save() unexpected error = %v", err)
+	}
+	if got := profile.loadTestSecrets(t)["/app/other"].Value; got != "second" {
+		t.Errorf("saved secret = %q, want %q", got, "second")
+	}
+}
+
+func TestRotateCommands(t *testing.T) {
+	clock := useStoreClock(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	profile := setupTestProfile(t, map[string]string{"/app/key": "value"})
+
+	if _, err := runTestCommand(t, RotateSetCommand, nil, []string{"/app/key", "often"}, ""); err == nil {
+		t.Error("RotateSetCommand() expected error for invalid interval")
+	}
+	if _, err := runTestCommand(t, RotateSetCommand, nil, []string{"/app/missing", "90d"}, ""); err == nil {
+		t.Error("RotateSetCommand() expected error for missing key")
+	}
+
+	if _, err := runTestCommand(t, RotateSetCommand, nil, []string{"/app/key", "90d"}, ""); err != nil {
+		t.Fatalf("RotateSetCommand() unexpected error = %v", err)
+	}
+	secrets := profile.loadTestSecrets(t)
+	if got := secrets["/app/key"]; got.Rotate != "90d" || got.Value != "value" {
+		t.Errorf("after rotate set got %+v", got)
+	}
+
+	output, err := runTestCommand(t, RotateDueCommand, nil, nil, "")
+	if err != nil {
+		t.Fatalf("RotateDueCommand() unexpected error = %v", err)
+	}
+	if output != "No secrets are due for rotation\n" {
+		t.Errorf("freshly set secret should not be due, got:\n%s", output)
+	}
+
+	clock.Advance(91 * 24 * time.Hour)
+	output, err = runTestCommand(t, RotateDueCommand, nil, nil, "")
+	if err != nil {
+		t.Fatalf("RotateDueCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "/app/key") || !strings.Contains(output, "2026-04-01T00:00:00Z") {
+		t.Errorf("secret past its interval should be due on 2026-04-01, got:\n%s", output)
+	}
+
+	if _, err := runTestCommand(t, RotateClearCommand, nil, []string{"/app/key"}, ""); err != nil {
+		t.Fatalf("RotateClearCommand() unexpected error = %v", err)
+	}
+	if got := profile.loadTestSecrets(t)["/app/key"]; got.Rotate != "" {
+		t.Errorf("rotation not cleared: %+v", got)
+	}
+}
+
+func TestListCommandSort(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/b/alpha": "1",
+		"/a/zulu":  "2",
+		"/a/beta":  "3",
+	})
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: nil, want: "/a/beta\n/a/zulu\n/b/alpha\n"},
+		{args: []string{"--reverse"}, want: "/b/alpha\n/a/zulu\n/a/beta\n"},
+		{args: []string{"--sort", "leaf"}, want: "/b/alpha\n/a/beta\n/a/zulu\n"},
+		{args: []string{"--sort", "leaf", "--reverse"}, want: "/a/zulu\n/a/beta\n/b/alpha\n"},
+	}
+
+	for _, tt := range tests {
+		output, err := runTestCommand(t, ListCommand, listTestFlags(), tt.args, "")
+		if err != nil {
+			t.Fatalf("ListCommand(%v) unexpected error = %v", tt.args, err)
+		}
+		if output != tt.want {
+			t.Errorf("ListCommand(%v) = %q, want %q", tt.args, output, tt.want)
+		}
+	}
+
+	if _, err := runTestCommand(t, ListCommand, listTestFlags(), []string{"--sort", "size"}, ""); err == nil {
+		t.Error("ListCommand() expected error for unsupported --sort")
+	}
+}
+
+func TestGetCommandExists(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/user":     "admin",
+		"/app/password": "",
+	})
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{name: "present", args: []string{"/app/user"}, wantCode: 0},
+		{name: "present with empty value", args: []string{"/app/password"}, wantCode: 0},
+		{name: "absent", args: []string{"/app/missing"}, wantCode: 1},
+		{name: "all present", args: []string{"/app/user", "/app/password"}, wantCode: 0},
+		{name: "one absent", args: []string{"/app/user", "/app/missing"}, wantCode: 1},
+	}
+
+	for _, tt := range tests {
+		output, err := runTestCommand(t, GetCommand, getTestFlags(), append([]string{"--exists"}, tt.args...), "")
+		code := 0
+		if err != nil {
+			exitErr, ok := err.(cli.ExitCoder)
+			if !ok {
+				t.Fatalf("%s: unexpected error = %v", tt.name, err)
+			}
+			code = exitErr.ExitCode()
+		}
+		if code != tt.wantCode {
+			t.Errorf("%s: exit code = %d, want %d", tt.name, code, tt.wantCode)
+		}
+		if output != "" {
+			t.Errorf("%s: --exists should print nothing, got %q", tt.name, output)
+		}
+	}
+}
+
+func TestGetCommandMultipleKeys(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/user":          "admin",
+		"/app/database/host": "db.internal",
+		"/app/password":      "hunter2",
+	})
+
+	output, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--no-labels", "/app/password", "/app/user", "/app/database/host"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() unexpected error = %v", err)
+	}
+	if output != "hunter2\nadmin\ndb.internal\n" {
+		t.Errorf("--no-labels should follow argument order, got %q", output)
+	}
+
+	output, err = runTestCommand(t, GetCommand, getTestFlags(), []string{"/app/user", "/app/database/host"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() unexpected error = %v", err)
+	}
+	if output != "/app/user          = ****\n/app/database/host = ****\n" {
+		t.Errorf("labels should be aligned and masked, got %q", output)
+	}
+
+	output, err = runTestCommand(t, GetCommand, getTestFlags(), []string{"--show", "--force", "/app/user", "/app/password"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() unexpected error = %v", err)
+	}
+	if output != "/app/user     = admin\n/app/password = hunter2\n" {
+		t.Errorf("--show should reveal labelled values, got %q", output)
+	}
+
+	if _, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--show", "/app/user", "/app/password"}, ""); err == nil {
+		t.Error("GetCommand() expected error revealing labelled values into a pipe without --force")
+	}
+
+	_, err = runTestCommand(t, GetCommand, getTestFlags(), []string{"--no-labels", "/app/user", "/app/missing"}, "")
+	if err == nil || !strings.Contains(err.Error(), "/app/missing") {
+		t.Errorf("expected error naming the missing key, got %v", err)
+	}
+
+	if _, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--format", "json", "/app/user", "/app/password"}, ""); err == nil {
+		t.Error("GetCommand() expected error for --format with several keys")
+	}
+}
+
+func TestGetCommandMaskStyle(t *testing.T) {
+	setupTestProfile(t, map[string]string{"/app/password": "hunter2"})
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", args: nil, want: "****\n"},
+		{name: "fixed length", args: []string{"--mask-length", "8"}, want: "********\n"},
+		{name: "preserve length", args: []string{"--mask-length", "preserve"}, want: "*******\n"},
+		{name: "custom char", args: []string{"--mask-char", "#", "--mask-length", "preserve"}, want: "#######\n"},
+		{name: "invalid length", args: []string{"--mask-length", "0"}, wantErr: true},
+		{name: "invalid char", args: []string{"--mask-char", "ab"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		args := append(append([]string{"--mask"}, tt.args...), "/app/password")
+		output, err := runTestCommand(t, GetCommand, getTestFlags(), args, "")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error = %v", tt.name, err)
+		}
+		if output != tt.want {
+			t.Errorf("%s: output = %q, want %q", tt.name, output, tt.want)
+		}
+	}
+}
+
+func TestListCommandTrailingSlash(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/prod/api_key":         "a",
+		"/prod/db/password":     "b",
+		"/prod/db/replica/host": "c",
+		"/dev/db/password":      "d",
+	})
+
+	output, err := runTestCommand(t, ListCommand, listTestFlags(), []string{"/prod"}, "")
+	if err != nil {
+		t.Fatalf("ListCommand() unexpected error = %v", err)
+	}
+	if output != "/prod/api_key\n/prod/db/password\n/prod/db/replica/host\n" {
+		t.Errorf("/prod should list the whole subtree, got:\n%s", output)
+	}
+
+	output, err = runTestCommand(t, ListCommand, listTestFlags(), []string{"/prod/"}, "")
+	if err != nil {
+		t.Fatalf("ListCommand() unexpected error = %v", err)
+	}
+	if output != "/prod/api_key\n/prod/db/\n" {
+		t.Errorf("/prod/ should list one level, got:\n%s", output)
+	}
+
+	output, err = runTestCommand(t, ListCommand, listTestFlags(), []string{"/prod/db/"}, "")
+	if err != nil {
+		t.Fatalf("ListCommand() unexpected error = %v", err)
+	}
+	if output != "/prod/db/password\n/prod/db/replica/\n" {
+		t.Errorf("/prod/db/ should list one level, got:\n%s", output)
+	}
+}
+
+func TestListCommandOutputModes(t *testing.T) {
+	useStoreClock(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	setupTestProfile(t, map[string]string{
+		"/app/api_key":  "abc123",
+		"/app/db/host":  "db.local",
+		"/app/empty":    "",
+		"/other/secret": "x",
+	})
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "paths only by default",
+			args:     []string{"/app"},
+			expected: "/app/api_key\n/app/db/host\n/app/empty\n",
+		},
+		{
+			name:     "explicit paths only",
+			args:     []string{"--paths-only", "/app"},
+			expected: "/app/api_key\n/app/db/host\n/app/empty\n",
+		},
+		{
+			name:     "with values masked",
+			args:     []string{"--with-values", "/app"},
+			expected: "/app/api_key = ****\n/app/db/host = ****\n/app/empty   = (empty)\n",
+		},
+		{
+			name:     "with values shown",
+			args:     []string{"--with-values", "--show", "--force", "/app"},
+			expected: "/app/api_key = abc123\n/app/db/host = db.local\n/app/empty   = \n",
+		},
+		{
+			name:     "with values one level",
+			args:     []string{"--with-values", "/app/"},
+			expected: "/app/api_key = ****\n/app/db/\n/app/empty   = (empty)\n",
+		},
+		{
+			name: "with values and long",
+			args: []string{"--with-values", "--long", "/app/db"},
+			expected: "KEY           UPDATED               EXPIRES  VALUE\n" +
+				"/app/db/host  2026-03-01T12:00:00Z  (none)   ****\n",
+		},
+		{
+			name: "json paths",
+			args: []string{"--format", "json", "/app/"},
+			expected: `{
+  "version": 1,
+  "keys": [
+    {
+      "key": "/app/api_key",
+      "updated": "2026-03-01T12:00:00Z"
+    },
+    {
+      "key": "/app/db/"
+    },
+    {
+      "key": "/app/empty",
+      "updated": "2026-03-01T12:00:00Z"
+    }
+  ]
+}
+`,
+		},
+		{
+			name: "json with values",
+			args: []string{"--format", "json", "--with-values", "--show", "--force", "/app/empty"},
+			expected: `{
+  "version": 1,
+  "keys": [
+    {
+      "key": "/app/empty",
+      "updated": "2026-03-01T12:00:00Z",
+      "value": ""
+    }
+  ]
+}
+`,
+		},
+		{
+			name:     "json with nothing matching",
+			args:     []string{"--format", "json", "/missing"},
+			expected: "{\n  \"version\": 1,\n  \"keys\": []\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runTestCommand(t, ListCommand, listTestFlags(), tt.args, "")
+			if err != nil {
+				t.Fatalf("ListCommand() unexpected error = %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("output = %q, want %q", output, tt.expected)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"paths only with values", []string{"--paths-only", "--with-values"}, "--paths-only and --with-values cannot be used together"},
+		{"paths only with long", []string{"--paths-only", "--long"}, "--paths-only and --long cannot be used together"},
+		{"show without values", []string{"--show"}, "--show requires --with-values"},
+		{"show without a terminal", []string{"--with-values", "--show"}, "stdout is not a terminal"},
+		{"unknown format", []string{"--format", "yaml"}, "unsupported --format value: yaml"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runTestCommand(t, ListCommand, listTestFlags(), tt.args, "")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ListCommand() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetCommandEditor(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{})
+
+	// The "editor" records the file it was given and its permissions, then
+	// saves a PEM-like value with a trailing newline
+	dir := t.TempDir()
+	record := filepath.Join(dir, "record")
+	editor := filepath.Join(dir, "editor.sh")
+	script := "#!/bin/sh\n" +
+		"echo \"$1\" > " + record + "\n" +
+		"ls -l \"$1\" | cut -c1-10 >> " + record + "\n" +
+		"printf -- '-----BEGIN KEY-----\\nabc\\n-----END KEY-----\\n' > \"$1\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0700); err != nil {
+		t.Fatalf("Failed to write editor script: %v", err)
+	}
+	t.Setenv("EDITOR", editor)
+
+	if _, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"--editor", "/app/tls-key"}, ""); err != nil {
+		t.Fatalf("SetCommand() unexpected error = %v", err)
+	}
+
+	want := "-----BEGIN KEY-----\nabc\n-----END KEY-----\n"
+	if got := profile.loadTestSecrets(t)["/app/tls-key"].Value; got != want {
+		t.Errorf("stored value = %q, want %q", got, want)
+	}
+
+	recorded, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatalf("Failed to read editor record: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(recorded)), "\n")
+	if len(lines) != 2 || lines[1] != "-rw-------" {
+		t.Errorf("editor record = %q, want the temp file path and mode -rw-------", recorded)
+	}
+	if _, err := os.Stat(lines[0]); !os.IsNotExist(err) {
+		t.Errorf("temp file %s should be removed, stat error = %v", lines[0], err)
+	}
+
+	_, err = runTestCommand(t, SetCommand, setTestFlags(), []string{"--editor", "/app/other", "value"}, "")
+	if err == nil || !strings.Contains(err.Error(), "--editor cannot be combined with a value argument") {
+		t.Errorf("SetCommand() error = %v, want value argument error", err)
+	}
+
+	emptyEditor := filepath.Join(dir, "empty.sh")
+	if err := os.WriteFile(emptyEditor, []byte("#!/bin/sh\nprintf '\\n' > \"$1\"\n"), 0700); err != nil {
+		t.Fatalf("Failed to write editor script: %v", err)
+	}
+	t.Setenv("EDITOR", emptyEditor)
+	_, err = runTestCommand(t, SetCommand, setTestFlags(), []string{"--editor", "/app/blank"}, "")
+	if err == nil || !strings.Contains(err.Error(), "secret value cannot be empty") {
+		t.Errorf("SetCommand() error = %v, want empty value error", err)
+	}
+}
+
+func TestGetCommandEmptyVersusMissing(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/empty": "",
+		"/app/set":   "abc",
+	})
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "empty plain", args: []string{"/app/empty"}, want: "\n"},
+		{name: "empty masked", args: []string{"--mask", "/app/empty"}, want: "(empty)\n"},
+		{name: "empty masked preserving length", args: []string{"--mask", "--mask-length", "preserve", "/app/empty"}, want: "(empty)\n"},
+		{name: "empty export", args: []string{"--export", "/app/empty"}, want: "export EMPTY=\"\"\n"},
+		{name: "empty dotenv", args: []string{"--format", "dotenv", "/app/empty"}, want: "EMPTY=\"\"\n"},
+		{name: "empty json", args: []string{"--format", "json", "/app/empty"}, want: "{\"version\":1,\"vars\":{\"EMPTY\":\"\"}}\n"},
+		{name: "empty among several", args: []string{"/app/empty", "/app/set"}, want: "/app/empty = (empty)\n/app/set   = ****\n"},
+		{name: "empty shown among several", args: []string{"--show", "--force", "/app/empty", "/app/set"}, want: "/app/empty = \n/app/set   = abc\n"},
+		{name: "set plain", args: []string{"/app/set"}, want: "abc\n"},
+		{name: "set masked", args: []string{"--mask", "/app/set"}, want: "****\n"},
+		{name: "set export", args: []string{"--export", "/app/set"}, want: "export SET=abc\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runTestCommand(t, GetCommand, getTestFlags(), tt.args, "")
+			if err != nil {
+				t.Fatalf("GetCommand() unexpected error = %v", err)
+			}
+			if output != tt.want {
+				t.Errorf("output = %q, want %q", output, tt.want)
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"/app/missing"}, {"--mask", "/app/missing"}, {"--export", "/app/missing"}} {
+		output, err := runTestCommand(t, GetCommand, getTestFlags(), args, "")
+		if err == nil || err.Error() != "key not found: /app/missing" {
+			t.Errorf("GetCommand(%v) error = %v, want key not found", args, err)
+		}
+		if output != "" {
+			t.Errorf("GetCommand(%v) printed %q for a missing key", args, output)
+		}
+	}
+}
+
+func TestGetCommandDefault(t *testing.T) {
+	setupTestProfile(t, map[string]string{"/app/region": "eu-west-1"})
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "present key ignores default", args: []string{"--default", "us-east-1", "/app/region"}, want: "eu-west-1\n"},
+		{name: "missing key uses default", args: []string{"--default", "us-east-1", "/app/zone"}, want: "us-east-1\n"},
+		{name: "empty default", args: []string{"--default", "", "/app/zone"}, want: "\n"},
+		{name: "export default", args: []string{"--default", "info", "--export", "/app/log-level"}, want: "export LOG_LEVEL=info\n"},
+		{name: "dotenv default", args: []string{"--default", "a b", "--format", "dotenv", "/app/motd"}, want: "MOTD=\"a b\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runTestCommand(t, GetCommand, getTestFlags(), tt.args, "")
+			if err != nil {
+				t.Fatalf("GetCommand() unexpected error = %v", err)
+			}
+			if output != tt.want {
+				t.Errorf("output = %q, want %q", output, tt.want)
+			}
+		})
+	}
+
+	if _, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"/app/zone"}, ""); err == nil || err.Error() != "key not found: /app/zone" {
+		t.Errorf("expected a missing key to fail without --default, got: %v", err)
+	}
+	if _, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--default", "x", "/app/region", "/app/zone"}, ""); err == nil {
+		t.Error("expected --default with several keys to fail")
+	}
+}
+
+func TestGetCommandHistory(t *testing.T) {
+	clock := useStoreClock(t, time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC))
+	setupTestProfile(t, map[string]string{"/app/token": "first"})
+
+	for _, value := range []string{"second", "third"} {
+		clock.Advance(24 * time.Hour)
+		if _, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"--only-if-exists", "/app/token", value}, ""); err != nil {
+			t.Fatalf("SetCommand() unexpected error = %v", err)
+		}
+	}
+
+	output, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--history", "/app/token"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() unexpected error = %v", err)
+	}
+	expected := "2026-03-03T09:00:00Z  ****  (current)\n" +
+		"2026-03-02T09:00:00Z  ****\n" +
+		"2026-03-01T09:00:00Z  ****\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	output, err = runTestCommand(t, GetCommand, getTestFlags(), []string{"--history", "--show", "--force", "/app/token"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() unexpected error = %v", err)
+	}
+	expected = "2026-03-03T09:00:00Z  third  (current)\n" +
+		"2026-03-02T09:00:00Z  second\n" +
+		"2026-03-01T09:00:00Z  first\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	if _, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--history", "/app/missing"}, ""); err == nil {
+		t.Error("expected --history for a missing key to fail")
+	}
+	if _, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--history", "--export", "/app/token"}, ""); err == nil {
+		t.Error("expected --history with --export to fail")
+	}
+}
+
+func TestGetCommandBase64(t *testing.T) {
+	// Binary-ish and multi-line values are where a separate | base64 pipe
+	// tends to pick up a trailing newline
+	values := map[string]string{
+		"/app/cert":  "-----BEGIN CERT-----\nabc\n-----END CERT-----\n",
+		"/app/token": "s3cr3t",
+		"/app/empty": "",
+	}
+	setupTestProfile(t, values)
+
+	decode := func(t *testing.T, encoded string) string {
+		t.Helper()
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatalf("output %q is not valid base64: %v", encoded, err)
+		}
+		return string(decoded)
+	}
+
+	for keyPath, value := range values {
+		t.Run(keyPath, func(t *testing.T) {
+			output, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--base64", keyPath}, "")
+			if err != nil {
+				t.Fatalf("GetCommand() unexpected error = %v", err)
+			}
+			encoded, ok := strings.CutSuffix(output, "\n")
+			if !ok || strings.Contains(encoded, "\n") {
+				t.Fatalf("output = %q, want a single line", output)
+			}
+			if got := decode(t, encoded); got != value {
+				t.Errorf("decoded value = %q, want %q", got, value)
+			}
+		})
+	}
+
+	output, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--base64", "--export", "/app/token"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() unexpected error = %v", err)
+	}
+	if output != "export TOKEN=czNjcjN0\n" {
+		t.Errorf("--export output = %q, want %q", output, "export TOKEN=czNjcjN0\n")
+	}
+
+	output, err = runTestCommand(t, GetCommand, getTestFlags(), []string{"--base64", "--no-labels", "/app/token", "/app/cert"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() unexpected error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 2 || decode(t, lines[0]) != values["/app/token"] || decode(t, lines[1]) != values["/app/cert"] {
+		t.Errorf("--no-labels output = %q, want both values encoded in argument order", output)
+	}
+
+	if _, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--base64", "/app/"}, ""); err == nil || !strings.Contains(err.Error(), "--base64 cannot be combined with --all-under") {
+		t.Errorf("GetCommand() error = %v, want --all-under rejected", err)
+	}
+}
+
+func TestGetCommandFD(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/token": "line one\nline two",
+		"/app/other": "x",
+	})
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer reader.Close()
+
+	// GetCommand closes the descriptor it writes to, so it gets its own copy
+	// of the write end, as a child process would
+	dupFD, err := syscall.Dup(int(writer.Fd()))
+	if err != nil {
+		t.Fatalf("Failed to duplicate descriptor: %v", err)
+	}
+	writer.Close()
+	fd := strconv.Itoa(dupFD)
+	output, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--fd", fd, "--mask", "/app/token"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() --fd unexpected error = %v", err)
+	}
+	if output != "" {
+		t.Errorf("stdout = %q, want nothing", output)
+	}
+
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to read pipe: %v", err)
+	}
+	if string(got) != "line one\nline two" {
+		t.Errorf("read from fd = %q, want the raw, unmasked value", got)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"standard stream", []string{"--fd", "1", "/app/token"}, "--fd must be 3 or higher"},
+		{"several keys", []string{"--fd", "3", "/app/token", "/app/other"}, "cannot be combined with several keys"},
+		{"with format", []string{"--fd", "3", "--format", "json", "/app/token"}, "cannot be combined with --all-under, --export or --format"},
+		{"closed descriptor", []string{"--fd", "987", "/app/token"}, "failed to write to file descriptor 987"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runTestCommand(t, GetCommand, getTestFlags(), tt.args, "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GetCommand() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetCommandAppend(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/allowed-origins": "https://a.example",
+		"/app/paths":           "/usr/bin",
+	})
+
+	steps := []struct {
+		name string
+		args []string
+		key  string
+		want string
+	}{
+		{"appends to an existing value", []string{"--append", "https://b.example", "/app/allowed-origins"}, "/app/allowed-origins", "https://a.example,https://b.example"},
+		{"duplicates are kept by default", []string{"--append", "https://a.example", "/app/allowed-origins"}, "/app/allowed-origins", "https://a.example,https://b.example,https://a.example"},
+		{"unique skips an entry already present", []string{"--append", "https://b.example", "--unique", "/app/allowed-origins"}, "/app/allowed-origins", "https://a.example,https://b.example,https://a.example"},
+		{"custom separator", []string{"--append", "/usr/local/bin", "--separator", ":", "/app/paths"}, "/app/paths", "/usr/bin:/usr/local/bin"},
+		{"creates a missing key", []string{"--append", "alpha", "/app/new-list"}, "/app/new-list", "alpha"},
+		{"appends to the created key", []string{"--append", "beta", "--unique", "/app/new-list"}, "/app/new-list", "alpha,beta"},
+	}
+	for _, step := range steps {
+		if _, err := runTestCommand(t, SetCommand, setTestFlags(), step.args, ""); err != nil {
+			t.Fatalf("%s: SetCommand() unexpected error = %v", step.name, err)
+		}
+		if got := profile.loadTestSecrets(t)[step.key].Value; got != step.want {
+			t.Errorf("%s: value = %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--append", "x", "/app/paths", "value"},
+		{"--append", " ", "/app/paths"},
+		{"--append", "x", "--separator", "", "/app/paths"},
+	} {
+		if _, err := runTestCommand(t, SetCommand, setTestFlags(), args, ""); err == nil {
+			t.Errorf("SetCommand(%v) should fail", args)
+		}
+	}
+}
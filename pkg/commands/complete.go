@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"crumb/pkg/storage"
+)
+
+// maxKeyCompletions caps how many suggestions __complete-keys prints, so a
+// large store doesn't flood the terminal
+const maxKeyCompletions = 100
+
+// completeKeyPaths returns the completions for prefix among keys. Matching
+// ignores case, and each completion only extends prefix by one path segment:
+// intermediate segments end in "/" so completion drills down a level at a
+// time, while keys that end within the segment are returned in full.
+func completeKeyPaths(keys []string, prefix string) []string {
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	seen := make(map[string]bool)
+	var completions []string
+	for _, key := range keys {
+		if len(key) < len(prefix) || !strings.EqualFold(key[:len(prefix)], prefix) {
+			continue
+		}
+
+		completion := key
+		if i := strings.Index(key[len(prefix):], "/"); i >= 0 {
+			completion = key[:len(prefix)+i+1]
+		}
+		if !seen[completion] {
+			seen[completion] = true
+			completions = append(completions, completion)
+		}
+	}
+
+	sort.Strings(completions)
+	if len(completions) > maxKeyCompletions {
+		completions = completions[:maxKeyCompletions]
+	}
+	return completions
+}
+
+// CompleteKeysCommand prints key path completions for the optional prefix
+// argument, one per line, for shell completion scripts. Only key paths are
+// printed, never values.
+func CompleteKeysCommand(ctx context.Context, cmd *cli.Command) error {
+	store, err := resolveStore(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	for _, completion := range completeKeyPaths(storage.GetFilteredKeys(secrets, ""), cmd.Args().Get(0)) {
+		fmt.Println(completion)
+	}
+	return nil
+}
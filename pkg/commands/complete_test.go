@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompleteKeyPaths(t *testing.T) {
+	keys := []string{
+		"/prod/db/password",
+		"/prod/db/user",
+		"/prod/api-key",
+		"/Preview/token",
+		"/staging/db/password",
+		"/top",
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{"empty prefix lists top-level segments", "", []string{"/Preview/", "/prod/", "/staging/", "/top"}},
+		{"partial segment completes to the segment", "/pr", []string{"/Preview/", "/prod/"}},
+		{"matching ignores case", "/PROD", []string{"/prod/"}},
+		{"drills down one level", "/prod/", []string{"/prod/api-key", "/prod/db/"}},
+		{"leaf keys are returned in full", "/prod/db/", []string{"/prod/db/password", "/prod/db/user"}},
+		{"partial leaf", "/prod/db/p", []string{"/prod/db/password"}},
+		{"no matches", "/nope", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := completeKeyPaths(keys, tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("completeKeyPaths(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+
+	var many []string
+	for i := range maxKeyCompletions + 50 {
+		many = append(many, fmt.Sprintf("/bulk/key-%03d", i))
+	}
+	if got := completeKeyPaths(many, "/bulk/"); len(got) != maxKeyCompletions {
+		t.Errorf("completeKeyPaths() returned %d completions, want the cap of %d", len(got), maxKeyCompletions)
+	}
+}
+
+func TestCompleteKeysCommand(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/prod/db/password": "hunter2",
+		"/prod/api-key":     "sk-secret",
+	})
+
+	output, err := runTestCommand(t, CompleteKeysCommand, nil, []string{"/Pr"}, "")
+	if err != nil {
+		t.Fatalf("CompleteKeysCommand() unexpected error = %v", err)
+	}
+	if output != "/prod/\n" {
+		t.Errorf("output = %q, want %q", output, "/prod/\n")
+	}
+
+	output, err = runTestCommand(t, CompleteKeysCommand, nil, []string{"/prod/"}, "")
+	if err != nil {
+		t.Fatalf("CompleteKeysCommand() unexpected error = %v", err)
+	}
+	if output != "/prod/api-key\n/prod/db/\n" {
+		t.Errorf("output = %q, want %q", output, "/prod/api-key\n/prod/db/\n")
+	}
+	if strings.Contains(output, "hunter2") || strings.Contains(output, "sk-secret") {
+		t.Errorf("output = %q, must not contain values", output)
+	}
+}
@@ -0,0 +1,266 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+
+	"crumb/pkg/config"
+)
+
+// configDescription is what describe-config reports about a .crumb.yaml
+type configDescription struct {
+	Version      int                      `json:"version"`
+	File         string                   `json:"file"`
+	Environments []environmentDescription `json:"environments"`
+	BranchMap    map[string]string        `json:"branch_map,omitempty"`
+	Problems     []string                 `json:"problems"`
+}
+
+// environmentDescription summarizes one environment of a .crumb.yaml
+type environmentDescription struct {
+	Name     string             `json:"name"`
+	Profile  string             `json:"profile,omitempty"`
+	EnvFiles []string           `json:"env_files"`
+	Path     string             `json:"path,omitempty"`
+	Remap    []remapDescription `json:"remap"`
+	Env      []envEntry         `json:"env"`
+}
+
+// remapDescription is a single remap from a variable name to a new one
+type remapDescription struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// envEntry is a single env-section entry. Kind is "secret" when Value is a
+// secret path and "literal" when Value is exported as-is.
+type envEntry struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// DescribeConfigCommand explains what each environment in a .crumb.yaml will
+// export, without reading or decrypting the secrets.
+func DescribeConfigCommand(_ context.Context, cmd *cli.Command) error {
+	configFile := cmd.String("file")
+	if !cmd.Bool("no-parent-search") {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+		configFile, err = config.FindCrumbConfig(cwd, configFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	crumbConfig, err := config.LoadCrumbConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	description := describeCrumbConfig(configFile, crumbConfig)
+	if problem := checkConfigSchema(configFile); problem != "" {
+		description.Problems = append([]string{problem}, description.Problems...)
+	}
+
+	if cmd.Bool("json") {
+		description.Version = jsonSchemaVersion
+		encoded, err := json.MarshalIndent(description, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		fmt.Println(string(encoded))
+	} else {
+		printConfigDescription(description)
+	}
+
+	if len(description.Problems) > 0 {
+		return fmt.Errorf("found %d problem(s) in %s", len(description.Problems), configFile)
+	}
+	return nil
+}
+
+// checkConfigSchema reports fields the .crumb.yaml schema doesn't know, which
+// are otherwise ignored silently (e.g. a misspelled "remaps:")
+func checkConfigSchema(configFile string) string {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return ""
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var strict config.CrumbConfig
+	if err := decoder.Decode(&strict); err != nil {
+		return fmt.Sprintf("schema: %v", err)
+	}
+	return ""
+}
+
+// describeCrumbConfig summarizes every environment, sorted by name, and
+// collects problems that would make an export fail or do nothing
+func describeCrumbConfig(configFile string, crumbConfig *config.CrumbConfig) configDescription {
+	description := configDescription{
+		File:         configFile,
+		Environments: []environmentDescription{},
+		Problems:     []string{},
+	}
+
+	var names []string
+	for name := range crumbConfig.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		envConfig := crumbConfig.Environments[name]
+		env := environmentDescription{
+			Name:     name,
+			Profile:  envConfig.Profile,
+			EnvFiles: []string{},
+			Path:     envConfig.Path,
+			Remap:    []remapDescription{},
+			Env:      []envEntry{},
+		}
+
+		for _, envFile := range envConfig.EnvFiles {
+			env.EnvFiles = append(env.EnvFiles, envFile)
+			if _, err := os.Stat(resolveEnvFilePath(configFile, envFile)); err != nil {
+				description.Problems = append(description.Problems, fmt.Sprintf("environment '%s': env file %s can't be read: %v", name, envFile, err))
+			}
+		}
+
+		if envConfig.Path != "" && !strings.HasPrefix(envConfig.Path, "/") {
+			description.Problems = append(description.Problems, fmt.Sprintf("environment '%s': path %q must start with '/'", name, envConfig.Path))
+		}
+
+		var envNames []string
+		for envName := range envConfig.Env {
+			envNames = append(envNames, envName)
+		}
+		sort.Strings(envNames)
+		for _, envName := range envNames {
+			entry := describeEnvValue(envName, envConfig.Env[envName])
+			if entry.Kind == "secret" {
+				if err := config.ValidateKeyPath(entry.Value); err != nil {
+					description.Problems = append(description.Problems, fmt.Sprintf("environment '%s': env %s refers to an invalid secret path: %v", name, envName, err))
+				}
+			}
+			env.Env = append(env.Env, entry)
+		}
+
+		var sources []string
+		for source := range envConfig.Remap {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		claimedBy := make(map[string]string)
+		for _, source := range sources {
+			target := envConfig.Remap[source]
+			env.Remap = append(env.Remap, remapDescription{From: source, To: target})
+
+			sanitizedTarget := strings.ToUpper(strings.ReplaceAll(target, "-", "_"))
+			if previous, claimed := claimedBy[sanitizedTarget]; claimed {
+				description.Problems = append(description.Problems, fmt.Sprintf("environment '%s': %s and %s both remap to %s; export fails unless their values are identical", name, previous, source, sanitizedTarget))
+				continue
+			}
+			claimedBy[sanitizedTarget] = source
+		}
+
+		if envConfig.Path == "" && len(envConfig.Env) == 0 && len(envConfig.EnvFiles) == 0 {
+			description.Problems = append(description.Problems, fmt.Sprintf("environment '%s' has no path, env entries or env files, so it exports nothing", name))
+		}
+
+		description.Environments = append(description.Environments, env)
+	}
+
+	var branches []string
+	for branch := range crumbConfig.BranchMap {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	for _, branch := range branches {
+		environment := crumbConfig.BranchMap[branch]
+		if _, exists := crumbConfig.Environments[environment]; !exists {
+			description.Problems = append(description.Problems, fmt.Sprintf("branch_map maps %s to environment '%s', which doesn't exist", branch, environment))
+		}
+	}
+	description.BranchMap = crumbConfig.BranchMap
+
+	return description
+}
+
+// describeEnvValue classifies an env-section value the same way export
+// resolves it, see resolveEnvValue
+func describeEnvValue(name, value string) envEntry {
+	if literal, ok := strings.CutPrefix(value, literalPrefix); ok {
+		return envEntry{Name: name, Kind: "literal", Value: literal}
+	}
+	if strings.HasPrefix(value, "/") {
+		return envEntry{Name: name, Kind: "secret", Value: value}
+	}
+	return envEntry{Name: name, Kind: "literal", Value: value}
+}
+
+// printConfigDescription writes the description as indented text
+func printConfigDescription(description configDescription) {
+	fmt.Printf("Config: %s\n", description.File)
+
+	for _, env := range description.Environments {
+		fmt.Printf("\nEnvironment: %s\n", env.Name)
+		if env.Profile != "" {
+			fmt.Printf("  Profile: %s\n", env.Profile)
+		}
+		for _, envFile := range env.EnvFiles {
+			fmt.Printf("  Env file: %s\n", envFile)
+		}
+		if env.Path != "" {
+			fmt.Printf("  Path: %s (every secret below it)\n", env.Path)
+		}
+		if len(env.Env) > 0 {
+			fmt.Println("  Env:")
+			for _, entry := range env.Env {
+				if entry.Kind == "secret" {
+					fmt.Printf("    %s <- secret %s\n", entry.Name, entry.Value)
+				} else {
+					fmt.Printf("    %s = literal %q\n", entry.Name, entry.Value)
+				}
+			}
+		}
+		if len(env.Remap) > 0 {
+			fmt.Println("  Remap:")
+			for _, remap := range env.Remap {
+				fmt.Printf("    %s -> %s\n", remap.From, remap.To)
+			}
+		}
+	}
+
+	if len(description.BranchMap) > 0 {
+		var branches []string
+		for branch := range description.BranchMap {
+			branches = append(branches, branch)
+		}
+		sort.Strings(branches)
+		fmt.Println("\nBranch map:")
+		for _, branch := range branches {
+			fmt.Printf("  %s -> %s\n", branch, description.BranchMap[branch])
+		}
+	}
+
+	if len(description.Problems) > 0 {
+		fmt.Println("\nProblems:")
+		for _, problem := range description.Problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+	}
+}
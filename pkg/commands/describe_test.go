@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDescribeConfigCommand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	writeCrumbConfig(t, home, `version: "1.0"
+environments:
+  default:
+    path: /myapp/dev/
+    env:
+      API_KEY: /myapp/shared/api-key
+      HEALTH_PATH: "literal:/health"
+      REGION: eu-west-1
+    remap:
+      DB_HOST: DATABASE_HOST
+`)
+
+	output, err := runTestCommand(t, DescribeConfigCommand, describeConfigTestFlags(), nil, "")
+	if err != nil {
+		t.Fatalf("DescribeConfigCommand() unexpected error = %v", err)
+	}
+
+	for _, want := range []string{
+		"Environment: default\n",
+		"  Path: /myapp/dev/ (every secret below it)\n",
+		"    API_KEY <- secret /myapp/shared/api-key\n",
+		"    HEALTH_PATH = literal \"/health\"\n",
+		"    REGION = literal \"eu-west-1\"\n",
+		"    DB_HOST -> DATABASE_HOST\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "Problems:") {
+		t.Errorf("expected no problems, got:\n%s", output)
+	}
+}
+
+func TestDescribeConfigCommandProblems(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	writeCrumbConfig(t, home, `version: "1.0"
+environments:
+  default:
+    path: /app
+    remaps:
+      A: B
+    remap:
+      PRIMARY_URL: DATABASE_URL
+      REPLICA_URL: database-url
+  empty: {}
+branch_map:
+  main: production
+`)
+
+	output, err := runTestCommand(t, DescribeConfigCommand, describeConfigTestFlags(), []string{"--json"}, "")
+	if err == nil || !strings.HasPrefix(err.Error(), "found 4 problem(s)") {
+		t.Fatalf("expected 4 problems, got error: %v", err)
+	}
+
+	var description configDescription
+	if err := json.Unmarshal([]byte(output), &description); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	if description.Version != jsonSchemaVersion {
+		t.Errorf("version = %d, want %d", description.Version, jsonSchemaVersion)
+	}
+
+	if len(description.Environments) != 2 || description.Environments[0].Name != "default" {
+		t.Fatalf("unexpected environments: %+v", description.Environments)
+	}
+	wantRemap := []remapDescription{
+		{From: "PRIMARY_URL", To: "DATABASE_URL"},
+		{From: "REPLICA_URL", To: "database-url"},
+	}
+	if !reflect.DeepEqual(description.Environments[0].Remap, wantRemap) {
+		t.Errorf("remap = %+v, want %+v", description.Environments[0].Remap, wantRemap)
+	}
+
+	if len(description.Problems) != 4 {
+		t.Fatalf("problems = %q, want 4", description.Problems)
+	}
+	if !strings.Contains(description.Problems[0], "field remaps not found") {
+		t.Errorf("expected an unknown field problem first, got: %q", description.Problems[0])
+	}
+	if !strings.Contains(description.Problems[1], "PRIMARY_URL and REPLICA_URL both remap to DATABASE_URL") {
+		t.Errorf("expected a duplicate target problem, got: %q", description.Problems[1])
+	}
+	if !strings.Contains(description.Problems[2], "environment 'empty' has no path, env entries or env files") {
+		t.Errorf("expected an empty environment problem, got: %q", description.Problems[2])
+	}
+	if description.Problems[3] != "branch_map maps main to environment 'production', which doesn't exist" {
+		t.Errorf("expected a branch_map problem, got: %q", description.Problems[3])
+	}
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/urfave/cli/v3"
+
+	"crumb/pkg/storage"
+)
+
+// envFileDiff is how a .env file differs from the resolved crumb export
+type envFileDiff struct {
+	OnlyInFile  []string
+	OnlyInCrumb []string
+	Changed     []string
+}
+
+// empty reports whether the file and crumb agree on every variable
+func (d envFileDiff) empty() bool {
+	return len(d.OnlyInFile) == 0 && len(d.OnlyInCrumb) == 0 && len(d.Changed) == 0
+}
+
+// diffEnvFile compares the variables of a .env file with crumb's. Each list
+// of names is sorted.
+func diffEnvFile(fileVars, crumbVars map[string]string) envFileDiff {
+	var diff envFileDiff
+	for name, value := range fileVars {
+		crumbValue, ok := crumbVars[name]
+		switch {
+		case !ok:
+			diff.OnlyInFile = append(diff.OnlyInFile, name)
+		case crumbValue != value:
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range crumbVars {
+		if _, ok := fileVars[name]; !ok {
+			diff.OnlyInCrumb = append(diff.OnlyInCrumb, name)
+		}
+	}
+	sort.Strings(diff.OnlyInFile)
+	sort.Strings(diff.OnlyInCrumb)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// DiffCommand compares a .env file with what crumb export would produce and
+// lists the variables that only one side has or that have different values.
+// Values stay hidden unless --show is given.
+func DiffCommand(ctx context.Context, cmd *cli.Command) error {
+	envFile := cmd.String("file")
+	if envFile == "" {
+		return fmt.Errorf("--file is required")
+	}
+
+	fileVars, err := storage.ParseEnvFile(envFile)
+	if err != nil {
+		return err
+	}
+
+	result, err := resolveExport(cmd, newProfileSecrets(ctx, cmd), cmd.String("config"))
+	if err != nil {
+		return err
+	}
+
+	diff := diffEnvFile(fileVars, result.Vars)
+	if diff.empty() {
+		fmt.Printf("%s matches crumb (%d variables)\n", envFile, len(fileVars))
+		return nil
+	}
+
+	show := cmd.Bool("show")
+	printSection := func(title string, names []string, value func(string) string) {
+		if len(names) == 0 {
+			return
+		}
+		fmt.Println(title)
+		for _, name := range names {
+			if show {
+				fmt.Printf("  %s %s\n", name, value(name))
+			} else {
+				fmt.Printf("  %s\n", name)
+			}
+		}
+	}
+
+	printSection(fmt.Sprintf("Only in %s:", envFile), diff.OnlyInFile, func(name string) string {
+		return fmt.Sprintf("= %q", fileVars[name])
+	})
+	printSection("Only in crumb:", diff.OnlyInCrumb, func(name string) string {
+		return fmt.Sprintf("= %q", result.Vars[name])
+	})
+	printSection("Different values:", diff.Changed, func(name string) string {
+		return fmt.Sprintf("(file: %q, crumb: %q)", fileVars[name], result.Vars[name])
+	})
+
+	count := len(diff.OnlyInFile) + len(diff.OnlyInCrumb) + len(diff.Changed)
+	return fmt.Errorf("%s differs from crumb in %d variable(s)", envFile, count)
+}
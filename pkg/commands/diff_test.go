@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffCommand(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/shared":     "same",
+		"/app/changed":    "crumb-value",
+		"/app/crumb-only": "fresh",
+	})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app/
+    env:
+      LOG_LEVEL: "literal:info"
+`)
+
+	writeEnvFile := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(profile.Home, ".env")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write .env: %v", err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name        string
+		envFile     string
+		show        bool
+		wantOutput  []string
+		wantMissing []string
+		wantErr     string
+	}{
+		{
+			name:       "no differences",
+			envFile:    "SHARED=same\nCHANGED=crumb-value\nCRUMB_ONLY=fresh\nLOG_LEVEL=info\n",
+			wantOutput: []string{"matches crumb (4 variables)"},
+		},
+		{
+			name:        "only in file",
+			envFile:     "SHARED=same\nCHANGED=crumb-value\nCRUMB_ONLY=fresh\nLOG_LEVEL=info\nSTALE=old\n",
+			wantOutput:  []string{"Only in " + filepath.Join(profile.Home, ".env") + ":\n  STALE\n"},
+			wantMissing: []string{"Only in crumb", "Different values", "old"},
+			wantErr:     "differs from crumb in 1 variable(s)",
+		},
+		{
+			name:        "only in crumb",
+			envFile:     "SHARED=same\nCHANGED=crumb-value\n",
+			wantOutput:  []string{"Only in crumb:\n  CRUMB_ONLY\n  LOG_LEVEL\n"},
+			wantMissing: []string{"Different values", "fresh"},
+			wantErr:     "differs from crumb in 2 variable(s)",
+		},
+		{
+			name:        "different values hidden",
+			envFile:     "SHARED=same\nCHANGED=file-value\nCRUMB_ONLY=fresh\nLOG_LEVEL=info\n",
+			wantOutput:  []string{"Different values:\n  CHANGED\n"},
+			wantMissing: []string{"file-value", "crumb-value"},
+			wantErr:     "differs from crumb in 1 variable(s)",
+		},
+		{
+			name:       "different values shown",
+			envFile:    "SHARED=same\nCHANGED=file-value\nLOG_LEVEL=info\n",
+			show:       true,
+			wantOutput: []string{"  CHANGED (file: \"file-value\", crumb: \"crumb-value\")\n", "  CRUMB_ONLY = \"fresh\"\n"},
+			wantErr:    "differs from crumb in 2 variable(s)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"--file", writeEnvFile(t, tt.envFile)}
+			if tt.show {
+				args = append(args, "--show")
+			}
+			output, err := runTestCommand(t, DiffCommand, diffTestFlags(), args, "")
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("DiffCommand() unexpected error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("DiffCommand() error = %v, want %q", err, tt.wantErr)
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(output, want) {
+					t.Errorf("output = %q, want it to contain %q", output, want)
+				}
+			}
+			for _, unwanted := range tt.wantMissing {
+				if strings.Contains(output, unwanted) {
+					t.Errorf("output = %q, should not contain %q", output, unwanted)
+				}
+			}
+		})
+	}
+
+	if _, err := runTestCommand(t, DiffCommand, diffTestFlags(), []string{"--file", filepath.Join(profile.Home, "missing.env")}, ""); err == nil {
+		t.Error("DiffCommand() with a missing .env file should fail")
+	}
+}
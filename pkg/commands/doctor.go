@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v3"
+
+	"crumb/pkg/backend"
+)
+
+// doctorIssue is a problem found by crumb doctor
+type doctorIssue struct {
+	Problem string
+	// Fix corrects the problem and describes what it did. It is nil when the
+	// problem can't be fixed without risking secrets or needs a decision.
+	Fix func() (string, error)
+}
+
+// DoctorCommand checks the profile's configuration, keys and storage file and
+// reports what's wrong. With --fix, problems that are safe to correct are
+// fixed and each action is printed; nothing is ever overwritten or deleted.
+func DoctorCommand(ctx context.Context, cmd *cli.Command) error {
+	issues := diagnoseProfile(ctx, cmd)
+	if len(issues) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+
+	remaining := 0
+	for _, issue := range issues {
+		if issue.Fix == nil {
+			fmt.Printf("Problem: %s\n", issue.Problem)
+			remaining++
+			continue
+		}
+		if !cmd.Bool("fix") {
+			fmt.Printf("Problem: %s (fixable with --fix)\n", issue.Problem)
+			remaining++
+			continue
+		}
+		action, err := issue.Fix()
+		if err != nil {
+			fmt.Printf("Problem: %s (fix failed: %v)\n", issue.Problem, err)
+			remaining++
+			continue
+		}
+		fmt.Printf("Fixed: %s\n", action)
+	}
+
+	if remaining > 0 {
+		return fmt.Errorf("found %d problem(s)", remaining)
+	}
+	return nil
+}
+
+// diagnoseProfile lists the problems with the current profile in the order
+// they should be fixed, so creating a directory comes before creating the
+// store inside it
+func diagnoseProfile(ctx context.Context, cmd *cli.Command) []doctorIssue {
+	var issues []doctorIssue
+
+	configDir := filepath.Join(os.Getenv("HOME"), ".config", "crumb")
+	if _, err := os.Stat(configDir); os.IsNotExist(err) {
+		issues = append(issues, doctorIssue{
+			Problem: fmt.Sprintf("config directory %s is missing", configDir),
+			Fix: func() (string, error) {
+				if err := mkdirWithMode(configDir, 0700); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("created %s", configDir), nil
+			},
+		})
+	}
+
+	profileCfg, b, err := resolveBackend(cmd)
+	if err != nil {
+		return append(issues, doctorIssue{Problem: err.Error()})
+	}
+
+	publicKeyOK := true
+	if _, err := os.Stat(profileCfg.PublicKeyPath); err != nil {
+		publicKeyOK = false
+		issues = append(issues, doctorIssue{Problem: fmt.Sprintf("public key %s can't be read: %v", profileCfg.PublicKeyPath, err)})
+	}
+	if profileCfg.PrivateKeyPath != "" {
+		if _, err := os.Stat(profileCfg.PrivateKeyPath); err != nil {
+			issues = append(issues, doctorIssue{Problem: fmt.Sprintf("private key %s can't be read: %v", profileCfg.PrivateKeyPath, err)})
+		}
+	}
+
+	// Remote storage has no local file to check
+	fileBackend, ok := b.(*backend.FileBackend)
+	if !ok {
+		return issues
+	}
+	fileMode, err := profileCfg.StorageFileMode()
+	if err != nil {
+		return append(issues, doctorIssue{Problem: err.Error()})
+	}
+	dirMode, err := profileCfg.StorageDirMode()
+	if err != nil {
+		return append(issues, doctorIssue{Problem: err.Error()})
+	}
+
+	storageDir := filepath.Dir(fileBackend.Path)
+	if _, err := os.Stat(storageDir); os.IsNotExist(err) {
+		issues = append(issues, doctorIssue{
+			Problem: fmt.Sprintf("storage directory %s is missing", storageDir),
+			Fix: func() (string, error) {
+				if err := mkdirWithMode(storageDir, dirMode); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("created %s with mode %04o", storageDir, dirMode), nil
+			},
+		})
+	}
+
+	info, err := os.Stat(fileBackend.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return append(issues, doctorIssue{Problem: fmt.Sprintf("failed to check storage file: %v", err)})
+	}
+	if err != nil || info.Size() == 0 {
+		issue := doctorIssue{Problem: fmt.Sprintf("storage file %s doesn't exist yet", fileBackend.Path)}
+		// An empty store is only created for a readable key, so the fix
+		// can't leave the profile with a store it can't use
+		if publicKeyOK {
+			issue.Fix = func() (string, error) {
+				if err := mkdirWithMode(storageDir, dirMode); err != nil {
+					return "", err
+				}
+				if _, err := ensureStorage(profileCfg.PublicKeyPath, fileBackend, false); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("created an empty store at %s encrypted to %s", fileBackend.Path, profileCfg.PublicKeyPath), nil
+			}
+		}
+		return append(issues, issue)
+	}
+
+	if perm := info.Mode().Perm(); perm&^fileMode != 0 {
+		issues = append(issues, doctorIssue{
+			Problem: fmt.Sprintf("storage file %s has mode %04o, more permissive than %04o", fileBackend.Path, perm, fileMode),
+			Fix: func() (string, error) {
+				if err := os.Chmod(fileBackend.Path, fileMode); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("changed the mode of %s from %04o to %04o", fileBackend.Path, perm, fileMode), nil
+			},
+		})
+	}
+
+	// A store that can't be decrypted is never replaced: it may hold secrets
+	// encrypted to another key
+	store, err := resolveStore(ctx, cmd)
+	if err == nil {
+		_, err = store.Load()
+	}
+	if err != nil {
+		issues = append(issues, doctorIssue{Problem: fmt.Sprintf("storage file %s can't be decrypted: %v", fileBackend.Path, err)})
+	}
+	return issues
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDoctorCommand(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "value"})
+	storagePath := profile.Backend.Location()
+
+	output, err := runTestCommand(t, DoctorCommand, doctorTestFlags(), nil, "")
+	if err != nil || output != "No problems found\n" {
+		t.Fatalf("healthy profile: output = %q, error = %v", output, err)
+	}
+
+	if err := os.Chmod(storagePath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = runTestCommand(t, DoctorCommand, doctorTestFlags(), nil, "")
+	if err == nil || !strings.Contains(output, "has mode 0644, more permissive than 0600 (fixable with --fix)") {
+		t.Errorf("output = %q, error = %v, want the loose mode reported", output, err)
+	}
+	if info, _ := os.Stat(storagePath); info.Mode().Perm() != 0644 {
+		t.Errorf("doctor without --fix changed the mode to %04o", info.Mode().Perm())
+	}
+
+	output, err = runTestCommand(t, DoctorCommand, doctorTestFlags(), []string{"--fix"}, "")
+	if err != nil {
+		t.Fatalf("DoctorCommand() --fix unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "Fixed: changed the mode of "+storagePath+" from 0644 to 0600") {
+		t.Errorf("output = %q, want the chmod reported", output)
+	}
+	if info, _ := os.Stat(storagePath); info.Mode().Perm() != 0600 {
+		t.Errorf("storage mode = %04o after --fix, want 0600", info.Mode().Perm())
+	}
+	if secrets := profile.loadTestSecrets(t); secrets["/app/key"].Value != "value" {
+		t.Errorf("--fix changed the secrets: %v", secrets)
+	}
+
+	if err := os.Remove(storagePath); err != nil {
+		t.Fatal(err)
+	}
+	output, err = runTestCommand(t, DoctorCommand, doctorTestFlags(), []string{"--fix"}, "")
+	if err != nil {
+		t.Fatalf("DoctorCommand() --fix unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "Fixed: created an empty store at "+storagePath) {
+		t.Errorf("output = %q, want the new store reported", output)
+	}
+	if secrets := profile.loadTestSecrets(t); len(secrets) != 0 {
+		t.Errorf("expected an empty store, got: %v", secrets)
+	}
+}
+
+func TestDoctorCommandLeavesUndecryptableStore(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "value"})
+	storagePath := profile.Backend.Location()
+
+	garbage := []byte("not an age file")
+	if err := os.WriteFile(storagePath, garbage, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := runTestCommand(t, DoctorCommand, doctorTestFlags(), []string{"--fix"}, "")
+	if err == nil || err.Error() != "found 1 problem(s)" {
+		t.Errorf("DoctorCommand() error = %v, want one remaining problem", err)
+	}
+	if !strings.Contains(output, "can't be decrypted") || strings.Contains(output, "Fixed:") {
+		t.Errorf("output = %q, want the store reported and nothing fixed", output)
+	}
+	if data, _ := os.ReadFile(storagePath); string(data) != string(garbage) {
+		t.Errorf("--fix must not touch a store it can't decrypt, got %q", data)
+	}
+}
@@ -0,0 +1,1650 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
+
+	"crumb/pkg/backend"
+	"crumb/pkg/config"
+	"crumb/pkg/crypto"
+	"crumb/pkg/storage"
+)
+
+const (
+	// watchPollInterval is how often --watch checks the export inputs for changes
+	watchPollInterval = 250 * time.Millisecond
+	// watchDebounce is how long the inputs must stay unchanged before re-exporting
+	watchDebounce = 500 * time.Millisecond
+)
+
+// exportResult holds the resolved variables for an export and the comment
+// lines describing where they came from.
+type exportResult struct {
+	Comments []string
+	Vars     map[string]string
+	// Sources maps each variable to the secret path it was read from; literal
+	// values have no entry
+	Sources map[string]string
+	// Problems lists things export tolerates but --check reports, such as an
+	// env entry whose secret is missing
+	Problems []string
+	// DefinedIn maps each variable from a comma-separated --env to the
+	// environments that defined it, in the order they were merged
+	DefinedIn map[string][]string
+}
+
+// newExportResult creates an empty exportResult
+func newExportResult() *exportResult {
+	return &exportResult{
+		Vars:      make(map[string]string),
+		Sources:   make(map[string]string),
+		DefinedIn: make(map[string][]string),
+	}
+}
+
+// set records a variable and the secret path it came from ("" for literals)
+func (r *exportResult) set(name, value, source string) {
+	r.Vars[name] = value
+	if source != "" {
+		r.Sources[name] = source
+	} else {
+		delete(r.Sources, name)
+	}
+}
+
+// overlappingEnvironments describes each exported variable that more than one
+// merged environment defined, and which of them won, sorted by name
+func (r *exportResult) overlappingEnvironments() []string {
+	var overlaps []string
+	for _, name := range r.orderedNames("name") {
+		environments := r.DefinedIn[name]
+		if len(environments) < 2 {
+			continue
+		}
+		overlaps = append(overlaps, fmt.Sprintf("%s: %s (using %s)", name, strings.Join(environments, ", "), environments[len(environments)-1]))
+	}
+	return overlaps
+}
+
+// dropIdenticalToEnv removes the variables the environment already has with
+// the same value, leaving new and changed ones. Comments go too when nothing
+// is left, so an unchanged export prints nothing.
+func (r *exportResult) dropIdenticalToEnv(env map[string]string) {
+	for name, value := range r.Vars {
+		if current, ok := env[name]; ok && current == value {
+			delete(r.Vars, name)
+			delete(r.Sources, name)
+		}
+	}
+	if len(r.Vars) == 0 {
+		r.Comments = nil
+	}
+}
+
+// filterNames keeps only the variables whose names match keep (when set) and
+// don't match drop (when set)
+func (r *exportResult) filterNames(keep, drop *regexp.Regexp) {
+	for name := range r.Vars {
+		if (keep != nil && !keep.MatchString(name)) || (drop != nil && drop.MatchString(name)) {
+			delete(r.Vars, name)
+			delete(r.Sources, name)
+		}
+	}
+}
+
+// compileNameFilter compiles the regular expression of a name filter flag;
+// an empty pattern gives nil, which filters nothing
+func compileNameFilter(flagName, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", flagName, err)
+	}
+	return re, nil
+}
+
+// exportOptions controls how resolved variables are written
+type exportOptions struct {
+	// Format is "shell" for assignments in Shell's syntax, "dotenv" for
+	// KEY=value lines as read by docker compose, "laravel" for KEY=value
+	// lines quoted for PHP's vlucas/phpdotenv, "compose" for a YAML
+	// environment: mapping, "vault" for vault kv put commands, or "null" for
+	// NUL-terminated KEY=value records
+	Format string
+	Shell  string
+	SortBy string
+	// CommentSource prints a "# from <path>" line before each variable read from a secret
+	CommentSource bool
+	// NoComments leaves out all comment lines, including source comments
+	NoComments bool
+	// Mask replaces every value according to MaskStyle, for looking at what
+	// would be exported; the output can't be sourced
+	Mask      bool
+	MaskStyle maskStyle
+	// Redact masks only the values it matches, like Mask, for showing the
+	// export on screen with token-like values hidden
+	Redact *regexp.Regexp
+	// QuoteAll double-quotes every bash/zsh/fish value, not just the ones
+	// that need it
+	QuoteAll bool
+	// Template is a text/template file rendered with the variables instead
+	// of writing assignments
+	Template string
+	// EscapeDollar doubles every $ in dotenv values so docker compose
+	// interpolation leaves them alone
+	EscapeDollar bool
+	// Indent is the number of spaces before each entry of the compose
+	// environment: mapping
+	Indent int
+	// Mount is the Vault KV secrets engine mount for --format vault
+	Mount string
+	// AllowMultiline exports values containing newlines even where the
+	// output can't carry them intact
+	AllowMultiline bool
+}
+
+// masks reports whether value is written masked: every value with Mask, and
+// the ones matching Redact otherwise
+func (o exportOptions) masks(value string) bool {
+	return o.Mask || redacted(o.Redact, value)
+}
+
+// exportOptionsFromFlags reads and validates the output flags of the export command
+func exportOptionsFromFlags(cmd *cli.Command) (exportOptions, error) {
+	opts := exportOptions{
+		Format:         cmd.String("format"),
+		Shell:          cmd.String("shell"),
+		SortBy:         cmd.String("sort-by"),
+		CommentSource:  cmd.Bool("comment-source"),
+		NoComments:     cmd.Bool("no-comments"),
+		Template:       cmd.String("template"),
+		QuoteAll:       cmd.Bool("quote-all"),
+		Mask:           cmd.Bool("mask"),
+		EscapeDollar:   cmd.Bool("escape-dollar"),
+		Indent:         int(cmd.Int("indent")),
+		Mount:          cmd.String("mount"),
+		AllowMultiline: cmd.Bool("allow-multiline"),
+	}
+	if opts.Mask && (cmd.String("output") != "" || opts.Template != "") {
+		return opts, fmt.Errorf("--mask is for viewing on the terminal and cannot be combined with --output or --template")
+	}
+	redact, err := redactPatternFromFlags(cmd)
+	if err != nil {
+		return opts, err
+	}
+	if redact != nil {
+		if opts.Mask {
+			return opts, fmt.Errorf("--redact-pattern cannot be combined with --mask, which already masks every value")
+		}
+		if cmd.String("output") != "" || opts.Template != "" {
+			return opts, fmt.Errorf("--redact-pattern is for viewing on the terminal and cannot be combined with --output or --template")
+		}
+		opts.Redact = redact
+	}
+	if opts.Mask || opts.Redact != nil {
+		style, err := maskStyleFromFlags(cmd, maskPreserve)
+		if err != nil {
+			return opts, err
+		}
+		opts.MaskStyle = style
+	}
+	if opts.Template != "" && cmd.IsSet("format") {
+		return opts, fmt.Errorf("--template cannot be combined with --format")
+	}
+	if opts.Format == "" {
+		opts.Format = "shell"
+	}
+	if !slices.Contains(supportedExportFormats, opts.Format) {
+		return opts, fmt.Errorf("unsupported export format: %s (supported: %s)", opts.Format, strings.Join(supportedExportFormats, ", "))
+	}
+	if opts.EscapeDollar && opts.Format != "dotenv" {
+		return opts, fmt.Errorf("--escape-dollar only applies to --format dotenv")
+	}
+	if cmd.IsSet("indent") && opts.Format != "compose" {
+		return opts, fmt.Errorf("--indent only applies to --format compose")
+	}
+	if opts.Indent < 1 || opts.Indent > 8 {
+		return opts, fmt.Errorf("--indent must be between 1 and 8, got %d", opts.Indent)
+	}
+	if cmd.IsSet("mount") && opts.Format != "vault" {
+		return opts, fmt.Errorf("--mount only applies to --format vault")
+	}
+	// vault kv put commands carry the values in the clear, unlike shell output
+	// that's usually eval'd straight away, so they need a terminal or --force
+	if opts.Format == "vault" && !opts.Mask && !cmd.Bool("force") {
+		if cmd.String("output") != "" {
+			return opts, fmt.Errorf("refusing to write secret values for vault to a file, pass --force to override")
+		}
+		if !term.IsTerminal(int(os.Stdout.Fd())) {
+			return opts, fmt.Errorf("refusing to reveal secret values because stdout is not a terminal, pass --force to override")
+		}
+	}
+	if opts.Shell == "" {
+		opts.Shell = "bash"
+	}
+	if err := validateExportShell(opts.Shell); err != nil {
+		return opts, err
+	}
+	if cmd.Bool("merge") {
+		if cmd.String("output") == "" {
+			return opts, fmt.Errorf("--merge requires --output")
+		}
+		mergeable := opts.Format == "dotenv" || opts.Format == "laravel" ||
+			opts.Format == "shell" && (opts.Shell == "bash" || opts.Shell == "zsh")
+		if opts.Template != "" || !mergeable {
+			return opts, fmt.Errorf("--merge only applies to --format dotenv or laravel, or shell output for bash or zsh")
+		}
+	}
+	switch opts.SortBy {
+	case "":
+		opts.SortBy = "name"
+	case "name", "path":
+	default:
+		return opts, fmt.Errorf("unsupported --sort-by value: %s (supported: name, path)", opts.SortBy)
+	}
+	return opts, nil
+}
+
+// ExportCommand handles the export command
+func ExportCommand(ctx context.Context, cmd *cli.Command) error {
+	opts, err := exportOptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	outputPath := cmd.String("output")
+	if cmd.Bool("check") {
+		if outputPath != "" || cmd.Bool("watch") {
+			return fmt.Errorf("--check cannot be combined with --output or --watch")
+		}
+		return checkExport(ctx, cmd)
+	}
+	if cmd.Bool("fingerprint") {
+		if outputPath != "" || cmd.Bool("watch") {
+			return fmt.Errorf("--fingerprint cannot be combined with --output or --watch")
+		}
+		inputs, _, state, err := exportInputs(cmd)
+		if err != nil {
+			return err
+		}
+		fmt.Println(exportFingerprint(inputs, state))
+		return nil
+	}
+	if cmd.Bool("only-changed") && outputPath != "" {
+		return fmt.Errorf("--only-changed compares what was last printed and cannot be combined with --output")
+	}
+	if cmd.Bool("watch") {
+		if outputPath == "" {
+			return fmt.Errorf("--watch requires --output")
+		}
+		return watchExport(ctx, cmd, opts, outputPath)
+	}
+
+	if outputPath != "" {
+		if cmd.Bool("dedupe-identical") {
+			return fmt.Errorf("--dedupe-identical compares against the current environment and cannot be combined with --output")
+		}
+		return writeExportFile(ctx, cmd, opts, outputPath)
+	}
+
+	result, err := loadExport(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Bool("dedupe-identical") {
+		result.dropIdenticalToEnv(currentEnvironment())
+	}
+
+	var buf bytes.Buffer
+	if err := renderExport(&buf, opts, result); err != nil {
+		return err
+	}
+
+	var hashPath, record string
+	if cmd.Bool("only-changed") {
+		hashDir := exportHashDir()
+		hashPath, err = exportHashPath(hashDir)
+		if err != nil {
+			return err
+		}
+		unchanged := false
+		err = withExportHashLock(cmd, hashDir, func() error {
+			key, err := exportHashKey(hashDir)
+			if err != nil {
+				return err
+			}
+			mac := hmac.New(sha256.New, key)
+			mac.Write(buf.Bytes())
+			record = fmt.Sprintf("%d %s", os.Getppid(), hex.EncodeToString(mac.Sum(nil)))
+			if stored, err := os.ReadFile(hashPath); err == nil && string(stored) == record && !cmd.Bool("force") {
+				// Keep a hash that's still in use from being pruned
+				now := time.Now()
+				_ = os.Chtimes(hashPath, now, now)
+				unchanged = true
+			}
+			return nil
+		})
+		if err != nil || unchanged {
+			return err
+		}
+	}
+
+	if opts.Template == "" {
+		diffStatus := computeEnvDiff(result.Vars)
+		if diffStatus != "" {
+			fmt.Fprintf(os.Stderr, "crumb: export %s\n", diffStatus)
+		}
+	}
+
+	if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if hashPath != "" {
+		return withExportHashLock(cmd, filepath.Dir(hashPath), func() error {
+			if err := crypto.WriteFileAtomic(hashPath, []byte(record), 0600); err != nil {
+				return fmt.Errorf("failed to record export hash: %w", err)
+			}
+			pruneExportHashes(filepath.Dir(hashPath), time.Now())
+			return nil
+		})
+	}
+	return nil
+}
+
+// exportHashMaxAge is how long an --only-changed hash that isn't used again
+// is kept
+const exportHashMaxAge = 7 * 24 * time.Hour
+
+// exportHashKeyName is the file in the exports directory holding the key
+// the hashes are computed with
+const exportHashKeyName = ".key"
+
+// exportHashLockName is the file in the exports directory that serializes
+// --only-changed runs, so concurrent shells never see a half-created key or
+// prune each other's writes
+const exportHashLockName = ".lock"
+
+// withExportHashLock runs fn while holding an exclusive lock on the exports
+// directory in dir, waiting at most --lock-timeout for it
+func withExportHashLock(cmd *cli.Command, dir string, fn func() error) error {
+	if err := mkdirWithMode(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	// The lock file's content is never used; a nil update leaves it empty
+	return crypto.UpdateFileWithLock(filepath.Join(dir, exportHashLockName), 0600, cmd.Duration("lock-timeout"), func([]byte) ([]byte, error) {
+		return nil, fn()
+	})
+}
+
+// exportHashDir returns the directory where --only-changed keeps its hashes
+func exportHashDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "crumb", "exports")
+}
+
+// exportHashPath returns the file in dir where --only-changed keeps the hash
+// of the last export printed in the current directory. The calling process,
+// usually the shell, is part of the name, so a new shell always gets a full
+// export.
+func exportHashPath(dir string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+	name := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d", cwd, os.Getppid())))
+	return filepath.Join(dir, hex.EncodeToString(name[:16])), nil
+}
+
+// exportHashKey returns the random per-user key the --only-changed hashes are
+// computed with, creating it in dir on first use. Without a secret key, a
+// stored hash of an export could be used to guess its values offline. The
+// caller holds the exports directory lock.
+func exportHashKey(dir string) ([]byte, error) {
+	keyPath := filepath.Join(dir, exportHashKeyName)
+	if key, err := os.ReadFile(keyPath); err == nil && len(key) == sha256.Size {
+		return key, nil
+	}
+
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate export hash key: %w", err)
+	}
+	if err := crypto.WriteFileAtomic(keyPath, key, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save export hash key: %w", err)
+	}
+	return key, nil
+}
+
+// pruneExportHashes removes hashes in dir that haven't been used for
+// exportHashMaxAge or whose shell has exited. Only names exportHashPath
+// produces are considered, so the key and the temp files of a concurrent
+// write are left alone. It's best effort: a hash it can't read or remove is
+// left for the next run.
+func pruneExportHashes(dir string, now time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !isExportHashName(entry.Name()) || !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) > exportHashMaxAge {
+			_ = os.Remove(path)
+			continue
+		}
+		record, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		pidField, _, _ := strings.Cut(string(record), " ")
+		if pid, err := strconv.Atoi(pidField); err != nil || !processAlive(pid) {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+// isExportHashName reports whether name looks like a file exportHashPath
+// returns: 32 lowercase hex characters
+func isExportHashName(name string) bool {
+	if len(name) != 32 {
+		return false
+	}
+	for _, c := range name {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// processAlive reports whether a process with the given pid exists
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// checkExport resolves the export like a real one but prints only how many
+// variables it would produce and any problems, failing if there are some
+func checkExport(ctx context.Context, cmd *cli.Command) error {
+	var problems []string
+	result, err := resolveExport(cmd, newProfileSecrets(ctx, cmd), cmd.String("file"))
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		problems = append(problems, result.Problems...)
+		if len(result.Vars) == 0 {
+			problems = append(problems, errNothingToExport.Error())
+		}
+		if maxLength := int(cmd.Int("max-value-length")); maxLength > 0 {
+			if err := checkValueLengths(result, maxLength); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+		fmt.Printf("%d variables would be exported\n", len(result.Vars))
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+
+	fmt.Println("Problems:")
+	for _, problem := range problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+	return fmt.Errorf("found %d problem(s)", len(problems))
+}
+
+// loadExport decrypts the stores it needs and resolves the variables to export
+func loadExport(ctx context.Context, cmd *cli.Command) (*exportResult, error) {
+	result, err := resolveExport(cmd, newProfileSecrets(ctx, cmd), cmd.String("file"))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Vars) == 0 {
+		return nil, errNothingToExport
+	}
+
+	// Encoded before the length check, since the encoded value is what ends
+	// up in the environment
+	if cmd.Bool("base64") {
+		for name, value := range result.Vars {
+			result.Vars[name] = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	}
+
+	if err := checkValueLengths(result, int(cmd.Int("max-value-length"))); err != nil {
+		return nil, err
+	}
+	if cmd.Bool("annotate-duplicates") {
+		if overlaps := result.overlappingEnvironments(); len(overlaps) > 0 {
+			fmt.Fprintln(os.Stderr, "Variables defined in more than one environment:")
+			for _, overlap := range overlaps {
+				fmt.Fprintf(os.Stderr, "  %s\n", overlap)
+			}
+		}
+	}
+	return result, nil
+}
+
+// largeValueWarningBytes is the value size above which export warns when no
+// --max-value-length is given. Linux rejects a single environment string
+// longer than 128 KiB (MAX_ARG_STRLEN) when starting a program.
+const largeValueWarningBytes = 128 * 1024
+
+// checkValueLengths fails if any value is longer than maxLength bytes, naming
+// the variables. Without a limit it only warns about values large enough to
+// break starting programs.
+func checkValueLengths(result *exportResult, maxLength int) error {
+	limit := maxLength
+	if limit <= 0 {
+		limit = largeValueWarningBytes
+	}
+
+	var oversized []string
+	for _, name := range result.orderedNames("name") {
+		if size := len(result.Vars[name]); size > limit {
+			oversized = append(oversized, fmt.Sprintf("%s (%d bytes)", name, size))
+		}
+	}
+	if len(oversized) == 0 {
+		return nil
+	}
+
+	if maxLength > 0 {
+		return fmt.Errorf("values longer than --max-value-length %d: %s", maxLength, strings.Join(oversized, ", "))
+	}
+	fmt.Fprintf(os.Stderr, "Warning: very large values can exceed the system's environment size limit: %s\n", strings.Join(oversized, ", "))
+	return nil
+}
+
+// prefixRule prefixes the names derived from secrets under PathPrefix
+type prefixRule struct {
+	PathPrefix string
+	VarPrefix  string
+}
+
+// prefixMap holds the --prefix-map rules, longest path prefix first
+type prefixMap []prefixRule
+
+// parsePrefixMap parses <pathPrefix>=<VARPREFIX> rules. The split is on the
+// last "=" since key paths may contain "=" but variable names can't.
+func parsePrefixMap(rules []string) (prefixMap, error) {
+	var prefixes prefixMap
+	for _, rule := range rules {
+		separator := strings.LastIndex(rule, "=")
+		if separator < 0 {
+			return nil, fmt.Errorf("invalid --prefix-map %q, expected <path-prefix>=<VARPREFIX>", rule)
+		}
+		pathPrefix := strings.TrimSuffix(rule[:separator], "/")
+		varPrefix := rule[separator+1:]
+		if err := config.ValidateKeyPath(pathPrefix + "/"); err != nil {
+			return nil, fmt.Errorf("invalid --prefix-map %q: %w", rule, err)
+		}
+		if strings.Trim(varPrefix, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+			return nil, fmt.Errorf("invalid --prefix-map %q: variable prefix may only contain letters, digits and '_'", rule)
+		}
+		prefixes = append(prefixes, prefixRule{PathPrefix: pathPrefix, VarPrefix: strings.ToUpper(varPrefix)})
+	}
+
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return len(prefixes[i].PathPrefix) > len(prefixes[j].PathPrefix)
+	})
+	return prefixes, nil
+}
+
+// apply prefixes name with the rule whose path prefix most specifically
+// contains secretPath, matching whole segments; name is unchanged otherwise
+func (p prefixMap) apply(secretPath, name string) string {
+	for _, rule := range p {
+		if secretPath == rule.PathPrefix || strings.HasPrefix(secretPath, rule.PathPrefix+"/") {
+			return rule.VarPrefix + name
+		}
+	}
+	return name
+}
+
+// derivedNames turns a variable name derived from a secret path into the
+// exported one: the --strip-prefix prefix is removed, then the --prefix-map
+// prefix is added
+type derivedNames struct {
+	strip    string
+	prefixes prefixMap
+}
+
+// apply returns the exported name for name, derived from secretPath. A name
+// that is nothing but the strip prefix is left alone.
+func (d derivedNames) apply(secretPath, name string) string {
+	if stripped, ok := strings.CutPrefix(name, d.strip); ok && stripped != "" {
+		name = stripped
+	}
+	return d.prefixes.apply(secretPath, name)
+}
+
+// profileSecrets decrypts profile stores on first use, so an export only
+// touches the profiles its environments actually read from
+type profileSecrets struct {
+	ctx            context.Context
+	cmd            *cli.Command
+	defaultProfile string
+	loaded         map[string]storage.SecretStore
+}
+
+func newProfileSecrets(ctx context.Context, cmd *cli.Command) *profileSecrets {
+	return &profileSecrets{ctx: ctx, cmd: cmd, defaultProfile: getProfile(cmd), loaded: make(map[string]storage.SecretStore)}
+}
+
+// load returns the secrets of the named profile, or of the command line
+// profile when profile is empty
+func (p *profileSecrets) load(profile string) (storage.SecretStore, error) {
+	if profile == "" {
+		profile = p.defaultProfile
+	}
+	if secrets, ok := p.loaded[profile]; ok {
+		return secrets, nil
+	}
+
+	store, err := resolveProfileStore(p.ctx, p.cmd, profile)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	p.loaded[profile] = secrets
+	return secrets, nil
+}
+
+// resolveExport maps secrets to environment variables, either from --path or
+// from the selected environment in configFile. An environment with a profile
+// reads from that profile's store instead of the command line one.
+func resolveExport(cmd *cli.Command, stores *profileSecrets, configFile string) (*exportResult, error) {
+	pathFlag := cmd.String("path")
+	nameSegments := int(cmd.Int("name-segments"))
+	if nameSegments < 1 {
+		return nil, fmt.Errorf("--name-segments must be at least 1")
+	}
+
+	prefixes, err := parsePrefixMap(cmd.StringSlice("prefix-map"))
+	if err != nil {
+		return nil, err
+	}
+	// Derived names are always upper case, so the prefix is too
+	names := derivedNames{strip: strings.ToUpper(cmd.String("strip-prefix")), prefixes: prefixes}
+
+	nameFilter, err := compileNameFilter("name-filter", cmd.String("name-filter"))
+	if err != nil {
+		return nil, err
+	}
+	excludeFilter, err := compileNameFilter("exclude-filter", cmd.String("exclude-filter"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := newExportResult()
+
+	// Variables from --merge-file are seeded first so crumb's values override them
+	if mergeFile := cmd.String("merge-file"); mergeFile != "" {
+		fileVars, err := storage.ParseEnvFile(mergeFile)
+		if err != nil {
+			return nil, err
+		}
+		result.Comments = append(result.Comments, fmt.Sprintf("# Merged from %s", mergeFile))
+		for key, value := range fileVars {
+			result.set(key, value, "")
+		}
+	}
+
+	if pathFlag != "" {
+		secrets, err := stores.load("")
+		if err != nil {
+			return nil, err
+		}
+		isPathPrefix := strings.HasSuffix(pathFlag, "/")
+
+		if isPathPrefix {
+			pathPrefix := strings.TrimSuffix(pathFlag, "/")
+			result.Comments = append(result.Comments, fmt.Sprintf("# Exported from %s", pathPrefix))
+
+			// Sorted like an environment's path, so colliding names resolve the same way every run
+			pathSecrets := storage.GetSecretsForPath(secrets, pathPrefix)
+			var secretPaths []string
+			for secretPath := range pathSecrets {
+				secretPaths = append(secretPaths, secretPath)
+			}
+			sort.Strings(secretPaths)
+			for _, secretPath := range secretPaths {
+				keyName := storage.ConvertPathToEnvVar(secretPath, pathPrefix, nameSegments)
+				if keyName != "" {
+					result.set(names.apply(secretPath, keyName), pathSecrets[secretPath], secretPath)
+				}
+			}
+		} else {
+			if entry, exists := storage.SecretExists(secrets, pathFlag); exists {
+				result.Comments = append(result.Comments, fmt.Sprintf("# Exported from %s", pathFlag))
+
+				keyName := storage.ConvertPathToEnvVar(pathFlag, "", nameSegments)
+				if keyName != "" {
+					result.set(names.apply(pathFlag, keyName), entry.Value, pathFlag)
+				}
+			}
+		}
+	} else {
+		crumbConfig, configFile, environmentNames, err := selectEnvironments(cmd, configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range environmentNames {
+			secrets, err := stores.load(crumbConfig.Environments[name].Profile)
+			if err != nil {
+				return nil, fmt.Errorf("environment '%s': %w", name, err)
+			}
+			envResult, err := resolveEnvironment(crumbConfig.Environments[name], name, configFile, secrets, names, cmd.Bool("strict-remap"), cmd.Bool("strict-env"))
+			if err != nil {
+				return nil, err
+			}
+			result.Comments = append(result.Comments, envResult.Comments...)
+			for _, problem := range envResult.Problems {
+				result.Problems = append(result.Problems, fmt.Sprintf("environment '%s': %s", name, problem))
+			}
+			for key, value := range envResult.Vars {
+				result.set(key, value, envResult.Sources[key])
+				result.DefinedIn[key] = append(result.DefinedIn[key], name)
+			}
+		}
+	}
+
+	// Filters see the final, remapped names
+	result.filterNames(nameFilter, excludeFilter)
+
+	return result, nil
+}
+
+// selectEnvironments finds the .crumb.yaml an export reads, searching parent
+// directories unless --no-parent-search is set, and returns it with its path
+// and the environments --env (or --env-from-branch) selects in it.
+func selectEnvironments(cmd *cli.Command, configFile string) (*config.CrumbConfig, string, []string, error) {
+	if !cmd.Bool("no-parent-search") {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to get current directory: %w", err)
+		}
+		configFile, err = config.FindCrumbConfig(cwd, configFile)
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	crumbConfig, err := config.LoadCrumbConfig(configFile)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	environmentName := cmd.String("env")
+	if cmd.Bool("env-from-branch") {
+		environmentName, err = environmentForBranch(crumbConfig, configFile, environmentName)
+		if err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	// A comma-separated --env layers environments in order; later ones win
+	environmentNames := strings.Split(environmentName, ",")
+	for i, name := range environmentNames {
+		environmentNames[i] = strings.TrimSpace(name)
+		if _, exists := crumbConfig.Environments[environmentNames[i]]; !exists {
+			return nil, "", nil, fmt.Errorf("environment '%s' not found in %s", environmentNames[i], configFile)
+		}
+	}
+	return crumbConfig, configFile, environmentNames, nil
+}
+
+// exportInputs returns the local files an export with cmd's flags reads: the
+// profile config, --merge-file, the .crumb.yaml with its env files, and the
+// storage file of every profile the export takes secrets from. Stores that
+// aren't local files can't be stat'ed and are left out; their profiles are
+// returned as remote. state holds what the export depends on besides files:
+// the selected environments, the git branch with --env-from-branch and the
+// process environment variables that env literals expand. Nothing is
+// decrypted.
+func exportInputs(cmd *cli.Command) (inputs, remote, state []string, err error) {
+	inputs = []string{filepath.Join(os.Getenv("HOME"), ".config", "crumb", "config.yaml")}
+	if mergeFile := cmd.String("merge-file"); mergeFile != "" {
+		inputs = append(inputs, mergeFile)
+	}
+
+	profiles := []string{""}
+	if cmd.String("path") == "" {
+		crumbConfig, configFile, environmentNames, err := selectEnvironments(cmd, cmd.String("file"))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		inputs = append(inputs, configFile)
+		state = append(state, "env="+strings.Join(environmentNames, ","))
+		if cmd.Bool("env-from-branch") {
+			branch, err := config.GitBranch(filepath.Dir(configFile))
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			state = append(state, "branch="+branch)
+		}
+
+		profiles = nil
+		for _, name := range environmentNames {
+			envConfig := crumbConfig.Environments[name]
+			for _, envFile := range envConfig.EnvFiles {
+				inputs = append(inputs, resolveEnvFilePath(configFile, envFile))
+			}
+			state = append(state, processEnvState(envConfig.Env)...)
+			profiles = append(profiles, envConfig.Profile)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, profile := range profiles {
+		if profile == "" {
+			profile = getProfile(cmd)
+		}
+		if seen[profile] {
+			continue
+		}
+		seen[profile] = true
+
+		_, b, err := resolveProfileBackend(cmd, profile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if fileBackend, ok := b.(*backend.FileBackend); ok {
+			inputs = append(inputs, fileBackend.Path)
+		} else {
+			remote = append(remote, profile)
+		}
+	}
+	return inputs, remote, state, nil
+}
+
+// processEnvState returns NAME=value for every process environment variable
+// the literals in an environment's env section expand, in sorted order, and
+// NAME unset for those that aren't set
+func processEnvState(env map[string]string) []string {
+	names := make(map[string]bool)
+	for _, envVarValue := range env {
+		if strings.HasPrefix(envVarValue, literalPrefix) || strings.HasPrefix(envVarValue, "/") {
+			continue
+		}
+		os.Expand(envVarValue, func(name string) string {
+			if name != "$" {
+				names[name] = true
+			}
+			return ""
+		})
+	}
+
+	var state []string
+	for name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			state = append(state, fmt.Sprintf("$%s=%s", name, value))
+		} else {
+			state = append(state, fmt.Sprintf("$%s unset", name))
+		}
+	}
+	sort.Strings(state)
+	return state
+}
+
+// exportFingerprint hashes the path, size and modification time of every
+// input along with state, so it changes whenever an input is written or the
+// export would select or expand something else
+func exportFingerprint(inputs, state []string) string {
+	hash := sha256.New()
+	for _, input := range inputs {
+		fmt.Fprintf(hash, "%s\x00", input)
+		if info, err := os.Stat(input); err == nil {
+			fmt.Fprintf(hash, "%d\x00%d", info.Size(), info.ModTime().UnixNano())
+		}
+		hash.Write([]byte("\n"))
+	}
+	for _, entry := range state {
+		fmt.Fprintf(hash, "%s\n", entry)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// environmentForBranch returns the environment branch_map assigns to the git
+// branch checked out where configFile lives, or fallback when the branch
+// isn't mapped, HEAD is detached or the directory isn't a git work tree
+func environmentForBranch(crumbConfig *config.CrumbConfig, configFile, fallback string) (string, error) {
+	if len(crumbConfig.BranchMap) == 0 {
+		return "", fmt.Errorf("--env-from-branch needs a branch_map in %s", configFile)
+	}
+
+	branch, err := config.GitBranch(filepath.Dir(configFile))
+	if err != nil {
+		return "", err
+	}
+	if environment, ok := crumbConfig.BranchMap[branch]; ok && branch != "" {
+		return environment, nil
+	}
+	return fallback, nil
+}
+
+// errNothingToExport is reported when resolution produced no variables
+var errNothingToExport = errors.New("no secrets found to export")
+
+// resolveEnvironment maps secrets to variables for a single .crumb.yaml
+// environment: its env files, then its path, then its env entries, then its
+// remaps. Names derived from the path lose their --strip-prefix prefix and
+// get their --prefix-map prefix before remapping. With strictRemap, a remap
+// whose source variable wasn't produced is an error; with strictEnv, so is an
+// env entry referring to an unset process environment variable.
+func resolveEnvironment(envConfig config.EnvironmentConfig, environmentName, configFile string, secrets storage.SecretStore, names derivedNames, strictRemap, strictEnv bool) (*exportResult, error) {
+	result := newExportResult()
+
+	for _, envFile := range envConfig.EnvFiles {
+		envFilePath := resolveEnvFilePath(configFile, envFile)
+		fileVars, err := storage.ParseEnvFile(envFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("env_files entry %s for environment '%s' in %s: %w", envFile, environmentName, configFile, err)
+		}
+		result.Comments = append(result.Comments, fmt.Sprintf("# Included %s (environment: %s)", envFile, environmentName))
+		for key, value := range fileVars {
+			result.set(key, value, "")
+		}
+	}
+
+	if envConfig.Path != "" {
+		result.Comments = append(result.Comments, fmt.Sprintf("# Exported from %s (environment: %s)", envConfig.Path, environmentName))
+
+		pathPrefix := strings.TrimSuffix(envConfig.Path, "/")
+		pathSecrets := storage.GetSecretsForPath(secrets, pathPrefix)
+		if len(pathSecrets) == 0 {
+			result.Problems = append(result.Problems, fmt.Sprintf("no secrets found under path %s", envConfig.Path))
+		}
+		// Paths are visited in sorted order so that when two of them name the
+		// same variable (db-pass and db_pass), the same one wins every run
+		var secretPaths []string
+		for secretPath := range pathSecrets {
+			secretPaths = append(secretPaths, secretPath)
+		}
+		sort.Strings(secretPaths)
+		for _, secretPath := range secretPaths {
+			secretValue := pathSecrets[secretPath]
+			// The name joins every segment below the path, which never
+			// outnumber the segments of the whole secret path
+			keyName := storage.ConvertPathToEnvVar(secretPath, pathPrefix, strings.Count(secretPath, "/")+1)
+
+			if keyName != "" {
+				result.set(names.apply(secretPath, keyName), secretValue, secretPath)
+			}
+		}
+	}
+
+	var envVarNames []string
+	for envVarName := range envConfig.Env {
+		envVarNames = append(envVarNames, envVarName)
+	}
+	sort.Strings(envVarNames)
+	for _, envVarName := range envVarNames {
+		envVarValue := envConfig.Env[envVarName]
+		sanitizedEnvVarName := strings.ToUpper(strings.ReplaceAll(envVarName, "-", "_"))
+
+		if value, source, ok := resolveEnvValue(envVarValue, secrets); ok {
+			if source == "" && !strings.HasPrefix(envVarValue, literalPrefix) {
+				expanded, unset := expandProcessEnv(value)
+				if len(unset) > 0 && strictEnv {
+					return nil, fmt.Errorf("env %s for environment '%s' in %s uses unset variables: %s", envVarName, environmentName, configFile, strings.Join(unset, ", "))
+				}
+				value = expanded
+			}
+			result.set(sanitizedEnvVarName, value, source)
+		} else {
+			result.Problems = append(result.Problems, fmt.Sprintf("env %s refers to missing secret %s", envVarName, envVarValue))
+		}
+	}
+
+	if err := applyRemap(result, envConfig.Remap, strictRemap); err != nil {
+		return nil, fmt.Errorf("invalid remap for environment '%s' in %s: %w", environmentName, configFile, err)
+	}
+
+	return result, nil
+}
+
+// resolveEnvFilePath resolves an env_files entry relative to the directory of
+// the .crumb.yaml that lists it
+func resolveEnvFilePath(configFile, envFile string) string {
+	envFile = config.ExpandTilde(envFile)
+	if filepath.IsAbs(envFile) {
+		return envFile
+	}
+	return filepath.Join(filepath.Dir(configFile), envFile)
+}
+
+// literalPrefix marks an env-section value as literal text even if it starts with "/"
+const literalPrefix = "literal:"
+
+// resolveEnvValue resolves a value from an environment's env section. Values
+// prefixed with "literal:" are used verbatim without the prefix, values
+// starting with "/" are secret paths (ok is false if the secret is missing),
+// and anything else is a literal, which resolveEnvironment expands against
+// the process environment. source is the secret path, or "" for literals.
+func resolveEnvValue(envVarValue string, secrets storage.SecretStore) (value, source string, ok bool) {
+	if literal, isLiteral := strings.CutPrefix(envVarValue, literalPrefix); isLiteral {
+		return literal, "", true
+	}
+	if strings.HasPrefix(envVarValue, "/") {
+		entry, exists := storage.SecretExists(secrets, envVarValue)
+		return entry.Value, envVarValue, exists
+	}
+	return envVarValue, "", true
+}
+
+// expandProcessEnv replaces ${VAR} and $VAR in an env-section literal with
+// the process environment, returning the names that weren't set. Unset
+// variables expand to "" and $$ is a literal "$".
+func expandProcessEnv(value string) (string, []string) {
+	var unset []string
+	expanded := os.Expand(value, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			unset = append(unset, name)
+		}
+		return envValue
+	})
+	return expanded, unset
+}
+
+// applyRemap renames variables according to remap. Sources are processed in
+// sorted order against the variables as they were before remapping, so the
+// result doesn't depend on map iteration order. Several sources may share a
+// target only if their values are identical. A remapped value replaces a
+// different value already using the target name, unless that variable is
+// itself remapped away; the replacement is reported as a problem. Remaps
+// whose source doesn't exist are skipped. When strict is set, both missing
+// sources and replaced variables are errors.
+func applyRemap(result *exportResult, remap map[string]string, strict bool) error {
+	envVars := result.Vars
+
+	var sources []string
+	renamed := make(map[string]bool)
+	for originalKey := range remap {
+		sources = append(sources, originalKey)
+		renamed[strings.ToUpper(strings.ReplaceAll(originalKey, "-", "_"))] = true
+	}
+	sort.Strings(sources)
+
+	remapped := make(map[string]string)
+	remappedSources := make(map[string]string)
+	claimedBy := make(map[string]string)
+	var missing, replaced []string
+	for _, originalKey := range sources {
+		sanitizedOriginalKey := strings.ToUpper(strings.ReplaceAll(originalKey, "-", "_"))
+		sanitizedNewKey := strings.ToUpper(strings.ReplaceAll(remap[originalKey], "-", "_"))
+
+		value, exists := envVars[sanitizedOriginalKey]
+		if !exists {
+			missing = append(missing, fmt.Sprintf("%s -> %s", originalKey, remap[originalKey]))
+			continue
+		}
+
+		if previous, claimed := claimedBy[sanitizedNewKey]; claimed && remapped[sanitizedNewKey] != value {
+			return fmt.Errorf("%s and %s both remap to %s with different values", previous, sanitizedOriginalKey, sanitizedNewKey)
+		}
+		if _, claimed := claimedBy[sanitizedNewKey]; !claimed {
+			claimedBy[sanitizedNewKey] = sanitizedOriginalKey
+			remappedSources[sanitizedNewKey] = result.Sources[sanitizedOriginalKey]
+			if existing, ok := envVars[sanitizedNewKey]; ok && existing != value && !renamed[sanitizedNewKey] {
+				replaced = append(replaced, fmt.Sprintf("%s -> %s", sanitizedOriginalKey, sanitizedNewKey))
+			}
+		}
+		remapped[sanitizedNewKey] = value
+	}
+
+	if len(missing) > 0 {
+		if strict {
+			return fmt.Errorf("remap source not found: %s", strings.Join(missing, ", "))
+		}
+		result.Problems = append(result.Problems, fmt.Sprintf("remap source not found: %s", strings.Join(missing, ", ")))
+	}
+	if len(replaced) > 0 {
+		if strict {
+			return fmt.Errorf("remap target already exported with a different value: %s", strings.Join(replaced, ", "))
+		}
+		result.Problems = append(result.Problems, fmt.Sprintf("remap replaces a variable that was already exported: %s", strings.Join(replaced, ", ")))
+	}
+
+	for _, originalKey := range sources {
+		sanitizedOriginalKey := strings.ToUpper(strings.ReplaceAll(originalKey, "-", "_"))
+		delete(envVars, sanitizedOriginalKey)
+		delete(result.Sources, sanitizedOriginalKey)
+	}
+	for newKey, value := range remapped {
+		result.set(newKey, value, remappedSources[newKey])
+	}
+
+	return nil
+}
+
+// supportedExportFormats lists the --format values understood by export
+var supportedExportFormats = []string{"shell", "dotenv", "laravel", "compose", "vault", "null"}
+
+// supportedExportShells lists the --shell values understood by export and get --export
+var supportedExportShells = []string{"bash", "zsh", "fish", "csh", "tcsh", "elvish"}
+
+// validateExportShell rejects shells writeExport has no syntax for, so an
+// unknown --shell fails instead of silently producing empty output
+func validateExportShell(shell string) error {
+	if slices.Contains(supportedExportShells, shell) {
+		return nil
+	}
+	return fmt.Errorf("unsupported shell format: %s (supported: %s)", shell, strings.Join(supportedExportShells, ", "))
+}
+
+// renderExport writes the export as configured: the rendered --template if
+// one was given, otherwise the variable assignments
+func renderExport(w io.Writer, opts exportOptions, result *exportResult) error {
+	if err := checkMultilineValues(opts, result); err != nil {
+		return err
+	}
+	if opts.Template == "" {
+		writeExport(w, opts, result)
+		return nil
+	}
+	return renderExportTemplate(w, opts.Template, result)
+}
+
+// checkMultilineValues looks for values with line breaks before they're
+// written. Shell, dotenv, laravel, compose, vault and null output quote or
+// escape them, but the csh hook evals the output as one line, so csh and tcsh
+// need --allow-multiline. A template's output format is unknown, so it only
+// gets a warning.
+func checkMultilineValues(opts exportOptions, result *exportResult) error {
+	var multiline []string
+	for _, name := range result.orderedNames("name") {
+		value := result.Vars[name]
+		if strings.ContainsAny(value, "\n\r") && !opts.masks(value) {
+			multiline = append(multiline, name)
+		}
+	}
+	if len(multiline) == 0 {
+		return nil
+	}
+
+	switch {
+	case opts.Template != "":
+		fmt.Fprintf(os.Stderr, "Warning: values with line breaks may not survive the template's output format: %s\n", strings.Join(multiline, ", "))
+	case opts.Format == "shell" && isCshShell(opts.Shell) && !opts.AllowMultiline:
+		return fmt.Errorf("values with line breaks can't be exported safely for %s: %s (pass --allow-multiline to export them anyway)", opts.Shell, strings.Join(multiline, ", "))
+	}
+	return nil
+}
+
+// renderExportTemplate executes the text/template in templatePath with the
+// resolved variables as its data, e.g. {{ .DB_PASSWORD }}. A reference to a
+// variable that wasn't resolved is an error rather than an empty string.
+func renderExportTemplate(w io.Writer, templatePath string, result *exportResult) error {
+	content, err := os.ReadFile(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to read template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(templatePath)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s: %w", templatePath, err)
+	}
+
+	if err := tmpl.Execute(w, result.Vars); err != nil {
+		return fmt.Errorf("failed to render template %s: %w", templatePath, err)
+	}
+	return nil
+}
+
+// writeExport writes the comments and variable assignments in the given
+// shell's syntax, or NUL-terminated records for the "null" format. The shell
+// must have passed validateExportShell.
+func writeExport(w io.Writer, opts exportOptions, result *exportResult) {
+	shell := opts.Shell
+
+	// NUL-delimited consumers (env -0, xargs -0) read values literally, so
+	// records are neither quoted nor commented
+	if opts.Format == "null" {
+		for _, key := range result.orderedNames(opts.SortBy) {
+			value := result.Vars[key]
+			if opts.masks(value) {
+				value = maskSecret(value, opts.MaskStyle)
+			}
+			fmt.Fprintf(w, "%s=%s\x00", key, value)
+		}
+		return
+	}
+	if opts.Format == "compose" {
+		writeComposeExport(w, opts, result)
+		return
+	}
+	if opts.Format == "vault" {
+		writeVaultExport(w, opts, result)
+		return
+	}
+
+	// Interactive csh doesn't treat # as a comment, and the csh hook evals the
+	// output as a single line, so comments are left out for csh
+	comments := !opts.NoComments && (opts.Format == "dotenv" || opts.Format == "laravel" || !isCshShell(shell))
+	if comments {
+		for _, comment := range result.Comments {
+			fmt.Fprintln(w, comment)
+		}
+	}
+
+	for _, key := range result.orderedNames(opts.SortBy) {
+		value := result.Vars[key]
+		if source, ok := result.Sources[key]; ok && comments && opts.CommentSource {
+			fmt.Fprintf(w, "# from %s\n", source)
+		}
+		if opts.Format == "dotenv" {
+			writeDotenvValue(w, opts, key, value)
+			continue
+		}
+		if opts.Format == "laravel" {
+			if opts.masks(value) {
+				fmt.Fprintf(w, "%s=%s\n", key, maskSecret(value, opts.MaskStyle))
+			} else {
+				fmt.Fprintf(w, "%s=%s\n", key, storage.LaravelQuoteValue(value))
+			}
+			continue
+		}
+		var quotedValue string
+		switch {
+		case shell == "fish" && opts.QuoteAll:
+			quotedValue = storage.FishQuoteAlways(value)
+		case shell == "fish":
+			quotedValue = storage.FishQuoteValue(value)
+		case opts.QuoteAll:
+			quotedValue = storage.ShellQuoteAlways(value)
+		default:
+			quotedValue = storage.ShellQuoteValue(value)
+		}
+		masked := opts.masks(value)
+		if masked {
+			quotedValue = maskSecret(value, opts.MaskStyle)
+		}
+		switch shell {
+		case "bash", "zsh":
+			fmt.Fprintf(w, "export %s=%s\n", key, quotedValue)
+		case "fish":
+			fmt.Fprintf(w, "set -x -g %s %s\n", key, quotedValue)
+		case "csh", "tcsh":
+			if !masked {
+				quotedValue = storage.CshQuoteValue(value)
+			}
+			fmt.Fprintf(w, "setenv %s %s;\n", key, quotedValue)
+		case "elvish":
+			// A bare **** would be a glob in elvish, so masked values are quoted too
+			if masked {
+				quotedValue = storage.ElvishQuoteValue(quotedValue)
+			} else {
+				quotedValue = storage.ElvishQuoteValue(value)
+			}
+			fmt.Fprintf(w, "set-env %s %s\n", key, quotedValue)
+		}
+	}
+}
+
+// writeDotenvValue writes a single KEY=value line. With EscapeDollar, $ is
+// doubled before quoting, following docker compose's interpolation rules.
+func writeDotenvValue(w io.Writer, opts exportOptions, key, value string) {
+	if opts.masks(value) {
+		fmt.Fprintf(w, "%s=%s\n", key, maskSecret(value, opts.MaskStyle))
+		return
+	}
+	if opts.EscapeDollar {
+		value = strings.ReplaceAll(value, "$", "$$")
+	}
+	fmt.Fprintf(w, "%s=%s\n", key, storage.DotenvQuoteValue(value))
+}
+
+// writeComposeExport writes the variables as a YAML environment: mapping to
+// paste into a compose service definition. Every value is double-quoted and
+// has its $ doubled, since compose interpolates the file before using it.
+func writeComposeExport(w io.Writer, opts exportOptions, result *exportResult) {
+	comments := !opts.NoComments
+	if comments {
+		for _, comment := range result.Comments {
+			fmt.Fprintln(w, comment)
+		}
+	}
+
+	names := result.orderedNames(opts.SortBy)
+	if len(names) == 0 {
+		fmt.Fprintln(w, "environment: {}")
+		return
+	}
+
+	indent := strings.Repeat(" ", opts.Indent)
+	fmt.Fprintln(w, "environment:")
+	for _, key := range names {
+		value := result.Vars[key]
+		if source, ok := result.Sources[key]; ok && comments && opts.CommentSource {
+			fmt.Fprintf(w, "%s# from %s\n", indent, source)
+		}
+		if opts.masks(value) {
+			value = maskSecret(value, opts.MaskStyle)
+		} else {
+			value = strings.ReplaceAll(value, "$", "$$")
+		}
+		fmt.Fprintf(w, "%s%s: %s\n", indent, key, yamlQuoteValue(value))
+	}
+}
+
+// vaultHeredocDelimiter ends the JSON payload of each vault kv put command.
+// The payload is a single line starting with "{", so it can't end early.
+const vaultHeredocDelimiter = "CRUMB_EOF"
+
+// writeVaultExport writes a vault kv put command for each secret path with
+// variables, with the parent of each secret's path as the Vault path and its
+// last segment as the field. Values are passed as JSON on stdin, because
+// vault reads a command-line value starting with "@" from a file. Variables
+// that don't come from a secret, such as literals, have no path and are left
+// out with a warning.
+func writeVaultExport(w io.Writer, opts exportOptions, result *exportResult) {
+	if !opts.NoComments {
+		for _, comment := range result.Comments {
+			fmt.Fprintln(w, comment)
+		}
+	}
+
+	fields := make(map[string]map[string]string)
+	skipped := 0
+	for name, value := range result.Vars {
+		source, ok := result.Sources[name]
+		if !ok {
+			skipped++
+			continue
+		}
+		vaultPath, field := vaultPathAndField(source)
+		if fields[vaultPath] == nil {
+			fields[vaultPath] = make(map[string]string)
+		}
+		if opts.masks(value) {
+			value = maskSecret(value, opts.MaskStyle)
+		}
+		fields[vaultPath][field] = value
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: --format vault left out %d variable(s) that don't come from a secret path\n", skipped)
+	}
+
+	var paths []string
+	for vaultPath := range fields {
+		paths = append(paths, vaultPath)
+	}
+	sort.Strings(paths)
+
+	for _, vaultPath := range paths {
+		// Map keys are sorted by encoding/json, so output is stable
+		payload, _ := json.Marshal(fields[vaultPath])
+		fmt.Fprintf(w, "vault kv put -mount=%s %s - <<'%s'\n%s\n%s\n",
+			storage.ShellQuoteValue(opts.Mount), storage.ShellQuoteValue(vaultPath), vaultHeredocDelimiter, payload, vaultHeredocDelimiter)
+	}
+}
+
+// vaultPathAndField splits a secret path such as /myapp/db/password into the
+// Vault path myapp/db and the field password. A top-level secret such as
+// /token becomes the field "value" of the Vault path token.
+func vaultPathAndField(secretPath string) (string, string) {
+	trimmed := strings.Trim(secretPath, "/")
+	i := strings.LastIndex(trimmed, "/")
+	if i < 0 {
+		return trimmed, "value"
+	}
+	return trimmed[:i], trimmed[i+1:]
+}
+
+// yamlQuoteValue returns value as a YAML double-quoted scalar. JSON strings
+// are valid double-quoted YAML, so the JSON encoder does the escaping.
+func yamlQuoteValue(value string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(value)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// orderedNames returns the variable names sorted by name, or with sortBy
+// "path" by the secret path they came from. Literal values have no path and
+// follow the secrets, sorted by name.
+func (r *exportResult) orderedNames(sortBy string) []string {
+	var names []string
+	for name := range r.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if sortBy == "path" {
+		sort.SliceStable(names, func(i, j int) bool {
+			sourceI, hasI := r.Sources[names[i]]
+			sourceJ, hasJ := r.Sources[names[j]]
+			if hasI != hasJ {
+				return hasI
+			}
+			return sourceI < sourceJ
+		})
+	}
+
+	return names
+}
+
+// isCshShell reports whether shell uses csh syntax
+func isCshShell(shell string) bool {
+	return shell == "csh" || shell == "tcsh"
+}
+
+// writeExportFile resolves the export and atomically writes it to outputPath.
+// The file may contain secrets, so it is only readable by the owner.
+func writeExportFile(ctx context.Context, cmd *cli.Command, opts exportOptions, outputPath string) error {
+	result, err := loadExport(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := renderExport(&buf, opts, result); err != nil {
+		return err
+	}
+
+	content := buf.Bytes()
+	if cmd.Bool("merge") {
+		existing, err := os.ReadFile(outputPath)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %w", outputPath, err)
+		}
+		merged, err := mergeManagedBlock(string(existing), buf.String(), result.Vars)
+		if err != nil {
+			return fmt.Errorf("failed to merge into %s: %w", outputPath, err)
+		}
+		content = []byte(merged)
+	}
+
+	if err := crypto.WriteFileAtomic(outputPath, content, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	return nil
+}
+
+// Markers around the part of an --output --merge file that crumb rewrites
+const (
+	managedBlockBegin = "# crumb:managed begin"
+	managedBlockEnd   = "# crumb:managed end"
+)
+
+// mergeManagedBlock puts block between crumb's markers in existing, leaving
+// every other line alone. The block replaces the previous marked region, or
+// is appended if there is none. Lines outside it that assign one of the
+// managed variables are dropped, since crumb's value now takes their place.
+func mergeManagedBlock(existing, block string, managed map[string]string) (string, error) {
+	lines := strings.Split(strings.ReplaceAll(existing, "\r\n", "\n"), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var kept []string
+	blockAt := -1
+	inside := false
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case managedBlockBegin:
+			if blockAt != -1 {
+				return "", fmt.Errorf("line %d: more than one %q", i+1, managedBlockBegin)
+			}
+			blockAt = len(kept)
+			inside = true
+			continue
+		case managedBlockEnd:
+			if !inside {
+				return "", fmt.Errorf("line %d: %q without %q", i+1, managedBlockEnd, managedBlockBegin)
+			}
+			inside = false
+			continue
+		}
+		if inside {
+			continue
+		}
+		if _, ok := managed[assignedName(line)]; ok {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if inside {
+		return "", fmt.Errorf("%q is never closed by %q", managedBlockBegin, managedBlockEnd)
+	}
+
+	region := []string{managedBlockBegin}
+	region = append(region, strings.Split(strings.TrimSuffix(block, "\n"), "\n")...)
+	region = append(region, managedBlockEnd)
+	if blockAt == -1 {
+		if len(kept) > 0 && strings.TrimSpace(kept[len(kept)-1]) != "" {
+			kept = append(kept, "")
+		}
+		blockAt = len(kept)
+	}
+
+	merged := append(kept[:blockAt:blockAt], region...)
+	merged = append(merged, kept[blockAt:]...)
+	return strings.Join(merged, "\n") + "\n", nil
+}
+
+// assignedName returns the variable a KEY=value or export KEY=value line
+// sets, or "" for anything else
+func assignedName(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#") {
+		return ""
+	}
+	line = strings.TrimPrefix(line, "export ")
+	name, _, ok := strings.Cut(line, "=")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(name)
+}
+
+// watchExport writes the export to outputPath and rewrites it whenever one of
+// the files the export reads changes, until interrupted. The inputs are
+// resolved again on every poll, so an edited .crumb.yaml that adds an env file
+// or switches profiles is followed too.
+func watchExport(ctx context.Context, cmd *cli.Command, opts exportOptions, outputPath string) error {
+	inputs, remote, state, err := exportInputs(cmd)
+	if err != nil {
+		return err
+	}
+	if len(remote) > 0 {
+		return fmt.Errorf("--watch is only supported for local storage (profile %s)", strings.Join(remote, ", "))
+	}
+
+	if err := writeExportFile(ctx, cmd, opts, outputPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "crumb: wrote %s, watching %s for changes (Ctrl+C to stop)\n", outputPath, strings.Join(inputs, ", "))
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	// A .crumb.yaml caught mid-edit may not resolve; that counts as a change,
+	// and the re-export reports the error
+	fingerprint := func() string {
+		inputs, _, state, err := exportInputs(cmd)
+		if err != nil {
+			return ""
+		}
+		return exportFingerprint(inputs, state)
+	}
+
+	lastFingerprint := exportFingerprint(inputs, state)
+	var changedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr, "crumb: stopped watching")
+			return nil
+		case <-ticker.C:
+			current := fingerprint()
+			if current != lastFingerprint {
+				// Restart the debounce window on every change so bursts of writes
+				// produce a single re-export
+				lastFingerprint = current
+				changedAt = time.Now()
+				continue
+			}
+			if changedAt.IsZero() || time.Since(changedAt) < watchDebounce {
+				continue
+			}
+			changedAt = time.Time{}
+
+			if err := writeExportFile(ctx, cmd, opts, outputPath); err != nil {
+				fmt.Fprintf(os.Stderr, "crumb: %v\n", err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "crumb: inputs changed, rewrote %s\n", outputPath)
+		}
+	}
+}
@@ -0,0 +1,2138 @@
+package commands
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+
+	"crumb/pkg/storage"
+)
+
+func TestExportCommandOutputFile(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/api-key": "secret123",
+		"/app/db-host": "localhost",
+	})
+
+	outputPath := filepath.Join(profile.Home, "app.env")
+	stdout, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--output", outputPath}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if stdout != "" {
+		t.Errorf("expected nothing on stdout with --output, got: %q", stdout)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	expected := "# Exported from /app\nexport API_KEY=secret123\nexport DB_HOST=localhost\n"
+	if string(data) != expected {
+		t.Errorf("output file = %q, want %q", string(data), expected)
+	}
+
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat output file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("output file mode = %o, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestExportCommandOutputMerge(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/api-key": "new-key",
+		"/app/db-host": "db.internal",
+	})
+
+	outputPath := filepath.Join(profile.Home, "app.env")
+	existing := "# Local overrides\n" +
+		"DEBUG=true\n" +
+		"DB_HOST=localhost\n" +
+		"\n" +
+		"# crumb:managed begin\n" +
+		"API_KEY=old-key\n" +
+		"REMOVED=gone\n" +
+		"# crumb:managed end\n" +
+		"PORT=8080\n"
+	if err := os.WriteFile(outputPath, []byte(existing), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"--path", "/app/", "--format", "dotenv", "--no-comments", "--output", outputPath, "--merge"}
+	if _, err := runTestCommand(t, ExportCommand, exportTestFlags(), args, ""); err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	want := "# Local overrides\n" +
+		"DEBUG=true\n" +
+		"\n" +
+		"# crumb:managed begin\n" +
+		"API_KEY=new-key\n" +
+		"DB_HOST=db.internal\n" +
+		"# crumb:managed end\n" +
+		"PORT=8080\n"
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if string(data) != want {
+		t.Errorf("merged file = %q, want %q", string(data), want)
+	}
+
+	// Merging again changes nothing
+	if _, err := runTestCommand(t, ExportCommand, exportTestFlags(), args, ""); err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if data, _ := os.ReadFile(outputPath); string(data) != want {
+		t.Errorf("second merge = %q, want %q", string(data), want)
+	}
+
+	// A file without markers gets the block appended
+	manualPath := filepath.Join(profile.Home, "manual.env")
+	if err := os.WriteFile(manualPath, []byte("DEBUG=true"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	args = []string{"--path", "/app/", "--format", "dotenv", "--no-comments", "--output", manualPath, "--merge"}
+	if _, err := runTestCommand(t, ExportCommand, exportTestFlags(), args, ""); err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	want = "DEBUG=true\n\n# crumb:managed begin\nAPI_KEY=new-key\nDB_HOST=db.internal\n# crumb:managed end\n"
+	if data, _ := os.ReadFile(manualPath); string(data) != want {
+		t.Errorf("appended block = %q, want %q", string(data), want)
+	}
+
+	if err := os.WriteFile(manualPath, []byte("# crumb:managed begin\nAPI_KEY=x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runTestCommand(t, ExportCommand, exportTestFlags(), args, ""); err == nil || !strings.Contains(err.Error(), "is never closed") {
+		t.Errorf("expected an unclosed block error, got: %v", err)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--merge"}, "")
+	if err == nil || err.Error() != "--merge requires --output" {
+		t.Errorf("expected --merge to require --output, got: %v", err)
+	}
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "compose", "--output", outputPath, "--merge"}, "")
+	if err == nil || !strings.HasPrefix(err.Error(), "--merge only applies to") {
+		t.Errorf("expected --merge to reject compose, got: %v", err)
+	}
+}
+
+func TestExportCommandOnlyChanged(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/api-key": "secret123"})
+	args := []string{"--path", "/app/", "--only-changed"}
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), args, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "export API_KEY=secret123\n") {
+		t.Fatalf("first run output = %q, want the export", output)
+	}
+
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), args, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if output != "" {
+		t.Errorf("identical second run output = %q, want nothing", output)
+	}
+
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), append(args, "--force"), "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "export API_KEY=secret123\n") {
+		t.Errorf("--force output = %q, want the export", output)
+	}
+
+	// The recorded hash is keyed, so it can't be matched against guesses
+	hashPath, err := exportHashPath(exportHashDir())
+	if err != nil {
+		t.Fatalf("exportHashPath() unexpected error = %v", err)
+	}
+	record, err := os.ReadFile(hashPath)
+	if err != nil {
+		t.Fatalf("Failed to read export hash: %v", err)
+	}
+	plain := sha256.Sum256([]byte(output))
+	if strings.Contains(string(record), hex.EncodeToString(plain[:])) {
+		t.Errorf("export hash %q is an unkeyed hash of the output", record)
+	}
+	if info, err := os.Stat(filepath.Join(exportHashDir(), exportHashKeyName)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("export hash key should exist with mode 0600, got %v, %v", info, err)
+	}
+
+	secrets := profile.loadTestSecrets(t)
+	storage.SetSecret(secrets, "/app/api-key", "rotated", storeClock.Now())
+	if err := storage.SaveSecrets(secrets, profile.Config.PublicKeyPath, profile.Backend); err != nil {
+		t.Fatalf("Failed to save secrets: %v", err)
+	}
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), args, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "export API_KEY=rotated\n") {
+		t.Errorf("output after a change = %q, want the new export", output)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--only-changed", "--output", filepath.Join(profile.Home, "app.env")}, "")
+	if err == nil || !strings.Contains(err.Error(), "cannot be combined with --output") {
+		t.Errorf("expected --only-changed to reject --output, got: %v", err)
+	}
+}
+
+func TestExportCommandOnlyChangedConcurrent(t *testing.T) {
+	setupTestProfile(t, map[string]string{"/app/api-key": "secret123"})
+	args := []string{"--path", "/app/", "--only-changed"}
+
+	// Several exporters start at once in the same directory with no key yet,
+	// some forcing a rewrite of the hash. Each runs in a process of its own,
+	// all children of the test, so they share the hash of one calling shell.
+	var runs [][]string
+	for i := range 20 {
+		runArgs := args
+		if i%2 == 1 {
+			runArgs = append(append([]string{}, args...), "--force")
+		}
+		runs = append(runs, runArgs)
+	}
+	outputs := runTestProcesses(t, "export", runs)
+	if !strings.Contains(strings.Join(outputs, ""), "export API_KEY=secret123\n") {
+		t.Errorf("concurrent output = %q, want at least one export", outputs)
+	}
+
+	// The cache is whole: one key, one complete record and no temp files left
+	entries, err := os.ReadDir(exportHashDir())
+	if err != nil {
+		t.Fatalf("Failed to read exports directory: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("temp file %s left in the exports directory", entry.Name())
+		}
+	}
+	if key, err := os.ReadFile(filepath.Join(exportHashDir(), exportHashKeyName)); err != nil || len(key) != sha256.Size {
+		t.Errorf("export hash key = %d bytes (%v), want %d", len(key), err, sha256.Size)
+	}
+
+	// Whichever run wrote last, its record matches the unchanged export
+	if output := runTestProcesses(t, "export", [][]string{args})[0]; output != "" {
+		t.Errorf("run after the concurrent ones printed %q, want nothing", output)
+	}
+}
+
+func TestPruneExportHashes(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Skipf("cannot run true: %v", err)
+	}
+
+	// Hash files are named with 32 hex characters; anything else, such as the
+	// key or a concurrent write's temp file, must survive
+	live := strings.Repeat("a", 32)
+	stale := strings.Repeat("b", 32)
+	exitedName := strings.Repeat("c", 32)
+	legacy := strings.Repeat("d", 32)
+	tempFile := "." + strings.Repeat("e", 32) + ".tmp-123"
+	keyTempFile := "." + exportHashKeyName + ".tmp-456"
+	files := map[string]string{
+		exportHashKeyName: "key",
+		live:              fmt.Sprintf("%d abc", os.Getpid()),
+		stale:             fmt.Sprintf("%d abc", os.Getpid()),
+		exitedName:        fmt.Sprintf("%d abc", exited.Process.Pid),
+		legacy:            "abc",
+		tempFile:          "",
+		keyTempFile:       "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	old := now.Add(-exportHashMaxAge - time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, stale), old, old); err != nil {
+		t.Fatalf("Failed to age stale: %v", err)
+	}
+
+	pruneExportHashes(dir, now)
+
+	for name, want := range map[string]bool{exportHashKeyName: true, live: true, stale: false, exitedName: false, legacy: false, tempFile: true, keyTempFile: true} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if got := err == nil; got != want {
+			t.Errorf("%s kept = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestExportCommandFingerprint(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "value"})
+	staging := addTestProfile(t, profile.Home, "staging", map[string]string{"/app/key": "staging"})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app
+    env_files: [shared.env]
+  staging:
+    profile: staging
+    path: /app
+`)
+	envFile := filepath.Join(profile.Home, "shared.env")
+	if err := os.WriteFile(envFile, []byte("SHARED=1\n"), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	fingerprint := func(args ...string) string {
+		t.Helper()
+		output, err := runTestCommand(t, ExportCommand, exportTestFlags(), append([]string{"--fingerprint"}, args...), "")
+		if err != nil {
+			t.Fatalf("ExportCommand() unexpected error = %v", err)
+		}
+		return strings.TrimSpace(output)
+	}
+	changed := func(name string, args []string, change func()) {
+		t.Helper()
+		before := fingerprint(args...)
+		if again := fingerprint(args...); again != before {
+			t.Fatalf("fingerprint changed without a change: %q, then %q", before, again)
+		}
+		change()
+		if after := fingerprint(args...); after == before {
+			t.Errorf("fingerprint unchanged after %s", name)
+		}
+	}
+	setSecret := func(p *testProfile, value string) {
+		t.Helper()
+		secrets := p.loadTestSecrets(t)
+		storage.SetSecret(secrets, "/app/key", value, storeClock.Now())
+		if err := storage.SaveSecrets(secrets, p.Config.PublicKeyPath, p.Backend); err != nil {
+			t.Fatalf("Failed to save secrets: %v", err)
+		}
+	}
+
+	changed("a secret was set", nil, func() {
+		setSecret(profile, "a much longer value than before")
+	})
+	changed("an env file was written", nil, func() {
+		if err := os.WriteFile(envFile, []byte("SHARED=2\nMORE=1\n"), 0600); err != nil {
+			t.Fatalf("Failed to write env file: %v", err)
+		}
+	})
+	changed("a secret of the environment's own profile was set", []string{"--env", "staging"}, func() {
+		setSecret(staging, "a much longer staging value")
+	})
+
+	// The staging store isn't read by the default environment
+	before := fingerprint()
+	setSecret(staging, "changed once more, and longer")
+	if after := fingerprint(); after != before {
+		t.Errorf("fingerprint changed after writing a store the export doesn't read")
+	}
+}
+
+func TestExportCommandFingerprintFollowsBranchAndProcessEnv(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/prod/url": "https://example.com",
+		"/app/dev/url":  "http://localhost",
+	})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app/dev
+    env:
+      LOG_DIR: "${CRUMB_TEST_LOG_ROOT}/logs"
+  production:
+    path: /app/prod
+branch_map:
+  main: production
+  dev: default
+`)
+	if err := os.MkdirAll(filepath.Join(profile.Home, ".git"), 0700); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+	checkout := func(branch string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(profile.Home, ".git", "HEAD"), []byte("ref: refs/heads/"+branch+"\n"), 0600); err != nil {
+			t.Fatalf("Failed to write HEAD: %v", err)
+		}
+	}
+	fingerprint := func() string {
+		t.Helper()
+		output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--fingerprint", "--env-from-branch"}, "")
+		if err != nil {
+			t.Fatalf("ExportCommand() unexpected error = %v", err)
+		}
+		return strings.TrimSpace(output)
+	}
+
+	t.Setenv("CRUMB_TEST_LOG_ROOT", "/var")
+	checkout("main")
+	onMain := fingerprint()
+	checkout("dev")
+	onDev := fingerprint()
+	if onDev == onMain {
+		t.Errorf("fingerprint unchanged after switching from main to dev: %q", onDev)
+	}
+	if again := fingerprint(); again != onDev {
+		t.Errorf("fingerprint changed without a change: %q, then %q", onDev, again)
+	}
+
+	t.Setenv("CRUMB_TEST_LOG_ROOT", "/srv")
+	if after := fingerprint(); after == onDev {
+		t.Errorf("fingerprint unchanged after a variable an env literal expands was changed")
+	}
+}
+
+func TestExportCommandWatchRequiresOutput(t *testing.T) {
+	setupTestProfile(t, map[string]string{"/app/key": "value"})
+
+	_, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--watch"}, "")
+	if err == nil || !strings.Contains(err.Error(), "--watch requires --output") {
+		t.Errorf("expected --output requirement error, got: %v", err)
+	}
+}
+
+// startExportWatch runs export --watch with args in the background and
+// returns a channel that receives its result once ctx is cancelled.
+func startExportWatch(t *testing.T, ctx context.Context, args ...string) <-chan error {
+	t.Helper()
+
+	cmd := &cli.Command{
+		Name:   "crumb",
+		Action: ExportCommand,
+		Flags:  append([]cli.Flag{&cli.StringFlag{Name: "profile", Value: "default"}}, exportTestFlags()...),
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Run(ctx, append([]string{"crumb", "--watch"}, args...))
+	}()
+	return done
+}
+
+// waitForFileContent waits for path to contain want.
+func waitForFileContent(t *testing.T, path, want string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(path); err == nil && strings.Contains(string(data), want) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	data, _ := os.ReadFile(path)
+	t.Fatalf("timed out waiting for %q in %s, got: %q", want, path, string(data))
+}
+
+// stopExportWatch cancels a watch and checks that it stops cleanly.
+func stopExportWatch(t *testing.T, cancel context.CancelFunc, done <-chan error) {
+	t.Helper()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("watch returned error after cancel: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop after context cancellation")
+	}
+}
+
+func TestExportCommandWatch(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "first"})
+	outputPath := filepath.Join(profile.Home, "app.env")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := startExportWatch(t, ctx, "--path", "/app/", "--output", outputPath)
+
+	waitForFileContent(t, outputPath, "export KEY=first")
+
+	secrets := profile.loadTestSecrets(t)
+	storage.SetSecret(secrets, "/app/key", "second", storeClock.Now())
+	if err := storage.SaveSecrets(secrets, profile.Config.PublicKeyPath, profile.Backend); err != nil {
+		t.Fatalf("Failed to save secrets: %v", err)
+	}
+
+	waitForFileContent(t, outputPath, "export KEY=second")
+	stopExportWatch(t, cancel, done)
+}
+
+func TestExportCommandWatchFollowsAllInputs(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "default"})
+	staging := addTestProfile(t, profile.Home, "staging", map[string]string{"/app/key": "first"})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  staging:
+    profile: staging
+    path: /app
+    env_files: [shared.env]
+`)
+	envFile := filepath.Join(profile.Home, "shared.env")
+	if err := os.WriteFile(envFile, []byte("SHARED=one\n"), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	outputPath := filepath.Join(profile.Home, "app.env")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := startExportWatch(t, ctx, "--env", "staging", "--output", outputPath)
+
+	waitForFileContent(t, outputPath, "export KEY=first")
+	waitForFileContent(t, outputPath, "export SHARED=one")
+
+	// The environment's own profile, not the CLI one, holds its secrets
+	secrets := staging.loadTestSecrets(t)
+	storage.SetSecret(secrets, "/app/key", "second", storeClock.Now())
+	if err := storage.SaveSecrets(secrets, staging.Config.PublicKeyPath, staging.Backend); err != nil {
+		t.Fatalf("Failed to save secrets: %v", err)
+	}
+	waitForFileContent(t, outputPath, "export KEY=second")
+
+	if err := os.WriteFile(envFile, []byte("SHARED=two\n"), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	waitForFileContent(t, outputPath, "export SHARED=two")
+
+	stopExportWatch(t, cancel, done)
+}
+
+func TestApplyRemap(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		remap   map[string]string
+		strict  bool
+		want    map[string]string
+		problem string
+		wantErr string
+	}{
+		{
+			name:  "rename",
+			vars:  map[string]string{"API_KEY": "a", "OTHER": "b"},
+			remap: map[string]string{"api-key": "service-key"},
+			want:  map[string]string{"SERVICE_KEY": "a", "OTHER": "b"},
+		},
+		{
+			name:  "swap uses values from before remapping",
+			vars:  map[string]string{"A": "1", "B": "2"},
+			remap: map[string]string{"A": "B", "B": "A"},
+			want:  map[string]string{"A": "2", "B": "1"},
+		},
+		{
+			name:  "identical values may share a target",
+			vars:  map[string]string{"PRIMARY_URL": "db", "REPLICA_URL": "db"},
+			remap: map[string]string{"PRIMARY_URL": "DATABASE_URL", "REPLICA_URL": "DATABASE_URL"},
+			want:  map[string]string{"DATABASE_URL": "db"},
+		},
+		{
+			name:    "remapped value replaces existing target",
+			vars:    map[string]string{"OLD": "new-value", "TARGET": "old-value"},
+			remap:   map[string]string{"OLD": "TARGET"},
+			want:    map[string]string{"TARGET": "new-value"},
+			problem: "remap replaces a variable that was already exported: OLD -> TARGET",
+		},
+		{
+			name:  "existing target with the same value",
+			vars:  map[string]string{"OLD": "same", "TARGET": "same"},
+			remap: map[string]string{"OLD": "TARGET"},
+			want:  map[string]string{"TARGET": "same"},
+		},
+		{
+			name:  "existing target that is remapped away",
+			vars:  map[string]string{"OLD": "1", "TARGET": "2"},
+			remap: map[string]string{"OLD": "TARGET", "TARGET": "ELSEWHERE"},
+			want:  map[string]string{"TARGET": "1", "ELSEWHERE": "2"},
+		},
+		{
+			name:    "strict rejects replacing an existing target",
+			vars:    map[string]string{"OLD": "new-value", "TARGET": "old-value"},
+			remap:   map[string]string{"OLD": "TARGET"},
+			strict:  true,
+			wantErr: "remap target already exported with a different value: OLD -> TARGET",
+		},
+		{
+			name:    "missing source is ignored",
+			vars:    map[string]string{"A": "1"},
+			remap:   map[string]string{"MISSING": "A"},
+			want:    map[string]string{"A": "1"},
+			problem: "remap source not found: MISSING -> A",
+		},
+		{
+			name:    "conflicting values for the same target",
+			vars:    map[string]string{"PRIMARY_URL": "db1", "REPLICA_URL": "db2"},
+			remap:   map[string]string{"REPLICA_URL": "DATABASE_URL", "PRIMARY_URL": "DATABASE_URL"},
+			wantErr: "PRIMARY_URL and REPLICA_URL both remap to DATABASE_URL with different values",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := newExportResult()
+			for key, value := range tt.vars {
+				result.set(key, value, "")
+			}
+			err := applyRemap(result, tt.remap, tt.strict)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("applyRemap() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyRemap() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(result.Vars, tt.want) {
+				t.Errorf("applyRemap() = %v, want %v", result.Vars, tt.want)
+			}
+			var wantProblems []string
+			if tt.problem != "" {
+				wantProblems = []string{tt.problem}
+			}
+			if !reflect.DeepEqual(result.Problems, wantProblems) {
+				t.Errorf("applyRemap() problems = %q, want %q", result.Problems, wantProblems)
+			}
+		})
+	}
+}
+
+func TestExportCommandDeterministic(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/db-pass":  "dash",
+		"/app/db_pass":  "underscore",
+		"/app/old-key":  "remapped",
+		"/app/new-key":  "existing",
+		"/app/token":    "t",
+		"/other/secret": "s",
+	})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app
+    env:
+      secret-name: /other/secret
+      SECRET_NAME: literal:plain
+    remap:
+      OLD_KEY: NEW_KEY
+      TOKEN: API_TOKEN
+      DB_PASS: DATABASE_PASSWORD
+`)
+
+	first, err := runTestCommand(t, ExportCommand, exportTestFlags(), nil, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	// Colliding names resolve by sorted path and env name, so the last one wins
+	for _, want := range []string{"export DATABASE_PASSWORD=underscore\n", "export NEW_KEY=remapped\n", "export SECRET_NAME=s\n"} {
+		if !strings.Contains(first, want) {
+			t.Errorf("output = %q, want it to contain %q", first, want)
+		}
+	}
+
+	for i := range 50 {
+		output, err := runTestCommand(t, ExportCommand, exportTestFlags(), nil, "")
+		if err != nil {
+			t.Fatalf("ExportCommand() unexpected error = %v", err)
+		}
+		if output != first {
+			t.Fatalf("run %d output = %q, want the same as the first run %q", i+1, output, first)
+		}
+	}
+
+	// --path resolves colliding names the same way
+	pathArgs := []string{"--path", "/app/"}
+	first, err = runTestCommand(t, ExportCommand, exportTestFlags(), pathArgs, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(first, "export DB_PASS=underscore\n") {
+		t.Errorf("--path output = %q, want it to contain %q", first, "export DB_PASS=underscore\n")
+	}
+	for i := range 50 {
+		output, err := runTestCommand(t, ExportCommand, exportTestFlags(), pathArgs, "")
+		if err != nil {
+			t.Fatalf("ExportCommand() unexpected error = %v", err)
+		}
+		if output != first {
+			t.Fatalf("--path run %d output = %q, want the same as the first run %q", i+1, output, first)
+		}
+	}
+}
+
+func TestExportCommandRemapConflict(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/primary-url": "db1",
+		"/app/replica-url": "db2",
+	})
+
+	crumbYAML := `version: "1.0"
+environments:
+  default:
+    path: /app
+    remap:
+      PRIMARY_URL: DATABASE_URL
+      REPLICA_URL: DATABASE_URL
+`
+	writeCrumbConfig(t, profile.Home, crumbYAML)
+
+	// Run repeatedly: the error must not depend on map iteration order
+	for range 5 {
+		_, err := runTestCommand(t, ExportCommand, exportTestFlags(), nil, "")
+		if err == nil || !strings.Contains(err.Error(), "PRIMARY_URL and REPLICA_URL both remap to DATABASE_URL") {
+			t.Fatalf("expected remap conflict error, got: %v", err)
+		}
+	}
+}
+
+func TestExportCommandStrictRemap(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/api-key": "secret123",
+	})
+
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app
+    remap:
+      API_KEY: SERVICE_KEY
+      DB-PASSWORD: DATABASE_PASSWORD
+`)
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), nil, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "export SERVICE_KEY=secret123\n") {
+		t.Errorf("lenient remap output = %q, want SERVICE_KEY exported", output)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--strict-remap"}, "")
+	if err == nil || !strings.HasSuffix(err.Error(), "remap source not found: DB-PASSWORD -> DATABASE_PASSWORD") {
+		t.Fatalf("expected missing remap source error, got: %v", err)
+	}
+}
+
+func TestExportCommandRemapOntoDerivedVariable(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/primary-url":  "postgres://primary",
+		"/app/database-url": "postgres://stale",
+	})
+
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app
+    remap:
+      PRIMARY_URL: DATABASE_URL
+`)
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--no-comments"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if output != "export DATABASE_URL=postgres://primary\n" {
+		t.Errorf("output = %q, want only the remapped DATABASE_URL", output)
+	}
+
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--check"}, "")
+	if err == nil || !strings.Contains(output, "remap replaces a variable that was already exported: PRIMARY_URL -> DATABASE_URL") {
+		t.Errorf("--check output = %q, error = %v, want the replaced variable reported", output, err)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--strict-remap"}, "")
+	if err == nil || !strings.HasSuffix(err.Error(), "remap target already exported with a different value: PRIMARY_URL -> DATABASE_URL") {
+		t.Fatalf("expected replaced target error, got: %v", err)
+	}
+}
+
+func TestExportCommandExpandsProcessEnv(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/dir": "${HOME}/secret",
+	})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    env:
+      LOG_DIR: "${HOME}/logs"
+      CACHE_DIR: "$HOME/cache"
+      PRICE: "$$5"
+      VERBATIM: "literal:${HOME}"
+      SECRET_DIR: /app/dir
+      MISSING: "${CRUMB_TEST_UNSET}/x"
+`)
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--no-comments"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	// setupTestProfile points HOME at the test profile
+	want := "export CACHE_DIR=" + profile.Home + "/cache\n" +
+		"export LOG_DIR=" + profile.Home + "/logs\n" +
+		"export MISSING=/x\n" +
+		"export PRICE=\"\\$5\"\n" +
+		"export SECRET_DIR=\"\\${HOME}/secret\"\n" +
+		"export VERBATIM=\"\\${HOME}\"\n"
+	if output != want {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--strict-env"}, "")
+	if err == nil || !strings.Contains(err.Error(), "env MISSING for environment 'default'") || !strings.HasSuffix(err.Error(), "uses unset variables: CRUMB_TEST_UNSET") {
+		t.Fatalf("expected unset variable error, got: %v", err)
+	}
+}
+
+func TestExportCommandEnvFromBranch(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/prod/url": "https://example.com",
+		"/app/dev/url":  "http://localhost",
+		"/app/ci/url":   "http://ci",
+	})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app/dev
+  production:
+    path: /app/prod
+  ci:
+    path: /app/ci
+branch_map:
+  main: production
+`)
+
+	setHead := func(t *testing.T, head string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(profile.Home, ".git"), 0700); err != nil {
+			t.Fatalf("Failed to create .git: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(profile.Home, ".git", "HEAD"), []byte(head), 0600); err != nil {
+			t.Fatalf("Failed to write HEAD: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		head string
+		args []string
+		want string
+	}{
+		{"mapped branch", "ref: refs/heads/main\n", nil, "export URL=https://example.com\n"},
+		{"unmapped branch falls back to default", "ref: refs/heads/feature\n", nil, "export URL=http://localhost\n"},
+		{"unmapped branch falls back to --env", "ref: refs/heads/feature\n", []string{"--env", "ci"}, "export URL=http://ci\n"},
+		{"detached HEAD falls back", "4b825dc642cb6eb9a060e54bf8d69288fbee4904\n", nil, "export URL=http://localhost\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setHead(t, tt.head)
+			output, err := runTestCommand(t, ExportCommand, exportTestFlags(), append([]string{"--env-from-branch", "--no-comments"}, tt.args...), "")
+			if err != nil {
+				t.Fatalf("ExportCommand() unexpected error = %v", err)
+			}
+			if output != tt.want {
+				t.Errorf("output = %q, want %q", output, tt.want)
+			}
+		})
+	}
+
+	t.Run("not a git repository", func(t *testing.T) {
+		if err := os.RemoveAll(filepath.Join(profile.Home, ".git")); err != nil {
+			t.Fatalf("Failed to remove .git: %v", err)
+		}
+		output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--env-from-branch", "--no-comments"}, "")
+		if err != nil {
+			t.Fatalf("ExportCommand() unexpected error = %v", err)
+		}
+		if output != "export URL=http://localhost\n" {
+			t.Errorf("output = %q, want the default environment", output)
+		}
+	})
+
+	t.Run("no branch_map", func(t *testing.T) {
+		writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app/dev
+`)
+		_, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--env-from-branch"}, "")
+		if err == nil || !strings.Contains(err.Error(), "--env-from-branch needs a branch_map") {
+			t.Errorf("ExportCommand() error = %v, want missing branch_map", err)
+		}
+	})
+}
+
+func TestExportCommandMergeEnvironments(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/shared/log-level":    "info",
+		"/shared/database-url": "postgres://shared",
+		"/api/database-url":    "postgres://api",
+		"/api/token":           "api-token",
+	})
+
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  shared:
+    path: /shared
+    env:
+      REGION: eu-west-1
+  api:
+    path: /api
+    remap:
+      TOKEN: API_TOKEN
+  renamed:
+    path: /shared
+    remap:
+      LOG_LEVEL: API_TOKEN
+`)
+
+	tests := []struct {
+		name     string
+		env      string
+		expected string
+	}{
+		{
+			name: "later environment wins",
+			env:  "shared,api",
+			expected: "# Exported from /shared (environment: shared)\n" +
+				"# Exported from /api (environment: api)\n" +
+				"export API_TOKEN=api-token\n" +
+				"export DATABASE_URL=postgres://api\n" +
+				"export LOG_LEVEL=info\n" +
+				"export REGION=eu-west-1\n",
+		},
+		{
+			name: "order reversed",
+			env:  "api, shared",
+			expected: "# Exported from /api (environment: api)\n" +
+				"# Exported from /shared (environment: shared)\n" +
+				"export API_TOKEN=api-token\n" +
+				"export DATABASE_URL=postgres://shared\n" +
+				"export LOG_LEVEL=info\n" +
+				"export REGION=eu-west-1\n",
+		},
+		{
+			name: "remaps apply within each environment before merging",
+			env:  "api,renamed",
+			expected: "# Exported from /api (environment: api)\n" +
+				"# Exported from /shared (environment: renamed)\n" +
+				"export API_TOKEN=info\n" +
+				"export DATABASE_URL=postgres://shared\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--env", tt.env}, "")
+			if err != nil {
+				t.Fatalf("ExportCommand() unexpected error = %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("output = %q, want %q", output, tt.expected)
+			}
+		})
+	}
+
+	_, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--env", "shared,missing"}, "")
+	if err == nil || !strings.Contains(err.Error(), "environment 'missing' not found") {
+		t.Errorf("expected missing environment error, got: %v", err)
+	}
+}
+
+func TestExportCommandAnnotateDuplicates(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/dev/database-url":  "postgres://dev",
+		"/prod/database-url": "postgres://prod",
+		"/prod/token":        "prod-token",
+	})
+
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  dev:
+    path: /dev
+    env:
+      REGION: eu-west-1
+  prod:
+    path: /prod
+    env:
+      REGION: us-east-1
+`)
+
+	var result *exportResult
+	resolve := func(ctx context.Context, cmd *cli.Command) error {
+		var err error
+		result, err = resolveExport(cmd, newProfileSecrets(ctx, cmd), cmd.String("file"))
+		return err
+	}
+	if _, err := runTestCommand(t, resolve, exportTestFlags(), []string{"--env", "dev,prod"}, ""); err != nil {
+		t.Fatalf("resolveExport() unexpected error = %v", err)
+	}
+
+	expected := []string{
+		"DATABASE_URL: dev, prod (using prod)",
+		"REGION: dev, prod (using prod)",
+	}
+	if got := result.overlappingEnvironments(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("overlappingEnvironments() = %q, want %q", got, expected)
+	}
+
+	// The report goes to stderr and leaves the export itself alone
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--env", "dev,prod", "--no-comments", "--annotate-duplicates"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	want := "export DATABASE_URL=postgres://prod\n" +
+		"export REGION=us-east-1\n" +
+		"export TOKEN=prod-token\n"
+	if output != want {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+}
+
+func TestExportCommandZsh(t *testing.T) {
+	setupTestProfile(t, map[string]string{"/app/api-key": "secret 123"})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--shell", "zsh"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	expected := "# Exported from /app\nexport API_KEY=\"secret 123\"\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+}
+
+func TestGetCommandExportZsh(t *testing.T) {
+	setupTestProfile(t, map[string]string{"/app/api-key": "secret123"})
+
+	output, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--export", "--shell", "zsh", "/app/api-key"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() unexpected error = %v", err)
+	}
+	if output != "export API_KEY=secret123\n" {
+		t.Errorf("output = %q, want an export line", output)
+	}
+}
+
+func TestExportCommandUnknownShell(t *testing.T) {
+	setupTestProfile(t, map[string]string{"/app/api-key": "secret123"})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--shell", "psh"}, "")
+	if err == nil || err.Error() != "unsupported shell format: psh (supported: bash, zsh, fish, csh, tcsh, elvish)" {
+		t.Errorf("expected unsupported shell error, got: %v", err)
+	}
+	if output != "" {
+		t.Errorf("expected no output for an unknown shell, got: %q", output)
+	}
+
+	_, err = runTestCommand(t, GetCommand, getTestFlags(), []string{"--export", "--shell", "psh", "/app/api-key"}, "")
+	if err == nil || !strings.Contains(err.Error(), "unsupported shell format: psh") {
+		t.Errorf("expected unsupported shell error from get, got: %v", err)
+	}
+}
+
+func TestExportCommandMultilineValues(t *testing.T) {
+	setupTestProfile(t, map[string]string{"/app/cert": "line1\nline2", "/app/port": "8080"})
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "bash", args: []string{"--shell", "bash"}, expected: "export CERT=\"line1\nline2\"\nexport PORT=8080\n"},
+		{name: "fish", args: []string{"--shell", "fish"}, expected: "set -x -g CERT \"line1\nline2\"\nset -x -g PORT 8080\n"},
+		{name: "elvish", args: []string{"--shell", "elvish"}, expected: "set-env CERT 'line1\nline2'\nset-env PORT 8080\n"},
+		{name: "dotenv", args: []string{"--format", "dotenv"}, expected: "CERT=\"line1\\nline2\"\nPORT=8080\n"},
+		{name: "laravel", args: []string{"--format", "laravel"}, expected: "CERT=\"line1\\nline2\"\nPORT=8080\n"},
+		{name: "compose", args: []string{"--format", "compose"}, expected: "environment:\n  CERT: \"line1\\nline2\"\n  PORT: \"8080\"\n"},
+		{name: "csh allowed", args: []string{"--shell", "csh", "--allow-multiline"}, expected: "setenv CERT 'line1\\\nline2';\nsetenv PORT 8080;\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--path", "/app/", "--no-comments"}, tt.args...)
+			output, err := runTestCommand(t, ExportCommand, exportTestFlags(), args, "")
+			if err != nil {
+				t.Fatalf("ExportCommand() unexpected error = %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("output = %q, want %q", output, tt.expected)
+			}
+		})
+	}
+
+	for _, shell := range []string{"csh", "tcsh"} {
+		output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--shell", shell}, "")
+		if err == nil || !strings.Contains(err.Error(), "--allow-multiline") || !strings.Contains(err.Error(), "CERT") {
+			t.Errorf("--shell %s: expected an error naming CERT, got: %v", shell, err)
+		}
+		if output != "" {
+			t.Errorf("--shell %s: expected no output, got: %q", shell, output)
+		}
+	}
+
+	// A masked value can't carry the line break, so it's not a problem
+	if _, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--shell", "csh", "--mask"}, ""); err != nil {
+		t.Errorf("ExportCommand() with --mask unexpected error = %v", err)
+	}
+}
+
+func TestExportCommandEnvValueKinds(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/secret": "from-store"})
+
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    env:
+      HEALTH_PATH: "literal:/health"
+      SECRET: "/app/secret"
+      MISSING: "/app/missing"
+      PLAIN: "postgres"
+      PREFIXED: "literal:literal:x"
+`)
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), nil, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+
+	expected := "export HEALTH_PATH=/health\n" +
+		"export PLAIN=postgres\n" +
+		"export PREFIXED=literal:x\n" +
+		"export SECRET=from-store\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+}
+
+func TestExportCommandCsh(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/api-key":  "secret123",
+		"/app/password": "pa!ss word",
+	})
+
+	for _, shell := range []string{"csh", "tcsh"} {
+		t.Run(shell, func(t *testing.T) {
+			output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--shell", shell}, "")
+			if err != nil {
+				t.Fatalf("ExportCommand() unexpected error = %v", err)
+			}
+			expected := "setenv API_KEY secret123;\nsetenv PASSWORD 'pa\\!ss word';\n"
+			if output != expected {
+				t.Errorf("output = %q, want %q", output, expected)
+			}
+		})
+	}
+
+	output, err := runTestCommand(t, GetCommand, getTestFlags(), []string{"--export", "--shell", "csh", "/app/password"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() unexpected error = %v", err)
+	}
+	if output != "setenv PASSWORD 'pa\\!ss word';\n" {
+		t.Errorf("get output = %q", output)
+	}
+}
+
+func TestExportCommandElvish(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/api-key":  "secret123",
+		"/app/password": "it's $ecret",
+	})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--shell", "elvish"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	expected := "# Exported from /app\nset-env API_KEY secret123\nset-env PASSWORD 'it''s $ecret'\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	output, err = runTestCommand(t, GetCommand, getTestFlags(), []string{"--export", "--shell", "elvish", "/app/password"}, "")
+	if err != nil {
+		t.Fatalf("GetCommand() unexpected error = %v", err)
+	}
+	if output != "set-env PASSWORD 'it''s $ecret'\n" {
+		t.Errorf("get output = %q", output)
+	}
+}
+
+func TestExportCommandSortBy(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/a/token": "t",
+		"/app/b/key":   "k",
+	})
+
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    env:
+      ZEBRA: "/app/a/token"
+      APPLE: "/app/b/key"
+      LITERAL: "plain"
+`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "name is the default",
+			expected: "export APPLE=k\nexport LITERAL=plain\nexport ZEBRA=t\n",
+		},
+		{
+			name:     "path orders by secret path with literals last",
+			args:     []string{"--sort-by", "path"},
+			expected: "export ZEBRA=t\nexport APPLE=k\nexport LITERAL=plain\n",
+		},
+		{
+			name:    "unknown value",
+			args:    []string{"--sort-by", "size"},
+			wantErr: "unsupported --sort-by value: size (supported: name, path)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runTestCommand(t, ExportCommand, exportTestFlags(), tt.args, "")
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ExportCommand() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExportCommand() unexpected error = %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("output = %q, want %q", output, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExportCommandCommentSource(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/prod/billing/db/host": "db.internal",
+		"/prod/billing/api-key": "secret123",
+	})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/prod/billing/db/", "--comment-source", "--shell", "fish"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	expected := "# Exported from /prod/billing/db\n" +
+		"# from /prod/billing/db/host\n" +
+		"set -x -g HOST db.internal\n"
+	if output != expected {
+		t.Errorf("path mode output = %q, want %q", output, expected)
+	}
+
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: "/prod/billing/db"
+    env:
+      API_KEY: "/prod/billing/api-key"
+      REGION: "eu-west-1"
+    remap:
+      HOST: DB_HOST
+`)
+
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--comment-source"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	expected = "# Exported from /prod/billing/db (environment: default)\n" +
+		"# from /prod/billing/api-key\n" +
+		"export API_KEY=secret123\n" +
+		"# from /prod/billing/db/host\n" +
+		"export DB_HOST=db.internal\n" +
+		"export REGION=eu-west-1\n"
+	if output != expected {
+		t.Errorf("config mode output = %q, want %q", output, expected)
+	}
+
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--comment-source", "--no-comments"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	expected = "export API_KEY=secret123\nexport DB_HOST=db.internal\nexport REGION=eu-west-1\n"
+	if output != expected {
+		t.Errorf("--no-comments output = %q, want %q", output, expected)
+	}
+}
+
+func TestExportCommandMergeFile(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/api-key": "from-crumb",
+	})
+
+	mergePath := filepath.Join(profile.Home, "static.env")
+	if err := os.WriteFile(mergePath, []byte("API_KEY=from-file\nLOG_LEVEL=debug\n"), 0600); err != nil {
+		t.Fatalf("Failed to write merge file: %v", err)
+	}
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--merge-file", mergePath}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+
+	expected := "# Merged from " + mergePath + "\n" +
+		"# Exported from /app\n" +
+		"export API_KEY=from-crumb\n" +
+		"export LOG_LEVEL=debug\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--merge-file", filepath.Join(profile.Home, "missing.env")}, "")
+	if err == nil {
+		t.Error("expected an error for a missing merge file")
+	}
+}
+
+func TestExportCommandNullFormat(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/api-key": "secret123",
+		"/app/cert":    "line1\nline2 \"quoted\" $HOME",
+	})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "null"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+
+	expected := "API_KEY=secret123\x00CERT=line1\nline2 \"quoted\" $HOME\x00"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	records := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+	if len(records) != 2 {
+		t.Errorf("expected 2 NUL-separated records, got %d: %q", len(records), records)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "yaml"}, "")
+	if err == nil || err.Error() != "unsupported export format: yaml (supported: shell, dotenv, laravel, compose, vault, null)" {
+		t.Errorf("expected unsupported format error, got: %v", err)
+	}
+}
+
+func TestExportCommandMaxValueLength(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/keystore": strings.Repeat("A", 2048),
+		"/app/api-key":  "secret123",
+	})
+
+	_, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--max-value-length", "1024"}, "")
+	if err == nil || err.Error() != "values longer than --max-value-length 1024: KEYSTORE (2048 bytes)" {
+		t.Fatalf("expected oversized value error, got: %v", err)
+	}
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--max-value-length", "4096"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "export KEYSTORE=") {
+		t.Errorf("expected KEYSTORE within the limit to be exported, got: %q", output)
+	}
+}
+
+func TestCheckValueLengthsWarnsByDefault(t *testing.T) {
+	result := newExportResult()
+	result.set("HUGE", strings.Repeat("A", largeValueWarningBytes+1), "/app/huge")
+
+	if err := checkValueLengths(result, 0); err != nil {
+		t.Errorf("checkValueLengths() without a limit should only warn, got: %v", err)
+	}
+}
+
+func TestExportCommandEnvFiles(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/api-key": "from-crumb",
+	})
+
+	configDir := filepath.Join(profile.Home, "config")
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "static.env"), []byte("API_KEY=from-file\nLOG_LEVEL=debug\nREGION=us-east-1\n"), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    env_files:
+      - config/static.env
+    path: /app
+    env:
+      REGION: eu-west-1
+  broken:
+    env_files:
+      - missing.env
+`)
+
+	// Run from a subdirectory: env files are relative to .crumb.yaml, not the cwd
+	subDir := filepath.Join(profile.Home, "src")
+	if err := os.MkdirAll(subDir, 0700); err != nil {
+		t.Fatalf("Failed to create subdir: %v", err)
+	}
+	t.Chdir(subDir)
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), nil, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+
+	expected := "# Included config/static.env (environment: default)\n" +
+		"# Exported from /app (environment: default)\n" +
+		"export API_KEY=from-crumb\n" +
+		"export LOG_LEVEL=debug\n" +
+		"export REGION=eu-west-1\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--env", "broken"}, "")
+	if err == nil || !strings.Contains(err.Error(), "env_files entry missing.env for environment 'broken'") {
+		t.Errorf("expected a missing env file error, got: %v", err)
+	}
+}
+
+func TestExportCommandTemplate(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/db-password": "s3cr3t",
+		"/app/db-host":     "db.internal",
+	})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app
+`)
+
+	templatePath := filepath.Join(profile.Home, "app.yaml.tmpl")
+	if err := os.WriteFile(templatePath, []byte("database:\n  host: {{ .DB_HOST }}\n  password: {{ .DB_PASSWORD }}\n"), 0600); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--template", templatePath}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	expected := "database:\n  host: db.internal\n  password: s3cr3t\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	outputPath := filepath.Join(profile.Home, "app.yaml")
+	if _, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--template", templatePath, "--output", outputPath}, ""); err != nil {
+		t.Fatalf("ExportCommand() with --output unexpected error = %v", err)
+	}
+	written, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if string(written) != expected {
+		t.Errorf("written = %q, want %q", written, expected)
+	}
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat output: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("output mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	if err := os.WriteFile(templatePath, []byte("token: {{ .API_TOKEN }}\n"), 0600); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--template", templatePath}, "")
+	if err == nil || !strings.Contains(err.Error(), "API_TOKEN") {
+		t.Errorf("expected error naming the unresolved variable, got %v", err)
+	}
+	if output != "" {
+		t.Errorf("failed render should print nothing, got %q", output)
+	}
+}
+
+func TestExportCommandQuoteAll(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/name":  "abc",
+		"/app/quote": `say "hi"`,
+	})
+
+	tests := []struct {
+		shell string
+		want  string
+	}{
+		{shell: "bash", want: "export NAME=\"abc\"\nexport QUOTE=\"say \\\"hi\\\"\"\n"},
+		{shell: "fish", want: "set -x -g NAME \"abc\"\nset -x -g QUOTE \"say \\\"hi\\\"\"\n"},
+	}
+
+	for _, tt := range tests {
+		output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--no-comments", "--quote-all", "--shell", tt.shell}, "")
+		if err != nil {
+			t.Fatalf("ExportCommand(%s) unexpected error = %v", tt.shell, err)
+		}
+		if output != tt.want {
+			t.Errorf("ExportCommand(%s) = %q, want %q", tt.shell, output, tt.want)
+		}
+	}
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--no-comments"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "export NAME=abc\n") {
+		t.Errorf("without --quote-all simple values should stay bare, got %q", output)
+	}
+}
+
+func TestExportCommandQuotingEvaluatesToStoredValue(t *testing.T) {
+	value := "p@ss $HOME `echo id` $(echo sub) \\ \\n \"q\" 'single'"
+	setupTestProfile(t, map[string]string{"/app/db-password": value})
+
+	shells := []struct {
+		shell  string
+		script string
+	}{
+		{"bash", `printf %s "$DB_PASSWORD"`},
+		{"zsh", `printf %s "$DB_PASSWORD"`},
+		{"fish", `printf %s $DB_PASSWORD`},
+	}
+	for _, sh := range shells {
+		if _, err := exec.LookPath(sh.shell); err != nil {
+			continue
+		}
+		for _, args := range [][]string{nil, {"--quote-all"}} {
+			output, err := runTestCommand(t, ExportCommand, exportTestFlags(), append([]string{"--path", "/app/", "--no-comments", "--shell", sh.shell}, args...), "")
+			if err != nil {
+				t.Fatalf("ExportCommand(%s %q) unexpected error = %v", sh.shell, args, err)
+			}
+			got, err := exec.Command(sh.shell, "-c", output+sh.script).Output()
+			if err != nil {
+				t.Fatalf("%s failed to evaluate %q: %v", sh.shell, output, err)
+			}
+			if string(got) != value {
+				t.Errorf("%s %q evaluated to %q, want the stored %q", sh.shell, args, got, value)
+			}
+		}
+	}
+}
+
+func TestExportCommandPrefixMap(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/svc/billing/db-url":    "postgres://billing",
+		"/svc/auth/db-url":       "postgres://auth",
+		"/svc/auth/admin/token":  "root",
+		"/svc/shared/log-level":  "info",
+		"/svc/billingreport/key": "r",
+	})
+
+	args := []string{"--path", "/svc/", "--no-comments", "--prefix-map", "/svc/billing=BILLING_", "--prefix-map", "/svc/auth/=auth_"}
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), args, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+
+	expected := "export AUTH_DB_URL=postgres://auth\n" +
+		"export AUTH_TOKEN=root\n" +
+		"export BILLING_DB_URL=postgres://billing\n" +
+		"export KEY=r\n" +
+		"export LOG_LEVEL=info\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	if _, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/svc/", "--prefix-map", "/svc/billing"}, ""); err == nil {
+		t.Error("ExportCommand() expected error for a rule without '='")
+	}
+	if _, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/svc/", "--prefix-map", "/svc/billing=BILL-"}, ""); err == nil {
+		t.Error("ExportCommand() expected error for an invalid variable prefix")
+	}
+}
+
+func TestPrefixMapLongestMatchWins(t *testing.T) {
+	prefixes, err := parsePrefixMap([]string{"/svc=SVC_", "/svc/auth=AUTH_"})
+	if err != nil {
+		t.Fatalf("parsePrefixMap() unexpected error = %v", err)
+	}
+
+	if got := prefixes.apply("/svc/auth/token", "TOKEN"); got != "AUTH_TOKEN" {
+		t.Errorf("apply() = %q, want AUTH_TOKEN", got)
+	}
+	if got := prefixes.apply("/svc/other/token", "TOKEN"); got != "SVC_TOKEN" {
+		t.Errorf("apply() = %q, want SVC_TOKEN", got)
+	}
+	if got := prefixes.apply("/elsewhere/token", "TOKEN"); got != "TOKEN" {
+		t.Errorf("apply() = %q, want TOKEN", got)
+	}
+}
+
+func TestExportCommandStripPrefix(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/svc/MYAPP_DB_HOST": "db.local",
+		"/svc/myapp_port":    "5432",
+		"/svc/OTHER":         "x",
+		"/svc/MYAPP_":        "bare",
+	})
+
+	args := []string{"--path", "/svc/", "--no-comments", "--strip-prefix", "MYAPP_"}
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), args, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	expected := "export DB_HOST=db.local\n" +
+		"export MYAPP_=bare\n" +
+		"export OTHER=x\n" +
+		"export PORT=5432\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	// A prefix that matches nothing leaves every name unchanged
+	args = []string{"--path", "/svc/", "--no-comments", "--strip-prefix", "NOPE_"}
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), args, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "export MYAPP_DB_HOST=db.local\n") || !strings.Contains(output, "export OTHER=x\n") {
+		t.Errorf("expected unchanged names, got:\n%s", output)
+	}
+
+	// Stripping runs before --prefix-map
+	args = []string{"--path", "/svc/", "--no-comments", "--strip-prefix", "myapp_", "--prefix-map", "/svc=SVC_"}
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), args, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "export SVC_DB_HOST=db.local\n") || !strings.Contains(output, "export SVC_PORT=5432\n") {
+		t.Errorf("expected stripped then prefixed names, got:\n%s", output)
+	}
+
+	// ... and before remap, which must use the stripped name
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: "/svc"
+    remap:
+      DB_HOST: DATABASE_HOST
+`)
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--no-comments", "--strip-prefix", "MYAPP_"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "export DATABASE_HOST=db.local\n") {
+		t.Errorf("expected remap of the stripped name, got:\n%s", output)
+	}
+}
+
+func TestExportCommandMask(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/password": "hunter2",
+		"/app/token":    "sk_live_abc",
+	})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--mask"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	for _, secret := range []string{"hunter2", "sk_live_abc"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("--mask output reveals %q:\n%s", secret, output)
+		}
+	}
+	if !strings.Contains(output, "export PASSWORD=*******\n") || !strings.Contains(output, "export TOKEN=***********\n") {
+		t.Errorf("expected length-preserving masks, got:\n%s", output)
+	}
+
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--mask", "--mask-length", "3", "--mask-char", "x"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "export PASSWORD=xxx\n") || !strings.Contains(output, "export TOKEN=xxx\n") {
+		t.Errorf("expected fixed-length masks, got:\n%s", output)
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "env")
+	if _, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--mask", "--output", outputPath}, ""); err == nil {
+		t.Error("ExportCommand() expected error combining --mask with --output")
+	}
+}
+
+func TestExportCommandRedactPattern(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/region": "us-east-1",
+		"/app/token":  "sk_live_abc",
+		"/app/github": "ghp_12345",
+	})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--redact-pattern", "^(sk_|ghp_)"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	expected := "# Exported from /app\nexport GITHUB=*********\nexport REGION=us-east-1\nexport TOKEN=***********\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "dotenv", "--redact-pattern", "live", "--mask-length", "4"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "TOKEN=****\n") || !strings.Contains(output, "GITHUB=ghp_12345\n") {
+		t.Errorf("expected only TOKEN to be masked, got:\n%s", output)
+	}
+
+	invalid := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"bad pattern", []string{"--redact-pattern", "("}, "invalid --redact-pattern"},
+		{"with mask", []string{"--redact-pattern", "sk_", "--mask"}, "cannot be combined with --mask"},
+		{"with output", []string{"--redact-pattern", "sk_", "--output", filepath.Join(t.TempDir(), "env")}, "cannot be combined with --output or --template"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runTestCommand(t, ExportCommand, exportTestFlags(), append([]string{"--path", "/app/"}, tt.args...), "")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ExportCommand() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportCommandBase64(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/password": "pa ss\nword",
+		"/app/user":     "admin",
+	})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "dotenv", "--no-comments", "--base64"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	expected := "PASSWORD=cGEgc3MKd29yZA==\nUSER=YWRtaW4=\n"
+	if output != expected {
+		t.Errorf("output = %q, want %q", output, expected)
+	}
+}
+
+func TestExportCommandCheck(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/db-password": "s3cr3t",
+		"/app/api-key":     "key",
+	})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app
+    env:
+      REGION: us-east-1
+  broken:
+    path: /missing
+    env:
+      TOKEN: /app/token
+    remap:
+      NOPE: SOMETHING
+      API_KEY: DB_PASSWORD
+`)
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--check"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() --check unexpected error = %v", err)
+	}
+	if output != "3 variables would be exported\nNo problems found\n" {
+		t.Errorf("unexpected output for a clean config: %q", output)
+	}
+
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--check", "--env", "broken"}, "")
+	if err == nil {
+		t.Fatal("ExportCommand() --check expected error for a broken config")
+	}
+	for _, want := range []string{
+		"environment 'broken': no secrets found under path /missing",
+		"environment 'broken': env TOKEN refers to missing secret /app/token",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--check", "--env", "default,broken", "--path", ""}, "")
+	if err == nil {
+		t.Fatal("ExportCommand() --check expected error for missing remap sources")
+	}
+	if !strings.Contains(output, "remap source not found: API_KEY -> DB_PASSWORD, NOPE -> SOMETHING") {
+		t.Errorf("output should report missing remap sources:\n%s", output)
+	}
+	if strings.Contains(output, "s3cr3t") || strings.Contains(output, "export ") {
+		t.Errorf("--check must not print values or export lines:\n%s", output)
+	}
+}
+
+func TestExportCommandEnvironmentProfile(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/database-url": "postgres://default",
+	})
+	addTestProfile(t, profile.Home, "staging", map[string]string{
+		"/app/database-url": "postgres://staging",
+	})
+	addTestProfile(t, profile.Home, "prod", map[string]string{
+		"/app/database-url": "postgres://prod",
+		"/app/token":        "prod-token",
+	})
+
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  local:
+    path: /app
+  staging:
+    profile: staging
+    path: /app
+  prod:
+    profile: prod
+    path: /app
+  missing:
+    profile: nope
+    path: /app
+`)
+
+	tests := []struct {
+		name     string
+		env      string
+		expected string
+	}{
+		{
+			name:     "falls back to the command line profile",
+			env:      "local",
+			expected: "# Exported from /app (environment: local)\nexport DATABASE_URL=postgres://default\n",
+		},
+		{
+			name:     "reads from the environment's profile",
+			env:      "staging",
+			expected: "# Exported from /app (environment: staging)\nexport DATABASE_URL=postgres://staging\n",
+		},
+		{
+			name: "layered environments each use their own profile",
+			env:  "staging,prod",
+			expected: "# Exported from /app (environment: staging)\n" +
+				"# Exported from /app (environment: prod)\n" +
+				"export DATABASE_URL=postgres://prod\n" +
+				"export TOKEN=prod-token\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--env", tt.env}, "")
+			if err != nil {
+				t.Fatalf("ExportCommand() unexpected error = %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("output = %q, want %q", output, tt.expected)
+			}
+		})
+	}
+
+	_, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--env", "missing"}, "")
+	if err == nil || !strings.Contains(err.Error(), "environment 'missing': profile 'nope' not found") {
+		t.Errorf("ExportCommand() error = %v, want unknown profile error", err)
+	}
+}
+
+func TestExportCommandDotenvEscapeDollar(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/password": "pa$HOME$$x",
+		"/app/plain":    "abc",
+	})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "dotenv"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	want := "# Exported from /app\nPASSWORD=\"pa$HOME$$x\"\nPLAIN=abc\n"
+	if output != want {
+		t.Errorf("dotenv output = %q, want %q", output, want)
+	}
+
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "dotenv", "--escape-dollar", "--no-comments"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	want = "PASSWORD=\"pa$$HOME$$$$x\"\nPLAIN=abc\n"
+	if output != want {
+		t.Errorf("--escape-dollar output = %q, want %q", output, want)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--escape-dollar"}, "")
+	if err == nil || !strings.Contains(err.Error(), "--escape-dollar only applies to --format dotenv") {
+		t.Errorf("ExportCommand() error = %v, want --escape-dollar format error", err)
+	}
+}
+
+func TestExportCommandLaravelFormat(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/password": "abc#123",
+		"/app/note":     "keep # this",
+		"/app/dsn":      "user=app host=db",
+		"/app/price":    "$5",
+		"/app/plain":    "abc",
+	})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "laravel"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	want := "# Exported from /app\n" +
+		"DSN=\"user=app host=db\"\n" +
+		"NOTE=\"keep # this\"\n" +
+		"PASSWORD=\"abc#123\"\n" +
+		"PLAIN=abc\n" +
+		"PRICE=\"\\$5\"\n"
+	if output != want {
+		t.Errorf("laravel output = %q, want %q", output, want)
+	}
+}
+
+func TestExportCommandComposeFormat(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/password": "pa$HOME: \"quoted\" #hash",
+		"/app/multi":    "line1\nline2",
+		"/app/plain":    "yes",
+	})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "compose", "--indent", "4"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "\n    PLAIN: \"yes\"\n") {
+		t.Errorf("output = %q, want entries indented by 4 spaces", output)
+	}
+
+	var parsed struct {
+		Environment map[string]string `yaml:"environment"`
+	}
+	if err := yaml.Unmarshal([]byte(output), &parsed); err != nil {
+		t.Fatalf("output is not valid YAML: %v\n%s", err, output)
+	}
+	want := map[string]string{
+		"PASSWORD": "pa$$HOME: \"quoted\" #hash",
+		"MULTI":    "line1\nline2",
+		"PLAIN":    "yes",
+	}
+	if !reflect.DeepEqual(parsed.Environment, want) {
+		t.Errorf("parsed environment = %v, want %v", parsed.Environment, want)
+	}
+
+	outputPath := filepath.Join(profile.Home, "compose.env.yaml")
+	if _, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "compose", "--output", outputPath}, ""); err != nil {
+		t.Fatalf("ExportCommand() with --output unexpected error = %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if err := yaml.Unmarshal(content, &parsed); err != nil || parsed.Environment["PLAIN"] != "yes" {
+		t.Errorf("output file = %q, err = %v, want a compose environment mapping", content, err)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--indent", "4"}, "")
+	if err == nil || !strings.Contains(err.Error(), "--indent only applies to --format compose") {
+		t.Errorf("ExportCommand() error = %v, want --indent format error", err)
+	}
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--format", "compose", "--indent", "0"}, "")
+	if err == nil || !strings.Contains(err.Error(), "--indent must be between 1 and 8") {
+		t.Errorf("ExportCommand() error = %v, want --indent range error", err)
+	}
+}
+
+func TestExportCommandDedupeIdentical(t *testing.T) {
+	setupTestProfile(t, map[string]string{
+		"/app/unchanged": "same",
+		"/app/changed":   "new-value",
+		"/app/added":     "fresh",
+	})
+	t.Setenv("UNCHANGED", "same")
+	t.Setenv("CHANGED", "old-value")
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--dedupe-identical"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	want := "# Exported from /app\nexport ADDED=fresh\nexport CHANGED=new-value\n"
+	if output != want {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+
+	t.Setenv("CHANGED", "new-value")
+	t.Setenv("ADDED", "fresh")
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--dedupe-identical"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if output != "" {
+		t.Errorf("with everything already set, output = %q, want nothing", output)
+	}
+
+	_, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/app/", "--dedupe-identical", "--output", filepath.Join(t.TempDir(), ".env")}, "")
+	if err == nil || !strings.Contains(err.Error(), "cannot be combined with --output") {
+		t.Errorf("ExportCommand() error = %v, want --output error", err)
+	}
+}
+
+func TestExportCommandNameFilter(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/db-host":     "localhost",
+		"/app/db-password": "secret",
+		"/app/api-db-key":  "key",
+		"/app/log-level":   "info",
+	})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    path: /app/
+    remap:
+      LOG_LEVEL: DB_LOG_LEVEL
+`)
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "anchored pattern",
+			args: []string{"--name-filter", "^DB_"},
+			want: []string{"DB_HOST", "DB_LOG_LEVEL", "DB_PASSWORD"},
+		},
+		{
+			name: "unanchored pattern",
+			args: []string{"--name-filter", "DB_"},
+			want: []string{"API_DB_KEY", "DB_HOST", "DB_LOG_LEVEL", "DB_PASSWORD"},
+		},
+		{
+			name: "exclude filter",
+			args: []string{"--exclude-filter", "PASSWORD|KEY$"},
+			want: []string{"DB_HOST", "DB_LOG_LEVEL"},
+		},
+		{
+			name: "name and exclude filters combined",
+			args: []string{"--name-filter", "^DB_", "--exclude-filter", "^DB_LOG"},
+			want: []string{"DB_HOST", "DB_PASSWORD"},
+		},
+		{
+			name:    "invalid regex",
+			args:    []string{"--name-filter", "DB_("},
+			wantErr: "invalid --name-filter",
+		},
+		{
+			name:    "invalid exclude regex",
+			args:    []string{"--exclude-filter", "["},
+			wantErr: "invalid --exclude-filter",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--format", "null"}, tt.args...)
+			output, err := runTestCommand(t, ExportCommand, exportTestFlags(), args, "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ExportCommand() error = %v, want %q", err, tt.wantErr)
+				}
+				if output != "" {
+					t.Errorf("output = %q, want nothing before the error", output)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExportCommand() unexpected error = %v", err)
+			}
+
+			var names []string
+			for _, record := range strings.Split(strings.TrimSuffix(output, "\x00"), "\x00") {
+				name, _, _ := strings.Cut(record, "=")
+				names = append(names, name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("exported names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportCommandVaultFormat(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/myapp/db/password": "p@ss'word",
+		"/myapp/db/user":     "admin",
+		"/myapp/api/key":     "@not-a-file",
+		"/myapp/region":      "eu-west-1",
+	})
+
+	output, err := runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--path", "/myapp/", "--name-segments", "2", "--format", "vault", "--mount", "kv", "--force", "--no-comments"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	want := "vault kv put -mount=kv myapp - <<'CRUMB_EOF'\n{\"region\":\"eu-west-1\"}\nCRUMB_EOF\n" +
+		"vault kv put -mount=kv myapp/api - <<'CRUMB_EOF'\n{\"key\":\"@not-a-file\"}\nCRUMB_EOF\n" +
+		"vault kv put -mount=kv myapp/db - <<'CRUMB_EOF'\n{\"password\":\"p@ss'word\",\"user\":\"admin\"}\nCRUMB_EOF\n"
+	if output != want {
+		t.Errorf("output =\n%s\nwant\n%s", output, want)
+	}
+
+	// A literal from .crumb.yaml has no secret path and is left out
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  default:
+    env:
+      DB_USER: /myapp/db/user
+      LOG_LEVEL: "literal:debug"
+`)
+	output, err = runTestCommand(t, ExportCommand, exportTestFlags(), []string{"--format", "vault", "--force", "--no-comments"}, "")
+	if err != nil {
+		t.Fatalf("ExportCommand() unexpected error = %v", err)
+	}
+	if output != "vault kv put -mount=secret myapp/db - <<'CRUMB_EOF'\n{\"user\":\"admin\"}\nCRUMB_EOF\n" {
+		t.Errorf("output = %q, want only the secret-backed variable", output)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"needs a terminal or --force", []string{"--format", "vault"}, "stdout is not a terminal, pass --force"},
+		{"needs --force for a file", []string{"--format", "vault", "--output", filepath.Join(profile.Home, "vault.sh")}, "pass --force"},
+		{"mount without vault format", []string{"--mount", "kv"}, "--mount only applies to --format vault"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runTestCommand(t, ExportCommand, exportTestFlags(), tt.args, "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExportCommand() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,510 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+
+	"crumb/pkg/backend"
+	"crumb/pkg/config"
+	"crumb/pkg/storage"
+)
+
+// testProfile describes an isolated crumb profile created for a test.
+type testProfile struct {
+	Home    string
+	Config  *config.ProfileConfig
+	Backend backend.Backend
+}
+
+// writeTestKeyPair generates an ed25519 SSH key pair in dir and returns the key paths.
+func writeTestKeyPair(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to convert public key: %v", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "crumb-test")
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+
+	pubPath := filepath.Join(dir, name+".pub")
+	privPath := filepath.Join(dir, name)
+	if err := os.WriteFile(pubPath, ssh.MarshalAuthorizedKey(sshPub), 0600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write private key: %v", err)
+	}
+
+	return pubPath, privPath
+}
+
+// useStoreClock gives every store the commands resolve a fake clock stopped
+// at now for the duration of the test.
+func useStoreClock(t *testing.T, now time.Time) *storage.FakeClock {
+	t.Helper()
+
+	clock := storage.NewFakeClock(now)
+	previous := storeClock
+	storeClock = clock
+	t.Cleanup(func() { storeClock = previous })
+	return clock
+}
+
+// setupTestProfile points HOME at a temp directory and creates a "default"
+// profile with a fresh key pair and the given secrets.
+func setupTestProfile(t *testing.T, secrets map[string]string) *testProfile {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	pubPath, privPath := writeTestKeyPair(t, home, "id_ed25519")
+	storagePath := filepath.Join(home, ".config", "crumb", "secrets")
+
+	profileConfig := config.ProfileConfig{
+		PublicKeyPath:  pubPath,
+		PrivateKeyPath: privPath,
+		Storage: config.StorageConfig{
+			Local: &config.LocalStorageConfig{Path: storagePath},
+		},
+	}
+	cfg := &config.Config{Profiles: map[string]config.ProfileConfig{"default": profileConfig}}
+	if err := config.SaveConfig(cfg); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	b := &backend.FileBackend{Path: storagePath}
+	store := make(storage.SecretStore)
+	for key, value := range secrets {
+		storage.SetSecret(store, key, value, storeClock.Now())
+	}
+	if err := storage.SaveSecrets(store, pubPath, b); err != nil {
+		t.Fatalf("Failed to save secrets: %v", err)
+	}
+
+	return &testProfile{Home: home, Config: &profileConfig, Backend: b}
+}
+
+// addTestProfile adds another named profile, with its own key pair and store,
+// to the config created by setupTestProfile.
+func addTestProfile(t *testing.T, home, name string, secrets map[string]string) *testProfile {
+	t.Helper()
+
+	pubPath, privPath := writeTestKeyPair(t, home, "id_"+name)
+	storagePath := filepath.Join(home, ".config", "crumb", "secrets-"+name)
+
+	profileConfig := config.ProfileConfig{
+		PublicKeyPath:  pubPath,
+		PrivateKeyPath: privPath,
+		Storage: config.StorageConfig{
+			Local: &config.LocalStorageConfig{Path: storagePath},
+		},
+	}
+
+	configData, err := os.ReadFile(filepath.Join(home, ".config", "crumb", "config.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	var cfg config.Config
+	if err := yaml.Unmarshal(configData, &cfg); err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	cfg.Profiles[name] = profileConfig
+	if err := config.SaveConfig(&cfg); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	b := &backend.FileBackend{Path: storagePath}
+	store := make(storage.SecretStore)
+	for key, value := range secrets {
+		storage.SetSecret(store, key, value, storeClock.Now())
+	}
+	if err := storage.SaveSecrets(store, pubPath, b); err != nil {
+		t.Fatalf("Failed to save secrets: %v", err)
+	}
+
+	return &testProfile{Home: home, Config: &profileConfig, Backend: b}
+}
+
+// loadTestSecrets decrypts the profile's store for assertions.
+func (p *testProfile) loadTestSecrets(t *testing.T) storage.SecretStore {
+	t.Helper()
+
+	secrets, err := storage.LoadSecrets(p.Config.PrivateKeyPath, p.Backend)
+	if err != nil {
+		t.Fatalf("Failed to load secrets: %v", err)
+	}
+	return secrets
+}
+
+// runTestCommand runs action as a CLI command with the given flags and args,
+// feeding stdin and returning everything written to stdout.
+func runTestCommand(t *testing.T, action cli.ActionFunc, flags []cli.Flag, args []string, stdin string) (string, error) {
+	t.Helper()
+
+	flags = append([]cli.Flag{
+		&cli.StringFlag{Name: "profile", Value: "default"},
+	}, flags...)
+
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create stdin pipe: %v", err)
+	}
+	go func() {
+		stdinWriter.WriteString(stdin)
+		stdinWriter.Close()
+	}()
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create stdout pipe: %v", err)
+	}
+
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdinReader, stdoutWriter
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		buf.ReadFrom(stdoutReader)
+		close(done)
+	}()
+
+	// Leave exit codes to the caller instead of letting cli.Exit end the test binary
+	cmd := &cli.Command{Name: "crumb", Action: action, Flags: flags, ExitErrHandler: func(context.Context, *cli.Command, error) {}}
+	runErr := cmd.Run(context.Background(), append([]string{"crumb"}, args...))
+
+	stdoutWriter.Close()
+	<-done
+	os.Stdin, os.Stdout = oldStdin, oldStdout
+	stdinReader.Close()
+
+	return buf.String(), runErr
+}
+
+// helperCommandEnv names the command TestHelperProcess runs in a re-executed
+// test binary.
+const helperCommandEnv = "CRUMB_TEST_HELPER_COMMAND"
+
+// TestHelperProcess isn't a real test. runTestProcesses re-executes the test
+// binary with it to run a command in a process of its own, taking the args
+// after "--" once stdin is closed.
+func TestHelperProcess(t *testing.T) {
+	name := os.Getenv(helperCommandEnv)
+	if name == "" {
+		return
+	}
+
+	helpers := map[string]struct {
+		action cli.ActionFunc
+		flags  []cli.Flag
+	}{
+		"export": {ExportCommand, exportTestFlags()},
+		"set":    {SetCommand, setTestFlags()},
+	}
+	helper, ok := helpers[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "no helper command %q\n", name)
+		os.Exit(2)
+	}
+
+	args := []string{"crumb"}
+	for i, arg := range os.Args {
+		if arg == "--" {
+			args = append(args, os.Args[i+1:]...)
+			break
+		}
+	}
+
+	io.Copy(io.Discard, os.Stdin)
+	cmd := &cli.Command{Name: "crumb", Action: helper.action, Flags: append([]cli.Flag{&cli.StringFlag{Name: "profile", Value: "default"}}, helper.flags...)}
+	if err := cmd.Run(context.Background(), args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// runTestProcesses runs the named command once per entry of runs, each in a
+// separate process with the test's environment and working directory. All
+// processes are started before any of them runs the command, so they contend
+// with each other. It returns each run's stdout and fails the test if a run
+// fails.
+func runTestProcesses(t *testing.T, name string, runs [][]string) []string {
+	t.Helper()
+
+	type process struct {
+		cmd    *exec.Cmd
+		stdin  io.WriteCloser
+		stdout bytes.Buffer
+		stderr bytes.Buffer
+	}
+	processes := make([]*process, len(runs))
+	for i, args := range runs {
+		p := &process{cmd: exec.Command(os.Args[0], append([]string{"-test.run=^TestHelperProcess$", "--"}, args...)...)}
+		p.cmd.Env = append(os.Environ(), helperCommandEnv+"="+name)
+		p.cmd.Stdout, p.cmd.Stderr = &p.stdout, &p.stderr
+		stdin, err := p.cmd.StdinPipe()
+		if err != nil {
+			t.Fatalf("Failed to create stdin pipe: %v", err)
+		}
+		p.stdin = stdin
+		if err := p.cmd.Start(); err != nil {
+			t.Fatalf("Failed to start %s %q: %v", name, args, err)
+		}
+		processes[i] = p
+	}
+
+	for _, p := range processes {
+		p.stdin.Close()
+	}
+	outputs := make([]string, len(runs))
+	for i, p := range processes {
+		if err := p.cmd.Wait(); err != nil {
+			t.Errorf("%s %q failed: %v: %s", name, runs[i], err, p.stderr.String())
+		}
+		outputs[i] = p.stdout.String()
+	}
+	if t.Failed() {
+		t.FailNow()
+	}
+	return outputs
+}
+
+// writeCrumbConfig writes a .crumb.yaml into dir and makes dir the working directory.
+func writeCrumbConfig(t *testing.T, dir, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, ".crumb.yaml"), []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write .crumb.yaml: %v", err)
+	}
+	t.Chdir(dir)
+}
+
+// listTestFlags mirrors the list command's flags from main.go.
+func listTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{Name: "long"},
+		&cli.StringFlag{Name: "modified-since"},
+		&cli.BoolFlag{Name: "include-undated"},
+		&cli.BoolFlag{Name: "empty-only"},
+		&cli.StringFlag{Name: "grep"},
+		&cli.BoolFlag{Name: "regex"},
+		&cli.StringFlag{Name: "sort", Value: "path"},
+		&cli.BoolFlag{Name: "reverse"},
+		&cli.BoolFlag{Name: "paths-only"},
+		&cli.BoolFlag{Name: "with-values"},
+		&cli.BoolFlag{Name: "show"},
+		&cli.BoolFlag{Name: "force"},
+		&cli.StringFlag{Name: "format", Value: "text"},
+		&cli.StringFlag{Name: "redact-pattern"},
+	}
+}
+
+// setTestFlags mirrors the set command's flags from main.go.
+func setTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "expires"},
+		&cli.BoolFlag{Name: "json"},
+		&cli.StringFlag{Name: "file"},
+		&cli.BoolFlag{Name: "if-not-exists"},
+		&cli.BoolFlag{Name: "only-if-exists"},
+		&cli.BoolFlag{Name: "editor"},
+		&cli.StringFlag{Name: "append"},
+		&cli.StringFlag{Name: "separator", Value: ","},
+		&cli.BoolFlag{Name: "unique"},
+		&cli.StringFlag{Name: "from-env"},
+		&cli.BoolFlag{Name: "allow-empty"},
+		&cli.BoolFlag{Name: "generate"},
+		&cli.IntFlag{Name: "length", Value: 32},
+		&cli.StringFlag{Name: "charset", Value: "alnum"},
+	}
+}
+
+// getTestFlags mirrors the get command's flags from main.go.
+func getTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{Name: "mask"},
+		&cli.StringFlag{Name: "mask-char"},
+		&cli.StringFlag{Name: "mask-length"},
+		&cli.BoolFlag{Name: "export"},
+		&cli.StringFlag{Name: "format"},
+		&cli.StringFlag{Name: "shell", Value: "bash"},
+		&cli.BoolFlag{Name: "interactive"},
+		&cli.BoolFlag{Name: "all-under"},
+		&cli.BoolFlag{Name: "show"},
+		&cli.BoolFlag{Name: "force"},
+		&cli.BoolFlag{Name: "no-labels"},
+		&cli.BoolFlag{Name: "exists"},
+		&cli.IntFlag{Name: "fd"},
+		&cli.StringFlag{Name: "redact-pattern"},
+		&cli.BoolFlag{Name: "base64"},
+		&cli.StringFlag{Name: "default"},
+		&cli.BoolFlag{Name: "history"},
+	}
+}
+
+// deleteTestFlags mirrors the delete command's flags from main.go.
+func deleteTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{Name: "stdin"},
+		&cli.BoolFlag{Name: "yes"},
+	}
+}
+
+// importTestFlags mirrors the import command's flags from main.go.
+func importTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "file"},
+		&cli.StringFlag{Name: "path"},
+		&cli.BoolFlag{Name: "dry-run"},
+		&cli.StringFlag{Name: "prefix-strip"},
+		&cli.StringFlag{Name: "only"},
+		&cli.StringFlag{Name: "exclude"},
+		&cli.StringFlag{Name: "format", Value: "env"},
+		&cli.BoolFlag{Name: "import-comments"},
+	}
+}
+
+// exportTestFlags mirrors the export command's flags from main.go.
+func exportTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "format", Value: "shell"},
+		&cli.StringFlag{Name: "shell", Value: "bash"},
+		&cli.StringFlag{Name: "file", Value: ".crumb.yaml"},
+		&cli.BoolFlag{Name: "no-parent-search"},
+		&cli.StringFlag{Name: "path"},
+		&cli.IntFlag{Name: "name-segments", Value: 1},
+		&cli.StringFlag{Name: "env", Value: "default"},
+		&cli.StringFlag{Name: "output"},
+		&cli.BoolFlag{Name: "watch"},
+		&cli.BoolFlag{Name: "fingerprint"},
+		&cli.BoolFlag{Name: "merge"},
+		&cli.BoolFlag{Name: "only-changed"},
+		&cli.StringFlag{Name: "sort-by", Value: "name"},
+		&cli.BoolFlag{Name: "comment-source"},
+		&cli.BoolFlag{Name: "no-comments"},
+		&cli.StringFlag{Name: "merge-file"},
+		&cli.BoolFlag{Name: "strict-remap"},
+		&cli.BoolFlag{Name: "strict-env"},
+		&cli.BoolFlag{Name: "env-from-branch"},
+		&cli.IntFlag{Name: "max-value-length"},
+		&cli.StringFlag{Name: "template"},
+		&cli.BoolFlag{Name: "quote-all"},
+		&cli.BoolFlag{Name: "allow-multiline"},
+		&cli.StringSliceFlag{Name: "prefix-map"},
+		&cli.StringFlag{Name: "strip-prefix"},
+		&cli.BoolFlag{Name: "mask"},
+		&cli.StringFlag{Name: "mask-char"},
+		&cli.StringFlag{Name: "mask-length"},
+		&cli.BoolFlag{Name: "check"},
+		&cli.BoolFlag{Name: "escape-dollar"},
+		&cli.IntFlag{Name: "indent", Value: 2},
+		&cli.StringFlag{Name: "mount", Value: "secret"},
+		&cli.BoolFlag{Name: "force"},
+		&cli.BoolFlag{Name: "dedupe-identical"},
+		&cli.BoolFlag{Name: "annotate-duplicates"},
+		&cli.StringFlag{Name: "name-filter"},
+		&cli.StringFlag{Name: "exclude-filter"},
+		&cli.StringFlag{Name: "redact-pattern"},
+		&cli.BoolFlag{Name: "base64"},
+	}
+}
+
+// diffTestFlags mirrors the diff command's flags from main.go.
+func diffTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "file"},
+		&cli.StringFlag{Name: "config", Value: ".crumb.yaml"},
+		&cli.BoolFlag{Name: "no-parent-search"},
+		&cli.StringFlag{Name: "path"},
+		&cli.IntFlag{Name: "name-segments", Value: 1},
+		&cli.StringFlag{Name: "env", Value: "default"},
+		&cli.StringSliceFlag{Name: "prefix-map"},
+		&cli.StringFlag{Name: "strip-prefix"},
+		&cli.BoolFlag{Name: "show"},
+	}
+}
+
+// shellTestFlags mirrors the shell command's flags from main.go.
+func shellTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "file", Value: ".crumb.yaml"},
+		&cli.BoolFlag{Name: "no-parent-search"},
+		&cli.StringFlag{Name: "path"},
+		&cli.IntFlag{Name: "name-segments", Value: 1},
+		&cli.StringFlag{Name: "env", Value: "default"},
+		&cli.StringSliceFlag{Name: "prefix-map"},
+		&cli.StringFlag{Name: "strip-prefix"},
+	}
+}
+
+// doctorTestFlags mirrors the doctor command's flags from main.go.
+func doctorTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{Name: "fix"},
+	}
+}
+
+// versionTestFlags mirrors the version command's flags from main.go.
+func versionTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{Name: "check"},
+		&cli.BoolFlag{Name: "no-network"},
+	}
+}
+
+// storageSetTestFlags mirrors the storage set command's flags from main.go.
+func storageSetTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{Name: "init"},
+	}
+}
+
+// storageMoveTestFlags mirrors the storage move command's flags from main.go.
+func storageMoveTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{Name: "yes"},
+		&cli.BoolFlag{Name: "keep-old"},
+	}
+}
+
+// describeConfigTestFlags mirrors the describe-config command's flags from main.go.
+func describeConfigTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "file", Value: ".crumb.yaml"},
+		&cli.BoolFlag{Name: "no-parent-search"},
+		&cli.BoolFlag{Name: "json"},
+	}
+}
+
+// syncTestFlags mirrors the sync push and pull commands' flags from main.go.
+func syncTestFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "remote"},
+		&cli.StringFlag{Name: "branch"},
+	}
+}
@@ -7,12 +7,16 @@ import (
 	"path/filepath"
 
 	"github.com/urfave/cli/v3"
+
+	"crumb/pkg/storage"
 )
 
 // HookCommand handles the hook command for shell integration
 func HookCommand(_ context.Context, cmd *cli.Command) error {
-
-	shell := cmd.String("shell")
+	shell, err := resolveHookShell(cmd)
+	if err != nil {
+		return err
+	}
 
 	// Get the path to the crumb binary
 	selfPath, err := os.Executable()
@@ -32,22 +36,62 @@ func HookCommand(_ context.Context, cmd *cli.Command) error {
 		hookScript = zshHook(selfPath)
 	case "fish":
 		hookScript = fishHook(selfPath)
+	case "csh", "tcsh":
+		hookScript = cshHook(selfPath)
+	case "elvish":
+		hookScript = elvishHook(selfPath)
 	default:
-		return fmt.Errorf("unsupported shell: %s (supported: bash, zsh, fish)", shell)
+		return fmt.Errorf("unsupported shell: %s (supported: bash, zsh, fish, csh, tcsh, elvish)", shell)
 	}
 
 	fmt.Print(hookScript)
 	return nil
 }
 
+// resolveHookShell picks the shell to generate a hook for. An explicit argument
+// wins, then the --shell flag or TOML setting, then the basename of $SHELL.
+func resolveHookShell(cmd *cli.Command) (string, error) {
+	if cmd.Args().Len() > 0 {
+		return cmd.Args().Get(0), nil
+	}
+	if cmd.IsSet("shell") {
+		return cmd.String("shell"), nil
+	}
+	if envShell := os.Getenv("SHELL"); envShell != "" {
+		return filepath.Base(envShell), nil
+	}
+	return "", fmt.Errorf("could not determine shell from $SHELL; pass one explicitly, e.g. 'crumb hook bash' (supported: bash, zsh, fish, csh, tcsh, elvish)")
+}
+
 func bashHook(selfPath string) string {
-	return fmt.Sprintf(`_crumb_hook() {
+	return fmt.Sprintf(`_crumb_has_config() {
+  local dir="$PWD"
+  while true; do
+    if [ -f "$dir/.crumb.yaml" ]; then
+      _crumb_config="$dir/.crumb.yaml"
+      return 0
+    fi
+    [ "$dir" = "/" ] && return 1
+    dir="${dir%%/*}"
+    dir="${dir:-/}"
+  done
+}
+_crumb_loaded=unloaded;
+_crumb_hook() {
   local previous_exit_status=$?;
-  if [ -f .crumb.yaml ]; then
-    eval "$("%s" export --shell bash)";
+  if _crumb_has_config; then
+    local state;
+    if ! state="$("%[1]s" export --fingerprint 2>/dev/null)" || [ "$state" != "$_crumb_loaded" ]; then
+      local output;
+      if output="$("%[1]s" export --shell bash)"; then
+        eval "$output";
+        _crumb_loaded="$state";
+      fi
+    fi
   fi
   return $previous_exit_status;
 };
+export _CRUMB_HOOK_ACTIVE=1;
 if ! [[ ";${PROMPT_COMMAND[*]:-};" =~ ";_crumb_hook;" ]]; then
   if [[ "$(declare -p PROMPT_COMMAND 2>&1)" == "declare -a"* ]]; then
     PROMPT_COMMAND=(_crumb_hook "${PROMPT_COMMAND[@]}")
@@ -59,11 +103,32 @@ fi
 }
 
 func zshHook(selfPath string) string {
-	return fmt.Sprintf(`_crumb_hook() {
-  if [ -f .crumb.yaml ]; then
-    eval "$("%s" export --shell bash)"
+	return fmt.Sprintf(`_crumb_has_config() {
+  local dir="$PWD"
+  while true; do
+    if [ -f "$dir/.crumb.yaml" ]; then
+      _crumb_config="$dir/.crumb.yaml"
+      return 0
+    fi
+    [ "$dir" = "/" ] && return 1
+    dir="${dir%%/*}"
+    dir="${dir:-/}"
+  done
+}
+_crumb_loaded=unloaded
+_crumb_hook() {
+  if _crumb_has_config; then
+    local state
+    if ! state="$("%[1]s" export --fingerprint 2>/dev/null)" || [ "$state" != "$_crumb_loaded" ]; then
+      local output
+      if output="$("%[1]s" export --shell bash)"; then
+        eval "$output"
+        _crumb_loaded="$state"
+      fi
+    fi
   fi
 }
+export _CRUMB_HOOK_ACTIVE=1
 typeset -ag precmd_functions
 if (( ! ${precmd_functions[(I)_crumb_hook]} )); then
   precmd_functions=(_crumb_hook $precmd_functions)
@@ -76,19 +141,116 @@ fi
 }
 
 func fishHook(selfPath string) string {
-	return fmt.Sprintf(`function _crumb_hook --on-variable PWD --description 'crumb hook'
-  if test -f .crumb.yaml
-    %s export --shell fish | source;
+	return fmt.Sprintf(`function _crumb_has_config --description 'find .crumb.yaml in PWD or a parent'
+  set -l dir $PWD
+  while true
+    if test -f "$dir/.crumb.yaml"
+      set -g _crumb_config "$dir/.crumb.yaml"
+      return 0
+    end
+    if test "$dir" = /
+      return 1
+    end
+    set dir (dirname "$dir")
   end
 end
 
-function _crumb_hook_prompt --on-event fish_prompt --description 'crumb hook on prompt'
-  if test -f .crumb.yaml
-    %s export --shell fish | source;
+set -g _crumb_loaded unloaded
+
+function _crumb_load --description 'load secrets unless nothing the export reads changed since the last load'
+  if _crumb_has_config
+    set -l state (%[1]s export --fingerprint 2>/dev/null)
+    set -l fingerprint_status $status
+    if test $fingerprint_status -ne 0; or test "$state" != "$_crumb_loaded"
+      set -l output (%[1]s export --shell fish)
+      and begin
+        printf '%%s\n' $output | source
+        set -g _crumb_loaded $state
+      end
+    end
   end
 end
 
+function _crumb_hook --on-variable PWD --description 'crumb hook'
+  _crumb_load
+end
+
+function _crumb_hook_prompt --on-event fish_prompt --description 'crumb hook on prompt'
+  _crumb_load
+end
+
+set -gx _CRUMB_HOOK_ACTIVE 1
+
+# Call hook immediately to load secrets in current directory
+_crumb_hook
+`, selfPath)
+}
+
+// cshHook loads secrets from the precmd alias. csh aliases can't loop, so
+// instead of searching parent directories for .crumb.yaml itself, it relies on
+// export --fingerprint, which does the search and prints nothing when no
+// config is found. csh can't silence stderr alone, so the fingerprint runs
+// under sh to drop its errors. Secrets are only decrypted when the fingerprint
+// is non-empty and changed. The set that records the fingerprint is only
+// echoed into the eval when the export succeeds, since csh can't see the
+// status of a command substitution. An existing precmd alias is captured when
+// the hook is evaluated and run after _crumb_hook; _crumb_hooked keeps a
+// second eval from chaining the hook twice. Like the export output, every line
+// ends with ";" so the script survives eval joining its lines.
+func cshHook(selfPath string) string {
+	return fmt.Sprintf(`set _crumb_loaded = unloaded;
+alias _crumb_hook 'set _crumb_state = "`+"`sh -c '\\''exec %[1]s export --fingerprint 2>/dev/null'\\''`"+`"; if ( "$_crumb_state" != "" && "$_crumb_state" != "$_crumb_loaded" ) eval "`+"`%[1]s export --shell csh && echo set _crumb_loaded = $_crumb_state`"+`"';
+if ( ! $?_crumb_hooked ) alias precmd "_crumb_hook; `+"`alias precmd`"+`";
+set _crumb_hooked;
+setenv _CRUMB_HOOK_ACTIVE 1;
+_crumb_hook;
+`, selfPath)
+}
+
+// elvishHook loads secrets when the directory changes and before each prompt.
+// It's meant to be evaluated from rc.elv with eval (crumb hook elvish | slurp).
+func elvishHook(selfPath string) string {
+	return fmt.Sprintf(`use path
+
+var _crumb_loaded = 'unloaded'
+
+fn _crumb_find_config {
+  var dir = $pwd
+  while $true {
+    if (path:is-regular $dir/.crumb.yaml) {
+      put $dir/.crumb.yaml
+      return
+    }
+    if (==s $dir /) {
+      put ''
+      return
+    }
+    set dir = (path:dir $dir)
+  }
+}
+
+fn _crumb_hook {
+  var config = (_crumb_find_config)
+  if (==s $config '') {
+    return
+  }
+  var state = ''
+  var fingerprinted = $false
+  try { set state = (%[1]s export --fingerprint 2>/dev/null); set fingerprinted = $true } catch { }
+  if (or (not $fingerprinted) (!=s $state $_crumb_loaded)) {
+    var output = ''
+    if ?(set output = (%[1]s export --shell elvish | slurp)) {
+      eval $output
+      set _crumb_loaded = $state
+    }
+  }
+}
+
+set-env _CRUMB_HOOK_ACTIVE 1
+set after-chdir = [$@after-chdir {|_| _crumb_hook }]
+set edit:before-readline = [$@edit:before-readline { _crumb_hook }]
+
 # Call hook immediately to load secrets in current directory
 _crumb_hook
-`, selfPath, selfPath)
+`, storage.ElvishQuoteValue(selfPath))
 }
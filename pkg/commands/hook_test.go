@@ -0,0 +1,206 @@
+package commands
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHooksSetMarkerAndTrackInputs(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "bash",
+			script: bashHook("/usr/local/bin/crumb"),
+			want:   []string{"export _CRUMB_HOOK_ACTIVE=1", "_crumb_loaded=unloaded", `if ! state="$("/usr/local/bin/crumb" export --fingerprint 2>/dev/null)" || [ "$state" != "$_crumb_loaded" ]`, `_crumb_loaded="$state"`},
+		},
+		{
+			name:   "zsh",
+			script: zshHook("/usr/local/bin/crumb"),
+			want:   []string{"export _CRUMB_HOOK_ACTIVE=1", "_crumb_loaded=unloaded", `if ! state="$("/usr/local/bin/crumb" export --fingerprint 2>/dev/null)" || [ "$state" != "$_crumb_loaded" ]`, `_crumb_loaded="$state"`},
+		},
+		{
+			name:   "fish",
+			script: fishHook("/usr/local/bin/crumb"),
+			want:   []string{"set -gx _CRUMB_HOOK_ACTIVE 1", "set -g _crumb_loaded unloaded", "set -l state (/usr/local/bin/crumb export --fingerprint 2>/dev/null)", `test $fingerprint_status -ne 0; or test "$state" != "$_crumb_loaded"`, "set -g _crumb_loaded $state"},
+		},
+		{
+			name:   "elvish",
+			script: elvishHook("/usr/local/bin/crumb"),
+			want:   []string{"set-env _CRUMB_HOOK_ACTIVE 1", "var _crumb_loaded = 'unloaded'", "set state = (/usr/local/bin/crumb export --fingerprint 2>/dev/null); set fingerprinted = $true", "(or (not $fingerprinted) (!=s $state $_crumb_loaded))", "set _crumb_loaded = $state"},
+		},
+		{
+			name:   "csh",
+			script: cshHook("/usr/local/bin/crumb"),
+			want:   []string{"setenv _CRUMB_HOOK_ACTIVE 1;", `set _crumb_state = "` + "`sh -c '\\''exec /usr/local/bin/crumb export --fingerprint 2>/dev/null'\\''`" + `"`, "set _crumb_loaded = unloaded;", `if ( "$_crumb_state" != "" && "$_crumb_state" != "$_crumb_loaded" )`, "export --shell csh && echo set _crumb_loaded = $_crumb_state`", `if ( ! $?_crumb_hooked ) alias precmd "_crumb_hook; ` + "`alias precmd`" + `";`},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, want := range tt.want {
+			if !strings.Contains(tt.script, want) {
+				t.Errorf("%s hook missing %q:\n%s", tt.name, want, tt.script)
+			}
+		}
+	}
+}
+
+func TestElvishHook(t *testing.T) {
+	script := elvishHook("/opt/my tools/crumb")
+
+	for _, want := range []string{
+		"set after-chdir = [$@after-chdir {|_| _crumb_hook }]",
+		"set edit:before-readline = [$@edit:before-readline { _crumb_hook }]",
+		"path:is-regular $dir/.crumb.yaml",
+		"('/opt/my tools/crumb' export --shell elvish | slurp)",
+		"eval $output",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("elvish hook missing %q:\n%s", want, script)
+		}
+	}
+
+	// None of the POSIX shell constructs the other hooks use are valid elvish
+	for _, unwanted := range []string{"\nexport ", "$(", "${", "PROMPT_COMMAND", "precmd", "; then", "\nfi", "local ", "[ -f"} {
+		if strings.Contains(script, unwanted) {
+			t.Errorf("elvish hook contains %q:\n%s", unwanted, script)
+		}
+	}
+}
+
+func TestBashHookReloadsWhenInputsChange(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	// The fake crumb's fingerprint covers .crumb.yaml and a stand-in for the
+	// storage file, like export --fingerprint does for the real inputs
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "calls")
+	storagePath := filepath.Join(dir, "secrets")
+	fakeCrumb := filepath.Join(dir, "crumb")
+	script := `#!/bin/sh
+if [ "$2" = "--fingerprint" ]; then
+  cat "$PWD/.crumb.yaml" "$PWD/../.crumb.yaml" "` + storagePath + `" 2>/dev/null | cksum
+  exit 0
+fi
+echo x >> ` + counter + `
+echo "export FROM_CRUMB=$(cat ` + storagePath + `)"
+`
+	if err := os.WriteFile(fakeCrumb, []byte(script), 0700); err != nil {
+		t.Fatalf("Failed to write fake crumb: %v", err)
+	}
+	if err := os.WriteFile(storagePath, []byte("first"), 0600); err != nil {
+		t.Fatalf("Failed to write storage: %v", err)
+	}
+
+	project := filepath.Join(dir, "project")
+	if err := os.MkdirAll(filepath.Join(project, "sub"), 0700); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".crumb.yaml"), []byte("version: \"1.0\"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	hookPath := filepath.Join(dir, "hook.bash")
+	if err := os.WriteFile(hookPath, []byte(bashHook(fakeCrumb)), 0600); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+
+	// Two prompts in the project, one in a subdirectory sharing the config,
+	// one after a secret changed and one after .crumb.yaml changed
+	session := `source "$1"
+cd "$2"; _crumb_hook; _crumb_hook
+cd sub; _crumb_hook
+printf second > "$3"; _crumb_hook
+echo "$FROM_CRUMB"
+echo "# edited" >> "$2/.crumb.yaml"; _crumb_hook
+echo "$_CRUMB_HOOK_ACTIVE"
+`
+	out, err := exec.Command("bash", "-c", session, "bash", hookPath, project, storagePath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash session failed: %v\n%s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "second\n1" {
+		t.Errorf("exported variable and marker = %q, want %q", got, "second\n1")
+	}
+
+	calls, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatalf("Failed to read call counter: %v", err)
+	}
+	if n := strings.Count(string(calls), "x"); n != 3 {
+		t.Errorf("crumb export ran %d times, want 3 (first load, after the secret changed and after the config changed)", n)
+	}
+}
+
+func TestBashHookReportsBrokenConfig(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	// Like the real one, the fake crumb fails both the fingerprint and the
+	// export while .crumb.yaml can't be parsed
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "calls")
+	fakeCrumb := filepath.Join(dir, "crumb")
+	script := `#!/bin/sh
+if [ "$2" != "--fingerprint" ]; then
+  echo x >> ` + counter + `
+fi
+if grep -q broken "$PWD/.crumb.yaml"; then
+  echo "Error: failed to parse .crumb.yaml" >&2
+  exit 1
+fi
+if [ "$2" = "--fingerprint" ]; then
+  cksum < "$PWD/.crumb.yaml"
+  exit 0
+fi
+echo "export FROM_CRUMB=loaded"
+`
+	if err := os.WriteFile(fakeCrumb, []byte(script), 0700); err != nil {
+		t.Fatalf("Failed to write fake crumb: %v", err)
+	}
+
+	project := filepath.Join(dir, "project")
+	if err := os.MkdirAll(project, 0700); err != nil {
+		t.Fatalf("Failed to create project: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".crumb.yaml"), []byte("broken: [\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	hookPath := filepath.Join(dir, "hook.bash")
+	if err := os.WriteFile(hookPath, []byte(bashHook(fakeCrumb)), 0600); err != nil {
+		t.Fatalf("Failed to write hook: %v", err)
+	}
+
+	// Every prompt with the broken config shows the error, and fixing it loads the secrets
+	session := `source "$1"
+cd "$2"; _crumb_hook; _crumb_hook
+echo "loaded=${FROM_CRUMB:-}"
+echo 'version: "1.0"' > "$2/.crumb.yaml"; _crumb_hook
+echo "loaded=$FROM_CRUMB"
+`
+	out, err := exec.Command("bash", "-c", session, "bash", hookPath, project).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash session failed: %v\n%s", err, out)
+	}
+	if n := strings.Count(string(out), "failed to parse .crumb.yaml"); n != 2 {
+		t.Errorf("parse error shown %d times, want once per prompt (2):\n%s", n, out)
+	}
+	if !strings.Contains(string(out), "loaded=\n") || !strings.Contains(string(out), "loaded=loaded") {
+		t.Errorf("expected secrets only after the config was fixed:\n%s", out)
+	}
+
+	calls, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatalf("Failed to read call counter: %v", err)
+	}
+	if n := strings.Count(string(calls), "x"); n != 3 {
+		t.Errorf("crumb export ran %d times, want 3 (two broken prompts and the fixed one)", n)
+	}
+}
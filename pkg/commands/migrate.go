@@ -69,7 +69,7 @@ func MigrateCommand(_ context.Context, cmd *cli.Command) error {
 	}
 
 	// Set updated timestamp for all entries
-	now := time.Now().UTC().Format(time.RFC3339)
+	now := storeClock.Now().UTC().Format(time.RFC3339)
 	for key, entry := range legacySecrets {
 		entry.Updated = now
 		legacySecrets[key] = entry
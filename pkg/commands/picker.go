@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -10,13 +11,13 @@ import (
 	"crumb/pkg/storage"
 )
 
-func pickSecretPath(cmd *cli.Command) (string, error) {
-	cfg, b, err := resolveBackend(cmd)
+func pickSecretPath(ctx context.Context, cmd *cli.Command) (string, error) {
+	store, err := resolveStore(ctx, cmd)
 	if err != nil {
 		return "", err
 	}
 
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
+	secrets, err := store.Load()
 	if err != nil {
 		return "", err
 	}
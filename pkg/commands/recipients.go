@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v3"
+
+	"crumb/pkg/crypto"
+)
+
+// RecipientsListCommand reports the recipients the storage file is encrypted to
+// by reading its age header, without decrypting the secrets.
+func RecipientsListCommand(_ context.Context, cmd *cli.Command) error {
+	cfg, b, err := resolveBackend(cmd)
+	if err != nil {
+		return err
+	}
+
+	exists, err := b.Exists()
+	if err != nil {
+		return fmt.Errorf("failed to check storage: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("no storage file found. Run 'crumb setup' first")
+	}
+
+	encryptedData, err := b.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read secrets: %w", err)
+	}
+
+	stanzas, err := crypto.ParseRecipientStanzas(encryptedData)
+	if err != nil {
+		return err
+	}
+
+	// The profile key is optional context; a missing public key shouldn't block the audit
+	profileTag, _ := crypto.SSHRecipientTag(cfg.PublicKeyPath)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "TYPE\tTAG\tNOTE\n")
+	for _, stanza := range stanzas {
+		tag := stanza.Tag()
+		note := ""
+		switch {
+		case tag != "" && tag == profileTag:
+			note = "profile public key"
+		case stanza.Type == "X25519":
+			tag = "-"
+			note = "native age recipient (anonymous)"
+		case stanza.Type == "scrypt":
+			tag = "-"
+			note = "passphrase"
+		case tag == "":
+			tag = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", stanza.Type, tag, note)
+	}
+	w.Flush()
+
+	return nil
+}
+
+// keyDescription is one public key in keys --json
+type keyDescription struct {
+	Fingerprint string `json:"fingerprint"`
+	Type        string `json:"type"`
+	Comment     string `json:"comment,omitempty"`
+	Path        string `json:"path"`
+}
+
+// keysJSON is the envelope of keys --json
+type keysJSON struct {
+	Version int              `json:"version"`
+	Keys    []keyDescription `json:"keys"`
+}
+
+// KeysCommand prints the fingerprints of the public keys the profile encrypts
+// to, read from the key files rather than the storage file. Unlike
+// 'recipients list' it works before anything is stored.
+func KeysCommand(_ context.Context, cmd *cli.Command) error {
+	cfg, _, err := resolveBackend(cmd)
+	if err != nil {
+		return err
+	}
+
+	// A profile has a single public key today; the list leaves room for more
+	publicKeyPaths := []string{cfg.PublicKeyPath}
+
+	keys := make([]keyDescription, 0, len(publicKeyPaths))
+	for _, path := range publicKeyPaths {
+		info, err := crypto.SSHPublicKeyInfo(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, keyDescription{Fingerprint: info.Fingerprint, Type: info.Type, Comment: info.Comment, Path: path})
+	}
+
+	if cmd.Bool("json") {
+		encoded, err := json.MarshalIndent(keysJSON{Version: jsonSchemaVersion, Keys: keys}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		fmt.Println(string(encoded))
+		return nil
+	}
+
+	for _, key := range keys {
+		line := fmt.Sprintf("%s %s %s", key.Fingerprint, key.Type, key.Path)
+		if key.Comment != "" {
+			line += " (" + key.Comment + ")"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
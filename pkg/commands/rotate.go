@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"crumb/pkg/config"
+	"crumb/pkg/storage"
+)
+
+// RotateSetCommand records a rotation interval for a secret
+func RotateSetCommand(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 2 {
+		return fmt.Errorf("usage: crumb rotate set <key-path> <interval>")
+	}
+
+	keyPath := cmd.Args().Get(0)
+	interval := cmd.Args().Get(1)
+	if err := config.ValidateKeyPath(keyPath); err != nil {
+		return err
+	}
+	if _, err := storage.ParseInterval(interval); err != nil {
+		return err
+	}
+
+	store, err := resolveStore(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	err = store.Update(func(secrets storage.SecretStore) error {
+		entry, exists := storage.SecretExists(secrets, keyPath)
+		if !exists {
+			return fmt.Errorf("key not found: %s", keyPath)
+		}
+		entry.Rotate = interval
+		secrets[keyPath] = entry
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rotation interval for %s set to %s\n", keyPath, interval)
+	return nil
+}
+
+// RotateClearCommand removes the rotation interval from a secret
+func RotateClearCommand(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 1 {
+		return fmt.Errorf("usage: crumb rotate clear <key-path>")
+	}
+
+	keyPath := cmd.Args().Get(0)
+	if err := config.ValidateKeyPath(keyPath); err != nil {
+		return err
+	}
+
+	store, err := resolveStore(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	var cleared bool
+	err = store.Update(func(secrets storage.SecretStore) error {
+		entry, exists := storage.SecretExists(secrets, keyPath)
+		if !exists {
+			return fmt.Errorf("key not found: %s", keyPath)
+		}
+		cleared = entry.Rotate != ""
+		entry.Rotate = ""
+		secrets[keyPath] = entry
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !cleared {
+		fmt.Printf("No rotation interval set for %s\n", keyPath)
+		return nil
+	}
+
+	fmt.Printf("Rotation interval for %s cleared\n", keyPath)
+	return nil
+}
+
+// RotateDueCommand lists secrets whose rotation interval has elapsed since
+// they were last updated. It only reports; nothing is rotated.
+func RotateDueCommand(ctx context.Context, cmd *cli.Command) error {
+	store, err := resolveStore(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	secrets, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	due := storage.DueForRotation(secrets, store.Clock().Now())
+	if len(due) == 0 {
+		fmt.Println("No secrets are due for rotation")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tUPDATED\tEVERY\tDUE")
+	for _, status := range due {
+		updated := secrets[status.Key].Updated
+		dueAt := "(unknown)"
+		if updated == "" {
+			updated = "(unknown)"
+		}
+		if !status.DueAt.IsZero() {
+			dueAt = status.DueAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", status.Key, updated, status.Interval, dueAt)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// crumbEnvVar is set in a crumb shell to what was loaded, so prompts and
+// scripts can tell that secrets are active
+const crumbEnvVar = "CRUMB_ENV"
+
+// shellEnv returns environ with vars and CRUMB_ENV=label set, replacing any
+// existing entries with the same names
+func shellEnv(environ []string, vars map[string]string, label string) []string {
+	overrides := make(map[string]string, len(vars)+1)
+	for name, value := range vars {
+		overrides[name] = value
+	}
+	overrides[crumbEnvVar] = label
+
+	env := make([]string, 0, len(environ)+len(overrides))
+	for _, entry := range environ {
+		name, _, _ := strings.Cut(entry, "=")
+		if _, ok := overrides[name]; !ok {
+			env = append(env, entry)
+		}
+	}
+
+	var names []string
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+overrides[name])
+	}
+	return env
+}
+
+// ShellCommand starts $SHELL with the exported variables in its environment,
+// so secrets are only set until the subshell exits. Arguments are passed to
+// the shell, e.g. crumb shell -- -c 'make deploy'. The shell's exit status
+// becomes crumb's.
+func ShellCommand(ctx context.Context, cmd *cli.Command) error {
+	result, err := loadExport(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	shellPath := os.Getenv("SHELL")
+	if shellPath == "" {
+		shellPath = "/bin/sh"
+	}
+
+	label := cmd.String("env")
+	if cmd.String("path") != "" {
+		label = cmd.String("path")
+	}
+	if current := os.Getenv(crumbEnvVar); current != "" {
+		fmt.Fprintf(os.Stderr, "Warning: already in a crumb shell for %s, starting a nested one\n", current)
+	}
+
+	sub := exec.CommandContext(ctx, shellPath, cmd.Args().Slice()...)
+	sub.Env = shellEnv(os.Environ(), result.Vars, label)
+	sub.Stdin, sub.Stdout, sub.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// Ctrl+C belongs to the subshell; crumb waits for it to exit instead of
+	// dying and leaving it behind
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	if err := sub.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// A shell killed by a signal has no exit code
+			return cli.Exit("", max(exitErr.ExitCode(), 1))
+		}
+		return fmt.Errorf("failed to start %s: %w", shellPath, err)
+	}
+	return nil
+}
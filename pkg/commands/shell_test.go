@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+func TestShellEnv(t *testing.T) {
+	environ := []string{"PATH=/usr/bin", "API_KEY=old", "HOME=/home/me"}
+	got := shellEnv(environ, map[string]string{"API_KEY": "new", "DB_URL": "postgres://db"}, "staging")
+	want := []string{"PATH=/usr/bin", "HOME=/home/me", "API_KEY=new", "CRUMB_ENV=staging", "DB_URL=postgres://db"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("shellEnv() = %q, want %q", got, want)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	profile := setupTestProfile(t, map[string]string{
+		"/app/dev/some-var": "from crumb",
+	})
+	writeCrumbConfig(t, profile.Home, `version: "1.0"
+environments:
+  dev:
+    path: /app/dev
+`)
+	t.Setenv("SHELL", sh)
+	t.Setenv("SOME_VAR", "from parent")
+
+	output, err := runTestCommand(t, ShellCommand, shellTestFlags(), []string{"--env", "dev", "--", "-c", `echo "$SOME_VAR|$CRUMB_ENV"`}, "")
+	if err != nil {
+		t.Fatalf("ShellCommand() unexpected error = %v", err)
+	}
+	if output != "from crumb|dev\n" {
+		t.Errorf("output = %q, want %q", output, "from crumb|dev\n")
+	}
+
+	output, err = runTestCommand(t, ShellCommand, shellTestFlags(), []string{"--path", "/app/dev/", "--", "-c", `echo "$CRUMB_ENV"`}, "")
+	if err != nil {
+		t.Fatalf("ShellCommand() unexpected error = %v", err)
+	}
+	if output != "/app/dev/\n" {
+		t.Errorf("output = %q, want %q", output, "/app/dev/\n")
+	}
+
+	_, err = runTestCommand(t, ShellCommand, shellTestFlags(), []string{"--env", "dev", "--", "-c", "exit 3"}, "")
+	var exitErr cli.ExitCoder
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("ShellCommand() error = %v, want exit code 3", err)
+	}
+}
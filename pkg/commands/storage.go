@@ -3,16 +3,22 @@ package commands
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/urfave/cli/v3"
 	"gopkg.in/yaml.v3"
 
+	"crumb/pkg/backend"
 	"crumb/pkg/config"
+	"crumb/pkg/crypto"
 	"crumb/pkg/storage"
 )
 
@@ -46,8 +52,31 @@ func StorageSetCommand(_ context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("profile '%s' not found. Run 'crumb setup --profile %s' first", profile, profile)
 	}
 
+	expandedPath, err := filepath.Abs(config.ExpandTilde(storagePath))
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	dirMode, err := profileConfig.StorageDirMode()
+	if err != nil {
+		return err
+	}
+	exists, err := checkStoragePath(expandedPath, dirMode)
+	if err != nil {
+		return err
+	}
+	if !exists && cmd.Bool("init") {
+		fileMode, err := profileConfig.StorageFileMode()
+		if err != nil {
+			return err
+		}
+		b := &backend.FileBackend{Path: expandedPath, Mode: fileMode}
+		if _, err := ensureStorage(profileConfig.PublicKeyPath, b, false); err != nil {
+			return err
+		}
+		exists = true
+	}
+
 	// Update local storage path
-	expandedPath := config.ExpandTilde(storagePath)
 	profileConfig.Storage.Local = &config.LocalStorageConfig{Path: expandedPath}
 	profileConfig.Storage.S3 = nil // Clear S3 if switching to local
 	cfg.Profiles[profile] = profileConfig
@@ -57,9 +86,153 @@ func StorageSetCommand(_ context.Context, cmd *cli.Command) error {
 	}
 
 	fmt.Printf("Storage path set to: %s (profile: %s)\n", expandedPath, profile)
+	if !exists {
+		fmt.Println("No storage file exists there yet; it will be created on the first 'crumb set', or pass --init to create it now")
+	}
 	return nil
 }
 
+// checkStoragePath makes sure a storage file can be written at path: its
+// directory is created with dirMode if missing, and path must not be a
+// directory. It reports whether a non-empty storage file already exists there.
+func checkStoragePath(path string, dirMode os.FileMode) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if err == nil && info.IsDir() {
+		return false, fmt.Errorf("%s is a directory, expected a storage file path", path)
+	}
+
+	dir := filepath.Dir(path)
+	if err := mkdirWithMode(dir, dirMode); err != nil {
+		return false, fmt.Errorf("failed to create storage directory %s: %w", dir, err)
+	}
+
+	// Storage is written atomically through a temporary file next to it, so
+	// the directory itself has to be writable
+	probe, err := os.CreateTemp(dir, ".crumb-write-check-*")
+	if err != nil {
+		return false, fmt.Errorf("storage directory %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	if info != nil {
+		file, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return false, fmt.Errorf("storage file %s is not writable: %w", path, err)
+		}
+		file.Close()
+	}
+	return info != nil && info.Size() > 0, nil
+}
+
+// StorageMoveCommand moves the profile's local storage file to a new path and
+// points the profile at it
+func StorageMoveCommand(_ context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 1 {
+		return fmt.Errorf("usage: crumb storage move <new-path>")
+	}
+	if cmd.Bool("yes") && cmd.Bool("keep-old") {
+		return fmt.Errorf("--yes and --keep-old cannot be used together")
+	}
+
+	profile := getProfile(cmd)
+	profileCfg, b, err := resolveBackend(cmd)
+	if err != nil {
+		return err
+	}
+	fileBackend, ok := b.(*backend.FileBackend)
+	if !ok {
+		return fmt.Errorf("crumb storage move only supports local storage")
+	}
+	dirMode, err := profileCfg.StorageDirMode()
+	if err != nil {
+		return err
+	}
+
+	oldPath := fileBackend.Path
+	newPath, err := filepath.Abs(config.ExpandTilde(cmd.Args().Get(0)))
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	if newPath == filepath.Clean(oldPath) {
+		return fmt.Errorf("storage is already at %s", newPath)
+	}
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("%s already exists, refusing to overwrite it", newPath)
+	}
+	exists, err := fileBackend.Exists()
+	if err != nil {
+		return fmt.Errorf("failed to check storage file: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("storage file %s does not exist", oldPath)
+	}
+
+	// Decide about the old file up front, so no one waits on its lock while
+	// the question is answered
+	removeOld := cmd.Bool("yes")
+	if !removeOld && !cmd.Bool("keep-old") {
+		response, err := config.PromptForInput(fmt.Sprintf("Remove the old storage file %s once it's moved? (y/n): ", oldPath))
+		if err != nil {
+			return err
+		}
+		response = strings.ToLower(response)
+		removeOld = response == "y" || response == "yes"
+	}
+
+	if err := mkdirWithMode(filepath.Dir(newPath), dirMode); err != nil {
+		return fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	// The old file stays locked from the copy until it's removed, so a
+	// concurrent set can't write to it in between and lose its change
+	err = crypto.UpdateFileWithLock(oldPath, fileBackend.Mode, fileBackend.LockTimeout, func(data []byte) ([]byte, error) {
+		if err := crypto.CreateFileAtomic(newPath, data, fileBackend.Mode); err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				return nil, fmt.Errorf("%s already exists, refusing to overwrite it", newPath)
+			}
+			return nil, fmt.Errorf("failed to write %s: %w", newPath, err)
+		}
+
+		if err := pointProfileAt(profile, newPath); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Moved storage to: %s (profile: %s)\n", newPath, profile)
+
+		if !removeOld {
+			fmt.Printf("Kept the old storage file: %s\n", oldPath)
+			return nil, nil
+		}
+		if err := os.Remove(oldPath); err != nil {
+			return nil, fmt.Errorf("failed to remove old storage file: %w", err)
+		}
+		fmt.Printf("Removed the old storage file: %s\n", oldPath)
+		return nil, nil
+	})
+	return err
+}
+
+// pointProfileAt makes profile's local storage path newPath in config.yaml
+func pointProfileAt(profile, newPath string) error {
+	configPath := filepath.Clean(filepath.Join(os.Getenv("HOME"), ".config", "crumb", "config.yaml"))
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	var cfg config.Config
+	if err := yaml.Unmarshal(configData, &cfg); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	profileConfig := cfg.Profiles[profile]
+	profileConfig.Storage.Local = &config.LocalStorageConfig{Path: newPath}
+	cfg.Profiles[profile] = profileConfig
+	return config.SaveConfig(&cfg)
+}
+
 // StorageGetCommand handles the storage get command
 func StorageGetCommand(_ context.Context, cmd *cli.Command) error {
 	profile := getProfile(cmd)
@@ -84,6 +257,85 @@ func StorageGetCommand(_ context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// storageInfo is what storage info reports about a profile's storage. File
+// facts are only filled in for local storage.
+type storageInfo struct {
+	Version     int    `json:"version"`
+	Profile     string `json:"profile"`
+	Location    string `json:"location"`
+	Initialized bool   `json:"initialized"`
+	Size        int64  `json:"size_bytes,omitempty"`
+	Modified    string `json:"modified,omitempty"`
+	Permissions string `json:"permissions,omitempty"`
+	Secrets     int    `json:"secrets"`
+}
+
+// StorageInfoCommand reports where a profile's secrets are stored, the
+// storage file's size, modification time and permissions, and how many
+// secrets it holds, without showing any values. A missing or empty storage
+// file is reported as not initialized.
+func StorageInfoCommand(ctx context.Context, cmd *cli.Command) error {
+	_, b, err := resolveBackend(cmd)
+	if err != nil {
+		return err
+	}
+
+	info := storageInfo{Profile: getProfile(cmd), Location: b.Location()}
+	if fileBackend, ok := b.(*backend.FileBackend); ok {
+		stat, err := os.Stat(fileBackend.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to stat storage file: %w", err)
+		}
+		if err == nil {
+			info.Initialized = stat.Size() > 0
+			info.Size = stat.Size()
+			info.Modified = stat.ModTime().UTC().Format(time.RFC3339)
+			info.Permissions = fmt.Sprintf("%04o", stat.Mode().Perm())
+		}
+	} else {
+		exists, err := b.Exists()
+		if err != nil {
+			return fmt.Errorf("failed to check storage: %w", err)
+		}
+		info.Initialized = exists
+	}
+
+	if info.Initialized {
+		store, err := resolveStore(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		secrets, err := store.Load()
+		if err != nil {
+			return err
+		}
+		info.Secrets = len(secrets)
+	}
+
+	if cmd.Bool("json") {
+		info.Version = jsonSchemaVersion
+		encoded, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		fmt.Println(string(encoded))
+		return nil
+	}
+
+	fmt.Printf("Storage: %s (profile: %s)\n", info.Location, info.Profile)
+	if info.Permissions != "" {
+		fmt.Printf("Size: %d bytes\n", info.Size)
+		fmt.Printf("Modified: %s\n", info.Modified)
+		fmt.Printf("Permissions: %s\n", info.Permissions)
+	}
+	if !info.Initialized {
+		fmt.Println("Status: not initialized")
+		return nil
+	}
+	fmt.Printf("Secrets: %d\n", info.Secrets)
+	return nil
+}
+
 // StorageClearCommand handles the storage clear command
 func StorageClearCommand(_ context.Context, cmd *cli.Command) error {
 	profile := getProfile(cmd)
@@ -120,13 +372,13 @@ func StorageClearCommand(_ context.Context, cmd *cli.Command) error {
 }
 
 // StorageShowCommand decrypts and displays all secrets in TOML format
-func StorageShowCommand(_ context.Context, cmd *cli.Command) error {
-	cfg, b, err := resolveBackend(cmd)
+func StorageShowCommand(ctx context.Context, cmd *cli.Command) error {
+	store, err := resolveStore(ctx, cmd)
 	if err != nil {
 		return err
 	}
 
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
+	secrets, err := store.Load()
 	if err != nil {
 		return err
 	}
@@ -155,43 +407,82 @@ func StorageShowCommand(_ context.Context, cmd *cli.Command) error {
 }
 
 // StorageEditCommand decrypts secrets to a temp file, opens $EDITOR, and re-encrypts on save
-func StorageEditCommand(_ context.Context, cmd *cli.Command) error {
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = os.Getenv("VISUAL")
-	}
-	if editor == "" {
-		return fmt.Errorf("$EDITOR is not set. Set it with: export EDITOR=vim")
+func StorageEditCommand(ctx context.Context, cmd *cli.Command) error {
+	editor, err := editorFromEnv()
+	if err != nil {
+		return err
 	}
 
-	cfg, b, err := resolveBackend(cmd)
+	store, err := resolveStore(ctx, cmd)
 	if err != nil {
 		return err
 	}
 
-	secrets, err := storage.LoadSecrets(cfg.PrivateKeyPath, b)
+	secrets, err := store.Load()
 	if err != nil {
 		return err
 	}
 
 	content := storage.SerializeSecretsForDisplay(secrets)
 
-	// Write to temp file with .toml extension for syntax highlighting
-	tmpFile, err := os.CreateTemp("", "crumb-edit-*.toml")
+	// Use a .toml extension for syntax highlighting
+	editedData, err := editInTempFile(editor, "crumb-edit-*.toml", content)
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return err
+	}
+
+	// Parse edited secrets (supports both TOML and legacy formats)
+	newSecrets := storage.ParseSecrets(string(editedData))
+
+	// Save re-encrypted secrets
+	err = store.Update(func(secrets storage.SecretStore) error {
+		for key := range secrets {
+			delete(secrets, key)
+		}
+		for key, entry := range newSecrets {
+			secrets[key] = entry
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully updated secrets (%d keys)\n", len(newSecrets))
+	return nil
+}
+
+// editorFromEnv returns the user's $EDITOR, falling back to $VISUAL
+func editorFromEnv() (string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = os.Getenv("VISUAL")
+	}
+	if editor == "" {
+		return "", fmt.Errorf("$EDITOR is not set. Set it with: export EDITOR=vim")
+	}
+	return editor, nil
+}
+
+// editInTempFile writes content to a private temp file named after pattern,
+// opens it in editor and returns what was saved. The temp file is overwritten
+// and removed afterwards, since it holds secret values in plain text.
+func editInTempFile(editor, pattern, content string) ([]byte, error) {
+	tmpFile, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
 	tmpPath := tmpFile.Name()
-	defer os.Remove(tmpPath)
+	defer shredFile(tmpPath)
 
 	if err := os.Chmod(tmpPath, 0600); err != nil {
 		tmpFile.Close()
-		return fmt.Errorf("failed to set temp file permissions: %w", err)
+		return nil, fmt.Errorf("failed to set temp file permissions: %w", err)
 	}
 
 	if _, err := tmpFile.WriteString(content); err != nil {
 		tmpFile.Close()
-		return fmt.Errorf("failed to write temp file: %w", err)
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
 	}
 	tmpFile.Close()
 
@@ -202,23 +493,26 @@ func StorageEditCommand(_ context.Context, cmd *cli.Command) error {
 	editorCmd.Stderr = os.Stderr
 
 	if err := editorCmd.Run(); err != nil {
-		return fmt.Errorf("editor exited with error: %w", err)
+		return nil, fmt.Errorf("editor exited with error: %w", err)
 	}
 
-	// Read edited content
 	editedData, err := os.ReadFile(tmpPath)
 	if err != nil {
-		return fmt.Errorf("failed to read edited file: %w", err)
+		return nil, fmt.Errorf("failed to read edited file: %w", err)
 	}
+	return editedData, nil
+}
 
-	// Parse edited secrets (supports both TOML and legacy formats)
-	newSecrets := storage.ParseSecrets(string(editedData))
-
-	// Save re-encrypted secrets
-	if err := storage.SaveSecrets(newSecrets, cfg.PublicKeyPath, b); err != nil {
-		return err
+// shredFile overwrites a file with zeros before removing it. Editors that
+// save by renaming leave the old contents elsewhere on disk, so this is best
+// effort.
+func shredFile(path string) {
+	if info, err := os.Stat(path); err == nil {
+		if f, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			_, _ = f.Write(make([]byte, info.Size()))
+			_ = f.Sync()
+			f.Close()
+		}
 	}
-
-	fmt.Printf("Successfully updated secrets (%d keys)\n", len(newSecrets))
-	return nil
+	os.Remove(path)
 }
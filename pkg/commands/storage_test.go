@@ -0,0 +1,279 @@
+package commands
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"crumb/pkg/backend"
+	"crumb/pkg/config"
+	"crumb/pkg/crypto"
+)
+
+func TestStorageSetCommand(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "value"})
+
+	newPath := filepath.Join(profile.Home, "new", "crumb", "secrets")
+	output, err := runTestCommand(t, StorageSetCommand, storageSetTestFlags(), []string{newPath}, "")
+	if err != nil {
+		t.Fatalf("StorageSetCommand() unexpected error = %v", err)
+	}
+	info, err := os.Stat(filepath.Dir(newPath))
+	if err != nil {
+		t.Fatalf("expected the storage directory to be created: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("storage directory mode = %o, want 0700", info.Mode().Perm())
+	}
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Errorf("storage set without --init should not create the file, stat err = %v", err)
+	}
+	if !strings.Contains(output, "pass --init") {
+		t.Errorf("output = %q, want a hint about --init", output)
+	}
+
+	initPath := filepath.Join(profile.Home, "init", "secrets")
+	if _, err := runTestCommand(t, StorageSetCommand, storageSetTestFlags(), []string{initPath, "--init"}, ""); err != nil {
+		t.Fatalf("StorageSetCommand() with --init unexpected error = %v", err)
+	}
+	cfg, err := config.LoadConfig("default")
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error = %v", err)
+	}
+	if got := config.GetLocalStoragePath(cfg); got != initPath {
+		t.Errorf("profile storage path = %q, want %q", got, initPath)
+	}
+	initialized := &testProfile{Home: profile.Home, Config: cfg, Backend: &backend.FileBackend{Path: initPath}}
+	if secrets := initialized.loadTestSecrets(t); len(secrets) != 0 {
+		t.Errorf("--init should create an empty store, got: %v", secrets)
+	}
+
+	// A regular file in place of the parent directory can't be created over,
+	// even when running as root
+	blocker := filepath.Join(profile.Home, "not-a-dir")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = runTestCommand(t, StorageSetCommand, storageSetTestFlags(), []string{filepath.Join(blocker, "secrets")}, "")
+	if err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("expected an unusable directory error, got: %v", err)
+	}
+	if _, err := runTestCommand(t, StorageSetCommand, storageSetTestFlags(), []string{profile.Home}, ""); err == nil {
+		t.Error("expected a directory path to be rejected")
+	}
+	if cfg, _ := config.LoadConfig("default"); config.GetLocalStoragePath(cfg) != initPath {
+		t.Error("a rejected path should leave the profile unchanged")
+	}
+
+	if os.Geteuid() == 0 {
+		return
+	}
+	readOnly := filepath.Join(profile.Home, "read-only")
+	if err := os.Mkdir(readOnly, 0500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(readOnly, 0700) })
+	_, err = runTestCommand(t, StorageSetCommand, storageSetTestFlags(), []string{filepath.Join(readOnly, "secrets")}, "")
+	if err == nil || !strings.Contains(err.Error(), "is not writable") {
+		t.Errorf("expected a not writable error, got: %v", err)
+	}
+}
+
+func TestStorageMoveCommand(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "value"})
+	oldPath := profile.Backend.Location()
+	newPath := filepath.Join(profile.Home, "synced", "crumb", "secrets")
+
+	output, err := runTestCommand(t, StorageMoveCommand, storageMoveTestFlags(), []string{newPath}, "n\n")
+	if err != nil {
+		t.Fatalf("StorageMoveCommand() unexpected error = %v", err)
+	}
+
+	cfg, err := config.LoadConfig("default")
+	if err != nil {
+		t.Fatalf("LoadConfig() unexpected error = %v", err)
+	}
+	if got := config.GetLocalStoragePath(cfg); got != newPath {
+		t.Errorf("profile storage path = %q, want %q", got, newPath)
+	}
+
+	info, err := os.Stat(newPath)
+	if err != nil {
+		t.Fatalf("expected the moved storage file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("moved file mode = %o, want 0600", info.Mode().Perm())
+	}
+	if _, err := os.Stat(oldPath); err != nil {
+		t.Errorf("answering n should keep the old file: %v (output: %q)", err, output)
+	}
+
+	moved := &testProfile{Home: profile.Home, Config: cfg, Backend: &backend.FileBackend{Path: newPath}}
+	if secrets := moved.loadTestSecrets(t); secrets["/app/key"].Value != "value" {
+		t.Errorf("moved store lost secrets, got: %v", secrets)
+	}
+
+	if _, err := runTestCommand(t, StorageMoveCommand, storageMoveTestFlags(), []string{oldPath}, ""); err == nil {
+		t.Error("expected moving onto an existing file to fail")
+	}
+
+	finalPath := filepath.Join(profile.Home, "final-secrets")
+	if _, err := runTestCommand(t, StorageMoveCommand, storageMoveTestFlags(), []string{finalPath, "--yes"}, ""); err != nil {
+		t.Fatalf("StorageMoveCommand() with --yes unexpected error = %v", err)
+	}
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Errorf("--yes should remove the previous file, stat err = %v", err)
+	}
+}
+
+func TestStorageMoveCommandWaitsForTheOldFileLock(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{"/app/key": "value"})
+	oldPath := profile.Backend.Location()
+	newPath := filepath.Join(profile.Home, "moved-secrets")
+
+	// A concurrent writer holds the old file's lock
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	go crypto.UpdateFileWithLock(oldPath, 0600, 0, func([]byte) ([]byte, error) {
+		close(locked)
+		<-release
+		return nil, nil
+	})
+	<-locked
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := runTestCommand(t, StorageMoveCommand, storageMoveTestFlags(), []string{newPath, "--yes"}, "")
+		done <- err
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Errorf("storage moved while the old file was locked, stat err = %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("StorageMoveCommand() unexpected error = %v", err)
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("expected the moved storage file: %v", err)
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Errorf("--yes should remove the old file, stat err = %v", err)
+	}
+}
+
+func TestStorageFileModePolicy(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{})
+
+	// A team store: group-readable file in a group-accessible directory
+	storagePath := filepath.Join(profile.Home, "team", "secrets")
+	if err := os.MkdirAll(filepath.Dir(storagePath), 0700); err != nil {
+		t.Fatalf("Failed to create storage dir: %v", err)
+	}
+	teamConfig := *profile.Config
+	teamConfig.Storage.Local = &config.LocalStorageConfig{Path: storagePath}
+	teamConfig.FileMode = "0640"
+	teamConfig.DirMode = "0750"
+	if err := config.SaveConfig(&config.Config{Profiles: map[string]config.ProfileConfig{"default": teamConfig}}); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	if _, err := runTestCommand(t, SetCommand, setTestFlags(), []string{"/app/key", "value"}, ""); err != nil {
+		t.Fatalf("SetCommand() unexpected error = %v", err)
+	}
+	info, err := os.Stat(storagePath)
+	if err != nil {
+		t.Fatalf("expected a storage file: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("storage file mode = %04o, want 0640", info.Mode().Perm())
+	}
+
+	movedPath := filepath.Join(profile.Home, "shared", "secrets")
+	if _, err := runTestCommand(t, StorageMoveCommand, storageMoveTestFlags(), []string{movedPath, "--yes"}, ""); err != nil {
+		t.Fatalf("StorageMoveCommand() unexpected error = %v", err)
+	}
+	if info, err := os.Stat(movedPath); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("moved storage file = %v (err %v), want mode 0640", info, err)
+	}
+	if info, err := os.Stat(filepath.Dir(movedPath)); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("created storage dir = %v (err %v), want mode 0750", info, err)
+	}
+
+	teamConfig.FileMode = "0666"
+	if err := config.SaveConfig(&config.Config{Profiles: map[string]config.ProfileConfig{"default": teamConfig}}); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	_, err = runTestCommand(t, ListCommand, listTestFlags(), nil, "")
+	if err == nil || !strings.Contains(err.Error(), "world-writable") {
+		t.Errorf("ListCommand() error = %v, want world-writable file_mode rejected", err)
+	}
+}
+
+func TestStorageInfoCommand(t *testing.T) {
+	profile := setupTestProfile(t, map[string]string{
+		"/app/one": "first-secret",
+		"/app/two": "second-secret",
+	})
+	storagePath := profile.Backend.(*backend.FileBackend).Path
+	jsonFlags := []cli.Flag{&cli.BoolFlag{Name: "json"}}
+
+	output, err := runTestCommand(t, StorageInfoCommand, jsonFlags, nil, "")
+	if err != nil {
+		t.Fatalf("StorageInfoCommand() unexpected error = %v", err)
+	}
+	for _, want := range []string{"Storage: " + storagePath + " (profile: default)", "Permissions: 0600", "Modified: ", "Secrets: 2"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output = %q, want it to contain %q", output, want)
+		}
+	}
+	if strings.Contains(output, "first-secret") {
+		t.Errorf("output = %q, must not contain values", output)
+	}
+
+	output, err = runTestCommand(t, StorageInfoCommand, jsonFlags, []string{"--json"}, "")
+	if err != nil {
+		t.Fatalf("StorageInfoCommand() --json unexpected error = %v", err)
+	}
+	var info storageInfo
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, output)
+	}
+	stat, err := os.Stat(storagePath)
+	if err != nil {
+		t.Fatalf("Failed to stat storage: %v", err)
+	}
+	if info.Version != jsonSchemaVersion {
+		t.Errorf("version = %d, want %d", info.Version, jsonSchemaVersion)
+	}
+	if !info.Initialized || info.Secrets != 2 || info.Size != stat.Size() || info.Permissions != "0600" || info.Location != storagePath {
+		t.Errorf("info = %+v, want an initialized store of %d bytes with 2 secrets", info, stat.Size())
+	}
+
+	for _, tt := range []struct {
+		name    string
+		prepare func() error
+	}{
+		{"empty file", func() error { return os.WriteFile(storagePath, nil, 0600) }},
+		{"missing file", func() error { return os.Remove(storagePath) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.prepare(); err != nil {
+				t.Fatalf("Failed to prepare storage: %v", err)
+			}
+			output, err := runTestCommand(t, StorageInfoCommand, jsonFlags, nil, "")
+			if err != nil {
+				t.Fatalf("StorageInfoCommand() unexpected error = %v", err)
+			}
+			if !strings.Contains(output, "Status: not initialized") || strings.Contains(output, "Secrets:") {
+				t.Errorf("output = %q, want not initialized", output)
+			}
+		})
+	}
+}
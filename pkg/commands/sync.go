@@ -0,0 +1,201 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"crumb/pkg/backend"
+)
+
+// syncCommitMessage is used for commits created by crumb sync push
+const syncCommitMessage = "crumb: update secrets"
+
+// syncTarget describes the git checkout holding a profile's storage file
+type syncTarget struct {
+	Dir    string
+	File   string
+	Remote string
+	Branch string
+}
+
+// resolveSyncTarget finds the git repository containing the profile's storage
+// file and the remote and branch to sync with. Flags override the profile's
+// sync settings; otherwise the remote defaults to origin and the branch to the
+// currently checked out one.
+func resolveSyncTarget(ctx context.Context, cmd *cli.Command) (*syncTarget, error) {
+	cfg, b, err := resolveBackend(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	fileBackend, ok := b.(*backend.FileBackend)
+	if !ok {
+		return nil, fmt.Errorf("crumb sync only supports local storage")
+	}
+
+	target := &syncTarget{
+		Dir:    filepath.Dir(fileBackend.Path),
+		File:   filepath.Base(fileBackend.Path),
+		Remote: "origin",
+	}
+
+	if _, err := runGit(ctx, target.Dir, "rev-parse", "--show-toplevel"); err != nil {
+		return nil, fmt.Errorf("storage directory %s is not inside a git repository; run 'git init' there and add a remote first", target.Dir)
+	}
+
+	if cfg.Sync != nil {
+		if cfg.Sync.Remote != "" {
+			target.Remote = cfg.Sync.Remote
+		}
+		target.Branch = cfg.Sync.Branch
+	}
+	if remote := cmd.String("remote"); remote != "" {
+		target.Remote = remote
+	}
+	if branch := cmd.String("branch"); branch != "" {
+		target.Branch = branch
+	}
+
+	if target.Branch == "" {
+		branch, err := runGit(ctx, target.Dir, "symbolic-ref", "--short", "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		target.Branch = branch
+	}
+
+	return target, nil
+}
+
+// runGitWaitDelay is how long runGit waits for git's output after killing it
+// on cancellation, in case a helper it started (ssh, a hook) holds it open
+const runGitWaitDelay = time.Second
+
+// runGit runs git in dir and returns its trimmed output. Cancelling ctx kills
+// git. LC_ALL=C keeps the output in English, so callers can match it.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	gitCmd := exec.CommandContext(ctx, "git", args...)
+	gitCmd.Dir = dir
+	gitCmd.Env = append(os.Environ(), "LC_ALL=C")
+	gitCmd.WaitDelay = runGitWaitDelay
+	output, err := gitCmd.CombinedOutput()
+	trimmed := strings.TrimSpace(string(output))
+	if err != nil {
+		return trimmed, fmt.Errorf("git %s failed: %w: %s", args[0], err, trimmed)
+	}
+	return trimmed, nil
+}
+
+// gitIsAncestor reports whether commit ancestor is reachable from commit
+// descendant. git exits with 1 for "no", anything else is an error.
+func gitIsAncestor(ctx context.Context, dir, ancestor, descendant string) (bool, error) {
+	_, err := runGit(ctx, dir, "merge-base", "--is-ancestor", ancestor, descendant)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SyncPushCommand commits the storage file if it changed and pushes it to the remote
+func SyncPushCommand(ctx context.Context, cmd *cli.Command) error {
+	target, err := resolveSyncTarget(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	status, err := runGit(ctx, target.Dir, "status", "--porcelain", "--", target.File)
+	if err != nil {
+		return err
+	}
+	if status != "" {
+		if _, err := runGit(ctx, target.Dir, "add", "--", target.File); err != nil {
+			return err
+		}
+		if _, err := runGit(ctx, target.Dir, "commit", "-m", syncCommitMessage, "--", target.File); err != nil {
+			return err
+		}
+		fmt.Printf("Committed changes to %s\n", target.File)
+	}
+
+	output, err := runGit(ctx, target.Dir, "push", target.Remote, "HEAD:"+target.Branch)
+	if err != nil {
+		if strings.Contains(output, "rejected") {
+			return fmt.Errorf("%s/%s has changes you don't have yet; run 'crumb sync pull' first", target.Remote, target.Branch)
+		}
+		return err
+	}
+
+	fmt.Printf("Pushed secrets to %s/%s\n", target.Remote, target.Branch)
+	return nil
+}
+
+// SyncPullCommand fast-forwards the storage file to the remote version. The
+// file is encrypted, so diverged histories can't be merged by git and are refused.
+func SyncPullCommand(ctx context.Context, cmd *cli.Command) error {
+	target, err := resolveSyncTarget(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	status, err := runGit(ctx, target.Dir, "status", "--porcelain", "--", target.File)
+	if err != nil {
+		return err
+	}
+	if status != "" {
+		return fmt.Errorf("%s has local changes that are not pushed; run 'crumb sync push' first", target.File)
+	}
+
+	if _, err := runGit(ctx, target.Dir, "fetch", target.Remote, target.Branch); err != nil {
+		return err
+	}
+
+	remote, err := runGit(ctx, target.Dir, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return err
+	}
+	// HEAD doesn't resolve before the first commit, and anything fast-forwards from there
+	head, err := runGit(ctx, target.Dir, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		head = ""
+	}
+
+	if head != "" {
+		if head == remote {
+			fmt.Println("Secrets are already up to date.")
+			return nil
+		}
+		if behind, err := gitIsAncestor(ctx, target.Dir, remote, head); err != nil {
+			return err
+		} else if behind {
+			fmt.Println("Secrets are already up to date.")
+			return nil
+		}
+		forward, err := gitIsAncestor(ctx, target.Dir, head, remote)
+		if err != nil {
+			return err
+		}
+		if !forward {
+			return fmt.Errorf("local and %s/%s secrets have both changed since the last sync, and encrypted files can't be merged by git. "+
+				"Note your local changes with 'crumb storage show', then run 'git -C %[3]s merge --no-commit FETCH_HEAD', "+
+				"'git -C %[3]s checkout FETCH_HEAD -- %[4]s' and 'git -C %[3]s commit --no-edit' to take the remote version, "+
+				"re-apply your changes with 'crumb set' and run 'crumb sync push'",
+				target.Remote, target.Branch, target.Dir, target.File)
+		}
+	}
+
+	if _, err := runGit(ctx, target.Dir, "merge", "--ff-only", "FETCH_HEAD"); err != nil {
+		return err
+	}
+
+	fmt.Printf("Pulled secrets from %s/%s\n", target.Remote, target.Branch)
+	return nil
+}
@@ -0,0 +1,210 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitForTest runs git in dir, failing the test on error.
+func gitForTest(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	output, err := runGit(t.Context(), dir, args...)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return output
+}
+
+// setupSyncRepos pushes a test profile's storage file to a new bare remote
+// and returns the profile and a teammate's clone of the remote.
+func setupSyncRepos(t *testing.T) (*testProfile, string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "crumb test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "crumb@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "crumb test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "crumb@example.com")
+
+	profile := setupTestProfile(t, map[string]string{"/app/key": "first"})
+	storageDir := filepath.Dir(profile.Config.Storage.Local.Path)
+
+	remoteDir := t.TempDir()
+	gitForTest(t, remoteDir, "init", "--bare", "-b", "main")
+	gitForTest(t, storageDir, "init", "-b", "main")
+	gitForTest(t, storageDir, "remote", "add", "origin", remoteDir)
+
+	output, err := runTestCommand(t, SyncPushCommand, syncTestFlags(), nil, "")
+	if err != nil {
+		t.Fatalf("SyncPushCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "Pushed secrets to origin/main") {
+		t.Errorf("expected push message, got: %s", output)
+	}
+	if files := gitForTest(t, remoteDir, "ls-tree", "--name-only", "main"); files != "secrets" {
+		t.Errorf("remote should only track the storage file, got: %q", files)
+	}
+
+	teammateDir := filepath.Join(t.TempDir(), "clone")
+	gitForTest(t, storageDir, "clone", remoteDir, teammateDir)
+	return profile, teammateDir
+}
+
+func TestSyncPushPull(t *testing.T) {
+	profile, teammateDir := setupSyncRepos(t)
+	storageDir := filepath.Dir(profile.Config.Storage.Local.Path)
+
+	// A teammate pushes an update
+	teammateFile := filepath.Join(teammateDir, "secrets")
+	if err := os.WriteFile(teammateFile, []byte("teammate ciphertext"), 0600); err != nil {
+		t.Fatalf("Failed to write teammate file: %v", err)
+	}
+	gitForTest(t, teammateDir, "commit", "-am", "teammate update")
+	gitForTest(t, teammateDir, "push", "origin", "main")
+
+	output, err := runTestCommand(t, SyncPullCommand, syncTestFlags(), nil, "")
+	if err != nil {
+		t.Fatalf("SyncPullCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "Pulled secrets from origin/main") {
+		t.Errorf("expected pull message, got: %s", output)
+	}
+	data, err := os.ReadFile(profile.Config.Storage.Local.Path)
+	if err != nil {
+		t.Fatalf("Failed to read storage file: %v", err)
+	}
+	if string(data) != "teammate ciphertext" {
+		t.Errorf("storage file = %q, want the teammate's version", string(data))
+	}
+
+	// Both sides change: push is rejected and pull refuses to merge ciphertext
+	if err := os.WriteFile(teammateFile, []byte("teammate second"), 0600); err != nil {
+		t.Fatalf("Failed to write teammate file: %v", err)
+	}
+	gitForTest(t, teammateDir, "commit", "-am", "teammate second update")
+	gitForTest(t, teammateDir, "push", "origin", "main")
+
+	if err := os.WriteFile(profile.Config.Storage.Local.Path, []byte("local change"), 0600); err != nil {
+		t.Fatalf("Failed to write storage file: %v", err)
+	}
+
+	_, err = runTestCommand(t, SyncPullCommand, syncTestFlags(), nil, "")
+	if err == nil || !strings.Contains(err.Error(), "crumb sync push") {
+		t.Errorf("expected pull to refuse uncommitted changes, got: %v", err)
+	}
+
+	_, err = runTestCommand(t, SyncPushCommand, syncTestFlags(), nil, "")
+	if err == nil || !strings.Contains(err.Error(), "run 'crumb sync pull' first") {
+		t.Errorf("expected rejected push error, got: %v", err)
+	}
+
+	_, err = runTestCommand(t, SyncPullCommand, syncTestFlags(), nil, "")
+	if err == nil || !strings.Contains(err.Error(), "can't be merged") {
+		t.Fatalf("expected diverged pull to be refused, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "reset --hard") || !strings.Contains(err.Error(), "checkout FETCH_HEAD -- secrets") {
+		t.Errorf("expected the recovery to only touch the storage file, got: %v", err)
+	}
+
+	// Following the suggested recovery lets the re-applied change be pushed
+	_, _ = runGit(t.Context(), storageDir, "merge", "--no-commit", "FETCH_HEAD")
+	gitForTest(t, storageDir, "checkout", "FETCH_HEAD", "--", "secrets")
+	gitForTest(t, storageDir, "commit", "--no-edit")
+	if err := os.WriteFile(profile.Config.Storage.Local.Path, []byte("reapplied"), 0600); err != nil {
+		t.Fatalf("Failed to write storage file: %v", err)
+	}
+	if _, err := runTestCommand(t, SyncPushCommand, syncTestFlags(), nil, ""); err != nil {
+		t.Fatalf("SyncPushCommand() after recovery unexpected error = %v", err)
+	}
+	gitForTest(t, teammateDir, "pull", "origin", "main")
+	if data, err := os.ReadFile(teammateFile); err != nil || string(data) != "reapplied" {
+		t.Errorf("teammate file = %q (%v), want the re-applied version", string(data), err)
+	}
+}
+
+func TestSyncPullUpToDate(t *testing.T) {
+	profile, _ := setupSyncRepos(t)
+	storageDir := filepath.Dir(profile.Config.Storage.Local.Path)
+
+	output, err := runTestCommand(t, SyncPullCommand, syncTestFlags(), nil, "")
+	if err != nil {
+		t.Fatalf("SyncPullCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "already up to date") {
+		t.Errorf("expected up to date message, got: %s", output)
+	}
+
+	// Local commits the remote doesn't have yet aren't a divergence
+	if err := os.WriteFile(profile.Config.Storage.Local.Path, []byte("local change"), 0600); err != nil {
+		t.Fatalf("Failed to write storage file: %v", err)
+	}
+	gitForTest(t, storageDir, "commit", "-am", "local update")
+
+	output, err = runTestCommand(t, SyncPullCommand, syncTestFlags(), nil, "")
+	if err != nil {
+		t.Fatalf("SyncPullCommand() with unpushed commits unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "already up to date") {
+		t.Errorf("expected up to date message, got: %s", output)
+	}
+}
+
+func TestSyncPullReportsGitErrors(t *testing.T) {
+	profile, teammateDir := setupSyncRepos(t)
+	storageDir := filepath.Dir(profile.Config.Storage.Local.Path)
+
+	// The teammate adds a file that is untracked locally, which blocks the fast-forward
+	if err := os.WriteFile(filepath.Join(teammateDir, "notes"), []byte("teammate notes"), 0600); err != nil {
+		t.Fatalf("Failed to write teammate file: %v", err)
+	}
+	gitForTest(t, teammateDir, "add", "notes")
+	gitForTest(t, teammateDir, "commit", "-m", "add notes")
+	gitForTest(t, teammateDir, "push", "origin", "main")
+	if err := os.WriteFile(filepath.Join(storageDir, "notes"), []byte("local notes"), 0600); err != nil {
+		t.Fatalf("Failed to write local file: %v", err)
+	}
+
+	_, err := runTestCommand(t, SyncPullCommand, syncTestFlags(), nil, "")
+	if err == nil {
+		t.Fatal("SyncPullCommand() should fail when git can't fast-forward")
+	}
+	if strings.Contains(err.Error(), "both changed") || !strings.Contains(err.Error(), "would be overwritten") {
+		t.Errorf("expected git's own error, got: %v", err)
+	}
+}
+
+func TestSyncRequiresGitRepository(t *testing.T) {
+	setupTestProfile(t, map[string]string{"/app/key": "value"})
+
+	_, err := runTestCommand(t, SyncPushCommand, syncTestFlags(), nil, "")
+	if err == nil || !strings.Contains(err.Error(), "not inside a git repository") {
+		t.Errorf("expected git repository error, got: %v", err)
+	}
+}
+
+func TestRunGitCancellation(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	// A shell alias stands in for a git command stuck on the network
+	start := time.Now()
+	_, err := runGit(ctx, t.TempDir(), "-c", "alias.nap=!sleep 30", "nap")
+	if err == nil {
+		t.Fatal("runGit() should fail when its context is cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("runGit() took %s after cancellation, want it to stop promptly", elapsed)
+	}
+}
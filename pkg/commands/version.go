@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// latestReleaseURL is the GitHub API endpoint for crumb's latest release. It's
+// a variable so tests can point it at a local server.
+var latestReleaseURL = "https://api.github.com/repos/crhuber/crumb/releases/latest"
+
+const (
+	// versionCheckTimeout bounds the GitHub API call, so an unreachable
+	// network never holds up the command for long
+	versionCheckTimeout = 5 * time.Second
+	// versionCheckTTL is how long a fetched release tag is reused before
+	// GitHub is asked again
+	versionCheckTTL = 24 * time.Hour
+)
+
+// VersionCommand prints the version of crumb. With --check it also compares
+// it against the latest GitHub release and says whether an update is
+// available; it never installs anything.
+func VersionCommand(ctx context.Context, cmd *cli.Command) error {
+	cli.VersionPrinter(cmd)
+	if !cmd.Bool("check") {
+		return nil
+	}
+	if cmd.Bool("no-network") {
+		fmt.Fprintln(os.Stderr, "Skipping the update check: network access is disabled")
+		return nil
+	}
+
+	// A failed check isn't worth failing the command over
+	latest, err := latestVersion(ctx, versionCheckPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to check for updates: %v\n", err)
+		return nil
+	}
+
+	current := cmd.Root().Version
+	switch {
+	case current == "" || current == "dev":
+		fmt.Printf("This is a development build, the latest release is %s\n", latest)
+	case newerVersion(latest, current):
+		fmt.Printf("A newer version is available: %s (you have %s)\n", latest, current)
+		fmt.Println("Download it from https://github.com/crhuber/crumb/releases/latest")
+	default:
+		fmt.Printf("crumb is up to date (%s)\n", current)
+	}
+	return nil
+}
+
+// versionCheckPath returns the file where the latest release tag is cached
+func versionCheckPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "crumb", "latest-version")
+}
+
+// latestVersion returns the tag of the latest release, from cachePath when it
+// was fetched less than a day ago and from GitHub otherwise
+func latestVersion(ctx context.Context, cachePath string) (string, error) {
+	if info, err := os.Stat(cachePath); err == nil && time.Since(info.ModTime()) < versionCheckTTL {
+		if cached, err := os.ReadFile(cachePath); err == nil && len(strings.TrimSpace(string(cached))) > 0 {
+			return strings.TrimSpace(string(cached)), nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, versionCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("failed to parse release: %w", err)
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("release has no tag")
+	}
+
+	// The cache only saves a request, so failing to write it isn't an error
+	if err := mkdirWithMode(filepath.Dir(cachePath), 0700); err == nil {
+		_ = os.WriteFile(cachePath, []byte(release.TagName+"\n"), 0600)
+	}
+	return release.TagName, nil
+}
+
+// newerVersion reports whether latest is a later release than current. Both
+// are dotted numbers with an optional "v" prefix; anything after a "-" or "+"
+// is ignored. Versions that can't be compared that way are only newer when
+// they differ.
+func newerVersion(latest, current string) bool {
+	latestParts, latestOK := parseVersion(latest)
+	currentParts, currentOK := parseVersion(current)
+	if !latestOK || !currentOK {
+		return strings.TrimPrefix(latest, "v") != strings.TrimPrefix(current, "v")
+	}
+
+	for i := 0; i < len(latestParts) || i < len(currentParts); i++ {
+		var l, c int
+		if i < len(latestParts) {
+			l = latestParts[i]
+		}
+		if i < len(currentParts) {
+			c = currentParts[i]
+		}
+		if l != c {
+			return l > c
+		}
+	}
+	return false
+}
+
+// parseVersion splits a version such as v1.2.3 into its numbers
+func parseVersion(version string) ([]int, bool) {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
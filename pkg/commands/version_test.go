@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.3.0", "1.2.9", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"v1.2.0", "1.2.0", false},
+		{"v1.2", "1.2.0", false},
+		{"v1.2.1", "1.2.1-rc1", false},
+		{"v1.2.0", "1.3.0", false},
+		{"v2.0.0", "nightly", true},
+	}
+	for _, tt := range tests {
+		if got := newerVersion(tt.latest, tt.current); got != tt.want {
+			t.Errorf("newerVersion(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestLatestVersionCachesForADay(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `{"tag_name": "v%d.0.0"}`, requests)
+	}))
+	defer server.Close()
+	oldURL := latestReleaseURL
+	latestReleaseURL = server.URL
+	defer func() { latestReleaseURL = oldURL }()
+
+	cachePath := filepath.Join(t.TempDir(), "crumb", "latest-version")
+	for range 2 {
+		latest, err := latestVersion(context.Background(), cachePath)
+		if err != nil {
+			t.Fatalf("latestVersion() unexpected error = %v", err)
+		}
+		if latest != "v1.0.0" {
+			t.Errorf("latestVersion() = %q, want v1.0.0", latest)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("made %d requests, want 1 with a fresh cache", requests)
+	}
+
+	stale := time.Now().Add(-25 * time.Hour)
+	if err := os.Chtimes(cachePath, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if latest, err := latestVersion(context.Background(), cachePath); err != nil || latest != "v2.0.0" {
+		t.Errorf("latestVersion() with a stale cache = %q, %v, want v2.0.0", latest, err)
+	}
+}
+
+func TestVersionCommandCheck(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"tag_name": "v9.9.9"}`)
+	}))
+	defer server.Close()
+	oldURL := latestReleaseURL
+	latestReleaseURL = server.URL
+	defer func() { latestReleaseURL = oldURL }()
+
+	output, err := runTestCommand(t, VersionCommand, versionTestFlags(), []string{"--check", "--no-network"}, "")
+	if err != nil || strings.Contains(output, "v9.9.9") {
+		t.Errorf("--no-network: output = %q, error = %v, want no check", output, err)
+	}
+
+	// A failed request is only a warning
+	status = http.StatusInternalServerError
+	output, err = runTestCommand(t, VersionCommand, versionTestFlags(), []string{"--check"}, "")
+	if err != nil || strings.Contains(output, "v9.9.9") {
+		t.Errorf("failed check: output = %q, error = %v, want no error", output, err)
+	}
+
+	status = http.StatusOK
+	output, err = runTestCommand(t, VersionCommand, versionTestFlags(), []string{"--check"}, "")
+	if err != nil {
+		t.Fatalf("VersionCommand() unexpected error = %v", err)
+	}
+	if !strings.Contains(output, "the latest release is v9.9.9") {
+		t.Errorf("output = %q, want the latest release reported", output)
+	}
+}
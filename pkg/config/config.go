@@ -4,10 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"golang.org/x/term"
@@ -37,29 +41,126 @@ type StorageConfig struct {
 	S3    *S3StorageConfig    `yaml:"s3,omitempty"`
 }
 
+// SyncConfig holds settings for sharing the storage file through git.
+type SyncConfig struct {
+	Remote string `yaml:"remote,omitempty"`
+	Branch string `yaml:"branch,omitempty"`
+}
+
 // ProfileConfig represents a single profile configuration
 type ProfileConfig struct {
 	PublicKeyPath  string        `yaml:"public_key_path"`
 	PrivateKeyPath string        `yaml:"private_key_path"`
 	Storage        StorageConfig `yaml:"storage"`
+	Sync           *SyncConfig   `yaml:"sync,omitempty"`
+	// FileMode and DirMode are octal permissions (e.g. "0640") for the
+	// storage file and the directories created for it. Empty means
+	// DefaultFileMode and DefaultDirMode.
+	FileMode string `yaml:"file_mode,omitempty"`
+	DirMode  string `yaml:"dir_mode,omitempty"`
+	// HistoryDepth is how many previous values to keep per secret; nil means
+	// the storage default and 0 keeps none
+	HistoryDepth *int `yaml:"history_depth,omitempty"`
+}
+
+// Default permissions for storage files and the directories crumb creates
+const (
+	DefaultFileMode os.FileMode = 0600
+	DefaultDirMode  os.FileMode = 0700
+)
+
+// StorageFileMode returns the permissions for the profile's storage file
+func (p *ProfileConfig) StorageFileMode() (os.FileMode, error) {
+	return ParseFileMode("file_mode", p.FileMode, DefaultFileMode)
+}
+
+// StorageDirMode returns the permissions for directories created for the
+// profile's storage
+func (p *ProfileConfig) StorageDirMode() (os.FileMode, error) {
+	return ParseFileMode("dir_mode", p.DirMode, DefaultDirMode)
+}
+
+// SecretHistoryDepth returns how many previous values to keep per secret,
+// defaultDepth when history_depth isn't set
+func (p *ProfileConfig) SecretHistoryDepth(defaultDepth int) (int, error) {
+	if p.HistoryDepth == nil {
+		return defaultDepth, nil
+	}
+	if *p.HistoryDepth < 0 {
+		return 0, fmt.Errorf("invalid history_depth %d: must not be negative", *p.HistoryDepth)
+	}
+	return *p.HistoryDepth, nil
+}
+
+// ParseFileMode parses an octal permission setting, returning defaultMode when
+// value is empty. Modes must keep every owner bit of defaultMode, so crumb can
+// still read and write its own files, and must not be world-writable.
+func ParseFileMode(name, value string, defaultMode os.FileMode) (os.FileMode, error) {
+	if value == "" {
+		return defaultMode, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || parsed > 0777 {
+		return 0, fmt.Errorf("invalid %s %q: must be an octal permission such as %04o", name, value, defaultMode)
+	}
+	mode := os.FileMode(parsed)
+	if mode&0002 != 0 {
+		return 0, fmt.Errorf("invalid %s %q: world-writable permissions are not allowed", name, value)
+	}
+	if mode&defaultMode != defaultMode {
+		return 0, fmt.Errorf("invalid %s %q: the owner needs at least %04o", name, value, defaultMode)
+	}
+	return mode, nil
 }
 
 // CrumbConfig represents the per-project configuration in .crumb.yaml
 type CrumbConfig struct {
 	Version      string                       `yaml:"version"`
 	Environments map[string]EnvironmentConfig `yaml:"environments"`
+	// BranchMap maps git branch names to the environment export
+	// --env-from-branch selects on that branch
+	BranchMap map[string]string `yaml:"branch_map,omitempty"`
 }
 
 type EnvironmentConfig struct {
 	Path  string            `yaml:"path"`
 	Remap map[string]string `yaml:"remap"`
 	Env   map[string]string `yaml:"env"`
+	// EnvFiles are static .env files, relative to the config file, whose
+	// variables are exported underneath the environment's secrets
+	EnvFiles []string `yaml:"env_files,omitempty"`
+	// Profile names the crumb profile whose store the environment's secrets
+	// come from; empty means the profile selected on the command line
+	Profile string `yaml:"profile,omitempty"`
 }
 
 // TomlConfig represents the TOML configuration in ~/.config/crumb/crumb.toml
 type TomlConfig struct {
-	Shell      string `toml:"shell"`
-	MaskValues bool   `toml:"mask_values"`
+	Profile    string     `toml:"profile"`
+	Shell      string     `toml:"shell"`
+	MaskValues bool       `toml:"mask_values"`
+	MaskChar   string     `toml:"mask_char"`
+	MaskLength MaskLength `toml:"mask_length"`
+	// LockTimeout is a duration such as "5s" bounding storage lock waits
+	LockTimeout string `toml:"lock_timeout"`
+}
+
+// MaskLength is the mask_length setting: a number of mask characters, or
+// "preserve" to match the length of the value
+type MaskLength string
+
+// UnmarshalTOML accepts mask_length as either a TOML integer or a string
+func (m *MaskLength) UnmarshalTOML(data any) error {
+	switch value := data.(type) {
+	case int64:
+		*m = MaskLength(strconv.FormatInt(value, 10))
+	case string:
+		*m = MaskLength(value)
+	default:
+		return fmt.Errorf("mask_length must be a number or \"preserve\"")
+	}
+	return nil
 }
 
 // LoadConfig loads the profile configuration from ~/.config/crumb/config.yaml
@@ -116,6 +217,9 @@ func SaveConfig(config *Config) error {
 	return nil
 }
 
+// supportedCrumbConfigVersions lists the .crumb.yaml versions this crumb can read
+var supportedCrumbConfigVersions = []string{"1.0", "1"}
+
 // LoadCrumbConfig loads the per-project configuration from .crumb.yaml
 func LoadCrumbConfig(configFileName string) (*CrumbConfig, error) {
 	configFileName = filepath.Clean(configFileName)
@@ -140,6 +244,10 @@ func LoadCrumbConfig(configFileName string) (*CrumbConfig, error) {
 	if config.Version == "" {
 		return nil, fmt.Errorf("invalid %s: missing version", configFileName)
 	}
+	if !slices.Contains(supportedCrumbConfigVersions, config.Version) {
+		return nil, fmt.Errorf("unsupported .crumb.yaml version %q in %s; this crumb supports %s (a newer crumb may be needed to read it)",
+			config.Version, configFileName, `"`+strings.Join(supportedCrumbConfigVersions, `", "`)+`"`)
+	}
 
 	// Initialize environments map if it's nil
 	if config.Environments == nil {
@@ -160,6 +268,91 @@ func LoadCrumbConfig(configFileName string) (*CrumbConfig, error) {
 	return &config, nil
 }
 
+// FindCrumbConfig searches for configFileName in startDir and each of its parent
+// directories, returning the path of the nearest match. Absolute file names are
+// returned unchanged.
+func FindCrumbConfig(startDir, configFileName string) (string, error) {
+	if filepath.IsAbs(configFileName) {
+		return configFileName, nil
+	}
+
+	dir, err := filepath.Abs(startDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	for {
+		candidate := filepath.Join(dir, configFileName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no %s found in %s or any parent directory", configFileName, startDir)
+		}
+		dir = parent
+	}
+}
+
+// GitBranch returns the branch checked out in the git work tree containing
+// startDir, read from .git/HEAD. It returns "" without an error when startDir
+// isn't in a work tree or HEAD is detached. A .git file, as used by worktrees
+// and submodules, is followed to the git directory it names.
+func GitBranch(startDir string) (string, error) {
+	dir, err := filepath.Abs(startDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	for {
+		gitPath := filepath.Join(dir, ".git")
+		if info, err := os.Stat(gitPath); err == nil {
+			gitDir := gitPath
+			if !info.IsDir() {
+				gitDir, err = readGitDirFile(gitPath)
+				if err != nil {
+					return "", err
+				}
+			}
+
+			head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+			if err != nil {
+				return "", fmt.Errorf("failed to read git HEAD: %w", err)
+			}
+			// A detached HEAD holds a commit hash instead of a branch ref
+			branch, onBranch := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+			if !onBranch {
+				return "", nil
+			}
+			return branch, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// readGitDirFile returns the git directory named by a "gitdir: <path>" .git
+// file, resolving a relative path against the file's directory
+func readGitDirFile(gitFile string) (string, error) {
+	content, err := os.ReadFile(gitFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", gitFile, err)
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("unrecognized %s: expected \"gitdir: <path>\"", gitFile)
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(gitFile), gitDir)
+	}
+	return gitDir, nil
+}
+
 // CreateDefaultCrumbConfig creates a default .crumb.yaml configuration
 func CreateDefaultCrumbConfig() *CrumbConfig {
 	defaultEnv := EnvironmentConfig{
@@ -208,10 +401,6 @@ func ValidateKeyPath(keyPath string) error {
 		return fmt.Errorf("key path cannot contain spaces")
 	}
 
-	if strings.Contains(keyPath, "=") {
-		return fmt.Errorf("key path cannot contain '=' character")
-	}
-
 	if strings.Contains(keyPath, "\n") {
 		return fmt.Errorf("key path cannot contain newlines")
 	}
@@ -239,42 +428,105 @@ func GetLocalStoragePath(profile *ProfileConfig) string {
 	return ""
 }
 
+// promptTimeout bounds how long interactive prompts wait for input; zero means no limit
+var promptTimeout time.Duration
+
+// SetPromptTimeout sets how long interactive prompts wait for input before failing
+func SetPromptTimeout(timeout time.Duration) {
+	promptTimeout = timeout
+}
+
+// readWithTimeout runs read in the background and gives up once the prompt timeout elapses
+func readWithTimeout(read func() (string, error)) (string, error) {
+	if promptTimeout <= 0 {
+		return read()
+	}
+
+	type readResult struct {
+		value string
+		err   error
+	}
+	results := make(chan readResult, 1)
+	go func() {
+		value, err := read()
+		results <- readResult{value: value, err: err}
+	}()
+
+	select {
+	case result := <-results:
+		return result.value, result.err
+	case <-time.After(promptTimeout):
+		return "", fmt.Errorf("timed out after %s waiting for input", promptTimeout)
+	}
+}
+
 // PromptForInput prompts the user for input and returns the trimmed response
 func PromptForInput(prompt string) (string, error) {
 	fmt.Print(prompt)
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
-	if err != nil {
-		return "", fmt.Errorf("failed to read input: %w", err)
-	}
-	return strings.TrimSpace(input), nil
+	// The read can outlive a timed-out prompt, so it keeps its own handle on stdin
+	in := os.Stdin
+	return readWithTimeout(func() (string, error) {
+		reader := bufio.NewReader(in)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+		return strings.TrimSpace(input), nil
+	})
 }
 
 // PromptForSecret prompts the user for secret input without echoing to terminal
 func PromptForSecret(prompt string) (string, error) {
-	fmt.Print(prompt)
+	return promptForSecret(os.Stdout, prompt)
+}
+
+// PromptForPassphrase prompts on stderr for the passphrase of an encrypted private key,
+// keeping stdout clean for commands whose output is sourced by the shell
+func PromptForPassphrase(privateKeyPath string) ([]byte, error) {
+	passphrase, err := promptForSecret(os.Stderr, fmt.Sprintf("Enter passphrase for %s: ", privateKeyPath))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(passphrase), nil
+}
+
+func promptForSecret(out io.Writer, prompt string) (string, error) {
+	fmt.Fprint(out, prompt)
 
 	// Check if stdin is a terminal
-	if !term.IsTerminal(int(syscall.Stdin)) {
+	stdinFd := int(syscall.Stdin)
+	if !term.IsTerminal(stdinFd) {
 		// If not a TTY, read from stdin normally (for testing/scripting)
-		reader := bufio.NewReader(os.Stdin)
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			return "", fmt.Errorf("failed to read input: %w", err)
-		}
-		return strings.TrimSpace(input), nil
+		in := os.Stdin
+		return readWithTimeout(func() (string, error) {
+			reader := bufio.NewReader(in)
+			input, err := reader.ReadString('\n')
+			if err != nil {
+				return "", fmt.Errorf("failed to read input: %w", err)
+			}
+			return strings.TrimSpace(input), nil
+		})
 	}
 
+	// Remember the terminal state so echo can be restored if the prompt times out
+	state, _ := term.GetState(stdinFd)
+
 	// Read password without echoing
-	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
-	if err != nil {
-		return "", fmt.Errorf("failed to read input: %w", err)
+	password, err := readWithTimeout(func() (string, error) {
+		bytePassword, err := term.ReadPassword(stdinFd)
+		if err != nil {
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+		return string(bytePassword), nil
+	})
+	if err != nil && state != nil {
+		term.Restore(stdinFd, state)
 	}
 
 	// Print newline after input
-	fmt.Println()
+	fmt.Fprintln(out)
 
-	return string(bytePassword), nil
+	return password, err
 }
 
 // LoadTomlConfig loads the TOML configuration from ~/.config/crumb/crumb.toml
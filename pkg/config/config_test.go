@@ -0,0 +1,165 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromptForInputTimeout(t *testing.T) {
+	// A pipe that is never written to blocks the reader like an unattended TTY
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	t.Cleanup(func() {
+		writer.Close()
+		reader.Close()
+	})
+
+	oldStdin := os.Stdin
+	os.Stdin = reader
+	t.Cleanup(func() { os.Stdin = oldStdin })
+
+	SetPromptTimeout(50 * time.Millisecond)
+	t.Cleanup(func() { SetPromptTimeout(0) })
+
+	start := time.Now()
+	_, err = PromptForInput("value: ")
+	if err == nil {
+		t.Fatal("Expected timeout error, got nil")
+	}
+	if !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Prompt took %s to time out", elapsed)
+	}
+}
+
+func TestPromptForInputWithinTimeout(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	if _, err := writer.WriteString("  hello \n"); err != nil {
+		t.Fatalf("Failed to write to pipe: %v", err)
+	}
+	writer.Close()
+
+	oldStdin := os.Stdin
+	os.Stdin = reader
+	t.Cleanup(func() { os.Stdin = oldStdin })
+
+	SetPromptTimeout(time.Second)
+	t.Cleanup(func() { SetPromptTimeout(0) })
+
+	got, err := PromptForInput("value: ")
+	if err != nil {
+		t.Fatalf("PromptForInput failed: %v", err)
+	}
+	if got != "hello" {
+		t.Errorf("Expected 'hello', got %q", got)
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    os.FileMode
+		wantErr string
+	}{
+		{value: "", want: DefaultFileMode},
+		{value: "0600", want: 0600},
+		{value: "640", want: 0640},
+		{value: "0660", want: 0660},
+		{value: "0666", wantErr: "world-writable"},
+		{value: "0602", wantErr: "world-writable"},
+		{value: "0400", wantErr: "the owner needs at least 0600"},
+		{value: "0644x", wantErr: "must be an octal permission"},
+		{value: "01600", wantErr: "must be an octal permission"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFileMode("file_mode", tt.value, DefaultFileMode)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseFileMode(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseFileMode(%q) unexpected error = %v", tt.value, err)
+		} else if got != tt.want {
+			t.Errorf("ParseFileMode(%q) = %04o, want %04o", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSecretHistoryDepth(t *testing.T) {
+	depth := func(n int) *int { return &n }
+
+	if got, err := (&ProfileConfig{}).SecretHistoryDepth(5); err != nil || got != 5 {
+		t.Errorf("unset history_depth = %d, %v, want the default 5", got, err)
+	}
+	if got, err := (&ProfileConfig{HistoryDepth: depth(0)}).SecretHistoryDepth(5); err != nil || got != 0 {
+		t.Errorf("history_depth 0 = %d, %v, want 0", got, err)
+	}
+	if _, err := (&ProfileConfig{HistoryDepth: depth(-1)}).SecretHistoryDepth(5); err == nil {
+		t.Error("expected a negative history_depth to fail")
+	}
+}
+
+func TestGitBranch(t *testing.T) {
+	writeFile := func(t *testing.T, path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	repo := t.TempDir()
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/feature/login\n")
+	subdir := filepath.Join(repo, "services", "api")
+	if err := os.MkdirAll(subdir, 0700); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+
+	detached := t.TempDir()
+	writeFile(t, filepath.Join(detached, ".git", "HEAD"), "4b825dc642cb6eb9a060e54bf8d69288fbee4904\n")
+
+	// Worktrees have a .git file pointing at their git directory
+	worktree := t.TempDir()
+	writeFile(t, filepath.Join(worktree, "gitdir", "HEAD"), "ref: refs/heads/develop\n")
+	writeFile(t, filepath.Join(worktree, "checkout", ".git"), "gitdir: ../gitdir\n")
+
+	tests := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{"branch", repo, "feature/login"},
+		{"subdirectory", subdir, "feature/login"},
+		{"detached HEAD", detached, ""},
+		{"worktree", filepath.Join(worktree, "checkout"), "develop"},
+		{"not a repository", t.TempDir(), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GitBranch(tt.dir)
+			if err != nil {
+				t.Fatalf("GitBranch() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GitBranch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -21,6 +21,11 @@ func (t *TomlValueSource) Lookup() (string, bool) {
 		return "", false
 	}
 
+	// Support "profile" key
+	if t.key == "profile" && config.Profile != "" {
+		return config.Profile, true
+	}
+
 	// Support "shell" key
 	if t.key == "shell" && config.Shell != "" {
 		return config.Shell, true
@@ -31,6 +36,19 @@ func (t *TomlValueSource) Lookup() (string, bool) {
 		return "true", true
 	}
 
+	// Support "mask-char" and "mask-length" keys for mask_char and mask_length
+	if t.key == "mask-char" && config.MaskChar != "" {
+		return config.MaskChar, true
+	}
+	if t.key == "mask-length" && config.MaskLength != "" {
+		return string(config.MaskLength), true
+	}
+
+	// Support "lock-timeout" key for lock_timeout
+	if t.key == "lock-timeout" && config.LockTimeout != "" {
+		return config.LockTimeout, true
+	}
+
 	return "", false
 }
 
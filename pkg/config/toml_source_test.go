@@ -300,6 +300,41 @@ func TestTomlValueSourceMaskValues(t *testing.T) {
 			expectedValue: "true",
 			expectedFound: true,
 		},
+		{
+			name:          "profile",
+			tomlContent:   `profile = "work"`,
+			key:           "profile",
+			expectedValue: "work",
+			expectedFound: true,
+		},
+		{
+			name:          "lock_timeout",
+			tomlContent:   `lock_timeout = "5s"`,
+			key:           "lock-timeout",
+			expectedValue: "5s",
+			expectedFound: true,
+		},
+		{
+			name:          "mask_char",
+			tomlContent:   `mask_char = "#"`,
+			key:           "mask-char",
+			expectedValue: "#",
+			expectedFound: true,
+		},
+		{
+			name:          "mask_length number",
+			tomlContent:   `mask_length = 8`,
+			key:           "mask-length",
+			expectedValue: "8",
+			expectedFound: true,
+		},
+		{
+			name:          "mask_length preserve",
+			tomlContent:   `mask_length = "preserve"`,
+			key:           "mask-length",
+			expectedValue: "preserve",
+			expectedFound: true,
+		},
 		{
 			name:          "both shell and mask_values - lookup shell",
 			tomlContent:   "shell = \"fish\"\nmask_values = true",
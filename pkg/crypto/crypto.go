@@ -2,13 +2,22 @@ package crypto
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"filippo.io/age"
 	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/sys/unix"
 )
 
@@ -47,9 +56,11 @@ func ValidateSSHKeys(publicKeyPath, privateKeyPath string) error {
 		return fmt.Errorf("failed to read private key: %w", err)
 	}
 
-	// Try to parse the private key with agessh
+	// Try to parse the private key with agessh; passphrase-protected keys are
+	// accepted here and unlocked when secrets are decrypted
 	_, err = agessh.ParseIdentity(privateKeyData)
-	if err != nil {
+	var missing *ssh.PassphraseMissingError
+	if err != nil && !errors.As(err, &missing) {
 		return fmt.Errorf("failed to parse private key: %w", err)
 	}
 
@@ -75,10 +86,17 @@ func EncryptData(data string, recipients []age.Recipient) ([]byte, error) {
 	return []byte(buf.String()), nil
 }
 
+// ErrKeyMismatch is returned when the identity is not one of the data's recipients.
+var ErrKeyMismatch = errors.New("private key does not match any recipient")
+
 // DecryptData decrypts the given encrypted data using the provided identity
 func DecryptData(encryptedData []byte, identity age.Identity) (string, error) {
 	r, err := age.Decrypt(strings.NewReader(string(encryptedData)), identity)
 	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return "", fmt.Errorf("failed to decrypt data: %w: %w", ErrKeyMismatch, err)
+		}
 		return "", fmt.Errorf("failed to decrypt data: %w", err)
 	}
 
@@ -112,11 +130,57 @@ func ParseSSHPrivateKey(privateKeyPath string) (age.Identity, error) {
 	// Read private key
 	privateKeyData, err := os.ReadFile(privateKeyPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read private key: %w", err)
+		return nil, fmt.Errorf("failed to read private key: %w%s", err, agentHint())
 	}
 
 	// Parse private key identity
 	identity, err := agessh.ParseIdentity(privateKeyData)
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return parseEncryptedSSHPrivateKey(privateKeyPath, privateKeyData, missing.PublicKey)
+		}
+		return nil, fmt.Errorf("failed to parse private key: %w%s", err, agentHint())
+	}
+
+	return identity, nil
+}
+
+// agentHint explains why a key loaded in a running ssh-agent can't stand in for
+// the private key file. Decrypting an age stanza needs an X25519 key exchange
+// (ssh-ed25519) or RSA-OAEP decryption (ssh-rsa), and the agent protocol only
+// offers signatures, so there is no agent-backed identity to fall back to.
+func agentHint() string {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return ""
+	}
+	return " (keys held only in ssh-agent can't be used: the agent can sign but not decrypt, so crumb needs the private key file)"
+}
+
+// PassphrasePrompt obtains the passphrase for an encrypted private key. It is
+// only invoked when decryption actually needs the key.
+var PassphrasePrompt func(privateKeyPath string) ([]byte, error)
+
+func parseEncryptedSSHPrivateKey(privateKeyPath string, privateKeyData []byte, publicKey ssh.PublicKey) (age.Identity, error) {
+	if PassphrasePrompt == nil {
+		return nil, fmt.Errorf("private key %s is passphrase-protected and no passphrase prompt is available", privateKeyPath)
+	}
+
+	// Older PEM-encoded keys don't embed the public key, so fall back to the .pub file
+	if publicKey == nil {
+		publicKeyData, err := os.ReadFile(privateKeyPath + ".pub")
+		if err != nil {
+			return nil, fmt.Errorf("private key %s is passphrase-protected and its public key could not be read: %w", privateKeyPath, err)
+		}
+		publicKey, _, _, _, err = ssh.ParseAuthorizedKey(publicKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+	}
+
+	identity, err := agessh.NewEncryptedSSHIdentity(publicKey, privateKeyData, func() ([]byte, error) {
+		return PassphrasePrompt(privateKeyPath)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
@@ -124,21 +188,77 @@ func ParseSSHPrivateKey(privateKeyPath string) (age.Identity, error) {
 	return identity, nil
 }
 
-// WriteFileWithLock writes data to a file with exclusive locking to prevent concurrent access
-func WriteFileWithLock(filePath string, data []byte, perm os.FileMode) error {
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+// ErrLocked is returned when another process holds the storage lock for longer
+// than the lock timeout
+var ErrLocked = errors.New("storage is locked by another process")
+
+const (
+	// lockInitialBackoff is the first wait between non-blocking lock attempts
+	lockInitialBackoff = 10 * time.Millisecond
+	// lockMaxBackoff caps the wait between non-blocking lock attempts
+	lockMaxBackoff = 500 * time.Millisecond
+)
+
+// lockFile takes a flock of the given kind (LOCK_SH or LOCK_EX) on file. A
+// timeout of 0 waits as long as it takes; otherwise the lock is retried
+// without blocking, backing off between attempts, until timeout has passed.
+func lockFile(file *os.File, how int, timeout time.Duration) error {
+	fd := int(file.Fd()) //nolint:gosec // file descriptors are small integers, no overflow risk
+	if timeout <= 0 {
+		if err := unix.Flock(fd, how); err != nil {
+			return fmt.Errorf("failed to lock file: %w", err)
+		}
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	backoff := lockInitialBackoff
+	for {
+		err := unix.Flock(fd, how|unix.LOCK_NB)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, unix.EWOULDBLOCK) {
+			return fmt.Errorf("failed to lock file: %w", err)
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%w (waited %s for %s)", ErrLocked, timeout, file.Name())
+		}
+		time.Sleep(min(backoff, remaining))
+		backoff = min(backoff*2, lockMaxBackoff)
+	}
+}
+
+// WriteFileWithLock writes data to a file with exclusive locking to prevent
+// concurrent access. A file it creates gets exactly perm, regardless of the
+// umask; an existing file keeps its permissions. The file is only truncated
+// once the lock is held, so a timed-out write leaves it untouched.
+func WriteFileWithLock(filePath string, data []byte, perm os.FileMode, lockTimeout time.Duration) error {
+	_, statErr := os.Stat(filePath)
+	created := os.IsNotExist(statErr)
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, perm)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	// Apply file lock
-	fd := int(file.Fd()) //nolint:gosec // file descriptors are small integers, no overflow risk
-	if err := unix.Flock(fd, unix.LOCK_EX); err != nil {
-		return fmt.Errorf("failed to lock file: %w", err)
+	if created {
+		if err := file.Chmod(perm); err != nil {
+			return fmt.Errorf("failed to set file permissions: %w", err)
+		}
 	}
-	defer unix.Flock(fd, unix.LOCK_UN)
 
+	if err := lockFile(file, unix.LOCK_EX, lockTimeout); err != nil {
+		return err
+	}
+	defer unix.Flock(int(file.Fd()), unix.LOCK_UN) //nolint:gosec // file descriptors are small integers, no overflow risk
+
+	if err := file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate file: %w", err)
+	}
 	_, err = file.Write(data)
 	if err != nil {
 		return fmt.Errorf("failed to write data: %w", err)
@@ -147,20 +267,19 @@ func WriteFileWithLock(filePath string, data []byte, perm os.FileMode) error {
 	return nil
 }
 
-// ReadFileWithLock reads data from a file with shared locking
-func ReadFileWithLock(filePath string) ([]byte, error) {
+// ReadFileWithLock reads data from a file with shared locking, waiting at
+// most lockTimeout for a writer to finish (0 waits forever)
+func ReadFileWithLock(filePath string, lockTimeout time.Duration) ([]byte, error) {
 	file, err := os.OpenFile(filePath, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	// Apply file lock
-	fd := int(file.Fd()) //nolint:gosec // file descriptors are small integers, no overflow risk
-	if err := unix.Flock(fd, unix.LOCK_SH); err != nil {
-		return nil, fmt.Errorf("failed to lock file: %w", err)
+	if err := lockFile(file, unix.LOCK_SH, lockTimeout); err != nil {
+		return nil, err
 	}
-	defer unix.Flock(fd, unix.LOCK_UN)
+	defer unix.Flock(int(file.Fd()), unix.LOCK_UN) //nolint:gosec // file descriptors are small integers, no overflow risk
 
 	data, err := io.ReadAll(file)
 	if err != nil {
@@ -170,6 +289,52 @@ func ReadFileWithLock(filePath string) ([]byte, error) {
 	return data, nil
 }
 
+// UpdateFileWithLock reads a file and writes back what update returns while
+// holding an exclusive lock on it throughout, so no other locked read or
+// write can come in between. A nil result leaves the file as it is. Like
+// WriteFileWithLock, a file it creates gets exactly perm and lockTimeout
+// bounds the wait for the lock (0 waits forever).
+func UpdateFileWithLock(filePath string, perm os.FileMode, lockTimeout time.Duration, update func(data []byte) ([]byte, error)) error {
+	_, statErr := os.Stat(filePath)
+	created := os.IsNotExist(statErr)
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, perm)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	if created {
+		if err := file.Chmod(perm); err != nil {
+			return fmt.Errorf("failed to set file permissions: %w", err)
+		}
+	}
+
+	if err := lockFile(file, unix.LOCK_EX, lockTimeout); err != nil {
+		return err
+	}
+	defer unix.Flock(int(file.Fd()), unix.LOCK_UN) //nolint:gosec // file descriptors are small integers, no overflow risk
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	updated, err := update(data)
+	if err != nil || updated == nil {
+		return err
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate file: %w", err)
+	}
+	if _, err := file.WriteAt(updated, 0); err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+
+	return nil
+}
+
 // ConfirmOverwrite prompts the user for confirmation before overwriting something
 func ConfirmOverwrite(item string) bool {
 	fmt.Printf("%s already exists. Overwrite? (y/n): ", item)
@@ -185,3 +350,193 @@ func ConfirmOverwrite(item string) bool {
 	response = strings.TrimSpace(strings.ToLower(response))
 	return response == "y" || response == "yes"
 }
+
+// RecipientStanza describes one recipient entry from an age file header.
+type RecipientStanza struct {
+	Type string
+	Args []string
+}
+
+// Tag returns the short key fingerprint recorded in SSH stanzas, or an empty
+// string for stanza types that don't identify the recipient.
+func (s RecipientStanza) Tag() string {
+	if (s.Type == "ssh-ed25519" || s.Type == "ssh-rsa") && len(s.Args) > 0 {
+		return s.Args[0]
+	}
+	return ""
+}
+
+// ParseRecipientStanzas reads the header of age-encrypted data and returns its
+// recipient stanzas without decrypting the payload.
+func ParseRecipientStanzas(encryptedData []byte) ([]RecipientStanza, error) {
+	reader := bufio.NewReader(bytes.NewReader(encryptedData))
+
+	intro, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read age header: %w", err)
+	}
+	if strings.TrimSuffix(intro, "\n") != "age-encryption.org/v1" {
+		return nil, fmt.Errorf("not an age encrypted file (unexpected header %q)", strings.TrimSpace(intro))
+	}
+
+	var stanzas []RecipientStanza
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read age header: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "---"):
+			return stanzas, nil
+		case strings.HasPrefix(line, "-> "):
+			fields := strings.Fields(strings.TrimPrefix(line, "-> "))
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("malformed age header: empty recipient stanza")
+			}
+			stanzas = append(stanzas, RecipientStanza{Type: fields[0], Args: fields[1:]})
+		default:
+			// Stanza body lines carry wrapped key material and are skipped
+			if len(stanzas) == 0 {
+				return nil, fmt.Errorf("malformed age header: unexpected line %q", line)
+			}
+		}
+	}
+}
+
+// SSHRecipientTag computes the tag age records in SSH recipient stanzas for
+// the public key at publicKeyPath.
+func SSHRecipientTag(publicKeyPath string) (string, error) {
+	publicKeyData, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKeyData)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	sum := sha256.Sum256(pubKey.Marshal())
+	return base64.RawStdEncoding.EncodeToString(sum[:4]), nil
+}
+
+// SSHKeyInfo identifies an SSH public key
+type SSHKeyInfo struct {
+	Type        string
+	Fingerprint string
+	Comment     string
+}
+
+// SSHPublicKeyInfo reads the public key at publicKeyPath and returns its type,
+// SHA256 fingerprint (as shown by ssh-keygen -l) and comment. The key must
+// also parse as an age recipient, so only keys crumb can encrypt to are
+// reported.
+func SSHPublicKeyInfo(publicKeyPath string) (SSHKeyInfo, error) {
+	if _, err := ParseSSHPublicKey(publicKeyPath); err != nil {
+		return SSHKeyInfo{}, err
+	}
+
+	publicKeyData, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return SSHKeyInfo{}, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	pubKey, comment, _, _, err := ssh.ParseAuthorizedKey(publicKeyData)
+	if err != nil {
+		return SSHKeyInfo{}, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	return SSHKeyInfo{Type: pubKey.Type(), Fingerprint: ssh.FingerprintSHA256(pubKey), Comment: comment}, nil
+}
+
+// WriteFileAtomic writes data to a temporary file next to filePath and renames
+// it into place, so readers never observe a partially written file.
+func WriteFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	tmpPath, err := writeTempFile(filePath, data, perm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	return nil
+}
+
+// CreateFileAtomic is WriteFileAtomic for a file that must not exist yet. The
+// complete file is linked into place, which fails with an error matching
+// fs.ErrExist if filePath exists, even if it appeared while data was being
+// written.
+func CreateFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	tmpPath, err := writeTempFile(filePath, data, perm)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if err := os.Link(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	return nil
+}
+
+// writeTempFile writes data with exactly perm to a new temporary file next to
+// filePath and returns its path.
+func writeTempFile(filePath string, data []byte, perm os.FileMode) (string, error) {
+	dir := filepath.Dir(filePath)
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+
+	if err := tmpFile.Chmod(perm); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to set file permissions: %w", err)
+	}
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write data: %w", err)
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to sync file: %w", err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to close file: %w", err)
+	}
+
+	return tmpPath, nil
+}
+
+// RandomString returns length characters drawn uniformly from alphabet using
+// the operating system's secure random source
+func RandomString(length int, alphabet string) (string, error) {
+	chars := []rune(alphabet)
+	if len(chars) == 0 {
+		return "", fmt.Errorf("alphabet cannot be empty")
+	}
+
+	max := big.NewInt(int64(len(chars)))
+	result := make([]rune, length)
+	for i := range result {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random value: %w", err)
+		}
+		result[i] = chars[n.Int64()]
+	}
+	return string(result), nil
+}
@@ -0,0 +1,371 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseRecipientStanzas(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to convert public key: %v", err)
+	}
+
+	publicKeyPath := filepath.Join(t.TempDir(), "id_ed25519.pub")
+	if err := os.WriteFile(publicKeyPath, ssh.MarshalAuthorizedKey(sshPub), 0600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+
+	sshRecipient, err := agessh.NewEd25519Recipient(sshPub)
+	if err != nil {
+		t.Fatalf("Failed to create SSH recipient: %v", err)
+	}
+	nativeIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Failed to create X25519 identity: %v", err)
+	}
+
+	encrypted, err := EncryptData("secret=value", []age.Recipient{sshRecipient, nativeIdentity.Recipient()})
+	if err != nil {
+		t.Fatalf("EncryptData() error = %v", err)
+	}
+
+	stanzas, err := ParseRecipientStanzas(encrypted)
+	if err != nil {
+		t.Fatalf("ParseRecipientStanzas() error = %v", err)
+	}
+
+	if len(stanzas) != 2 {
+		t.Fatalf("expected 2 stanzas, got %d: %+v", len(stanzas), stanzas)
+	}
+	if stanzas[0].Type != "ssh-ed25519" {
+		t.Errorf("stanza[0].Type = %q, want ssh-ed25519", stanzas[0].Type)
+	}
+	if stanzas[1].Type != "X25519" {
+		t.Errorf("stanza[1].Type = %q, want X25519", stanzas[1].Type)
+	}
+	if stanzas[1].Tag() != "" {
+		t.Errorf("X25519 stanza should have no tag, got %q", stanzas[1].Tag())
+	}
+
+	tag, err := SSHRecipientTag(publicKeyPath)
+	if err != nil {
+		t.Fatalf("SSHRecipientTag() error = %v", err)
+	}
+	if stanzas[0].Tag() != tag {
+		t.Errorf("stanza tag = %q, want profile key tag %q", stanzas[0].Tag(), tag)
+	}
+}
+
+func TestParseRecipientStanzasInvalid(t *testing.T) {
+	if _, err := ParseRecipientStanzas([]byte("not age data\n")); err == nil {
+		t.Error("expected error for non-age data")
+	}
+	if _, err := ParseRecipientStanzas([]byte("age-encryption.org/v1\n-> X25519 abc\n")); err == nil {
+		t.Error("expected error for truncated header")
+	}
+}
+
+func TestParseSSHPrivateKeyWithPassphrase(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to convert public key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+
+	privateKeyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(privateKeyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write private key: %v", err)
+	}
+
+	recipient, err := agessh.NewEd25519Recipient(sshPub)
+	if err != nil {
+		t.Fatalf("Failed to create recipient: %v", err)
+	}
+	encrypted, err := EncryptData("secret", []age.Recipient{recipient})
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	t.Cleanup(func() { PassphrasePrompt = nil })
+
+	PassphrasePrompt = nil
+	if _, err := ParseSSHPrivateKey(privateKeyPath); err == nil || !strings.Contains(err.Error(), "passphrase-protected") {
+		t.Fatalf("Expected passphrase-protected error without a prompt, got %v", err)
+	}
+
+	PassphrasePrompt = func(string) ([]byte, error) {
+		return nil, errors.New("timed out after 1s waiting for input")
+	}
+	identity, err := ParseSSHPrivateKey(privateKeyPath)
+	if err != nil {
+		t.Fatalf("ParseSSHPrivateKey failed: %v", err)
+	}
+	if _, err := DecryptData(encrypted, identity); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected prompt error to surface from decryption, got %v", err)
+	}
+
+	PassphrasePrompt = func(string) ([]byte, error) { return []byte("hunter2"), nil }
+	identity, err = ParseSSHPrivateKey(privateKeyPath)
+	if err != nil {
+		t.Fatalf("ParseSSHPrivateKey failed: %v", err)
+	}
+	plaintext, err := DecryptData(encrypted, identity)
+	if err != nil {
+		t.Fatalf("DecryptData failed: %v", err)
+	}
+	if plaintext != "secret" {
+		t.Errorf("Expected 'secret', got %q", plaintext)
+	}
+}
+
+func TestParseSSHPrivateKeyAgentHint(t *testing.T) {
+	missingPath := filepath.Join(t.TempDir(), "id_ed25519")
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	_, err := ParseSSHPrivateKey(missingPath)
+	if err == nil || strings.Contains(err.Error(), "ssh-agent") {
+		t.Errorf("Expected read error without agent hint, got %v", err)
+	}
+
+	t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+	_, err = ParseSSHPrivateKey(missingPath)
+	if err == nil || !strings.Contains(err.Error(), "ssh-agent can't be used") {
+		t.Errorf("Expected agent hint in error, got %v", err)
+	}
+}
+
+func TestFileLockTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets")
+	if err := os.WriteFile(path, []byte("original"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// Another open file description holding the lock stands in for a
+	// long-running crumb process
+	holder, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer holder.Close()
+	if err := unix.Flock(int(holder.Fd()), unix.LOCK_EX); err != nil {
+		t.Fatalf("Failed to take lock: %v", err)
+	}
+
+	start := time.Now()
+	_, err = ReadFileWithLock(path, 100*time.Millisecond)
+	if !errors.Is(err, ErrLocked) || !strings.Contains(err.Error(), "storage is locked by another process") {
+		t.Errorf("ReadFileWithLock() error = %v, want ErrLocked", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("ReadFileWithLock() gave up after %s, want at least the 100ms timeout", elapsed)
+	}
+
+	if err := WriteFileWithLock(path, []byte("new"), 0600, 50*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Errorf("WriteFileWithLock() error = %v, want ErrLocked", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "original" {
+		t.Errorf("file content after timed-out write = %q, want it untouched", content)
+	}
+
+	// Once the lock is released, waiting succeeds
+	holderFD := int(holder.Fd())
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		time.Sleep(50 * time.Millisecond)
+		unix.Flock(holderFD, unix.LOCK_UN)
+	}()
+	if err := WriteFileWithLock(path, []byte("new"), 0600, 5*time.Second); err != nil {
+		t.Fatalf("WriteFileWithLock() after release unexpected error = %v", err)
+	}
+	<-released
+	data, err := ReadFileWithLock(path, time.Second)
+	if err != nil || string(data) != "new" {
+		t.Errorf("ReadFileWithLock() = %q, %v, want \"new\"", data, err)
+	}
+}
+
+func TestUpdateFileWithLockConcurrentUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+
+	// Every update appends one byte; an update lost to another would leave
+	// the file short
+	const updates = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, updates)
+	for i := 0; i < updates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- UpdateFileWithLock(path, 0600, 5*time.Second, func(data []byte) ([]byte, error) {
+				return append(data, 'x'), nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("UpdateFileWithLock() unexpected error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if len(data) != updates {
+		t.Errorf("file has %d bytes after %d updates, want %d", len(data), updates, updates)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("file mode = %o, want 0600", info.Mode().Perm())
+	}
+
+	// A nil result leaves the file alone
+	if err := UpdateFileWithLock(path, 0600, time.Second, func([]byte) ([]byte, error) { return nil, nil }); err != nil {
+		t.Fatalf("UpdateFileWithLock() unexpected error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != updates {
+		t.Errorf("file has %d bytes after a nil update, want %d", len(data), updates)
+	}
+}
+
+func TestRandomString(t *testing.T) {
+	value, err := RandomString(64, "ab")
+	if err != nil {
+		t.Fatalf("RandomString() unexpected error = %v", err)
+	}
+	if len(value) != 64 || strings.Trim(value, "ab") != "" {
+		t.Errorf("RandomString() = %q, want 64 characters from \"ab\"", value)
+	}
+	if _, err := RandomString(8, ""); err == nil {
+		t.Error("RandomString() expected an error for an empty alphabet")
+	}
+}
+
+func TestCreateFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets")
+
+	if err := CreateFileAtomic(path, []byte("first"), 0600); err != nil {
+		t.Fatalf("CreateFileAtomic() unexpected error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat created file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("created file mode = %o, want 0600", info.Mode().Perm())
+	}
+
+	err = CreateFileAtomic(path, []byte("second"), 0600)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Errorf("CreateFileAtomic() on an existing file error = %v, want fs.ErrExist", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first" {
+		t.Errorf("existing file = %q, want it left as %q", data, "first")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want only the created file", len(entries))
+	}
+}
+
+func TestWriteFileAtomicConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env.local")
+
+	// Each writer's content is large enough that a torn write would be seen
+	contents := make([]string, 8)
+	for i := range contents {
+		contents[i] = strings.Repeat(fmt.Sprintf("export VAR_%d=value\n", i), 4096)
+	}
+	if err := WriteFileAtomic(path, []byte(contents[0]), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic() unexpected error = %v", err)
+	}
+
+	done := make(chan struct{})
+	readErrs := make(chan error, 1)
+	go func() {
+		defer close(readErrs)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				readErrs <- err
+				return
+			}
+			if !slices.Contains(contents, string(data)) {
+				readErrs <- fmt.Errorf("read %d bytes that match no writer's content", len(data))
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i, content := range contents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if err := WriteFileAtomic(path, []byte(content), 0600); err != nil {
+					t.Errorf("writer %d: WriteFileAtomic() unexpected error = %v", i, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	if err := <-readErrs; err != nil {
+		t.Errorf("concurrent reader: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the output file (no leftover temp files)", len(entries))
+	}
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time for timestamps and time-based
+// filters, so tests can freeze time instead of sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock reads the system time.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// DefaultClock is the clock of stores that weren't given one with WithClock.
+var DefaultClock Clock = realClock{}
+
+// FakeClock is a Clock that stays at a fixed time until it is moved.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock creates a FakeClock stopped at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to now.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
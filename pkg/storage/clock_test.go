@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	if got := clock.Now(); !got.Equal(start) {
+		t.Errorf("Now() = %v, want %v", got, start)
+	}
+
+	clock.Advance(90 * time.Minute)
+	if want := start.Add(90 * time.Minute); !clock.Now().Equal(want) {
+		t.Errorf("after Advance Now() = %v, want %v", clock.Now(), want)
+	}
+
+	later := time.Date(2027, 6, 1, 0, 0, 0, 0, time.UTC)
+	clock.Set(later)
+	if !clock.Now().Equal(later) {
+		t.Errorf("after Set Now() = %v, want %v", clock.Now(), later)
+	}
+}
+
+func TestFileStoreWithClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC))
+	store := NewFileStore("pub", "priv", nil, WithClock(clock))
+	secrets := make(SecretStore)
+
+	SetSecret(secrets, "/app/key", "value", store.Clock().Now())
+	if got := secrets["/app/key"].Updated; got != "2026-02-03T04:05:06Z" {
+		t.Errorf("SetSecret() Updated = %q", got)
+	}
+
+	clock.Advance(24 * time.Hour)
+	if err := MoveSecret(secrets, "/app/key", "/app/moved", store.Clock().Now()); err != nil {
+		t.Fatalf("MoveSecret() error: %v", err)
+	}
+	if got := secrets["/app/moved"].Updated; got != "2026-02-04T04:05:06Z" {
+		t.Errorf("MoveSecret() Updated = %q", got)
+	}
+
+	if got := NewFileStore("pub", "priv", nil).Clock(); got != DefaultClock {
+		t.Errorf("Clock() without WithClock = %v, want DefaultClock", got)
+	}
+}
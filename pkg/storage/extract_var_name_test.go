@@ -51,3 +51,79 @@ func TestExtractVarName(t *testing.T) {
 		})
 	}
 }
+
+func TestConvertPathToEnvVar(t *testing.T) {
+	tests := []struct {
+		name         string
+		secretPath   string
+		pathPrefix   string
+		nameSegments int
+		expected     string
+	}{
+		{
+			name:         "one segment",
+			secretPath:   "/svc/db/host",
+			pathPrefix:   "/svc",
+			nameSegments: 1,
+			expected:     "HOST",
+		},
+		{
+			name:         "two segments",
+			secretPath:   "/svc/db/host",
+			pathPrefix:   "/svc",
+			nameSegments: 2,
+			expected:     "DB_HOST",
+		},
+		{
+			name:         "three segments",
+			secretPath:   "/svc/billing/db/host",
+			pathPrefix:   "/svc",
+			nameSegments: 3,
+			expected:     "BILLING_DB_HOST",
+		},
+		{
+			name:         "hyphens converted",
+			secretPath:   "/svc/db-primary/api-key",
+			pathPrefix:   "/svc",
+			nameSegments: 2,
+			expected:     "DB_PRIMARY_API_KEY",
+		},
+		{
+			name:         "path shorter than segments",
+			secretPath:   "/svc/db/host",
+			pathPrefix:   "/svc",
+			nameSegments: 3,
+			expected:     "DB_HOST",
+		},
+		{
+			name:         "single leaf shorter than segments",
+			secretPath:   "/svc/token",
+			pathPrefix:   "/svc",
+			nameSegments: 2,
+			expected:     "TOKEN",
+		},
+		{
+			name:         "no prefix uses whole path",
+			secretPath:   "/svc/db/host",
+			pathPrefix:   "",
+			nameSegments: 3,
+			expected:     "SVC_DB_HOST",
+		},
+		{
+			name:         "zero treated as one",
+			secretPath:   "/svc/db/host",
+			pathPrefix:   "/svc",
+			nameSegments: 0,
+			expected:     "HOST",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ConvertPathToEnvVar(tt.secretPath, tt.pathPrefix, tt.nameSegments)
+			if result != tt.expected {
+				t.Errorf("ConvertPathToEnvVar(%q, %q, %d) = %q, want %q", tt.secretPath, tt.pathPrefix, tt.nameSegments, result, tt.expected)
+			}
+		})
+	}
+}
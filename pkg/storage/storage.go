@@ -1,9 +1,14 @@
 package storage
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,8 +24,25 @@ type SecretEntry struct {
 	Value   string `toml:"value"`
 	Updated string `toml:"updated"`
 	Expires string `toml:"expires"`
+	// Rotate is the rotation interval (e.g. "90d"); empty means no policy
+	Rotate string `toml:"rotate,omitempty"`
+	// Description documents what the secret is for, e.g. a comment kept
+	// from an imported .env file
+	Description string `toml:"description,omitempty"`
+	// History holds the values this secret had before, newest first
+	History []HistoryEntry `toml:"history,omitempty"`
 }
 
+// HistoryEntry is a previous value of a secret and when it was set
+type HistoryEntry struct {
+	Value   string `toml:"value"`
+	Updated string `toml:"updated"`
+}
+
+// DefaultHistoryDepth is how many previous values are kept per secret unless
+// the profile sets history_depth
+const DefaultHistoryDepth = 5
+
 // SecretStore is the top-level structure: map of key-path to entry.
 type SecretStore map[string]SecretEntry
 
@@ -34,22 +56,31 @@ func LoadSecrets(privateKeyPath string, b backend.Backend) (SecretStore, error)
 		return make(SecretStore), nil
 	}
 
-	identity, err := crypto.ParseSSHPrivateKey(privateKeyPath)
-	if err != nil {
-		return nil, err
-	}
-
 	encryptedData, err := b.Read()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read secrets: %w", err)
 	}
 
+	return decryptSecrets(privateKeyPath, encryptedData, b.Location())
+}
+
+// decryptSecrets decrypts and parses the stored data read from location.
+// Empty data is an empty store.
+func decryptSecrets(privateKeyPath string, encryptedData []byte, location string) (SecretStore, error) {
 	if len(encryptedData) == 0 {
 		return make(SecretStore), nil
 	}
 
+	identity, err := crypto.ParseSSHPrivateKey(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
 	decryptedData, err := crypto.DecryptData(encryptedData, identity)
 	if err != nil {
+		if errors.Is(err, crypto.ErrKeyMismatch) {
+			return nil, fmt.Errorf("private key %s cannot decrypt storage %s: it is encrypted to a different key. Check the profile's private_key_path in config.yaml, or run 'crumb recipients list' to see which keys the store is encrypted to: %w", privateKeyPath, location, err)
+		}
 		return nil, fmt.Errorf("failed to decrypt secrets: %w", err)
 	}
 
@@ -67,22 +98,31 @@ func LoadSecrets(privateKeyPath string, b backend.Backend) (SecretStore, error)
 
 // SaveSecrets encrypts and saves secrets to the given backend.
 func SaveSecrets(secrets SecretStore, publicKeyPath string, b backend.Backend) error {
-	recipient, err := crypto.ParseSSHPublicKey(publicKeyPath)
+	content, err := serializeSecrets(secrets)
+	if err != nil {
+		return fmt.Errorf("failed to serialize secrets: %w", err)
+	}
+
+	encryptedData, err := encryptContent(content, publicKeyPath)
 	if err != nil {
 		return err
 	}
 
-	content, err := serializeSecrets(secrets)
+	return b.Write(encryptedData)
+}
+
+// encryptContent encrypts serialized secrets to the public key
+func encryptContent(content, publicKeyPath string) ([]byte, error) {
+	recipient, err := crypto.ParseSSHPublicKey(publicKeyPath)
 	if err != nil {
-		return fmt.Errorf("failed to serialize secrets: %w", err)
+		return nil, err
 	}
 
 	encryptedData, err := crypto.EncryptData(content, []age.Recipient{recipient})
 	if err != nil {
-		return fmt.Errorf("failed to encrypt secrets: %w", err)
+		return nil, fmt.Errorf("failed to encrypt secrets: %w", err)
 	}
-
-	return b.Write(encryptedData)
+	return encryptedData, nil
 }
 
 // CreateEmptyStorage creates an empty encrypted storage via the given backend.
@@ -101,8 +141,9 @@ func CreateEmptyStorage(publicKeyPath string, b backend.Backend) error {
 }
 
 // GetFilteredKeys returns a sorted list of keys that match the given path filter.
+// The result is never nil, so it encodes as an empty JSON array.
 func GetFilteredKeys(secrets SecretStore, pathFilter string) []string {
-	var keys []string
+	keys := []string{}
 
 	if pathFilter != "" && pathFilter != "/" {
 		pathFilter = strings.TrimSuffix(pathFilter, "/")
@@ -113,7 +154,7 @@ func GetFilteredKeys(secrets SecretStore, pathFilter string) []string {
 	}
 
 	if pathFilter != "" {
-		var filteredKeys []string
+		filteredKeys := []string{}
 		for _, key := range keys {
 			if matchesPathFilter(key, pathFilter) {
 				filteredKeys = append(filteredKeys, key)
@@ -126,13 +167,17 @@ func GetFilteredKeys(secrets SecretStore, pathFilter string) []string {
 	return keys
 }
 
+// envVarNameReplacer maps characters that are valid in key paths but not in
+// environment variable names to underscores
+var envVarNameReplacer = strings.NewReplacer("-", "_", "=", "_")
+
 // ExtractVarName converts a key path to a valid environment variable name.
 func ExtractVarName(keyPath string) string {
 	trimmed := strings.TrimPrefix(keyPath, "/")
 	pathSegments := strings.Split(trimmed, "/")
 	if len(pathSegments) > 0 {
 		varName := pathSegments[len(pathSegments)-1]
-		varName = strings.ReplaceAll(varName, "-", "_")
+		varName = envVarNameReplacer.Replace(varName)
 		varName = strings.ToUpper(varName)
 		return varName
 	}
@@ -157,6 +202,12 @@ func ParseSecrets(content string) SecretStore {
 	return parseLegacySecrets(content)
 }
 
+// normalizeLineEndings converts CRLF line endings to LF, so files edited on
+// Windows parse the same as LF files and multi-line values don't keep a stray \r.
+func normalizeLineEndings(content string) string {
+	return strings.ReplaceAll(content, "\r\n", "\n")
+}
+
 // DetectFormat returns "toml" or "legacy" based on content inspection.
 func DetectFormat(content string) string {
 	return detectFormat(content)
@@ -198,7 +249,7 @@ func ParseLegacySecrets(content string) SecretStore {
 
 func parseLegacySecrets(content string) SecretStore {
 	secrets := make(SecretStore)
-	lines := strings.Split(strings.TrimSpace(content), "\n")
+	lines := strings.Split(strings.TrimSpace(normalizeLineEndings(content)), "\n")
 
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -249,6 +300,19 @@ func serializeSecrets(store SecretStore) (string, error) {
 
 		fmt.Fprintf(&buf, "updated = %q\n", entry.Updated)
 		fmt.Fprintf(&buf, "expires = %q\n", entry.Expires)
+		if entry.Rotate != "" {
+			fmt.Fprintf(&buf, "rotate = %q\n", entry.Rotate)
+		}
+		if entry.Description != "" {
+			fmt.Fprintf(&buf, "description = %q\n", entry.Description)
+		}
+		if len(entry.History) > 0 {
+			buf.WriteString("history = [\n")
+			for _, previous := range entry.History {
+				fmt.Fprintf(&buf, "  {value = %q, updated = %q},\n", previous.Value, previous.Updated)
+			}
+			buf.WriteString("]\n")
+		}
 	}
 
 	return buf.String(), nil
@@ -276,20 +340,52 @@ func SecretExists(secrets SecretStore, key string) (SecretEntry, bool) {
 	return entry, exists
 }
 
-// SetSecret sets a secret in the store with the current timestamp.
-func SetSecret(secrets SecretStore, key, value string) {
+// SetSecret sets a secret in the store, stamping it as updated at now. A
+// changed value moves the old one into the secret's history.
+func SetSecret(secrets SecretStore, key, value string, now time.Time) {
 	secrets[key] = SecretEntry{
-		Value:   value,
-		Updated: time.Now().UTC().Format(time.RFC3339),
+		Value:       value,
+		Updated:     now.UTC().Format(time.RFC3339),
+		Rotate:      secrets[key].Rotate,
+		Description: secrets[key].Description,
+		History:     historyBefore(secrets, key, value),
 	}
 }
 
 // SetSecretWithExpires sets a secret with an explicit expiry timestamp.
-func SetSecretWithExpires(secrets SecretStore, key, value, expires string) {
+func SetSecretWithExpires(secrets SecretStore, key, value, expires string, now time.Time) {
 	secrets[key] = SecretEntry{
-		Value:   value,
-		Updated: time.Now().UTC().Format(time.RFC3339),
-		Expires: expires,
+		Value:       value,
+		Updated:     now.UTC().Format(time.RFC3339),
+		Expires:     expires,
+		Rotate:      secrets[key].Rotate,
+		Description: secrets[key].Description,
+		History:     historyBefore(secrets, key, value),
+	}
+}
+
+// historyBefore returns the history key should have once its value becomes
+// value: the current value goes first unless it's unchanged. The result isn't
+// capped; TrimHistory does that when the store is saved.
+func historyBefore(secrets SecretStore, key, value string) []HistoryEntry {
+	entry, exists := secrets[key]
+	if !exists || entry.Value == value {
+		return entry.History
+	}
+	return append([]HistoryEntry{{Value: entry.Value, Updated: entry.Updated}}, entry.History...)
+}
+
+// TrimHistory drops all but the depth most recent previous values of every
+// secret. A depth of 0 keeps no history.
+func TrimHistory(secrets SecretStore, depth int) {
+	for key, entry := range secrets {
+		if len(entry.History) > depth {
+			entry.History = entry.History[:depth]
+			if depth == 0 {
+				entry.History = nil
+			}
+			secrets[key] = entry
+		}
 	}
 }
 
@@ -309,6 +405,164 @@ func ParseExpiryDate(input string) (string, error) {
 	return "", fmt.Errorf("invalid date format %q, accepted: YYYY-MM-DD, DD.MM.YYYY, DD/MM/YYYY", input)
 }
 
+// ParseSince parses a --modified-since value relative to now. It accepts a Go
+// duration (e.g. 36h), a number of days (e.g. 7d), or an RFC3339 timestamp.
+func ParseSince(input string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, input); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(input, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(input); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --modified-since value %q, expected a duration (e.g. 24h, 7d) or an RFC3339 timestamp", input)
+}
+
+// ParseInterval parses a rotation interval: a number of days (e.g. 90d) or a
+// Go duration (e.g. 720h). The interval must be positive.
+func ParseInterval(input string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(input, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	if d, err := time.ParseDuration(input); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid rotation interval %q, expected a number of days (e.g. 90d) or a duration (e.g. 720h)", input)
+}
+
+// RotationStatus describes a secret with a rotation policy
+type RotationStatus struct {
+	Key      string
+	Interval string
+	// DueAt is when the secret is due for rotation; zero if it has no
+	// update timestamp, in which case it is always considered due
+	DueAt time.Time
+}
+
+// DueForRotation returns the secrets with a rotation policy whose last update
+// plus interval is at or before now, sorted by key. Secrets without an update
+// timestamp are always due, since their age is unknown.
+func DueForRotation(secrets SecretStore, now time.Time) []RotationStatus {
+	due := []RotationStatus{}
+	for _, key := range GetFilteredKeys(secrets, "") {
+		entry := secrets[key]
+		if entry.Rotate == "" {
+			continue
+		}
+		interval, err := ParseInterval(entry.Rotate)
+		if err != nil {
+			continue
+		}
+
+		status := RotationStatus{Key: key, Interval: entry.Rotate}
+		if updated, err := time.Parse(time.RFC3339, entry.Updated); err == nil {
+			status.DueAt = updated.Add(interval)
+			if now.Before(status.DueAt) {
+				continue
+			}
+		}
+		due = append(due, status)
+	}
+	return due
+}
+
+// FilterModifiedSince returns the keys whose entries were updated at or after
+// since, keeping their order. Entries without a parsable update timestamp only
+// match when includeUndated is set.
+func FilterModifiedSince(secrets SecretStore, keys []string, since time.Time, includeUndated bool) []string {
+	filtered := []string{}
+	for _, key := range keys {
+		updated, err := time.Parse(time.RFC3339, secrets[key].Updated)
+		if err != nil {
+			if includeUndated {
+				filtered = append(filtered, key)
+			}
+			continue
+		}
+		if !updated.Before(since) {
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered
+}
+
+// FilterEmpty returns the keys whose values are empty or whitespace-only,
+// keeping their order.
+func FilterEmpty(secrets SecretStore, keys []string) []string {
+	filtered := []string{}
+	for _, key := range keys {
+		if strings.TrimSpace(secrets[key].Value) == "" {
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered
+}
+
+// FilterMatching returns the keys that pattern matches anywhere in the path,
+// keeping their order.
+func FilterMatching(keys []string, pattern *regexp.Regexp) []string {
+	filtered := []string{}
+	for _, key := range keys {
+		if pattern.MatchString(key) {
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered
+}
+
+// DirectChildren groups the keys below prefix (which ends in "/") by their
+// next path segment, like a directory listing: a secret directly under prefix
+// is returned as is, and deeper secrets collapse into "<prefix><segment>/".
+// Keys outside prefix are dropped. The result is sorted.
+func DirectChildren(keys []string, prefix string) []string {
+	seen := make(map[string]bool)
+	children := []string{}
+	for _, key := range keys {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		child := prefix + rest
+		if segment, _, nested := strings.Cut(rest, "/"); nested {
+			child = prefix + segment + "/"
+		}
+		if !seen[child] {
+			seen[child] = true
+			children = append(children, child)
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+// SortKeys orders keys in place by full path ("path") or by their last
+// segment ("leaf"), breaking leaf ties by full path. reverse sorts descending.
+func SortKeys(keys []string, by string, reverse bool) {
+	less := func(a, b string) bool { return a < b }
+	if by == "leaf" {
+		less = func(a, b string) bool {
+			leafA, leafB := a[strings.LastIndex(a, "/")+1:], b[strings.LastIndex(b, "/")+1:]
+			if leafA != leafB {
+				return leafA < leafB
+			}
+			return a < b
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if reverse {
+			return less(keys[j], keys[i])
+		}
+		return less(keys[i], keys[j])
+	})
+}
+
 // SetSecretExpiry updates only the expiry on an existing secret.
 func SetSecretExpiry(secrets SecretStore, key, expires string) {
 	entry := secrets[key]
@@ -325,20 +579,20 @@ func DeleteSecret(secrets SecretStore, key string) bool {
 	return false
 }
 
-// MoveSecret moves a secret from one key to another, preserving metadata.
-func MoveSecret(secrets SecretStore, oldKey, newKey string) error {
+// MoveSecret moves a secret from one key to another, preserving metadata
+// except that it's stamped as updated at now. An existing newKey is an error;
+// delete it first to overwrite it.
+func MoveSecret(secrets SecretStore, oldKey, newKey string, now time.Time) error {
 	entry, exists := secrets[oldKey]
 	if !exists {
 		return fmt.Errorf("old key not found: %s", oldKey)
 	}
 
 	if _, exists := secrets[newKey]; exists {
-		if !crypto.ConfirmOverwrite("key") {
-			return fmt.Errorf("operation cancelled")
-		}
+		return fmt.Errorf("new key already exists: %s", newKey)
 	}
 
-	entry.Updated = time.Now().UTC().Format(time.RFC3339)
+	entry.Updated = now.UTC().Format(time.RFC3339)
 	secrets[newKey] = entry
 	delete(secrets, oldKey)
 
@@ -360,18 +614,161 @@ func GetSecretsForPath(secrets SecretStore, pathPrefix string) map[string]string
 }
 
 // ConvertPathToEnvVar converts a secret path to an environment variable name for direct export.
-func ConvertPathToEnvVar(secretPath, pathPrefix string) string {
+// The name is built from the last nameSegments segments below pathPrefix, joined with "_".
+func ConvertPathToEnvVar(secretPath, pathPrefix string, nameSegments int) string {
 	remainingPath := strings.TrimPrefix(secretPath, pathPrefix)
 	remainingPath = strings.TrimPrefix(remainingPath, "/")
 
 	pathSegments := strings.Split(remainingPath, "/")
-	if len(pathSegments) > 0 {
-		keyName := pathSegments[len(pathSegments)-1]
-		keyName = strings.ToUpper(strings.ReplaceAll(keyName, "-", "_"))
-		return keyName
+	if nameSegments < 1 {
+		nameSegments = 1
+	}
+	if nameSegments > len(pathSegments) {
+		nameSegments = len(pathSegments)
 	}
 
-	return ""
+	keyName := strings.Join(pathSegments[len(pathSegments)-nameSegments:], "_")
+	keyName = strings.ToUpper(envVarNameReplacer.Replace(keyName))
+	return keyName
+}
+
+// FlattenJSON parses a JSON object and flattens it into key paths under parentPath.
+// Nested objects are joined with "/"; non-string leaves are stored as compact JSON.
+func FlattenJSON(parentPath string, data []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var root interface{}
+	if err := decoder.Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	obj, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("JSON input must be an object (e.g. {\"user\": \"admin\", \"password\": \"...\"}), got %s", jsonKind(root))
+	}
+
+	result := make(map[string]string)
+	if err := flattenJSONObject(strings.TrimSuffix(parentPath, "/"), obj, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ParseVaultJSON reads secrets from a HashiCorp Vault KV JSON dump and returns
+// them keyed by relative path: <field> for a single secret, or
+// <vault-path>/<field> for a file mapping Vault paths to secrets. A secret is
+// the output of `vault kv get -format=json`: KV v2 nests the fields under
+// data.data next to data.metadata, KV v1 has them directly under data.
+// Non-string field values are stored as compact JSON.
+func ParseVaultJSON(filePath string) (map[string]string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vault JSON file: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var root interface{}
+	if err := decoder.Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	obj, ok := root.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a Vault JSON object, got %s", jsonKind(root))
+	}
+
+	result := make(map[string]string)
+	if fields, ok := vaultSecretFields(obj); ok {
+		return result, addVaultFields("", fields, result)
+	}
+
+	for vaultPath, value := range obj {
+		secret, _ := value.(map[string]interface{})
+		fields, ok := vaultSecretFields(secret)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected a Vault KV secret with a \"data\" object", vaultPath)
+		}
+		if err := addVaultFields(strings.Trim(vaultPath, "/"), fields, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// vaultSecretFields returns the fields of a Vault KV v1 or v2 secret, and
+// false if secret doesn't look like one
+func vaultSecretFields(secret map[string]interface{}) (map[string]interface{}, bool) {
+	data, ok := secret["data"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	// KV v2 wraps the fields with their metadata; a v1 secret that happens to
+	// have a "data" field is told apart by the missing metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata || len(data) == 1 {
+			return inner, true
+		}
+	}
+	return data, true
+}
+
+// addVaultFields adds each field under prefix to result
+func addVaultFields(prefix string, fields map[string]interface{}, result map[string]string) error {
+	for field, value := range fields {
+		keyPath := field
+		if prefix != "" {
+			keyPath = prefix + "/" + field
+		}
+		if text, ok := value.(string); ok {
+			result[keyPath] = text
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode value for %s: %w", keyPath, err)
+		}
+		result[keyPath] = string(encoded)
+	}
+	return nil
+}
+
+func flattenJSONObject(prefix string, obj map[string]interface{}, result map[string]string) error {
+	for field, value := range obj {
+		keyPath := prefix + "/" + field
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flattenJSONObject(keyPath, v, result); err != nil {
+				return err
+			}
+		case string:
+			result[keyPath] = v
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("failed to encode value for %s: %w", keyPath, err)
+			}
+			result[keyPath] = string(encoded)
+		}
+	}
+	return nil
+}
+
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case json.Number:
+		return "a number"
+	case bool:
+		return "a boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
 }
 
 // ParseEnvFile parses a .env file and returns a map of key-value pairs.
@@ -384,15 +781,44 @@ func ParseEnvFile(filePath string) (map[string]string, error) {
 	return parseEnvContent(string(content)), nil
 }
 
+// ParseEnvFileComments reads a .env file and returns, for each variable, the
+// comment lines directly above it without their "#", joined by newlines. A
+// blank line ends a comment block, so only comments attached to a variable
+// are kept.
+func ParseEnvFileComments(filePath string) (map[string]string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .env file: %w", err)
+	}
+
+	_, comments := parseEnvEntries(string(content))
+	return comments, nil
+}
+
 // parseEnvContent parses .env file content into a map.
 func parseEnvContent(content string) map[string]string {
-	envVars := make(map[string]string)
-	lines := strings.Split(content, "\n")
+	envVars, _ := parseEnvEntries(content)
+	return envVars
+}
+
+// parseEnvEntries parses .env file content into its variables and the
+// comment block directly above each of them.
+func parseEnvEntries(content string) (envVars, comments map[string]string) {
+	envVars = make(map[string]string)
+	comments = make(map[string]string)
+	lines := strings.Split(normalizeLineEndings(content), "\n")
 
+	var pending []string
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 
-		if line == "" || strings.HasPrefix(line, "#") {
+		if comment, ok := strings.CutPrefix(line, "#"); ok {
+			pending = append(pending, strings.TrimSpace(comment))
+			continue
+		}
+		attached := strings.TrimSpace(strings.Join(pending, "\n"))
+		pending = nil
+		if line == "" {
 			continue
 		}
 
@@ -413,16 +839,66 @@ func parseEnvContent(content string) map[string]string {
 
 		if key != "" {
 			envVars[key] = value
+			if attached != "" {
+				comments[key] = attached
+			} else {
+				delete(comments, key)
+			}
 		}
 	}
 
-	return envVars
+	return envVars, comments
 }
 
-// ShellQuoteValue quotes a value for safe shell consumption if needed.
+// DotenvQuoteValue quotes a value for a .env file if needed. Values that need
+// quoting are double-quoted with backslashes, quotes and newlines escaped, so
+// multi-line values stay on one line.
+func DotenvQuoteValue(value string) string {
+	if value != "" && value == ShellQuoteValue(value) && !strings.ContainsAny(value, "\n\r") {
+		return value
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return "\"" + replacer.Replace(value) + "\""
+}
+
+// ShellQuoteValue quotes a value for safe bash/zsh consumption if needed.
 func ShellQuoteValue(value string) string {
-	needsQuoting := false
+	if needsShellQuoting(value) {
+		return ShellQuoteAlways(value)
+	}
+	return value
+}
+
+// ShellQuoteAlways wraps a value in double quotes for bash/zsh even when
+// ShellQuoteValue would leave it bare. Backslashes, dollar signs, backticks
+// and quotes are escaped, so the shell expands nothing inside the value.
+func ShellQuoteAlways(value string) string {
+	return "\"" + shellQuoteReplacer.Replace(value) + "\""
+}
+
+// FishQuoteValue quotes a value for safe fish consumption if needed.
+func FishQuoteValue(value string) string {
+	if needsShellQuoting(value) {
+		return FishQuoteAlways(value)
+	}
+	return value
+}
+
+// FishQuoteAlways wraps a value in double quotes for fish. Inside them fish
+// only expands $ and treats \ and " specially; a backtick is literal.
+func FishQuoteAlways(value string) string {
+	return "\"" + fishQuoteReplacer.Replace(value) + "\""
+}
 
+var (
+	shellQuoteReplacer = strings.NewReplacer(`\`, `\\`, `$`, `\$`, "`", "\\`", `"`, `\"`)
+	fishQuoteReplacer  = strings.NewReplacer(`\`, `\\`, `$`, `\$`, `"`, `\"`)
+)
+
+// needsShellQuoting reports whether a value has characters a POSIX shell or
+// fish would interpret, or is empty or multi-line.
+func needsShellQuoting(value string) bool {
 	for _, char := range value {
 		if char == ' ' || char == '\t' || char == '|' || char == '&' ||
 			char == ';' || char == '(' || char == ')' || char == '<' ||
@@ -430,19 +906,85 @@ func ShellQuoteValue(value string) string {
 			char == '\'' || char == '\\' || char == '*' || char == '?' ||
 			char == '[' || char == ']' || char == '{' || char == '}' ||
 			char == '~' || char == '#' || char == '!' {
+			return true
+		}
+	}
+
+	// A bare line break would end the assignment
+	return value == "" || strings.ContainsAny(value, "\n\r")
+}
+
+// CshQuoteValue quotes a value for csh/tcsh setenv. Values that need quoting
+// are single-quoted: an embedded ' closes the quote and adds an escaped one,
+// ! is backslash-escaped because csh expands history even inside single
+// quotes, and newlines are backslash-escaped as csh requires inside quotes.
+func CshQuoteValue(value string) string {
+	needsQuoting := value == ""
+	for _, char := range value {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' ||
+			strings.ContainsRune("_-.,/:@%+=", char)) {
 			needsQuoting = true
 			break
 		}
 	}
+	if !needsQuoting {
+		return value
+	}
 
-	if value == "" {
-		needsQuoting = true
+	var quoted strings.Builder
+	quoted.WriteByte('\'')
+	for _, char := range value {
+		switch char {
+		case '\'':
+			quoted.WriteString(`'\''`)
+		case '!':
+			quoted.WriteString(`\!`)
+		case '\n':
+			quoted.WriteString("\\\n")
+		default:
+			quoted.WriteRune(char)
+		}
 	}
+	quoted.WriteByte('\'')
+	return quoted.String()
+}
 
-	if needsQuoting {
-		escaped := strings.ReplaceAll(value, "\"", "\\\"")
-		return "\"" + escaped + "\""
+// LaravelQuoteValue quotes a value for a .env file read by vlucas/phpdotenv,
+// as Laravel does. phpdotenv rejects whitespace in bare values, cuts them at
+// " #" and expands $ in bare and double-quoted ones, so anything beyond a
+// simple value is double-quoted with backslashes, quotes and $ escaped and
+// newlines written as \n.
+func LaravelQuoteValue(value string) string {
+	needsQuoting := value == ""
+	for _, char := range value {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' ||
+			strings.ContainsRune("_-.,/:@%+", char)) {
+			needsQuoting = true
+			break
+		}
+	}
+	if !needsQuoting {
+		return value
 	}
 
-	return value
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`)
+	return "\"" + replacer.Replace(value) + "\""
+}
+
+// ElvishQuoteValue quotes a value for elvish. Values that need quoting are
+// single-quoted, where elvish reads everything literally, newlines included,
+// and an embedded quote is doubled.
+func ElvishQuoteValue(value string) string {
+	needsQuoting := value == ""
+	for _, char := range value {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' ||
+			strings.ContainsRune("_-.,/:@%+", char)) {
+			needsQuoting = true
+			break
+		}
+	}
+	if !needsQuoting {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
 }
@@ -4,7 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseEnvContent(t *testing.T) {
@@ -74,6 +78,15 @@ ANOTHER_KEY=""`,
 				"KEY2": "  value2  ",
 			},
 		},
+		{
+			name:    "CRLF line endings",
+			content: "# comment\r\nKEY1=value1\r\nKEY2=\"quoted\"\r\n\r\nKEY3=\r\n",
+			expected: map[string]string{
+				"KEY1": "value1",
+				"KEY2": "quoted",
+				"KEY3": "",
+			},
+		},
 		{
 			name:     "empty content",
 			content:  "",
@@ -104,6 +117,113 @@ KEY3=value3`,
 	}
 }
 
+func TestParseEnvFileComments(t *testing.T) {
+	content := `# Stripe secret key for payments
+STRIPE_KEY=sk_live_x
+
+# Primary database.
+#
+#   Rotated quarterly.
+DATABASE_URL=postgres://db
+PLAIN=value
+# Detached by the blank line below
+
+PORT=5432
+# Trailing comment
+`
+	envPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParseEnvFileComments(envPath)
+	if err != nil {
+		t.Fatalf("ParseEnvFileComments() unexpected error = %v", err)
+	}
+	want := map[string]string{
+		"STRIPE_KEY":   "Stripe secret key for payments",
+		"DATABASE_URL": "Primary database.\n\nRotated quarterly.",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseEnvFileComments() = %q, want %q", got, want)
+	}
+}
+
+func TestParseSecretsCRLF(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "toml",
+			content: "[\"app/key\"]\r\nvalue = \"secret\"\r\nupdated = \"\"\r\nexpires = \"\"\r\n\r\n" +
+				"[\"app/other\"]\r\nvalue = \"value\"\r\nupdated = \"\"\r\nexpires = \"\"\r\n",
+		},
+		{
+			name:    "legacy",
+			content: "/app/key=secret\r\n/app/other=value\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := ParseSecrets(strings.ReplaceAll(tt.content, "\r\n", "\n"))
+			crlf := ParseSecrets(tt.content)
+			if !reflect.DeepEqual(crlf, lf) {
+				t.Errorf("ParseSecrets() with CRLF = %q, want %q", crlf, lf)
+			}
+			if crlf["/app/key"].Value != "secret" {
+				t.Errorf("ParseSecrets() /app/key = %q, want %q", crlf["/app/key"].Value, "secret")
+			}
+		})
+	}
+}
+
+func TestCRLFValueRoundTrip(t *testing.T) {
+	// Line endings inside a stored value, such as a PEM key copied from
+	// Windows, are part of the value and must survive a save and load
+	value := "-----BEGIN KEY-----\r\nline1\r\nline2\r\n-----END KEY-----"
+	pubPath, privPath, b := newTestFileStore(t, map[string]string{"/app/pem": value, "/app/key": "secret"})
+	store := NewFileStore(pubPath, privPath, b)
+
+	if err := store.Update(func(secrets SecretStore) error {
+		SetSecret(secrets, "/app/other", "second", time.Now())
+		return nil
+	}); err != nil {
+		t.Fatalf("Update() unexpected error = %v", err)
+	}
+
+	secrets, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error = %v", err)
+	}
+	if got := secrets["/app/pem"].Value; got != value {
+		t.Errorf("/app/pem after save and load = %q, want %q", got, value)
+	}
+}
+
+func TestSecretsWithEqualsInKeyRoundTrip(t *testing.T) {
+	store := SecretStore{
+		"/prod/ids/dXNlcg==": {Value: "a=b", Updated: "2026-03-14T00:00:00Z"},
+		"/prod/key=value":    {Value: "plain"},
+	}
+
+	content, err := serializeSecrets(store)
+	if err != nil {
+		t.Fatalf("serializeSecrets() unexpected error = %v", err)
+	}
+	if got := ParseSecrets(content); !reflect.DeepEqual(got, store) {
+		t.Errorf("ParseSecrets(serializeSecrets()) = %v, want %v", got, store)
+	}
+
+	if got := ExtractVarName("/prod/ids/dXNlcg=="); got != "DXNLCG__" {
+		t.Errorf("ExtractVarName() = %q, want %q", got, "DXNLCG__")
+	}
+	if got := ConvertPathToEnvVar("/prod/key=value", "/prod", 1); got != "KEY_VALUE" {
+		t.Errorf("ConvertPathToEnvVar() = %q, want %q", got, "KEY_VALUE")
+	}
+}
+
 func TestParseEnvFile(t *testing.T) {
 	// Create a temporary directory
 	tempDir, err := os.MkdirTemp("", "crumb_env_test")
@@ -150,6 +270,79 @@ DEBUG=true`
 	})
 }
 
+func TestParseVaultJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]string
+		wantErr  string
+	}{
+		{
+			name: "KV v2 single secret",
+			content: `{
+  "request_id": "a1b2",
+  "lease_duration": 0,
+  "data": {
+    "data": {"password": "s3cret", "port": 5432, "tls": true},
+    "metadata": {"created_time": "2024-01-01T00:00:00Z", "version": 3}
+  }
+}`,
+			expected: map[string]string{"password": "s3cret", "port": "5432", "tls": "true"},
+		},
+		{
+			name:     "KV v1 single secret",
+			content:  `{"request_id": "a1b2", "data": {"password": "s3cret", "user": "admin"}}`,
+			expected: map[string]string{"password": "s3cret", "user": "admin"},
+		},
+		{
+			name:     "KV v1 secret with a data field",
+			content:  `{"data": {"data": {"nested": "x"}, "user": "admin"}}`,
+			expected: map[string]string{"data": `{"nested":"x"}`, "user": "admin"},
+		},
+		{
+			name: "paths mapped to secrets of both versions",
+			content: `{
+  "myapp/db": {"data": {"data": {"password": "s3cret"}, "metadata": {"version": 1}}},
+  "/myapp/api/": {"data": {"key": "abc"}}
+}`,
+			expected: map[string]string{"myapp/db/password": "s3cret", "myapp/api/key": "abc"},
+		},
+		{
+			name:    "path without a secret",
+			content: `{"myapp/db": {"password": "s3cret"}}`,
+			wantErr: `myapp/db: expected a Vault KV secret with a "data" object`,
+		},
+		{
+			name:    "not an object",
+			content: `["a", "b"]`,
+			wantErr: "expected a Vault JSON object, got an array",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vault.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			result, err := ParseVaultJSON(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseVaultJSON() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseVaultJSON() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ParseVaultJSON() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestShellQuoteValue(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -171,6 +364,11 @@ func TestShellQuoteValue(t *testing.T) {
 			input:    "",
 			expected: "\"\"",
 		},
+		{
+			name:     "line break needs quotes",
+			input:    "line1\nline2",
+			expected: "\"line1\nline2\"",
+		},
 		{
 			name:     "value with equals and spaces",
 			input:    "value with = equals",
@@ -191,6 +389,11 @@ func TestShellQuoteValue(t *testing.T) {
 			input:    "value\twith\ttab",
 			expected: "\"value\twith\ttab\"",
 		},
+		{
+			name:     "expansions are escaped",
+			input:    "$HOME `id` $(id) \\n",
+			expected: "\"\\$HOME \\`id\\` \\$(id) \\\\n\"",
+		},
 	}
 
 	for _, tt := range tests {
@@ -202,3 +405,384 @@ func TestShellQuoteValue(t *testing.T) {
 		})
 	}
 }
+
+func TestFishQuoteValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "simple_value", expected: "simple_value"},
+		{input: "", expected: "\"\""},
+		{input: "say \"hi\"", expected: "\"say \\\"hi\\\"\""},
+		// fish doesn't expand backticks, so they stay as they are
+		{input: "$HOME `id` $(id) \\n", expected: "\"\\$HOME `id` \\$(id) \\\\n\""},
+	}
+
+	for _, tt := range tests {
+		if result := FishQuoteValue(tt.input); result != tt.expected {
+			t.Errorf("FishQuoteValue(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestDotenvQuoteValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "simple value", input: "secret123", expected: "secret123"},
+		{name: "url", input: "postgres://user@host:5432/db", expected: "postgres://user@host:5432/db"},
+		{name: "empty", input: "", expected: `""`},
+		{name: "spaces", input: "hello world", expected: `"hello world"`},
+		{name: "hash", input: "abc#def", expected: `"abc#def"`},
+		{name: "double quote", input: `say "hi"`, expected: `"say \"hi\""`},
+		{name: "backslash", input: `a\b`, expected: `"a\\b"`},
+		{name: "newline", input: "line1\nline2", expected: `"line1\nline2"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DotenvQuoteValue(tt.input); got != tt.expected {
+				t.Errorf("DotenvQuoteValue(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFlattenJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		parentPath  string
+		input       string
+		expected    map[string]string
+		errContains string
+	}{
+		{
+			name:       "flat object",
+			parentPath: "/prod/db",
+			input:      `{"user": "admin", "password": "s3cret"}`,
+			expected: map[string]string{
+				"/prod/db/user":     "admin",
+				"/prod/db/password": "s3cret",
+			},
+		},
+		{
+			name:       "nested objects joined with slash",
+			parentPath: "/prod/",
+			input:      `{"db": {"host": "localhost", "creds": {"user": "admin"}}, "token": "abc"}`,
+			expected: map[string]string{
+				"/prod/db/host":       "localhost",
+				"/prod/db/creds/user": "admin",
+				"/prod/token":         "abc",
+			},
+		},
+		{
+			name:       "non-string leaves stored as JSON",
+			parentPath: "/svc",
+			input:      `{"port": 5432, "debug": true, "hosts": ["a", "b"], "ratio": 1.50}`,
+			expected: map[string]string{
+				"/svc/port":  "5432",
+				"/svc/debug": "true",
+				"/svc/hosts": `["a","b"]`,
+				"/svc/ratio": "1.50",
+			},
+		},
+		{
+			name:        "array rejected",
+			parentPath:  "/svc",
+			input:       `["a", "b"]`,
+			errContains: "must be an object",
+		},
+		{
+			name:        "scalar rejected",
+			parentPath:  "/svc",
+			input:       `"just a string"`,
+			errContains: "got a string",
+		},
+		{
+			name:        "invalid JSON",
+			parentPath:  "/svc",
+			input:       `{"user": `,
+			errContains: "failed to parse JSON",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := FlattenJSON(tt.parentPath, []byte(tt.input))
+			if tt.errContains != "" {
+				if err == nil {
+					t.Fatalf("FlattenJSON() expected error containing %q, got none", tt.errContains)
+				}
+				if !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("FlattenJSON() error = %v, want error containing %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FlattenJSON() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("FlattenJSON() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "hours", input: "36h", want: now.Add(-36 * time.Hour)},
+		{name: "days", input: "7d", want: time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)},
+		{name: "timestamp", input: "2026-01-02T03:04:05Z", want: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{name: "negative duration", input: "-1h", wantErr: true},
+		{name: "garbage", input: "last week", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSince(tt.input, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseSince(%q) expected error, got %v", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSince(%q) unexpected error: %v", tt.input, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseSince(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterModifiedSince(t *testing.T) {
+	secrets := SecretStore{
+		"/app/new":     {Value: "a", Updated: "2026-03-14T00:00:00Z"},
+		"/app/old":     {Value: "b", Updated: "2026-01-01T00:00:00Z"},
+		"/app/legacy":  {Value: "c"},
+		"/app/garbled": {Value: "d", Updated: "yesterday"},
+	}
+	keys := []string{"/app/garbled", "/app/legacy", "/app/new", "/app/old"}
+	since := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+
+	got := FilterModifiedSince(secrets, keys, since, false)
+	if want := []string{"/app/new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterModifiedSince() = %v, want %v", got, want)
+	}
+
+	got = FilterModifiedSince(secrets, keys, since, true)
+	if want := []string{"/app/garbled", "/app/legacy", "/app/new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterModifiedSince() with undated = %v, want %v", got, want)
+	}
+}
+
+func TestFilterEmpty(t *testing.T) {
+	secrets := SecretStore{
+		"/app/blank":  {Value: ""},
+		"/app/spaces": {Value: "  \n"},
+		"/app/set":    {Value: "x"},
+	}
+	keys := []string{"/app/blank", "/app/set", "/app/spaces"}
+
+	got := FilterEmpty(secrets, keys)
+	if want := []string{"/app/blank", "/app/spaces"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterEmpty() = %v, want %v", got, want)
+	}
+}
+
+func TestFilterMatching(t *testing.T) {
+	keys := []string{"/app/stripe/key", "/app/db/pass", "/billing/stripe-webhook"}
+
+	got := FilterMatching(keys, regexp.MustCompile(regexp.QuoteMeta("stripe")))
+	if want := []string{"/app/stripe/key", "/billing/stripe-webhook"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterMatching() = %v, want %v", got, want)
+	}
+
+	got = FilterMatching(keys, regexp.MustCompile(`/(key|pass)$`))
+	if want := []string{"/app/stripe/key", "/app/db/pass"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterMatching() with a regex = %v, want %v", got, want)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: "90d", want: 90 * 24 * time.Hour},
+		{input: "36h", want: 36 * time.Hour},
+		{input: "0d", wantErr: true},
+		{input: "-5h", wantErr: true},
+		{input: "quarterly", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseInterval(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseInterval(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseInterval(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDueForRotation(t *testing.T) {
+	secrets := SecretStore{
+		"/app/due":      {Value: "a", Updated: "2026-01-01T00:00:00Z", Rotate: "30d"},
+		"/app/exact":    {Value: "b", Updated: "2026-02-01T00:00:00Z", Rotate: "30d"},
+		"/app/fresh":    {Value: "c", Updated: "2026-03-01T00:00:00Z", Rotate: "30d"},
+		"/app/undated":  {Value: "d", Rotate: "90d"},
+		"/app/nopolicy": {Value: "e", Updated: "2020-01-01T00:00:00Z"},
+	}
+	now := time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)
+
+	var keys []string
+	for _, status := range DueForRotation(secrets, now) {
+		keys = append(keys, status.Key)
+	}
+	if want := []string{"/app/due", "/app/exact", "/app/undated"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("DueForRotation() = %v, want %v", keys, want)
+	}
+
+	due := DueForRotation(secrets, now)
+	if want := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC); !due[0].DueAt.Equal(want) {
+		t.Errorf("DueAt = %v, want %v", due[0].DueAt, want)
+	}
+	if !due[2].DueAt.IsZero() {
+		t.Errorf("undated secret should have a zero DueAt, got %v", due[2].DueAt)
+	}
+}
+
+func TestSetSecretKeepsRotation(t *testing.T) {
+	secrets := SecretStore{"/app/key": {Value: "old", Rotate: "90d"}}
+
+	SetSecret(secrets, "/app/key", "new", time.Now())
+	if got := secrets["/app/key"]; got.Value != "new" || got.Rotate != "90d" {
+		t.Errorf("SetSecret() = %+v, want rotation kept", got)
+	}
+}
+
+func TestDirectChildren(t *testing.T) {
+	keys := []string{"/prod/api_key", "/prod/db/password", "/prod/db/user", "/prod/db/replica/host", "/production/x", "/dev/db/password"}
+
+	got := DirectChildren(keys, "/prod/")
+	if want := []string{"/prod/api_key", "/prod/db/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DirectChildren(/prod/) = %v, want %v", got, want)
+	}
+
+	got = DirectChildren(keys, "/")
+	if want := []string{"/dev/", "/prod/", "/production/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DirectChildren(/) = %v, want %v", got, want)
+	}
+}
+
+func TestSortKeys(t *testing.T) {
+	keys := []string{"/prod/db/password", "/dev/api/token", "/dev/db/password", "/prod/api/host"}
+
+	tests := []struct {
+		by      string
+		reverse bool
+		want    []string
+	}{
+		{by: "path", want: []string{"/dev/api/token", "/dev/db/password", "/prod/api/host", "/prod/db/password"}},
+		{by: "path", reverse: true, want: []string{"/prod/db/password", "/prod/api/host", "/dev/db/password", "/dev/api/token"}},
+		{by: "leaf", want: []string{"/prod/api/host", "/dev/db/password", "/prod/db/password", "/dev/api/token"}},
+		{by: "leaf", reverse: true, want: []string{"/dev/api/token", "/prod/db/password", "/dev/db/password", "/prod/api/host"}},
+	}
+
+	for _, tt := range tests {
+		got := slices.Clone(keys)
+		SortKeys(got, tt.by, tt.reverse)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SortKeys(%s, reverse=%v) = %v, want %v", tt.by, tt.reverse, got, tt.want)
+		}
+	}
+}
+
+func TestLaravelQuoteValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "simple", want: "simple"},
+		{value: "https://example.com:8080/path", want: "https://example.com:8080/path"},
+		{value: "", want: `""`},
+		{value: "pass#word", want: `"pass#word"`},
+		{value: "value # not a comment", want: `"value # not a comment"`},
+		{value: "a=b", want: `"a=b"`},
+		{value: "two words", want: `"two words"`},
+		{value: "pa$HOME", want: `"pa\$HOME"`},
+		{value: `say "hi"`, want: `"say \"hi\""`},
+		{value: `back\slash`, want: `"back\\slash"`},
+		{value: "line1\nline2", want: `"line1\nline2"`},
+	}
+
+	for _, tt := range tests {
+		if got := LaravelQuoteValue(tt.value); got != tt.want {
+			t.Errorf("LaravelQuoteValue(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestElvishQuoteValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "simple value", input: "secret123", expected: "secret123"},
+		{name: "url", input: "https://example.com/a", expected: "https://example.com/a"},
+		{name: "empty", input: "", expected: "''"},
+		{name: "spaces", input: "hello world", expected: "'hello world'"},
+		{name: "single quote", input: "it's", expected: "'it''s'"},
+		{name: "dollar", input: "$HOME", expected: "'$HOME'"},
+		{name: "glob", input: "a*b", expected: "'a*b'"},
+		{name: "newline", input: "line1\nline2", expected: "'line1\nline2'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ElvishQuoteValue(tt.input); got != tt.expected {
+				t.Errorf("ElvishQuoteValue(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCshQuoteValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "simple value", input: "secret123", expected: "secret123"},
+		{name: "url", input: "https://example.com/a", expected: "https://example.com/a"},
+		{name: "empty", input: "", expected: "''"},
+		{name: "spaces", input: "hello world", expected: "'hello world'"},
+		{name: "history expansion", input: "pa!ss", expected: `'pa\!ss'`},
+		{name: "single quote", input: "it's", expected: `'it'\''s'`},
+		{name: "dollar", input: "$HOME", expected: "'$HOME'"},
+		{name: "newline", input: "line1\nline2", expected: "'line1\\\nline2'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CshQuoteValue(tt.input); got != tt.expected {
+				t.Errorf("CshQuoteValue(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"crumb/pkg/backend"
+)
+
+// Store loads and saves the secrets of a profile. Commands depend on this
+// interface so alternative stores can be plugged in without touching them.
+type Store interface {
+	// Load returns all secrets, or an empty set if nothing has been stored yet.
+	Load() (SecretStore, error)
+	// Save replaces the stored secrets.
+	Save(secrets SecretStore) error
+	// Location describes where the secrets live, for messages.
+	Location() string
+	// Update applies fn to the stored secrets and saves the result as a
+	// single change, so a concurrent update can't be lost. Commands make
+	// every change to a store through it rather than with Load and Save.
+	Update(fn func(SecretStore) error) error
+	// Clock is the source of the time secrets are stamped with.
+	Clock() Clock
+}
+
+// FileStore is the default Store: secrets serialized as TOML, encrypted with
+// age to the profile's SSH key, and persisted through a backend.
+type FileStore struct {
+	PublicKeyPath  string
+	PrivateKeyPath string
+	Backend        backend.Backend
+	// clock overrides DefaultClock for this store when set.
+	clock Clock
+	// Retries is how many more times Load tries after a transient I/O
+	// error, waiting RetryDelay in between.
+	Retries    int
+	RetryDelay time.Duration
+	// Context cancels the wait between retries; nil never cancels.
+	Context context.Context
+	// HistoryDepth is how many previous values Save keeps per secret.
+	HistoryDepth int
+}
+
+// FileStoreOption configures optional FileStore settings.
+type FileStoreOption func(*FileStore)
+
+// WithClock makes the store report time from clock instead of DefaultClock.
+func WithClock(clock Clock) FileStoreOption {
+	return func(s *FileStore) {
+		s.clock = clock
+	}
+}
+
+// WithRetry makes Load try up to retries more times, delay apart, when reading
+// the private key or the storage fails with a transient I/O error.
+func WithRetry(retries int, delay time.Duration) FileStoreOption {
+	return func(s *FileStore) {
+		s.Retries = retries
+		s.RetryDelay = delay
+	}
+}
+
+// WithContext makes Load stop retrying as soon as ctx is done.
+func WithContext(ctx context.Context) FileStoreOption {
+	return func(s *FileStore) {
+		s.Context = ctx
+	}
+}
+
+// WithHistoryDepth makes Save keep depth previous values per secret instead
+// of DefaultHistoryDepth.
+func WithHistoryDepth(depth int) FileStoreOption {
+	return func(s *FileStore) {
+		s.HistoryDepth = depth
+	}
+}
+
+// NewFileStore creates a FileStore for the given key pair and backend.
+func NewFileStore(publicKeyPath, privateKeyPath string, b backend.Backend, opts ...FileStoreOption) *FileStore {
+	s := &FileStore{
+		PublicKeyPath:  publicKeyPath,
+		PrivateKeyPath: privateKeyPath,
+		Backend:        b,
+		HistoryDepth:   DefaultHistoryDepth,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Clock returns the clock given with WithClock, or DefaultClock.
+func (s *FileStore) Clock() Clock {
+	if s.clock != nil {
+		return s.clock
+	}
+	return DefaultClock
+}
+
+// Load decrypts the secrets from the backend, retrying transient I/O errors
+// as configured. Decryption and parse errors are returned straight away.
+func (s *FileStore) Load() (SecretStore, error) {
+	secrets, err := LoadSecrets(s.PrivateKeyPath, s.Backend)
+	attempts := 1
+	for err != nil && attempts <= s.Retries && IsTransientIOError(err) {
+		if waitErr := s.waitRetry(); waitErr != nil {
+			return nil, fmt.Errorf("stopped retrying after %d attempts: %w", attempts, waitErr)
+		}
+		secrets, err = LoadSecrets(s.PrivateKeyPath, s.Backend)
+		attempts++
+	}
+	if err != nil && attempts > 1 {
+		return nil, fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+	}
+	return secrets, err
+}
+
+// waitRetry waits RetryDelay before the next attempt, returning early with the
+// context's error if it's cancelled first.
+func (s *FileStore) waitRetry() error {
+	if s.Context == nil {
+		time.Sleep(s.RetryDelay)
+		return nil
+	}
+
+	timer := time.NewTimer(s.RetryDelay)
+	defer timer.Stop()
+	select {
+	case <-s.Context.Done():
+		return s.Context.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// transientErrnos are the system errors a retry can plausibly fix, as seen on
+// networked filesystems such as NFS and SSHFS
+var transientErrnos = []syscall.Errno{
+	syscall.EIO,
+	syscall.ESTALE,
+	syscall.ETIMEDOUT,
+	syscall.EAGAIN,
+	syscall.EINTR,
+	syscall.EBUSY,
+}
+
+// IsTransientIOError reports whether err comes from an I/O failure that may
+// succeed if tried again. Missing files, permission problems and crypto or
+// parse errors are not transient.
+func IsTransientIOError(err error) bool {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	for _, errno := range transientErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// Save encrypts the secrets and writes them to the backend, keeping at most
+// HistoryDepth previous values per secret.
+func (s *FileStore) Save(secrets SecretStore) error {
+	TrimHistory(secrets, s.HistoryDepth)
+	return SaveSecrets(secrets, s.PublicKeyPath, s.Backend)
+}
+
+// Location returns the backend's location.
+func (s *FileStore) Location() string {
+	return s.Backend.Location()
+}
+
+// Update applies fn to the stored secrets and saves the result. When the
+// backend is a backend.Updater the whole read-modify-write happens under its
+// lock, so a concurrent update can't be lost; otherwise it's a plain Load and
+// Save. Nothing is written when fn fails or leaves the secrets unchanged.
+func (s *FileStore) Update(fn func(SecretStore) error) error {
+	updater, ok := s.Backend.(backend.Updater)
+	if !ok {
+		secrets, err := s.Load()
+		if err != nil {
+			return err
+		}
+		if err := fn(secrets); err != nil {
+			return err
+		}
+		return s.Save(secrets)
+	}
+
+	err := s.update(updater, fn)
+	attempts := 1
+	for err != nil && attempts <= s.Retries && IsTransientIOError(err) {
+		if waitErr := s.waitRetry(); waitErr != nil {
+			return fmt.Errorf("stopped retrying after %d attempts: %w", attempts, waitErr)
+		}
+		err = s.update(updater, fn)
+		attempts++
+	}
+	if err != nil && attempts > 1 {
+		return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+	}
+	return err
+}
+
+// update runs one locked read-modify-write for Update.
+func (s *FileStore) update(updater backend.Updater, fn func(SecretStore) error) error {
+	return updater.Update(func(data []byte) ([]byte, error) {
+		secrets, err := decryptSecrets(s.PrivateKeyPath, data, s.Backend.Location())
+		if err != nil {
+			return nil, err
+		}
+		before, err := serializeSecrets(secrets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize secrets: %w", err)
+		}
+
+		if err := fn(secrets); err != nil {
+			return nil, err
+		}
+		TrimHistory(secrets, s.HistoryDepth)
+
+		after, err := serializeSecrets(secrets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize secrets: %w", err)
+		}
+		if len(data) > 0 && after == before {
+			return nil, nil
+		}
+		return encryptContent(after, s.PublicKeyPath)
+	})
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"crumb/pkg/backend"
+)
+
+// flakyBackend fails its first reads with err before delegating to Backend.
+type flakyBackend struct {
+	backend.Backend
+	failures int
+	err      error
+	reads    int
+}
+
+func (b *flakyBackend) Read() ([]byte, error) {
+	b.reads++
+	if b.reads <= b.failures {
+		return nil, b.err
+	}
+	return b.Backend.Read()
+}
+
+// newTestFileStore creates a key pair and a file-backed store holding secrets.
+func newTestFileStore(t *testing.T, secrets map[string]string) (string, string, backend.Backend) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Failed to convert public key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "crumb-test")
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+
+	dir := t.TempDir()
+	pubPath := filepath.Join(dir, "id_ed25519.pub")
+	privPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(pubPath, ssh.MarshalAuthorizedKey(sshPub), 0600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write private key: %v", err)
+	}
+
+	b := &backend.FileBackend{Path: filepath.Join(dir, "secrets")}
+	store := make(SecretStore)
+	for key, value := range secrets {
+		SetSecret(store, key, value, time.Now())
+	}
+	if err := SaveSecrets(store, pubPath, b); err != nil {
+		t.Fatalf("Failed to save secrets: %v", err)
+	}
+	return pubPath, privPath, b
+}
+
+func TestFileStoreLoadRetriesTransientErrors(t *testing.T) {
+	pubPath, privPath, b := newTestFileStore(t, map[string]string{"/app/key": "value"})
+	eio := &fs.PathError{Op: "read", Path: "secrets", Err: syscall.EIO}
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		flaky := &flakyBackend{Backend: b, failures: 2, err: eio}
+		store := NewFileStore(pubPath, privPath, flaky, WithRetry(2, 0))
+
+		secrets, err := store.Load()
+		if err != nil {
+			t.Fatalf("Load() unexpected error = %v", err)
+		}
+		if secrets["/app/key"].Value != "value" {
+			t.Errorf("Load() = %v, want /app/key = value", secrets)
+		}
+		if flaky.reads != 3 {
+			t.Errorf("reads = %d, want 3", flaky.reads)
+		}
+	})
+
+	t.Run("reports the last error when retries run out", func(t *testing.T) {
+		flaky := &flakyBackend{Backend: b, failures: 5, err: eio}
+		store := NewFileStore(pubPath, privPath, flaky, WithRetry(2, 0))
+
+		_, err := store.Load()
+		if err == nil || !errors.Is(err, syscall.EIO) || !strings.Contains(err.Error(), "giving up after 3 attempts") {
+			t.Errorf("Load() error = %v, want EIO after 3 attempts", err)
+		}
+		if flaky.reads != 3 {
+			t.Errorf("reads = %d, want 3", flaky.reads)
+		}
+	})
+
+	t.Run("does not retry without --retry", func(t *testing.T) {
+		flaky := &flakyBackend{Backend: b, failures: 1, err: eio}
+		store := NewFileStore(pubPath, privPath, flaky)
+
+		if _, err := store.Load(); !errors.Is(err, syscall.EIO) {
+			t.Errorf("Load() error = %v, want EIO", err)
+		}
+		if flaky.reads != 1 {
+			t.Errorf("reads = %d, want 1", flaky.reads)
+		}
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		flaky := &flakyBackend{Backend: b, failures: 1, err: &fs.PathError{Op: "open", Path: "secrets", Err: fs.ErrPermission}}
+		store := NewFileStore(pubPath, privPath, flaky, WithRetry(3, 0))
+
+		if _, err := store.Load(); !errors.Is(err, fs.ErrPermission) || strings.Contains(err.Error(), "giving up") {
+			t.Errorf("Load() error = %v, want permission error without retries", err)
+		}
+		if flaky.reads != 1 {
+			t.Errorf("reads = %d, want 1", flaky.reads)
+		}
+	})
+
+	t.Run("does not retry decryption errors", func(t *testing.T) {
+		_, otherPrivPath, _ := newTestFileStore(t, nil)
+		flaky := &flakyBackend{Backend: b}
+		store := NewFileStore(pubPath, otherPrivPath, flaky, WithRetry(3, 0))
+
+		if _, err := store.Load(); err == nil || strings.Contains(err.Error(), "giving up") {
+			t.Errorf("Load() error = %v, want decryption error without retries", err)
+		}
+		if flaky.reads != 1 {
+			t.Errorf("reads = %d, want 1", flaky.reads)
+		}
+	})
+}
+
+func TestFileStoreLoadStopsRetryingWhenCancelled(t *testing.T) {
+	pubPath, privPath, b := newTestFileStore(t, map[string]string{"/app/key": "value"})
+	flaky := &flakyBackend{Backend: b, failures: 5, err: &fs.PathError{Op: "read", Path: "secrets", Err: syscall.EIO}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	store := NewFileStore(pubPath, privPath, flaky, WithRetry(3, time.Minute), WithContext(ctx))
+
+	start := time.Now()
+	_, err := store.Load()
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "stopped retrying after 1 attempts") {
+		t.Errorf("Load() error = %v, want cancellation after 1 attempt", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Load() took %s, want it to stop when the context is cancelled", elapsed)
+	}
+}
+
+func TestFileStoreUpdate(t *testing.T) {
+	pubPath, privPath, b := newTestFileStore(t, map[string]string{"/app/key": "value"})
+	store := NewFileStore(pubPath, privPath, b)
+
+	if err := store.Update(func(secrets SecretStore) error {
+		SetSecret(secrets, "/app/other", "second", time.Now())
+		return nil
+	}); err != nil {
+		t.Fatalf("Update() unexpected error = %v", err)
+	}
+	secrets, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error = %v", err)
+	}
+	if secrets["/app/key"].Value != "value" || secrets["/app/other"].Value != "second" {
+		t.Errorf("secrets after Update() = %v, want both keys", secrets)
+	}
+
+	// A failed or empty update leaves the file as it was
+	before, err := b.Read()
+	if err != nil {
+		t.Fatalf("Read() unexpected error = %v", err)
+	}
+	wantErr := errors.New("nope")
+	if err := store.Update(func(secrets SecretStore) error {
+		DeleteSecret(secrets, "/app/key")
+		return wantErr
+	}); !errors.Is(err, wantErr) {
+		t.Errorf("Update() error = %v, want %v", err, wantErr)
+	}
+	if err := store.Update(func(SecretStore) error { return nil }); err != nil {
+		t.Fatalf("Update() unexpected error = %v", err)
+	}
+	after, err := b.Read()
+	if err != nil {
+		t.Fatalf("Read() unexpected error = %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("Update() rewrote the storage without a change")
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -183,7 +184,7 @@ func TestParseLegacySecrets(t *testing.T) {
 
 func TestSetSecret(t *testing.T) {
 	store := make(SecretStore)
-	SetSecret(store, "/test/key", "myvalue")
+	SetSecret(store, "/test/key", "myvalue", time.Date(2026, 2, 3, 4, 5, 6, 0, time.FixedZone("CET", 3600)))
 
 	entry, exists := store["/test/key"]
 	if !exists {
@@ -192,20 +193,15 @@ func TestSetSecret(t *testing.T) {
 	if entry.Value != "myvalue" {
 		t.Errorf("Expected value 'myvalue', got %q", entry.Value)
 	}
-	if entry.Updated == "" {
-		t.Error("Updated should be set automatically")
-	}
-
-	_, err := time.Parse(time.RFC3339, entry.Updated)
-	if err != nil {
-		t.Errorf("Updated is not valid RFC3339: %v", err)
+	if entry.Updated != "2026-02-03T03:05:06Z" {
+		t.Errorf("Expected Updated in UTC, got %q", entry.Updated)
 	}
 }
 
 func TestSetSecretWithExpires(t *testing.T) {
 	store := make(SecretStore)
 	expires := "2026-12-31T00:00:00Z"
-	SetSecretWithExpires(store, "/test/key", "myvalue", expires)
+	SetSecretWithExpires(store, "/test/key", "myvalue", expires, time.Now())
 
 	entry := store["/test/key"]
 	if entry.Value != "myvalue" {
@@ -219,6 +215,58 @@ func TestSetSecretWithExpires(t *testing.T) {
 	}
 }
 
+func TestSetSecretKeepsHistory(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := make(SecretStore)
+
+	SetSecret(store, "/test/key", "one", start)
+	SetSecret(store, "/test/key", "two", start.Add(time.Hour))
+	SetSecret(store, "/test/key", "two", start.Add(2*time.Hour))
+	SetSecretWithExpires(store, "/test/key", "three", "2027-01-01T00:00:00Z", start.Add(3*time.Hour))
+
+	expected := []HistoryEntry{
+		{Value: "two", Updated: "2026-01-01T02:00:00Z"},
+		{Value: "one", Updated: "2026-01-01T00:00:00Z"},
+	}
+	if got := store["/test/key"].History; !reflect.DeepEqual(got, expected) {
+		t.Errorf("History = %+v, want %+v", got, expected)
+	}
+
+	TrimHistory(store, 1)
+	if got := store["/test/key"].History; !reflect.DeepEqual(got, expected[:1]) {
+		t.Errorf("History after TrimHistory(1) = %+v, want %+v", got, expected[:1])
+	}
+	TrimHistory(store, 0)
+	if got := store["/test/key"].History; got != nil {
+		t.Errorf("History after TrimHistory(0) = %+v, want none", got)
+	}
+}
+
+func TestSerializeSecretsHistoryRoundTrip(t *testing.T) {
+	store := SecretStore{
+		"/test/key": SecretEntry{
+			Value:   "current",
+			Updated: "2026-01-02T00:00:00Z",
+			History: []HistoryEntry{
+				{Value: "line one\nline \"two\"", Updated: "2026-01-01T00:00:00Z"},
+				{Value: "", Updated: ""},
+			},
+		},
+	}
+
+	content, err := serializeSecrets(store)
+	if err != nil {
+		t.Fatalf("serializeSecrets() unexpected error = %v", err)
+	}
+	parsed, err := parseSecretsToml(content)
+	if err != nil {
+		t.Fatalf("parseSecretsToml() unexpected error = %v\n%s", err, content)
+	}
+	if !reflect.DeepEqual(parsed["/test/key"].History, store["/test/key"].History) {
+		t.Errorf("History = %+v, want %+v", parsed["/test/key"].History, store["/test/key"].History)
+	}
+}
+
 func TestMoveSecretPreservesMetadata(t *testing.T) {
 	store := SecretStore{
 		"/old/key": {
@@ -228,7 +276,7 @@ func TestMoveSecretPreservesMetadata(t *testing.T) {
 		},
 	}
 
-	err := MoveSecret(store, "/old/key", "/new/key")
+	err := MoveSecret(store, "/old/key", "/new/key", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
 	if err != nil {
 		t.Fatalf("MoveSecret() error: %v", err)
 	}
@@ -247,8 +295,8 @@ func TestMoveSecretPreservesMetadata(t *testing.T) {
 	if entry.Expires != "2026-12-31T00:00:00Z" {
 		t.Errorf("Expires not preserved: got %q", entry.Expires)
 	}
-	if entry.Updated == "2026-01-01T00:00:00Z" {
-		t.Error("Updated should be refreshed on move")
+	if entry.Updated != "2026-02-01T00:00:00Z" {
+		t.Errorf("Updated should be refreshed on move, got %q", entry.Updated)
 	}
 }
 